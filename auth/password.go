@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MinPasswordLength is the shortest password HashPassword accepts.
+const MinPasswordLength = 10
+
+// Passwords are hashed with PBKDF2-HMAC-SHA256 at the iteration count OWASP
+// recommends, with a random salt per password.
+const (
+	hashScheme     = "pbkdf2-sha256"
+	hashIterations = 600000
+	saltLength     = 16
+	keyLength      = 32
+)
+
+var ErrPasswordTooShort = fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+
+// HashPassword returns an encoded hash of password holding its scheme,
+// iteration count and salt, for CheckPassword.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := pbkdf2([]byte(password), salt, hashIterations, keyLength)
+	return fmt.Sprintf("%s$%d$%s$%s", hashScheme, hashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// CheckPassword reports whether password matches an encoded hash from
+// HashPassword.
+func CheckPassword(encoded, password string) bool {
+	iterations, salt, key, err := decodeHash(encoded)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(pbkdf2([]byte(password), salt, iterations, len(key)), key) == 1
+}
+
+// dummyHash is checked against when there is no account, so a failed login
+// takes as long whether or not the account exists.
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// CheckNoPassword spends as long as CheckPassword and always fails.
+func CheckNoPassword(password string) bool {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = HashPassword("not a real password")
+	})
+	CheckPassword(dummyHash, password)
+	return false
+}
+
+func decodeHash(encoded string) (iterations int, salt, key []byte, err error) {
+	fields := strings.Split(encoded, "$")
+	if len(fields) != 4 || fields[0] != hashScheme {
+		return 0, nil, nil, errors.New("unknown password hash format")
+	}
+	if iterations, err = strconv.Atoi(fields[1]); err != nil || iterations < 1 {
+		return 0, nil, nil, errors.New("invalid password hash iterations")
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil {
+		return 0, nil, nil, err
+	}
+	if key, err = base64.RawStdEncoding.DecodeString(fields[3]); err != nil {
+		return 0, nil, nil, err
+	}
+	return iterations, salt, key, nil
+}
+
+// pbkdf2 derives a key of keyLen bytes from password as in RFC 8018,
+// with HMAC-SHA256 as the pseudorandom function.
+func pbkdf2(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+	var key []byte
+	u := make([]byte, prf.Size())
+	t := make([]byte, prf.Size())
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, uint32(block))
+		u = prf.Sum(u[:0])
+		copy(t, u)
+
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The PBKDF2-HMAC-SHA256 test vectors of RFC 7914, section 11, and a
+// shorter key than one block.
+func TestPBKDF2(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 4096, 20, "c5e478d59288c841aa530db6845c4c8d962893a0"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+		}
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "pbkdf2-sha256$600000$") {
+		t.Errorf("HashPassword = %q, want the scheme and iteration count first", hash)
+	}
+	if !CheckPassword(hash, "correct horse battery") {
+		t.Error("CheckPassword rejected the right password")
+	}
+	if CheckPassword(hash, "correct horse battery ") {
+		t.Error("CheckPassword accepted the wrong password")
+	}
+
+	// Every hash has its own salt
+	again, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Error("HashPassword gave the same hash twice")
+	}
+
+	if _, err := HashPassword("too short"); err != ErrPasswordTooShort {
+		t.Errorf("HashPassword(\"too short\") = %v, want ErrPasswordTooShort", err)
+	}
+}
+
+func TestCheckPasswordMalformed(t *testing.T) {
+	for _, encoded := range []string{
+		"",
+		"bcrypt$10$c2FsdA$a2V5",
+		"pbkdf2-sha256$0$c2FsdA$a2V5",
+		"pbkdf2-sha256$x$c2FsdA$a2V5",
+		"pbkdf2-sha256$1$!!$a2V5",
+		"pbkdf2-sha256$1$c2FsdA",
+	} {
+		if CheckPassword(encoded, "any password") {
+			t.Errorf("CheckPassword(%q) accepted a password", encoded)
+		}
+	}
+	if CheckNoPassword("any password") {
+		t.Error("CheckNoPassword accepted a password")
+	}
+}
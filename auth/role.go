@@ -0,0 +1,79 @@
+package auth
+
+import "fmt"
+
+// Roles a user can have, from most to least access.
+const (
+	Admin      = "admin"
+	Accountant = "accountant"
+	Clerk      = "clerk"
+	ReadOnly   = "read_only"
+)
+
+// Permissions are what a route needs; each role is granted a fixed set.
+const (
+	ViewRecords         = "records:view"
+	ViewAudit           = "audit:view"
+	EditCustomers       = "customers:edit"
+	DeleteCustomers     = "customers:delete"
+	EditProducts        = "products:edit"
+	DeleteProducts      = "products:delete"
+	ManageSettings      = "settings:manage"
+	EditInvoices        = "invoices:edit"
+	ChangeInvoiceStatus = "invoices:status"
+	RecordPayments      = "payments:record"
+	IssueCreditNotes    = "credit_notes:issue"
+	EditQuotes          = "quotes:edit"
+	ChangeQuoteStatus   = "quotes:status"
+	ManageRecurring     = "recurring:manage"
+	ManageUsers         = "users:manage"
+	ManageOrganizations = "organizations:manage"
+)
+
+// Roles lists every role in order, for validation and documentation.
+var Roles = []string{Admin, Accountant, Clerk, ReadOnly}
+
+var rolePermissions = map[string][]string{
+	Admin: {
+		ViewRecords, ViewAudit, EditCustomers, DeleteCustomers, EditProducts, DeleteProducts,
+		ManageSettings, EditInvoices, ChangeInvoiceStatus, RecordPayments, IssueCreditNotes,
+		EditQuotes, ChangeQuoteStatus, ManageRecurring, ManageUsers, ManageOrganizations,
+	},
+	// Accountants run the books but do not manage users or organizations
+	Accountant: {
+		ViewRecords, ViewAudit, EditCustomers, DeleteCustomers, EditProducts, DeleteProducts,
+		ManageSettings, EditInvoices, ChangeInvoiceStatus, RecordPayments, IssueCreditNotes,
+		EditQuotes, ChangeQuoteStatus, ManageRecurring,
+	},
+	// Clerks prepare customers, products, quotes and draft invoices, but
+	// cannot delete records or move invoices on once they are drafted
+	Clerk: {
+		ViewRecords, EditCustomers, EditProducts, EditInvoices, EditQuotes,
+	},
+	ReadOnly: {
+		ViewRecords,
+	},
+}
+
+// ParseRole checks that role is one of Roles.
+func ParseRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("role %q must be one of %v", role, Roles)
+	}
+	return nil
+}
+
+// Can reports whether role is granted permission.
+func Can(role, permission string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Permissions returns the permissions role is granted.
+func Permissions(role string) []string {
+	return append([]string(nil), rolePermissions[role]...)
+}
@@ -0,0 +1,59 @@
+package auth
+
+import "testing"
+
+func TestParseRole(t *testing.T) {
+	for _, role := range Roles {
+		if err := ParseRole(role); err != nil {
+			t.Errorf("ParseRole(%q) = %v", role, err)
+		}
+	}
+	for _, role := range []string{"", "owner", "Admin"} {
+		if err := ParseRole(role); err == nil {
+			t.Errorf("ParseRole(%q) accepted it", role)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission string
+		want       bool
+	}{
+		{Admin, ManageUsers, true},
+		{Admin, ManageOrganizations, true},
+		{Accountant, RecordPayments, true},
+		{Accountant, ManageUsers, false},
+		{Accountant, ManageOrganizations, false},
+		{Clerk, EditInvoices, true},
+		{Clerk, ChangeInvoiceStatus, false},
+		{Clerk, DeleteCustomers, false},
+		{ReadOnly, ViewRecords, true},
+		{ReadOnly, EditCustomers, false},
+		{ReadOnly, ViewAudit, false},
+		{"owner", ViewRecords, false},
+	}
+	for _, tt := range tests {
+		if got := Can(tt.role, tt.permission); got != tt.want {
+			t.Errorf("Can(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
+
+// Each role has at most the permissions of the role above it.
+func TestRolesAreOrdered(t *testing.T) {
+	for i := 1; i < len(Roles); i++ {
+		for _, p := range Permissions(Roles[i]) {
+			if !Can(Roles[i-1], p) {
+				t.Errorf("%s can %s but %s cannot", Roles[i], p, Roles[i-1])
+			}
+		}
+	}
+
+	// Permissions returns a copy
+	Permissions(ReadOnly)[0] = ManageUsers
+	if Can(ReadOnly, ManageUsers) {
+		t.Error("changing what Permissions returned changed the role")
+	}
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// APITokenPrefix starts every API token, so leaked tokens are easy to spot.
+const APITokenPrefix = "inv_"
+
+// Access levels a scope grants. Write includes read.
+const (
+	Read  = "read"
+	Write = "write"
+)
+
+// NewToken returns a random secret for a session or, with APITokenPrefix, an
+// API token. Only its hash, from HashToken, should be stored.
+func NewToken(prefix string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hashes a token for storage and lookup. Tokens are random, so a
+// fast hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScope checks an API token scope: "read" or "write" for every
+// resource, or "<resource>:read" or "<resource>:write" for one resource,
+// named as in its path such as "invoices" for /api/invoices.
+func ParseScope(scope string) error {
+	access := scope
+	if i := strings.IndexByte(scope, ':'); i >= 0 {
+		if i == 0 {
+			return fmt.Errorf("scope %q has no resource", scope)
+		}
+		access = scope[i+1:]
+	}
+	if access != Read && access != Write {
+		return fmt.Errorf("scope %q must be read, write, <resource>:read or <resource>:write", scope)
+	}
+	return nil
+}
+
+// Allows reports whether scopes grant access to resource, writing if write
+// is set.
+func Allows(scopes []string, resource string, write bool) bool {
+	for _, scope := range scopes {
+		access := scope
+		if i := strings.IndexByte(scope, ':'); i >= 0 {
+			if scope[:i] != resource {
+				continue
+			}
+			access = scope[i+1:]
+		}
+		if access == Write || access == Read && !write {
+			return true
+		}
+	}
+	return false
+}
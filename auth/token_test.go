@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	token, err := NewToken(APITokenPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 32 random bytes in unpadded URL-safe base64
+	if !strings.HasPrefix(token, APITokenPrefix) || len(token) != len(APITokenPrefix)+43 || strings.ContainsAny(token, "+/=") {
+		t.Errorf("NewToken = %q", token)
+	}
+	other, _ := NewToken(APITokenPrefix)
+	if other == token {
+		t.Error("NewToken gave the same token twice")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// SHA-256 of "abc"
+	if got := HashToken("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("HashToken(\"abc\") = %s", got)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	for scope, valid := range map[string]bool{
+		"read":            true,
+		"write":           true,
+		"invoices:read":   true,
+		"customers:write": true,
+		"":                false,
+		"admin":           false,
+		":read":           false,
+		"invoices:delete": false,
+		"invoices":        false,
+	} {
+		if err := ParseScope(scope); (err == nil) != valid {
+			t.Errorf("ParseScope(%q) = %v, want valid %v", scope, err, valid)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		scopes   []string
+		resource string
+		write    bool
+		want     bool
+	}{
+		{[]string{"read"}, "invoices", false, true},
+		{[]string{"read"}, "invoices", true, false},
+		{[]string{"write"}, "customers", true, true},
+		{[]string{"write"}, "customers", false, true},
+		{[]string{"invoices:read"}, "invoices", false, true},
+		{[]string{"invoices:read"}, "invoices", true, false},
+		{[]string{"invoices:read"}, "customers", false, false},
+		{[]string{"invoices:write"}, "invoices", false, true},
+		{[]string{"customers:read", "invoices:write"}, "invoices", true, true},
+		{nil, "invoices", false, false},
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.scopes, tt.resource, tt.write); got != tt.want {
+			t.Errorf("Allows(%v, %q, %v) = %v, want %v", tt.scopes, tt.resource, tt.write, got, tt.want)
+		}
+	}
+}
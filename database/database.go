@@ -5,61 +5,35 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const Path = "./invoice.db"
+
+// options make every transaction take SQLite's write lock when it begins,
+// and wait up to five seconds for it. Transactions that only took the lock
+// on their first write could not both upgrade their read locks, and one of
+// them would fail at once with "database is locked".
+const options = "?_busy_timeout=5000&_txlock=immediate"
+
+// Open connects to the SQLite database without checking its schema. Use it
+// for tooling such as the migrate command; the server should call Initialize.
+func Open() (*sql.DB, error) {
+	return OpenFile(Path)
+}
+
+// OpenFile is Open for the database at path.
+func OpenFile(path string) (*sql.DB, error) {
+	return sql.Open("sqlite3", path+options)
+}
+
 func Initialize() (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", "./invoice.db")
+	db, err := Open()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := createTables(db); err != nil {
+	if err := CheckSchema(db); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
-
-func createTables(db *sql.DB) error {
-	schemas := []string{
-		`CREATE TABLE IF NOT EXISTS customers (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			phone TEXT NOT NULL,
-			address TEXT NOT NULL,
-			country TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS products (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			name TEXT NOT NULL,
-			price DECIMAL(10,2) NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS invoices (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			customer_id INTEGER,
-			total_price DECIMAL(10,2) NOT NULL,
-			status TEXT CHECK(status IN ('created', 'processed', 'deleted')) DEFAULT 'created',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			processed_at DATETIME NULL,
-			FOREIGN KEY (customer_id) REFERENCES customers(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS invoice_items (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			invoice_id INTEGER NOT NULL,
-			product_id INTEGER NOT NULL,
-			quantity INTEGER NOT NULL,
-			unit_price DECIMAL(10,2) NOT NULL,
-			total_price DECIMAL(10,2) NOT NULL,
-			FOREIGN KEY (invoice_id) REFERENCES invoices(id),
-			FOREIGN KEY (product_id) REFERENCES products(id)
-		)`,
-	}
-
-	for _, schema := range schemas {
-		if _, err := db.Exec(schema); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
\ No newline at end of file
@@ -0,0 +1,39 @@
+CREATE TABLE invoice_items_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	unit_price DECIMAL(10,2) NOT NULL,
+	total_price DECIMAL(10,2) NOT NULL,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+INSERT INTO invoice_items_old (id, invoice_id, product_id, quantity, unit_price, total_price)
+	SELECT id, invoice_id, product_id, quantity, unit_price / 100.0, total_price / 100.0 FROM invoice_items;
+DROP TABLE invoice_items;
+ALTER TABLE invoice_items_old RENAME TO invoice_items;
+
+CREATE TABLE invoices_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	total_price DECIMAL(10,2) NOT NULL,
+	status TEXT CHECK(status IN ('created', 'processed', 'deleted')) DEFAULT 'created',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_old (id, customer_id, total_price, status, created_at, processed_at)
+	SELECT id, customer_id, total_price / 100.0, status, created_at, processed_at FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_old RENAME TO invoices;
+
+CREATE TABLE products_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	price DECIMAL(10,2) NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO products_old (id, name, price, created_at)
+	SELECT id, name, price / 100.0, created_at FROM products;
+DROP TABLE products;
+ALTER TABLE products_old RENAME TO products;
@@ -0,0 +1,46 @@
+-- Amounts move from DECIMAL (stored by SQLite as REAL) to INTEGER minor
+-- units. SQLite cannot change a column type in place, so each table is
+-- rebuilt and its rows copied across.
+
+CREATE TABLE products_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	price INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO products_new (id, name, price, created_at)
+	SELECT id, name, CAST(ROUND(price * 100) AS INTEGER), created_at FROM products;
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+
+CREATE TABLE invoices_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'USD',
+	status TEXT CHECK(status IN ('created', 'processed', 'deleted')) DEFAULT 'created',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_new (id, customer_id, total_price, currency, status, created_at, processed_at)
+	SELECT id, customer_id, CAST(ROUND(total_price * 100) AS INTEGER), 'USD', status, created_at, processed_at FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_new RENAME TO invoices;
+
+CREATE TABLE invoice_items_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	unit_price INTEGER NOT NULL,
+	total_price INTEGER NOT NULL,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+INSERT INTO invoice_items_new (id, invoice_id, product_id, quantity, unit_price, total_price)
+	SELECT id, invoice_id, product_id, quantity,
+	       CAST(ROUND(unit_price * 100) AS INTEGER), CAST(ROUND(total_price * 100) AS INTEGER)
+	FROM invoice_items;
+DROP TABLE invoice_items;
+ALTER TABLE invoice_items_new RENAME TO invoice_items;
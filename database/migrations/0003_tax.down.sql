@@ -0,0 +1,12 @@
+DROP TABLE invoice_tax_lines;
+
+ALTER TABLE invoices DROP COLUMN tax_total;
+ALTER TABLE invoices DROP COLUMN subtotal;
+
+ALTER TABLE invoice_items DROP COLUMN tax_amount;
+ALTER TABLE invoice_items DROP COLUMN tax_rate;
+
+ALTER TABLE products DROP COLUMN tax_category_id;
+
+DROP TABLE tax_rules;
+DROP TABLE tax_categories;
@@ -0,0 +1,36 @@
+CREATE TABLE tax_categories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- rate is in basis points (2000 = 20%). country matches customers.country
+-- case-insensitively; '*' applies to every country without its own rule.
+CREATE TABLE tax_rules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tax_category_id INTEGER NOT NULL,
+	country TEXT NOT NULL COLLATE NOCASE,
+	rate INTEGER NOT NULL CHECK(rate >= 0 AND rate <= 10000),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (tax_category_id, country),
+	FOREIGN KEY (tax_category_id) REFERENCES tax_categories(id)
+);
+
+ALTER TABLE products ADD COLUMN tax_category_id INTEGER NULL;
+
+ALTER TABLE invoice_items ADD COLUMN tax_rate INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE invoice_items ADD COLUMN tax_amount INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN subtotal INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN tax_total INTEGER NOT NULL DEFAULT 0;
+UPDATE invoices SET subtotal = total_price;
+
+CREATE TABLE invoice_tax_lines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_id INTEGER NOT NULL,
+	rate INTEGER NOT NULL,
+	taxable_amount INTEGER NOT NULL,
+	tax_amount INTEGER NOT NULL,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
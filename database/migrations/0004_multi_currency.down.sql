@@ -0,0 +1,6 @@
+ALTER TABLE invoices DROP COLUMN base_total;
+ALTER TABLE invoices DROP COLUMN exchange_rate;
+
+DROP TABLE exchange_rates;
+
+ALTER TABLE customers DROP COLUMN currency;
@@ -0,0 +1,18 @@
+ALTER TABLE customers ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD';
+
+-- rate is the number of units of currency per one unit of the base currency
+-- (USD), scaled by 1,000,000.
+CREATE TABLE exchange_rates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	currency TEXT NOT NULL,
+	rate INTEGER NOT NULL CHECK(rate > 0),
+	effective_date DATE NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (currency, effective_date)
+);
+
+-- Invoices keep the rate they were priced at, plus their total in the base
+-- currency for reporting.
+ALTER TABLE invoices ADD COLUMN exchange_rate INTEGER NOT NULL DEFAULT 1000000;
+ALTER TABLE invoices ADD COLUMN base_total INTEGER NOT NULL DEFAULT 0;
+UPDATE invoices SET base_total = total_price;
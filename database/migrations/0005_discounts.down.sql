@@ -0,0 +1,8 @@
+DROP TABLE invoice_adjustments;
+
+ALTER TABLE invoices DROP COLUMN adjustment_total;
+
+ALTER TABLE invoice_items DROP COLUMN adjustment_amount;
+ALTER TABLE invoice_items DROP COLUMN discount_amount;
+ALTER TABLE invoice_items DROP COLUMN discount_value;
+ALTER TABLE invoice_items DROP COLUMN discount_type;
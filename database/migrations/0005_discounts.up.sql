@@ -0,0 +1,22 @@
+-- discount_value is in basis points for 'percent' discounts and in minor
+-- units of the invoice currency for 'fixed' ones. total_price on a line is
+-- after its own discount; adjustment_amount is the line's share of the
+-- invoice-level adjustments and is included in the line's taxable amount.
+ALTER TABLE invoice_items ADD COLUMN discount_type TEXT NULL CHECK(discount_type IN ('percent', 'fixed'));
+ALTER TABLE invoice_items ADD COLUMN discount_value INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE invoice_items ADD COLUMN discount_amount INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE invoice_items ADD COLUMN adjustment_amount INTEGER NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN adjustment_total INTEGER NOT NULL DEFAULT 0;
+
+-- amount is signed: negative for discounts, positive for surcharges.
+CREATE TABLE invoice_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_id INTEGER NOT NULL,
+	kind TEXT NOT NULL CHECK(kind IN ('discount', 'surcharge')),
+	type TEXT NOT NULL CHECK(type IN ('percent', 'fixed')),
+	value INTEGER NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	amount INTEGER NOT NULL,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
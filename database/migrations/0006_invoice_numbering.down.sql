@@ -0,0 +1,4 @@
+DROP INDEX idx_invoices_invoice_number;
+ALTER TABLE invoices DROP COLUMN invoice_number;
+DROP TABLE number_counters;
+DROP TABLE number_series;
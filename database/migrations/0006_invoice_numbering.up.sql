@@ -0,0 +1,41 @@
+-- A number series formats document numbers from a pattern such as
+-- INV-{YYYY}-{seq:5}. Counters are kept per series and period; the period is
+-- the year for patterns that contain one and '' otherwise.
+CREATE TABLE number_series (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	pattern TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE number_counters (
+	series_id INTEGER NOT NULL,
+	period TEXT NOT NULL,
+	last_value INTEGER NOT NULL,
+	PRIMARY KEY (series_id, period),
+	FOREIGN KEY (series_id) REFERENCES number_series(id)
+);
+
+INSERT INTO number_series (name, pattern) VALUES ('invoice', 'INV-{YYYY}-{seq:5}');
+
+-- Existing invoices are numbered in the default series in the order they were
+-- created, and the counters continue from there.
+ALTER TABLE invoices ADD COLUMN invoice_number TEXT;
+
+UPDATE invoices SET invoice_number = (
+	SELECT 'INV-' || strftime('%Y', n.created_at) || '-' || printf('%05d', n.seq)
+	FROM (
+		SELECT id, created_at,
+		       ROW_NUMBER() OVER (PARTITION BY strftime('%Y', created_at) ORDER BY created_at, id) AS seq
+		FROM invoices
+	) n
+	WHERE n.id = invoices.id
+);
+
+INSERT INTO number_counters (series_id, period, last_value)
+SELECT s.id, strftime('%Y', i.created_at), COUNT(*)
+FROM invoices i, number_series s
+WHERE s.name = 'invoice'
+GROUP BY strftime('%Y', i.created_at);
+
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
@@ -0,0 +1,6 @@
+DROP INDEX idx_invoices_due_date;
+ALTER TABLE invoices DROP COLUMN due_date;
+ALTER TABLE invoices DROP COLUMN payment_term_days;
+ALTER TABLE invoices DROP COLUMN payment_terms;
+ALTER TABLE customers DROP COLUMN payment_term_days;
+ALTER TABLE customers DROP COLUMN payment_terms;
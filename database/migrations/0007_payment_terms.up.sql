@@ -0,0 +1,12 @@
+-- payment_terms is one of due_on_receipt, net_15, net_30, net_60 or custom;
+-- payment_term_days is the number of days it allows, set for every invoice
+-- and only for customers with custom terms.
+ALTER TABLE customers ADD COLUMN payment_terms TEXT NOT NULL DEFAULT 'net_30';
+ALTER TABLE customers ADD COLUMN payment_term_days INTEGER;
+
+ALTER TABLE invoices ADD COLUMN payment_terms TEXT NOT NULL DEFAULT 'net_30';
+ALTER TABLE invoices ADD COLUMN payment_term_days INTEGER NOT NULL DEFAULT 30;
+ALTER TABLE invoices ADD COLUMN due_date DATE;
+UPDATE invoices SET due_date = date(created_at, '+30 days');
+
+CREATE INDEX idx_invoices_due_date ON invoices(due_date);
@@ -0,0 +1,34 @@
+-- Paid invoices fall back to processed.
+CREATE TABLE invoices_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'USD',
+	status TEXT CHECK(status IN ('created', 'processed', 'deleted')) DEFAULT 'created',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME NULL,
+	subtotal INTEGER NOT NULL DEFAULT 0,
+	tax_total INTEGER NOT NULL DEFAULT 0,
+	exchange_rate INTEGER NOT NULL DEFAULT 1000000,
+	base_total INTEGER NOT NULL DEFAULT 0,
+	adjustment_total INTEGER NOT NULL DEFAULT 0,
+	invoice_number TEXT,
+	payment_terms TEXT NOT NULL DEFAULT 'net_30',
+	payment_term_days INTEGER NOT NULL DEFAULT 30,
+	due_date DATE,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_old (id, customer_id, total_price, currency, status, created_at, processed_at, subtotal, tax_total,
+		exchange_rate, base_total, adjustment_total, invoice_number, payment_terms, payment_term_days, due_date)
+	SELECT id, customer_id, total_price, currency,
+		CASE status WHEN 'paid' THEN 'processed' ELSE status END,
+		created_at, COALESCE(processed_at, paid_at), subtotal, tax_total,
+		exchange_rate, base_total, adjustment_total, invoice_number, payment_terms, payment_term_days, due_date
+	FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_old RENAME TO invoices;
+
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
+CREATE INDEX idx_invoices_due_date ON invoices(due_date);
+
+DROP TABLE payments;
@@ -0,0 +1,48 @@
+-- Payments are recorded in the invoice currency. amount_paid on invoices is
+-- the sum of its payments and may exceed total_price for over-payments.
+CREATE TABLE payments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_id INTEGER NOT NULL,
+	amount INTEGER NOT NULL CHECK(amount > 0),
+	payment_date DATE NOT NULL,
+	method TEXT NOT NULL CHECK(method IN ('bank_transfer', 'card', 'cash', 'cheque', 'other')),
+	reference TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
+
+CREATE INDEX idx_payments_invoice_id ON payments(invoice_id);
+
+-- The status check gains 'paid'. SQLite cannot alter a CHECK constraint, so
+-- invoices is rebuilt.
+CREATE TABLE invoices_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_number TEXT,
+	customer_id INTEGER,
+	subtotal INTEGER NOT NULL DEFAULT 0,
+	adjustment_total INTEGER NOT NULL DEFAULT 0,
+	tax_total INTEGER NOT NULL DEFAULT 0,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'USD',
+	exchange_rate INTEGER NOT NULL DEFAULT 1000000,
+	base_total INTEGER NOT NULL DEFAULT 0,
+	amount_paid INTEGER NOT NULL DEFAULT 0,
+	status TEXT CHECK(status IN ('created', 'processed', 'paid', 'deleted')) DEFAULT 'created',
+	payment_terms TEXT NOT NULL DEFAULT 'net_30',
+	payment_term_days INTEGER NOT NULL DEFAULT 30,
+	due_date DATE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME NULL,
+	paid_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_new (id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, status, payment_terms, payment_term_days, due_date, created_at, processed_at)
+	SELECT id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, status, payment_terms, payment_term_days, due_date, created_at, processed_at
+	FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_new RENAME TO invoices;
+
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
+CREATE INDEX idx_invoices_due_date ON invoices(due_date);
@@ -0,0 +1,37 @@
+-- Sent invoices fall back to processed, void and credited ones to deleted.
+CREATE TABLE invoices_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_number TEXT,
+	customer_id INTEGER,
+	subtotal INTEGER NOT NULL DEFAULT 0,
+	adjustment_total INTEGER NOT NULL DEFAULT 0,
+	tax_total INTEGER NOT NULL DEFAULT 0,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'USD',
+	exchange_rate INTEGER NOT NULL DEFAULT 1000000,
+	base_total INTEGER NOT NULL DEFAULT 0,
+	amount_paid INTEGER NOT NULL DEFAULT 0,
+	status TEXT CHECK(status IN ('created', 'processed', 'paid', 'deleted')) DEFAULT 'created',
+	payment_terms TEXT NOT NULL DEFAULT 'net_30',
+	payment_term_days INTEGER NOT NULL DEFAULT 30,
+	due_date DATE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	processed_at DATETIME NULL,
+	paid_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_old (id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, amount_paid, status, payment_terms, payment_term_days, due_date,
+		created_at, processed_at, paid_at)
+	SELECT id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, amount_paid,
+		CASE status WHEN 'draft' THEN 'created' WHEN 'finalized' THEN 'processed' WHEN 'sent' THEN 'processed'
+			WHEN 'void' THEN 'deleted' WHEN 'credited' THEN 'deleted' ELSE status END,
+		payment_terms, payment_term_days, due_date,
+		created_at, finalized_at, paid_at
+	FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_old RENAME TO invoices;
+
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
+CREATE INDEX idx_invoices_due_date ON invoices(due_date);
@@ -0,0 +1,43 @@
+-- Invoices move through draft, finalized, sent, paid, void and credited.
+-- Existing statuses map onto them: created is a draft, processed has been
+-- finalized and deleted is void. processed_at becomes finalized_at and each
+-- other transition gets its own timestamp.
+CREATE TABLE invoices_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	invoice_number TEXT,
+	customer_id INTEGER,
+	subtotal INTEGER NOT NULL DEFAULT 0,
+	adjustment_total INTEGER NOT NULL DEFAULT 0,
+	tax_total INTEGER NOT NULL DEFAULT 0,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'USD',
+	exchange_rate INTEGER NOT NULL DEFAULT 1000000,
+	base_total INTEGER NOT NULL DEFAULT 0,
+	amount_paid INTEGER NOT NULL DEFAULT 0,
+	status TEXT NOT NULL CHECK(status IN ('draft', 'finalized', 'sent', 'paid', 'void', 'credited')) DEFAULT 'draft',
+	payment_terms TEXT NOT NULL DEFAULT 'net_30',
+	payment_term_days INTEGER NOT NULL DEFAULT 30,
+	due_date DATE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	finalized_at DATETIME NULL,
+	sent_at DATETIME NULL,
+	paid_at DATETIME NULL,
+	voided_at DATETIME NULL,
+	credited_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+INSERT INTO invoices_new (id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, amount_paid, status, payment_terms, payment_term_days, due_date,
+		created_at, finalized_at, paid_at)
+	SELECT id, invoice_number, customer_id, subtotal, adjustment_total, tax_total, total_price,
+		currency, exchange_rate, base_total, amount_paid,
+		CASE status WHEN 'created' THEN 'draft' WHEN 'processed' THEN 'finalized' WHEN 'deleted' THEN 'void' ELSE status END,
+		payment_terms, payment_term_days, due_date,
+		created_at, processed_at, paid_at
+	FROM invoices;
+DROP TABLE invoices;
+ALTER TABLE invoices_new RENAME TO invoices;
+
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
+CREATE INDEX idx_invoices_due_date ON invoices(due_date);
+CREATE INDEX idx_invoices_status ON invoices(status);
@@ -0,0 +1,6 @@
+DELETE FROM number_counters WHERE series_id = (SELECT id FROM number_series WHERE name = 'credit_note');
+DELETE FROM number_series WHERE name = 'credit_note';
+ALTER TABLE invoices DROP COLUMN amount_credited;
+DROP TABLE credit_note_tax_lines;
+DROP TABLE credit_note_items;
+DROP TABLE credit_notes;
@@ -0,0 +1,54 @@
+-- A credit note reverses all or part of an issued invoice. Its amounts are
+-- positive and in the invoice's currency at the invoice's exchange rate;
+-- reports count them against the invoice. Each item credits a quantity of
+-- one invoice item.
+CREATE TABLE credit_notes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	credit_note_number TEXT NOT NULL,
+	invoice_id INTEGER NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	subtotal INTEGER NOT NULL,
+	adjustment_total INTEGER NOT NULL,
+	tax_total INTEGER NOT NULL,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	exchange_rate INTEGER NOT NULL,
+	base_total INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
+
+CREATE UNIQUE INDEX idx_credit_notes_number ON credit_notes(credit_note_number);
+CREATE INDEX idx_credit_notes_invoice_id ON credit_notes(invoice_id);
+
+CREATE TABLE credit_note_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	credit_note_id INTEGER NOT NULL,
+	invoice_item_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL CHECK(quantity > 0),
+	unit_price INTEGER NOT NULL,
+	discount_amount INTEGER NOT NULL,
+	total_price INTEGER NOT NULL,
+	adjustment_amount INTEGER NOT NULL,
+	tax_rate INTEGER NOT NULL,
+	tax_amount INTEGER NOT NULL,
+	FOREIGN KEY (credit_note_id) REFERENCES credit_notes(id),
+	FOREIGN KEY (invoice_item_id) REFERENCES invoice_items(id)
+);
+
+CREATE INDEX idx_credit_note_items_invoice_item_id ON credit_note_items(invoice_item_id);
+
+CREATE TABLE credit_note_tax_lines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	credit_note_id INTEGER NOT NULL,
+	rate INTEGER NOT NULL,
+	taxable_amount INTEGER NOT NULL,
+	tax_amount INTEGER NOT NULL,
+	FOREIGN KEY (credit_note_id) REFERENCES credit_notes(id)
+);
+
+-- amount_credited is the sum of the invoice's credit notes and reduces its
+-- balance due.
+ALTER TABLE invoices ADD COLUMN amount_credited INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO number_series (name, pattern) VALUES ('credit_note', 'CN-{YYYY}-{seq:5}');
@@ -0,0 +1,5 @@
+ALTER TABLE invoice_items DROP COLUMN product_name;
+ALTER TABLE invoices DROP COLUMN customer_country;
+ALTER TABLE invoices DROP COLUMN customer_address;
+ALTER TABLE invoices DROP COLUMN customer_phone;
+ALTER TABLE invoices DROP COLUMN customer_name;
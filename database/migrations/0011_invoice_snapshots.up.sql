@@ -0,0 +1,17 @@
+-- Invoices keep the billed-to details and product names they were issued
+-- with, so later changes to customers and products leave them unchanged.
+-- The customer columns are null for invoices without a customer.
+ALTER TABLE invoices ADD COLUMN customer_name TEXT NULL;
+ALTER TABLE invoices ADD COLUMN customer_phone TEXT NULL;
+ALTER TABLE invoices ADD COLUMN customer_address TEXT NULL;
+ALTER TABLE invoices ADD COLUMN customer_country TEXT NULL;
+
+UPDATE invoices SET
+	customer_name = (SELECT name FROM customers WHERE id = invoices.customer_id),
+	customer_phone = (SELECT phone FROM customers WHERE id = invoices.customer_id),
+	customer_address = (SELECT address FROM customers WHERE id = invoices.customer_id),
+	customer_country = (SELECT country FROM customers WHERE id = invoices.customer_id);
+
+ALTER TABLE invoice_items ADD COLUMN product_name TEXT NOT NULL DEFAULT '';
+
+UPDATE invoice_items SET product_name = COALESCE((SELECT name FROM products WHERE id = invoice_items.product_id), '');
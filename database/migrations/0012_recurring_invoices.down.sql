@@ -0,0 +1,5 @@
+ALTER TABLE invoices DROP COLUMN recurring_invoice_id;
+
+DROP TABLE recurring_invoice_adjustments;
+DROP TABLE recurring_invoice_items;
+DROP TABLE recurring_invoices;
@@ -0,0 +1,53 @@
+-- A recurring invoice is a template the scheduler turns into a draft invoice
+-- at each run. currency, series and payment terms are null to use the
+-- customer's and the defaults at the time of each run. Discount and
+-- adjustment values are kept as entered and validated again at every run,
+-- since a fixed amount depends on the invoice currency.
+--
+-- next_run_at is the next run still to be made, null once the schedule has
+-- finished. last_error is the reason the last attempt failed, if it did.
+CREATE TABLE recurring_invoices (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	customer_id INTEGER NOT NULL,
+	currency TEXT NULL,
+	series TEXT NULL,
+	payment_terms TEXT NULL,
+	payment_term_days INTEGER NULL,
+	interval TEXT NOT NULL CHECK(interval IN ('monthly', 'quarterly', 'cron')),
+	cron TEXT NOT NULL DEFAULT '',
+	start_date DATE NOT NULL,
+	end_date DATE NULL,
+	status TEXT NOT NULL DEFAULT 'active' CHECK(status IN ('active', 'paused', 'finished')),
+	next_run_at DATETIME NULL,
+	last_run_at DATETIME NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (customer_id) REFERENCES customers(id)
+);
+
+CREATE TABLE recurring_invoice_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recurring_invoice_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL CHECK(quantity > 0),
+	discount_type TEXT NULL CHECK(discount_type IN ('percent', 'fixed')),
+	discount_value TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (recurring_invoice_id) REFERENCES recurring_invoices(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE recurring_invoice_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	recurring_invoice_id INTEGER NOT NULL,
+	kind TEXT NOT NULL CHECK(kind IN ('discount', 'surcharge')),
+	type TEXT NOT NULL CHECK(type IN ('percent', 'fixed')),
+	value TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (recurring_invoice_id) REFERENCES recurring_invoices(id)
+);
+
+CREATE INDEX idx_recurring_invoice_items_recurring_invoice_id ON recurring_invoice_items(recurring_invoice_id);
+CREATE INDEX idx_recurring_invoice_adjustments_recurring_invoice_id ON recurring_invoice_adjustments(recurring_invoice_id);
+
+-- The template an invoice was generated from, if any.
+ALTER TABLE invoices ADD COLUMN recurring_invoice_id INTEGER NULL;
@@ -0,0 +1,6 @@
+DELETE FROM number_counters WHERE series_id = (SELECT id FROM number_series WHERE name = 'quote');
+DELETE FROM number_series WHERE name = 'quote';
+DROP TABLE quote_tax_lines;
+DROP TABLE quote_adjustments;
+DROP TABLE quote_items;
+DROP TABLE quotes;
@@ -0,0 +1,77 @@
+-- A quote is priced like an invoice and keeps the same snapshots, lines,
+-- adjustments and tax lines, so converting it into an invoice copies the
+-- quoted prices exactly. payment_terms are those the invoice will carry.
+-- invoice_id is the invoice the quote was converted into, if any.
+CREATE TABLE quotes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	quote_number TEXT NOT NULL,
+	customer_id INTEGER NOT NULL,
+	customer_name TEXT NULL,
+	customer_phone TEXT NULL,
+	customer_address TEXT NULL,
+	customer_country TEXT NULL,
+	subtotal INTEGER NOT NULL,
+	adjustment_total INTEGER NOT NULL,
+	tax_total INTEGER NOT NULL,
+	total_price INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	exchange_rate INTEGER NOT NULL,
+	base_total INTEGER NOT NULL,
+	status TEXT NOT NULL DEFAULT 'draft' CHECK(status IN ('draft', 'sent', 'accepted', 'rejected', 'expired')),
+	payment_terms TEXT NOT NULL,
+	payment_term_days INTEGER NOT NULL,
+	expires_on DATE NOT NULL,
+	invoice_id INTEGER NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	sent_at DATETIME NULL,
+	accepted_at DATETIME NULL,
+	rejected_at DATETIME NULL,
+	expired_at DATETIME NULL,
+	FOREIGN KEY (customer_id) REFERENCES customers(id),
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id)
+);
+
+CREATE UNIQUE INDEX idx_quotes_quote_number ON quotes(quote_number);
+CREATE INDEX idx_quotes_expires_on ON quotes(expires_on);
+
+CREATE TABLE quote_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	quote_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	product_name TEXT NOT NULL DEFAULT '',
+	quantity INTEGER NOT NULL CHECK(quantity > 0),
+	unit_price INTEGER NOT NULL,
+	discount_type TEXT NULL CHECK(discount_type IN ('percent', 'fixed')),
+	discount_value INTEGER NOT NULL DEFAULT 0,
+	discount_amount INTEGER NOT NULL DEFAULT 0,
+	total_price INTEGER NOT NULL,
+	adjustment_amount INTEGER NOT NULL DEFAULT 0,
+	tax_rate INTEGER NOT NULL DEFAULT 0,
+	tax_amount INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (quote_id) REFERENCES quotes(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE INDEX idx_quote_items_quote_id ON quote_items(quote_id);
+
+CREATE TABLE quote_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	quote_id INTEGER NOT NULL,
+	kind TEXT NOT NULL CHECK(kind IN ('discount', 'surcharge')),
+	type TEXT NOT NULL CHECK(type IN ('percent', 'fixed')),
+	value INTEGER NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	amount INTEGER NOT NULL,
+	FOREIGN KEY (quote_id) REFERENCES quotes(id)
+);
+
+CREATE TABLE quote_tax_lines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	quote_id INTEGER NOT NULL,
+	rate INTEGER NOT NULL,
+	taxable_amount INTEGER NOT NULL,
+	tax_amount INTEGER NOT NULL,
+	FOREIGN KEY (quote_id) REFERENCES quotes(id)
+);
+
+INSERT INTO number_series (name, pattern) VALUES ('quote', 'QUO-{YYYY}-{seq:5}');
@@ -0,0 +1,16 @@
+-- Every write through the API is recorded with who made it and the entity's
+-- stored row before and after, as JSON. before_json is NULL for a create and
+-- after_json for a delete.
+CREATE TABLE audit_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	actor TEXT NOT NULL,
+	entity TEXT NOT NULL,
+	entity_id INTEGER NOT NULL,
+	action TEXT NOT NULL,
+	before_json TEXT,
+	after_json TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_entity ON audit_events(entity, entity_id);
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at);
@@ -0,0 +1,4 @@
+-- Every user has a role deciding what they may do. Users from before roles
+-- existed could do everything, so they become admins.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'admin'
+	CHECK (role IN ('admin', 'accountant', 'clerk', 'read_only'));
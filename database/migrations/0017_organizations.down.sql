@@ -0,0 +1,59 @@
+-- Fails if organizations other than the first have numbers, names or rates
+-- that clash with the first's.
+CREATE TABLE number_series_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	pattern TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO number_series_old (id, name, pattern, created_at)
+	SELECT id, name, pattern, created_at FROM number_series;
+DROP TABLE number_series;
+ALTER TABLE number_series_old RENAME TO number_series;
+
+CREATE TABLE exchange_rates_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	currency TEXT NOT NULL,
+	rate INTEGER NOT NULL CHECK(rate > 0),
+	effective_date DATE NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (currency, effective_date)
+);
+INSERT INTO exchange_rates_old (id, currency, rate, effective_date, created_at)
+	SELECT id, currency, rate, effective_date, created_at FROM exchange_rates;
+DROP TABLE exchange_rates;
+ALTER TABLE exchange_rates_old RENAME TO exchange_rates;
+
+CREATE TABLE tax_categories_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO tax_categories_old (id, name, description, created_at)
+	SELECT id, name, description, created_at FROM tax_categories;
+DROP TABLE tax_categories;
+ALTER TABLE tax_categories_old RENAME TO tax_categories;
+
+DROP INDEX idx_quotes_quote_number;
+CREATE UNIQUE INDEX idx_quotes_quote_number ON quotes(quote_number);
+DROP INDEX idx_credit_notes_number;
+CREATE UNIQUE INDEX idx_credit_notes_number ON credit_notes(credit_note_number);
+DROP INDEX idx_invoices_invoice_number;
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(invoice_number);
+
+DROP INDEX idx_audit_events_organization_id;
+DROP INDEX idx_recurring_invoices_organization_id;
+DROP INDEX idx_products_organization_id;
+DROP INDEX idx_customers_organization_id;
+
+ALTER TABLE audit_events DROP COLUMN organization_id;
+ALTER TABLE recurring_invoices DROP COLUMN organization_id;
+ALTER TABLE quotes DROP COLUMN organization_id;
+ALTER TABLE credit_notes DROP COLUMN organization_id;
+ALTER TABLE invoices DROP COLUMN organization_id;
+ALTER TABLE products DROP COLUMN organization_id;
+ALTER TABLE customers DROP COLUMN organization_id;
+
+DROP TABLE organization_members;
+DROP TABLE organizations;
@@ -0,0 +1,104 @@
+-- One server keeps the books of several organizations. Users are members of
+-- one or more of them, and every customer, product, document, setting and
+-- audit event belongs to exactly one. Lines, tax lines, payments and
+-- counters belong to the organization of the row they hang off.
+CREATE TABLE organizations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE organization_members (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (organization_id, user_id),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+-- Everything so far belongs to a first organization, and every user is a
+-- member of it.
+INSERT INTO organizations (id, name) VALUES (1, 'Default organization');
+INSERT INTO organization_members (organization_id, user_id) SELECT 1, id FROM users;
+
+-- SQLite can only add a column without a default if it may be null, so these
+-- are left nullable; the application always sets them.
+ALTER TABLE customers ADD COLUMN organization_id INTEGER;
+ALTER TABLE products ADD COLUMN organization_id INTEGER;
+ALTER TABLE invoices ADD COLUMN organization_id INTEGER;
+ALTER TABLE credit_notes ADD COLUMN organization_id INTEGER;
+ALTER TABLE quotes ADD COLUMN organization_id INTEGER;
+ALTER TABLE recurring_invoices ADD COLUMN organization_id INTEGER;
+ALTER TABLE audit_events ADD COLUMN organization_id INTEGER;
+
+UPDATE customers SET organization_id = 1;
+UPDATE products SET organization_id = 1;
+UPDATE invoices SET organization_id = 1;
+UPDATE credit_notes SET organization_id = 1;
+UPDATE quotes SET organization_id = 1;
+UPDATE recurring_invoices SET organization_id = 1;
+UPDATE audit_events SET organization_id = 1;
+
+CREATE INDEX idx_customers_organization_id ON customers(organization_id);
+CREATE INDEX idx_products_organization_id ON products(organization_id);
+CREATE INDEX idx_recurring_invoices_organization_id ON recurring_invoices(organization_id);
+CREATE INDEX idx_audit_events_organization_id ON audit_events(organization_id);
+
+-- Document numbers are unique within an organization, which numbers its
+-- documents from its own series
+DROP INDEX idx_invoices_invoice_number;
+CREATE UNIQUE INDEX idx_invoices_invoice_number ON invoices(organization_id, invoice_number);
+DROP INDEX idx_credit_notes_number;
+CREATE UNIQUE INDEX idx_credit_notes_number ON credit_notes(organization_id, credit_note_number);
+DROP INDEX idx_quotes_quote_number;
+CREATE UNIQUE INDEX idx_quotes_quote_number ON quotes(organization_id, quote_number);
+
+-- Names of tax categories and series, and the dates of exchange rates, are
+-- unique within an organization. SQLite cannot change a UNIQUE constraint, so
+-- these tables are rebuilt.
+CREATE TABLE tax_categories_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (organization_id, name),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
+INSERT INTO tax_categories_new (id, organization_id, name, description, created_at)
+	SELECT id, 1, name, description, created_at FROM tax_categories;
+DROP TABLE tax_categories;
+ALTER TABLE tax_categories_new RENAME TO tax_categories;
+
+CREATE TABLE exchange_rates_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	rate INTEGER NOT NULL CHECK(rate > 0),
+	effective_date DATE NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (organization_id, currency, effective_date),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
+INSERT INTO exchange_rates_new (id, organization_id, currency, rate, effective_date, created_at)
+	SELECT id, 1, currency, rate, effective_date, created_at FROM exchange_rates;
+DROP TABLE exchange_rates;
+ALTER TABLE exchange_rates_new RENAME TO exchange_rates;
+
+CREATE TABLE number_series_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	pattern TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (organization_id, name),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
+INSERT INTO number_series_new (id, organization_id, name, pattern, created_at)
+	SELECT id, 1, name, pattern, created_at FROM number_series;
+DROP TABLE number_series;
+ALTER TABLE number_series_new RENAME TO number_series;
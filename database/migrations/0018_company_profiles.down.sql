@@ -0,0 +1,2 @@
+-- Uploaded logo files are left in place.
+DROP TABLE company_profiles;
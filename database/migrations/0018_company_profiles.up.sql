@@ -0,0 +1,25 @@
+-- Each organization's own details as the seller, printed on its invoices,
+-- credit notes and quotes. The logo is a file in the uploads directory;
+-- only its name and type are stored here.
+CREATE TABLE company_profiles (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL UNIQUE,
+	legal_name TEXT NOT NULL DEFAULT '',
+	trading_name TEXT NOT NULL DEFAULT '',
+	address TEXT NOT NULL DEFAULT '',
+	country TEXT NOT NULL DEFAULT '',
+	tax_id TEXT NOT NULL DEFAULT '',
+	registration_number TEXT NOT NULL DEFAULT '',
+	email TEXT NOT NULL DEFAULT '',
+	phone TEXT NOT NULL DEFAULT '',
+	website TEXT NOT NULL DEFAULT '',
+	bank_name TEXT NOT NULL DEFAULT '',
+	account_holder TEXT NOT NULL DEFAULT '',
+	iban TEXT NOT NULL DEFAULT '',
+	bic TEXT NOT NULL DEFAULT '',
+	payment_instructions TEXT NOT NULL DEFAULT '',
+	logo_file TEXT,
+	logo_content_type TEXT,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
@@ -0,0 +1 @@
+DROP TABLE pdf_templates;
@@ -0,0 +1,27 @@
+-- Stored styles for the PDFs of invoices, credit notes and quotes. Each
+-- organization may mark one template as its default; documents use the
+-- built-in style until it does.
+CREATE TABLE pdf_templates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	organization_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	layout TEXT NOT NULL DEFAULT 'classic',
+	primary_color TEXT NOT NULL DEFAULT '#2c3e50',
+	accent_color TEXT NOT NULL DEFAULT '#f8f9fa',
+	font TEXT NOT NULL DEFAULT 'helvetica',
+	footer_text TEXT NOT NULL DEFAULT '',
+	show_logo INTEGER NOT NULL DEFAULT 1,
+	show_seller INTEGER NOT NULL DEFAULT 1,
+	show_customer_details INTEGER NOT NULL DEFAULT 1,
+	show_payment_terms INTEGER NOT NULL DEFAULT 1,
+	show_tax_breakdown INTEGER NOT NULL DEFAULT 1,
+	show_item_count INTEGER NOT NULL DEFAULT 1,
+	show_payments INTEGER NOT NULL DEFAULT 1,
+	show_payment_instructions INTEGER NOT NULL DEFAULT 1,
+	show_generated_at INTEGER NOT NULL DEFAULT 1,
+	is_default INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (organization_id, name),
+	FOREIGN KEY (organization_id) REFERENCES organizations(id)
+);
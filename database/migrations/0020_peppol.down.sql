@@ -0,0 +1,3 @@
+ALTER TABLE customers DROP COLUMN buyer_reference;
+ALTER TABLE customers DROP COLUMN peppol_id;
+ALTER TABLE company_profiles DROP COLUMN peppol_id;
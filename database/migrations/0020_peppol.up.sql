@@ -0,0 +1,6 @@
+-- Peppol participant IDs, the electronic addresses UBL e-invoices are
+-- delivered to, written scheme:identifier such as 0088:5790000435975, and
+-- the reference a buyer asks its invoices to quote so it can route them.
+ALTER TABLE company_profiles ADD COLUMN peppol_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN peppol_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE customers ADD COLUMN buyer_reference TEXT NOT NULL DEFAULT '';
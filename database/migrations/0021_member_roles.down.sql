@@ -0,0 +1,12 @@
+-- Users take the highest role they have in any organization, so no one loses
+-- access they had.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'admin'
+	CHECK (role IN ('admin', 'accountant', 'clerk', 'read_only'));
+
+UPDATE users SET role = COALESCE((
+	SELECT role FROM organization_members m WHERE m.user_id = users.id
+	ORDER BY CASE role WHEN 'admin' THEN 0 WHEN 'accountant' THEN 1 WHEN 'clerk' THEN 2 ELSE 3 END
+	LIMIT 1
+), 'read_only');
+
+ALTER TABLE organization_members DROP COLUMN role;
@@ -0,0 +1,9 @@
+-- A user's role belongs to their membership of an organization, so an admin
+-- of one organization has no say over what a member may do in another.
+-- Members keep the role they had everywhere until now.
+ALTER TABLE organization_members ADD COLUMN role TEXT NOT NULL DEFAULT 'read_only'
+	CHECK (role IN ('admin', 'accountant', 'clerk', 'read_only'));
+
+UPDATE organization_members SET role = (SELECT role FROM users WHERE users.id = organization_members.user_id);
+
+ALTER TABLE users DROP COLUMN role;
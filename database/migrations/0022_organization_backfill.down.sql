@@ -0,0 +1,2 @@
+-- Which rows had no organization is not kept, so they stay in the first.
+SELECT 1;
@@ -0,0 +1,10 @@
+-- The sample data scripts used to insert products and customers without an
+-- organization, which no request can see. They belong to the first
+-- organization, where the scripts now put them.
+UPDATE customers SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE products SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE invoices SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE credit_notes SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE quotes SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE recurring_invoices SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
+UPDATE audit_events SET organization_id = (SELECT MIN(id) FROM organizations) WHERE organization_id IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE quote_items DROP COLUMN untaxed;
+ALTER TABLE invoice_items DROP COLUMN untaxed;
@@ -0,0 +1,23 @@
+-- Lines whose product had no tax category, or no rule for the customer's
+-- country, are not subject to tax, which a rule of 0% (zero-rated) is not.
+-- Earlier lines are marked from their product's category as it is now.
+ALTER TABLE invoice_items ADD COLUMN untaxed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE quote_items ADD COLUMN untaxed INTEGER NOT NULL DEFAULT 0;
+
+UPDATE invoice_items SET untaxed = 1
+WHERE tax_rate = 0 AND NOT EXISTS (
+	SELECT 1 FROM products p
+	JOIN tax_rules r ON r.tax_category_id = p.tax_category_id
+	JOIN invoices i ON i.id = invoice_items.invoice_id
+	WHERE p.id = invoice_items.product_id
+	  AND (r.country = TRIM(COALESCE(i.customer_country, '')) OR r.country = '*')
+);
+
+UPDATE quote_items SET untaxed = 1
+WHERE tax_rate = 0 AND NOT EXISTS (
+	SELECT 1 FROM products p
+	JOIN tax_rules r ON r.tax_category_id = p.tax_category_id
+	JOIN quotes q ON q.id = quote_items.quote_id
+	WHERE p.id = quote_items.product_id
+	  AND (r.country = TRIM(COALESCE(q.customer_country, '')) OR r.country = '*')
+);
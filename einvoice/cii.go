@@ -0,0 +1,415 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FacturXFilename is the name the CII XML must have within a Factur-X or
+// ZUGFeRD PDF.
+const FacturXFilename = "factur-x.xml"
+
+// Factur-X and ZUGFeRD documents conform to the EN 16931 profile.
+const (
+	cenGuideline   = "urn:cen.eu:en16931:2017"
+	invoiceType    = "380"
+	unitCode       = "C62" // one, as items are counted
+	creditTransfer = "58"  // SEPA credit transfer
+)
+
+// CII writes inv as UN/CEFACT Cross Industry Invoice XML in the EN 16931
+// profile, as Factur-X and ZUGFeRD embed it in a PDF.
+func CII(inv Invoice) ([]byte, error) {
+	doc := ciiInvoice{
+		RSM: "urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100",
+		RAM: "urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100",
+		QDT: "urn:un:unece:uncefact:data:standard:QualifiedDataType:100",
+		UDT: "urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100",
+		Context: ciiContext{
+			Guideline: ciiID{ID: cenGuideline},
+		},
+		Document: ciiDocument{
+			ID:        inv.Number,
+			TypeCode:  invoiceType,
+			IssueDate: ciiDate(inv.IssueDate),
+		},
+	}
+	t := &doc.Transaction
+
+	for _, line := range inv.Lines {
+		item := ciiLineItem{
+			LineDocument: ciiLineDocument{LineID: line.ID},
+			Product:      ciiProduct{Name: line.Name},
+			Agreement: ciiLineAgreement{
+				NetPrice: ciiPrice{Amount: line.UnitPrice.String()},
+			},
+			Delivery: ciiLineDelivery{
+				Quantity: ciiQuantity{UnitCode: unitCode, Value: strconv.Itoa(line.Quantity)},
+			},
+			Settlement: ciiLineSettlement{
+				Tax: ciiTax{
+					TypeCode:     "VAT",
+					CategoryCode: line.Category,
+					Rate:         percent(line.Category, line.TaxRate),
+				},
+				Summation: ciiLineSummation{LineTotal: line.NetAmount.String()},
+			},
+		}
+		if !line.Discount.IsZero() {
+			item.Settlement.AllowanceCharges = []ciiAllowanceCharge{{
+				ChargeIndicator: ciiIndicator{Indicator: false},
+				Amount:          line.Discount.String(),
+				Reason:          "Discount",
+			}}
+		}
+		t.Lines = append(t.Lines, item)
+	}
+
+	t.Agreement = ciiAgreement{
+		Seller: ciiPartyOf(inv.Seller),
+		Buyer:  ciiPartyOf(inv.Buyer),
+	}
+
+	s := &t.Settlement
+	s.PaymentReference = inv.PaymentReference
+	s.Currency = inv.Currency
+	if p := inv.Payment; p != nil {
+		means := &ciiPaymentMeans{
+			TypeCode: creditTransfer,
+			Account:  &ciiAccount{IBAN: p.IBAN, Name: p.AccountHolder},
+		}
+		if p.BIC != "" {
+			means.Institution = &ciiInstitution{BIC: p.BIC}
+		}
+		s.PaymentMeans = means
+	}
+	for _, st := range inv.TaxSubtotals {
+		tax := ciiTax{
+			Calculated:   st.Tax.String(),
+			TypeCode:     "VAT",
+			Basis:        st.Taxable.String(),
+			CategoryCode: st.Category,
+			Rate:         percent(st.Category, st.Rate),
+		}
+		if st.Category == CategoryNotSubject {
+			tax.ExemptionReason, tax.ExemptionReasonCode = notSubjectReason, notSubjectReasonCode
+		}
+		s.Taxes = append(s.Taxes, tax)
+	}
+	for _, ac := range inv.AllowanceCharges {
+		s.AllowanceCharges = append(s.AllowanceCharges, ciiAllowanceCharge{
+			ChargeIndicator: ciiIndicator{Indicator: ac.Charge},
+			Amount:          ac.Amount.String(),
+			Reason:          ac.Reason,
+			Tax: &ciiTax{
+				TypeCode:     "VAT",
+				CategoryCode: ac.Category,
+				Rate:         percent(ac.Category, ac.TaxRate),
+			},
+		})
+	}
+	if inv.PaymentTerms != "" || !inv.DueDate.IsZero() {
+		terms := &ciiPaymentTerms{Description: inv.PaymentTerms}
+		if !inv.DueDate.IsZero() {
+			due := ciiDate(inv.DueDate)
+			terms.DueDate = &due
+		}
+		s.PaymentTerms = terms
+	}
+	s.Summation = ciiSummation{
+		LineTotal:      inv.LineTotal.String(),
+		ChargeTotal:    inv.ChargeTotal.String(),
+		AllowanceTotal: inv.AllowanceTotal.String(),
+		TaxBasisTotal:  inv.TaxBasisTotal.String(),
+		TaxTotal:       ciiAmount{Currency: inv.Currency, Value: inv.TaxTotal.String()},
+		GrandTotal:     inv.GrandTotal.String(),
+		Prepaid:        inv.Prepaid.String(),
+		DuePayable:     inv.DuePayable.String(),
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func ciiPartyOf(p Party) ciiParty {
+	party := ciiParty{
+		Name: p.Name,
+		Address: ciiAddress{
+			LineOne: oneLine(p.Address),
+			Country: p.CountryCode,
+		},
+	}
+	if p.RegistrationNumber != "" || p.TradingName != "" {
+		party.LegalOrganization = &ciiLegalOrganization{ID: p.RegistrationNumber, TradingName: p.TradingName}
+	}
+	if p.Email != "" {
+		party.Email = &ciiEmail{URI: ciiSchemedID{Scheme: "EM", Value: p.Email}}
+	}
+	if p.TaxID != "" {
+		scheme := "FC"
+		if p.VATNumber() {
+			scheme = "VA"
+		}
+		party.TaxRegistration = &ciiTaxRegistration{ID: ciiSchemedID{Scheme: scheme, Value: p.TaxID}}
+	}
+	return party
+}
+
+// oneLine joins the lines of a multi-line address with commas.
+func oneLine(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, ", ")
+}
+
+func ciiDate(t time.Time) ciiDateTime {
+	return ciiDateTime{Value: ciiDateString{Format: "102", Value: t.Format("20060102")}}
+}
+
+// The CII elements an EN 16931 invoice uses, in the order the schema has
+// them.
+type ciiInvoice struct {
+	XMLName     xml.Name       `xml:"rsm:CrossIndustryInvoice"`
+	RSM         string         `xml:"xmlns:rsm,attr"`
+	RAM         string         `xml:"xmlns:ram,attr"`
+	QDT         string         `xml:"xmlns:qdt,attr"`
+	UDT         string         `xml:"xmlns:udt,attr"`
+	Context     ciiContext     `xml:"rsm:ExchangedDocumentContext"`
+	Document    ciiDocument    `xml:"rsm:ExchangedDocument"`
+	Transaction ciiTransaction `xml:"rsm:SupplyChainTradeTransaction"`
+}
+
+type ciiContext struct {
+	Guideline ciiID `xml:"ram:GuidelineSpecifiedDocumentContextParameter"`
+}
+
+type ciiID struct {
+	ID string `xml:"ram:ID"`
+}
+
+type ciiDocument struct {
+	ID        string      `xml:"ram:ID"`
+	TypeCode  string      `xml:"ram:TypeCode"`
+	IssueDate ciiDateTime `xml:"ram:IssueDateTime"`
+}
+
+type ciiDateTime struct {
+	Value ciiDateString `xml:"udt:DateTimeString"`
+}
+
+type ciiDateString struct {
+	Format string `xml:"format,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiTransaction struct {
+	Lines      []ciiLineItem `xml:"ram:IncludedSupplyChainTradeLineItem"`
+	Agreement  ciiAgreement  `xml:"ram:ApplicableHeaderTradeAgreement"`
+	Delivery   struct{}      `xml:"ram:ApplicableHeaderTradeDelivery"`
+	Settlement ciiSettlement `xml:"ram:ApplicableHeaderTradeSettlement"`
+}
+
+type ciiLineItem struct {
+	LineDocument ciiLineDocument   `xml:"ram:AssociatedDocumentLineDocument"`
+	Product      ciiProduct        `xml:"ram:SpecifiedTradeProduct"`
+	Agreement    ciiLineAgreement  `xml:"ram:SpecifiedLineTradeAgreement"`
+	Delivery     ciiLineDelivery   `xml:"ram:SpecifiedLineTradeDelivery"`
+	Settlement   ciiLineSettlement `xml:"ram:SpecifiedLineTradeSettlement"`
+}
+
+type ciiLineDocument struct {
+	LineID string `xml:"ram:LineID"`
+}
+
+type ciiProduct struct {
+	Name string `xml:"ram:Name"`
+}
+
+type ciiLineAgreement struct {
+	NetPrice ciiPrice `xml:"ram:NetPriceProductTradePrice"`
+}
+
+type ciiPrice struct {
+	Amount string `xml:"ram:ChargeAmount"`
+}
+
+type ciiLineDelivery struct {
+	Quantity ciiQuantity `xml:"ram:BilledQuantity"`
+}
+
+type ciiQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ciiLineSettlement struct {
+	Tax              ciiTax               `xml:"ram:ApplicableTradeTax"`
+	AllowanceCharges []ciiAllowanceCharge `xml:"ram:SpecifiedTradeAllowanceCharge"`
+	Summation        ciiLineSummation     `xml:"ram:SpecifiedTradeSettlementLineMonetarySummation"`
+}
+
+type ciiLineSummation struct {
+	LineTotal string `xml:"ram:LineTotalAmount"`
+}
+
+type ciiTax struct {
+	Calculated          string `xml:"ram:CalculatedAmount,omitempty"`
+	TypeCode            string `xml:"ram:TypeCode"`
+	ExemptionReason     string `xml:"ram:ExemptionReason,omitempty"`
+	Basis               string `xml:"ram:BasisAmount,omitempty"`
+	CategoryCode        string `xml:"ram:CategoryCode"`
+	ExemptionReasonCode string `xml:"ram:ExemptionReasonCode,omitempty"`
+	Rate                string `xml:"ram:RateApplicablePercent,omitempty"`
+}
+
+type ciiAllowanceCharge struct {
+	ChargeIndicator ciiIndicator `xml:"ram:ChargeIndicator"`
+	Amount          string       `xml:"ram:ActualAmount"`
+	Reason          string       `xml:"ram:Reason,omitempty"`
+	Tax             *ciiTax      `xml:"ram:CategoryTradeTax"`
+}
+
+type ciiIndicator struct {
+	Indicator bool `xml:"udt:Indicator"`
+}
+
+type ciiAgreement struct {
+	Seller ciiParty `xml:"ram:SellerTradeParty"`
+	Buyer  ciiParty `xml:"ram:BuyerTradeParty"`
+}
+
+type ciiParty struct {
+	Name              string                `xml:"ram:Name"`
+	LegalOrganization *ciiLegalOrganization `xml:"ram:SpecifiedLegalOrganization"`
+	Address           ciiAddress            `xml:"ram:PostalTradeAddress"`
+	Email             *ciiEmail             `xml:"ram:URIUniversalCommunication"`
+	TaxRegistration   *ciiTaxRegistration   `xml:"ram:SpecifiedTaxRegistration"`
+}
+
+type ciiLegalOrganization struct {
+	ID          string `xml:"ram:ID,omitempty"`
+	TradingName string `xml:"ram:TradingBusinessName,omitempty"`
+}
+
+type ciiAddress struct {
+	LineOne string `xml:"ram:LineOne,omitempty"`
+	Country string `xml:"ram:CountryID"`
+}
+
+type ciiEmail struct {
+	URI ciiSchemedID `xml:"ram:URIID"`
+}
+
+type ciiTaxRegistration struct {
+	ID ciiSchemedID `xml:"ram:ID"`
+}
+
+type ciiSchemedID struct {
+	Scheme string `xml:"schemeID,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ciiSettlement struct {
+	PaymentReference string               `xml:"ram:PaymentReference,omitempty"`
+	Currency         string               `xml:"ram:InvoiceCurrencyCode"`
+	PaymentMeans     *ciiPaymentMeans     `xml:"ram:SpecifiedTradeSettlementPaymentMeans"`
+	Taxes            []ciiTax             `xml:"ram:ApplicableTradeTax"`
+	AllowanceCharges []ciiAllowanceCharge `xml:"ram:SpecifiedTradeAllowanceCharge"`
+	PaymentTerms     *ciiPaymentTerms     `xml:"ram:SpecifiedTradePaymentTerms"`
+	Summation        ciiSummation         `xml:"ram:SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type ciiPaymentMeans struct {
+	TypeCode    string          `xml:"ram:TypeCode"`
+	Account     *ciiAccount     `xml:"ram:PayeePartyCreditorFinancialAccount"`
+	Institution *ciiInstitution `xml:"ram:PayeeSpecifiedCreditorFinancialInstitution"`
+}
+
+type ciiAccount struct {
+	IBAN string `xml:"ram:IBANID"`
+	Name string `xml:"ram:AccountName,omitempty"`
+}
+
+type ciiInstitution struct {
+	BIC string `xml:"ram:BICID"`
+}
+
+type ciiPaymentTerms struct {
+	Description string       `xml:"ram:Description,omitempty"`
+	DueDate     *ciiDateTime `xml:"ram:DueDateDateTime"`
+}
+
+type ciiSummation struct {
+	LineTotal      string    `xml:"ram:LineTotalAmount"`
+	ChargeTotal    string    `xml:"ram:ChargeTotalAmount"`
+	AllowanceTotal string    `xml:"ram:AllowanceTotalAmount"`
+	TaxBasisTotal  string    `xml:"ram:TaxBasisTotalAmount"`
+	TaxTotal       ciiAmount `xml:"ram:TaxTotalAmount"`
+	GrandTotal     string    `xml:"ram:GrandTotalAmount"`
+	Prepaid        string    `xml:"ram:TotalPrepaidAmount"`
+	DuePayable     string    `xml:"ram:DuePayableAmount"`
+}
+
+type ciiAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// FacturXMetadata is the XMP a Factur-X PDF/A-3 carries to say what its
+// attachment is, with the schema PDF/A requires for the Factur-X
+// properties.
+const FacturXMetadata = `<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentType>INVOICE</fx:DocumentType>
+<fx:DocumentFileName>` + FacturXFilename + `</fx:DocumentFileName>
+<fx:Version>1.0</fx:Version>
+<fx:ConformanceLevel>EN 16931</fx:ConformanceLevel>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdfaExtension="http://www.aiim.org/pdfa/ns/extension/" xmlns:pdfaSchema="http://www.aiim.org/pdfa/ns/schema#" xmlns:pdfaProperty="http://www.aiim.org/pdfa/ns/property#">
+<pdfaExtension:schemas>
+<rdf:Bag>
+<rdf:li rdf:parseType="Resource">
+<pdfaSchema:schema>Factur-X PDFA Extension Schema</pdfaSchema:schema>
+<pdfaSchema:namespaceURI>urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#</pdfaSchema:namespaceURI>
+<pdfaSchema:prefix>fx</pdfaSchema:prefix>
+<pdfaSchema:property>
+<rdf:Seq>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentFileName</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The name of the embedded XML document</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>DocumentType</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The type of the hybrid document in capital letters, e.g. INVOICE or ORDER</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>Version</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The actual version of the standard applying to the embedded XML document</pdfaProperty:description>
+</rdf:li>
+<rdf:li rdf:parseType="Resource">
+<pdfaProperty:name>ConformanceLevel</pdfaProperty:name>
+<pdfaProperty:valueType>Text</pdfaProperty:valueType>
+<pdfaProperty:category>external</pdfaProperty:category>
+<pdfaProperty:description>The conformance level of the embedded XML document</pdfaProperty:description>
+</rdf:li>
+</rdf:Seq>
+</pdfaSchema:property>
+</rdf:li>
+</rdf:Bag>
+</pdfaExtension:schemas>
+</rdf:Description>
+`
@@ -0,0 +1,430 @@
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"invoice-app/money"
+)
+
+func eur(cents int64) money.Money {
+	return money.New(cents, "EUR")
+}
+
+// testInvoice is an invoice that meets EN 16931 and Peppol, with lines at
+// two rates, a line discount, an invoice discount and a surcharge, and part
+// of it paid.
+func testInvoice() Invoice {
+	return Invoice{
+		Number:           "INV-2026-00001",
+		IssueDate:        time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		DueDate:          time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		PaymentTerms:     "Net 30 days",
+		Currency:         "EUR",
+		PaymentReference: "INV-2026-00001",
+		BuyerReference:   "PO-4711",
+		Seller: Party{
+			Name:               "Acme GmbH",
+			Address:            "Hauptstraße 1\n10115 Berlin",
+			Country:            "Germany",
+			CountryCode:        "DE",
+			TaxID:              "DE123456789",
+			RegistrationNumber: "HRB 12345",
+			Email:              "billing@acme.example",
+			PeppolID:           "0088:5790000435975",
+		},
+		Buyer: Party{
+			Name:        "John Smith",
+			Address:     "1 rue de Rivoli, Paris",
+			Country:     "France",
+			CountryCode: "FR",
+			Email:       "john@example.com",
+			PeppolID:    "9957:FR12345678901",
+		},
+		Payment: &PaymentMeans{IBAN: "DE89370400440532013000", AccountHolder: "Acme GmbH", BIC: "COBADEFFXXX"},
+		Lines: []Line{
+			{ID: "1", Name: "Consulting", Quantity: 3, UnitPrice: eur(10000), Discount: eur(1000), NetAmount: eur(29000), Category: "S", TaxRate: 2000},
+			{ID: "2", Name: "Books", Quantity: 2, UnitPrice: eur(1500), Discount: eur(0), NetAmount: eur(3000), Category: "Z", TaxRate: 0},
+		},
+		AllowanceCharges: []AllowanceCharge{
+			{Amount: eur(2900), Reason: "Loyalty discount", Category: "S", TaxRate: 2000},
+			{Charge: true, Amount: eur(500), Reason: "Shipping", Category: "S", TaxRate: 2000},
+		},
+		TaxSubtotals: []TaxSubtotal{
+			{Category: "S", Rate: 2000, Taxable: eur(26600), Tax: eur(5320)},
+			{Category: "Z", Rate: 0, Taxable: eur(3000), Tax: eur(0)},
+		},
+		LineTotal:      eur(32000),
+		AllowanceTotal: eur(2900),
+		ChargeTotal:    eur(500),
+		TaxBasisTotal:  eur(29600),
+		TaxTotal:       eur(5320),
+		GrandTotal:     eur(34920),
+		Prepaid:        eur(4920),
+		DuePayable:     eur(30000),
+	}
+}
+
+// ciiSchema is, for each element CII writes that has children, the children
+// the EN 16931 CII schema (Factur-X 1.0 EN16931 profile of UN/CEFACT D16B)
+// allows in the order it has them. Those marked ! are required. It is a
+// transcription of the parts of the schema CII uses, so the order the
+// schema enforces is checked without the schema, which cannot be shipped
+// here; TestCIIValidatesAgainstSchema checks against the schema itself.
+var ciiSchema = map[string]string{
+	"rsm:CrossIndustryInvoice":                       "rsm:ExchangedDocumentContext! rsm:ExchangedDocument! rsm:SupplyChainTradeTransaction!",
+	"rsm:ExchangedDocumentContext":                   "ram:TestIndicator ram:BusinessProcessSpecifiedDocumentContextParameter ram:GuidelineSpecifiedDocumentContextParameter!",
+	"ram:GuidelineSpecifiedDocumentContextParameter": "ram:ID!",
+	"rsm:ExchangedDocument":                          "ram:ID! ram:TypeCode! ram:IssueDateTime! ram:IncludedNote",
+	"ram:IssueDateTime":                              "udt:DateTimeString!",
+	"rsm:SupplyChainTradeTransaction":                "ram:IncludedSupplyChainTradeLineItem! ram:ApplicableHeaderTradeAgreement! ram:ApplicableHeaderTradeDelivery! ram:ApplicableHeaderTradeSettlement!",
+
+	"ram:IncludedSupplyChainTradeLineItem":              "ram:AssociatedDocumentLineDocument! ram:SpecifiedTradeProduct! ram:SpecifiedLineTradeAgreement! ram:SpecifiedLineTradeDelivery! ram:SpecifiedLineTradeSettlement!",
+	"ram:AssociatedDocumentLineDocument":                "ram:LineID! ram:IncludedNote",
+	"ram:SpecifiedTradeProduct":                         "ram:GlobalID ram:SellerAssignedID ram:BuyerAssignedID ram:Name! ram:Description ram:ApplicableProductCharacteristic ram:DesignatedProductClassification ram:OriginTradeCountry",
+	"ram:SpecifiedLineTradeAgreement":                   "ram:BuyerOrderReferencedDocument ram:GrossPriceProductTradePrice ram:NetPriceProductTradePrice!",
+	"ram:NetPriceProductTradePrice":                     "ram:ChargeAmount! ram:BasisQuantity",
+	"ram:SpecifiedLineTradeDelivery":                    "ram:BilledQuantity!",
+	"ram:SpecifiedLineTradeSettlement":                  "ram:ApplicableTradeTax! ram:BillingSpecifiedPeriod ram:SpecifiedTradeAllowanceCharge ram:SpecifiedTradeSettlementLineMonetarySummation! ram:AdditionalReferencedDocument ram:ReceivableSpecifiedTradeAccountingAccount",
+	"ram:SpecifiedTradeSettlementLineMonetarySummation": "ram:LineTotalAmount!",
+
+	"ram:ApplicableTradeTax":            "ram:CalculatedAmount ram:TypeCode! ram:ExemptionReason ram:BasisAmount ram:CategoryCode! ram:ExemptionReasonCode ram:DueDateTypeCode ram:RateApplicablePercent",
+	"ram:CategoryTradeTax":              "ram:TypeCode! ram:CategoryCode! ram:RateApplicablePercent",
+	"ram:SpecifiedTradeAllowanceCharge": "ram:ChargeIndicator! ram:CalculationPercent ram:BasisAmount ram:ActualAmount! ram:ReasonCode ram:Reason ram:CategoryTradeTax",
+	"ram:ChargeIndicator":               "udt:Indicator!",
+
+	"ram:ApplicableHeaderTradeAgreement": "ram:BuyerReference ram:SellerTradeParty! ram:BuyerTradeParty! ram:SellerTaxRepresentativeTradeParty ram:BuyerOrderReferencedDocument ram:ContractReferencedDocument ram:AdditionalReferencedDocument ram:SpecifiedProcuringProject",
+	"ram:SellerTradeParty":               "ram:ID ram:GlobalID ram:Name! ram:Description ram:SpecifiedLegalOrganization ram:DefinedTradeContact ram:PostalTradeAddress! ram:URIUniversalCommunication ram:SpecifiedTaxRegistration",
+	"ram:BuyerTradeParty":                "ram:ID ram:GlobalID ram:Name! ram:SpecifiedLegalOrganization ram:DefinedTradeContact ram:PostalTradeAddress! ram:URIUniversalCommunication ram:SpecifiedTaxRegistration",
+	"ram:SpecifiedLegalOrganization":     "ram:ID ram:TradingBusinessName",
+	"ram:PostalTradeAddress":             "ram:PostcodeCode ram:LineOne ram:LineTwo ram:LineThree ram:CityName ram:CountryID! ram:CountrySubDivisionName",
+	"ram:URIUniversalCommunication":      "ram:URIID!",
+	"ram:SpecifiedTaxRegistration":       "ram:ID!",
+	"ram:ApplicableHeaderTradeDelivery":  "ram:ShipToTradeParty ram:ActualDeliverySupplyChainEvent ram:DespatchAdviceReferencedDocument ram:ReceivingAdviceReferencedDocument",
+
+	"ram:ApplicableHeaderTradeSettlement":                 "ram:CreditorReferenceID ram:PaymentReference ram:TaxCurrencyCode ram:InvoiceCurrencyCode! ram:PayeeTradeParty ram:SpecifiedTradeSettlementPaymentMeans ram:ApplicableTradeTax! ram:BillingSpecifiedPeriod ram:SpecifiedTradeAllowanceCharge ram:SpecifiedTradePaymentTerms ram:SpecifiedTradeSettlementHeaderMonetarySummation! ram:InvoiceReferencedDocument ram:ReceivableSpecifiedTradeAccountingAccount",
+	"ram:SpecifiedTradeSettlementPaymentMeans":            "ram:TypeCode! ram:Information ram:ApplicableTradeSettlementFinancialCard ram:PayerPartyDebtorFinancialAccount ram:PayeePartyCreditorFinancialAccount ram:PayeeSpecifiedCreditorFinancialInstitution",
+	"ram:PayeePartyCreditorFinancialAccount":              "ram:IBANID ram:AccountName ram:ProprietaryID",
+	"ram:PayeeSpecifiedCreditorFinancialInstitution":      "ram:BICID!",
+	"ram:SpecifiedTradePaymentTerms":                      "ram:Description ram:DueDateDateTime ram:DirectDebitMandateID",
+	"ram:DueDateDateTime":                                 "udt:DateTimeString!",
+	"ram:SpecifiedTradeSettlementHeaderMonetarySummation": "ram:LineTotalAmount! ram:ChargeTotalAmount ram:AllowanceTotalAmount ram:TaxBasisTotalAmount! ram:TaxTotalAmount ram:RoundingAmount ram:GrandTotalAmount! ram:TotalPrepaidAmount ram:DuePayableAmount!",
+}
+
+var ciiPrefixes = map[string]string{
+	"urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100":                       "rsm",
+	"urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100": "ram",
+	"urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100":                        "udt",
+}
+
+// ciiElement is an element of a CII document: its prefixed name, text and
+// children.
+type ciiElement struct {
+	name     string
+	text     string
+	children []*ciiElement
+}
+
+func parseCII(t *testing.T, data []byte) *ciiElement {
+	t.Helper()
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*ciiElement
+	var root *ciiElement
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			prefix, ok := ciiPrefixes[tok.Name.Space]
+			if !ok {
+				t.Fatalf("%s is in namespace %q", tok.Name.Local, tok.Name.Space)
+			}
+			e := &ciiElement{name: prefix + ":" + tok.Name.Local}
+			if len(stack) == 0 {
+				root = e
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			}
+			stack = append(stack, e)
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += strings.TrimSpace(string(tok))
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return root
+}
+
+// checkOrder reports the children of e and its descendants that the schema
+// does not allow, or allows but elsewhere, and required ones that are
+// missing.
+func checkOrder(t *testing.T, e *ciiElement, path string) {
+	t.Helper()
+	path += "/" + e.name
+	sequence, ok := ciiSchema[e.name]
+	if !ok {
+		if len(e.children) > 0 {
+			t.Errorf("%s has children, which the schema has no place for", path)
+		}
+		return
+	}
+
+	order := map[string]int{}
+	var required []string
+	for i, child := range strings.Fields(sequence) {
+		name, isRequired := strings.CutSuffix(child, "!")
+		order[name] = i
+		if isRequired {
+			required = append(required, name)
+		}
+	}
+
+	last, seen := -1, map[string]bool{}
+	for _, child := range e.children {
+		i, ok := order[child.name]
+		switch {
+		case !ok:
+			t.Errorf("%s has %s, which the schema does not allow there", path, child.name)
+		case i < last:
+			t.Errorf("%s has %s out of the schema's order", path, child.name)
+		default:
+			last = i
+		}
+		seen[child.name] = true
+		checkOrder(t, child, path)
+	}
+	for _, name := range required {
+		if !seen[name] {
+			t.Errorf("%s lacks %s, which the schema requires", path, name)
+		}
+	}
+}
+
+func TestCIIFollowsSchemaOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Invoice)
+	}{
+		{"full", func(*Invoice) {}},
+		{"minimal", func(inv *Invoice) {
+			inv.Seller.RegistrationNumber, inv.Seller.Email, inv.Buyer.Email = "", "", ""
+			inv.Payment, inv.PaymentTerms, inv.DueDate, inv.PaymentReference = nil, "", time.Time{}, ""
+		}},
+		{"tax registration", func(inv *Invoice) { inv.Seller.TaxID = "123/456/78901" }},
+		{"trading name only", func(inv *Invoice) { inv.Seller.RegistrationNumber, inv.Seller.TradingName = "", "Acme" }},
+		{"not subject to VAT", notSubject},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := testInvoice()
+			tt.change(&inv)
+			out, err := CII(inv)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := parseCII(t, out)
+			if root.name != "rsm:CrossIndustryInvoice" {
+				t.Fatalf("root is %s", root.name)
+			}
+			checkOrder(t, root, "")
+		})
+	}
+}
+
+// ciiValues finds the texts of the elements at a path of prefixed names
+// below root.
+func ciiValues(root *ciiElement, path string) []string {
+	elements := []*ciiElement{root}
+	for _, name := range strings.Split(path, "/") {
+		var next []*ciiElement
+		for _, e := range elements {
+			for _, child := range e.children {
+				if child.name == name {
+					next = append(next, child)
+				}
+			}
+		}
+		elements = next
+	}
+	values := make([]string, len(elements))
+	for i, e := range elements {
+		values[i] = e.text
+	}
+	return values
+}
+
+func TestCIIValues(t *testing.T) {
+	out, err := CII(testInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := parseCII(t, out)
+
+	const (
+		settlement = "rsm:SupplyChainTradeTransaction/ram:ApplicableHeaderTradeSettlement/"
+		summation  = settlement + "ram:SpecifiedTradeSettlementHeaderMonetarySummation/"
+		seller     = "rsm:SupplyChainTradeTransaction/ram:ApplicableHeaderTradeAgreement/ram:SellerTradeParty/"
+		line       = "rsm:SupplyChainTradeTransaction/ram:IncludedSupplyChainTradeLineItem/"
+	)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"rsm:ExchangedDocumentContext/ram:GuidelineSpecifiedDocumentContextParameter/ram:ID", []string{"urn:cen.eu:en16931:2017"}},
+		{"rsm:ExchangedDocument/ram:ID", []string{"INV-2026-00001"}},
+		{"rsm:ExchangedDocument/ram:TypeCode", []string{"380"}},
+		{"rsm:ExchangedDocument/ram:IssueDateTime/udt:DateTimeString", []string{"20260301"}},
+		{line + "ram:SpecifiedLineTradeDelivery/ram:BilledQuantity", []string{"3", "2"}},
+		{line + "ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax/ram:CategoryCode", []string{"S", "Z"}},
+		{line + "ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeAllowanceCharge/ram:ActualAmount", []string{"10.00"}},
+		{line + "ram:SpecifiedLineTradeSettlement/ram:SpecifiedTradeSettlementLineMonetarySummation/ram:LineTotalAmount", []string{"290.00", "30.00"}},
+		{seller + "ram:Name", []string{"Acme GmbH"}},
+		{seller + "ram:PostalTradeAddress/ram:LineOne", []string{"Hauptstraße 1, 10115 Berlin"}},
+		{seller + "ram:SpecifiedTaxRegistration/ram:ID", []string{"DE123456789"}},
+		{settlement + "ram:InvoiceCurrencyCode", []string{"EUR"}},
+		{settlement + "ram:SpecifiedTradeSettlementPaymentMeans/ram:PayeePartyCreditorFinancialAccount/ram:IBANID", []string{"DE89370400440532013000"}},
+		{settlement + "ram:ApplicableTradeTax/ram:BasisAmount", []string{"266.00", "30.00"}},
+		{settlement + "ram:ApplicableTradeTax/ram:CalculatedAmount", []string{"53.20", "0.00"}},
+		{settlement + "ram:SpecifiedTradeAllowanceCharge/ram:ChargeIndicator/udt:Indicator", []string{"false", "true"}},
+		{settlement + "ram:SpecifiedTradeAllowanceCharge/ram:ActualAmount", []string{"29.00", "5.00"}},
+		{settlement + "ram:SpecifiedTradePaymentTerms/ram:DueDateDateTime/udt:DateTimeString", []string{"20260331"}},
+		{summation + "ram:LineTotalAmount", []string{"320.00"}},
+		{summation + "ram:TaxBasisTotalAmount", []string{"296.00"}},
+		{summation + "ram:TaxTotalAmount", []string{"53.20"}},
+		{summation + "ram:GrandTotalAmount", []string{"349.20"}},
+		{summation + "ram:DuePayableAmount", []string{"300.00"}},
+	}
+	for _, tt := range tests {
+		if got := ciiValues(root, tt.path); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s is %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	// Amounts are plain decimals, as the schema's AmountType needs
+	amount := regexp.MustCompile(`^-?\d+\.\d+$`)
+	for _, path := range []string{summation + "ram:LineTotalAmount", summation + "ram:ChargeTotalAmount", summation + "ram:AllowanceTotalAmount", summation + "ram:TotalPrepaidAmount"} {
+		for _, v := range ciiValues(root, path) {
+			if !amount.MatchString(v) {
+				t.Errorf("%s is %q, not a decimal amount", path, v)
+			}
+		}
+	}
+}
+
+// notSubject makes the zero-rated line of inv not subject to VAT.
+func notSubject(inv *Invoice) {
+	inv.Lines[1].Category = CategoryNotSubject
+	inv.TaxSubtotals[1].Category = CategoryNotSubject
+}
+
+func TestCIINotSubjectToVAT(t *testing.T) {
+	inv := testInvoice()
+	notSubject(&inv)
+	out, err := CII(inv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := parseCII(t, out)
+
+	// Only the standard-rated line and breakdown have a rate, and only the
+	// breakdown not subject to VAT says why
+	const (
+		settlement = "rsm:SupplyChainTradeTransaction/ram:ApplicableHeaderTradeSettlement/ram:ApplicableTradeTax/"
+		line       = "rsm:SupplyChainTradeTransaction/ram:IncludedSupplyChainTradeLineItem/ram:SpecifiedLineTradeSettlement/ram:ApplicableTradeTax/"
+	)
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{line + "ram:CategoryCode", []string{"S", "O"}},
+		{line + "ram:RateApplicablePercent", []string{"20.00"}},
+		{settlement + "ram:CategoryCode", []string{"S", "O"}},
+		{settlement + "ram:RateApplicablePercent", []string{"20.00"}},
+		{settlement + "ram:ExemptionReason", []string{"Not subject to VAT"}},
+		{settlement + "ram:ExemptionReasonCode", []string{"VATEX-EU-O"}},
+	}
+	for _, tt := range tests {
+		if got := ciiValues(root, tt.path); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s is %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestCIIValidatesAgainstSchema validates CII against the Factur-X EN 16931
+// XSD with xmllint. The schema is not distributed with this repository:
+// set CII_XSD to the path of Factur-X_1.0.07_EN16931.xsd, from the
+// Factur-X package, with the files it imports beside it.
+func TestCIIValidatesAgainstSchema(t *testing.T) {
+	schema := os.Getenv("CII_XSD")
+	if schema == "" {
+		t.Skip("CII_XSD is not set")
+	}
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint is not installed")
+	}
+
+	out, err := CII(testInvoice())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), FacturXFilename)
+	if err := os.WriteFile(file, out, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := exec.Command(xmllint, "--noout", "--schema", schema, file).CombinedOutput(); err != nil {
+		t.Errorf("xmllint: %v\n%s", err, result)
+	}
+}
+
+func TestFacturXMetadata(t *testing.T) {
+	// The descriptions go inside the XMP's rdf:RDF
+	var rdf struct {
+		Descriptions []struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"Description"`
+	}
+	doc := `<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + FacturXMetadata + `</rdf:RDF>`
+	if err := xml.Unmarshal([]byte(doc), &rdf); err != nil {
+		t.Fatal(err)
+	}
+	if len(rdf.Descriptions) != 2 {
+		t.Fatalf("got %d descriptions, want the Factur-X properties and their extension schema", len(rdf.Descriptions))
+	}
+
+	var fx struct {
+		DocumentType     string `xml:"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0# DocumentType"`
+		DocumentFileName string `xml:"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0# DocumentFileName"`
+		Version          string `xml:"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0# Version"`
+		ConformanceLevel string `xml:"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0# ConformanceLevel"`
+	}
+	if err := xml.Unmarshal([]byte(`<d xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">`+rdf.Descriptions[0].Inner+`</d>`), &fx); err != nil {
+		t.Fatal(err)
+	}
+	if fx.DocumentType != "INVOICE" || fx.DocumentFileName != FacturXFilename || fx.Version != "1.0" || fx.ConformanceLevel != "EN 16931" {
+		t.Errorf("Factur-X properties are %+v", fx)
+	}
+
+	// PDF/A needs every property used outside its own schemas described
+	for _, property := range []string{"DocumentFileName", "DocumentType", "Version", "ConformanceLevel"} {
+		if !strings.Contains(rdf.Descriptions[1].Inner, "<pdfaProperty:name>"+property+"</pdfaProperty:name>") {
+			t.Errorf("the extension schema does not describe %s", property)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package einvoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// Invoice is an invoice as the European e-invoicing standard, EN 16931,
+// describes it. Amounts are in Currency; the business term each field
+// carries is noted as BT-n.
+type Invoice struct {
+	Number           string    // BT-1
+	IssueDate        time.Time // BT-2
+	DueDate          time.Time // BT-9, zero if there is none
+	PaymentTerms     string    // BT-20
+	Currency         string    // BT-5
+	PaymentReference string    // BT-83
+	BuyerReference   string    // BT-10
+	Note             string    // BT-22
+
+	// A credit note (BT-3) refers to the invoice it credits
+	CreditNote    bool
+	Preceding     string    // BT-25
+	PrecedingDate time.Time // BT-26
+
+	Seller Party
+	Buyer  Party
+
+	// How to pay the seller, or nil if they have not said
+	Payment *PaymentMeans
+
+	Lines []Line
+	// Invoice-level discounts and surcharges, each split over the VAT
+	// categories and rates of the lines it was spread over
+	AllowanceCharges []AllowanceCharge
+	TaxSubtotals     []TaxSubtotal
+
+	LineTotal      money.Money // BT-106
+	AllowanceTotal money.Money // BT-107
+	ChargeTotal    money.Money // BT-108
+	TaxBasisTotal  money.Money // BT-109
+	TaxTotal       money.Money // BT-110
+	GrandTotal     money.Money // BT-112
+	Prepaid        money.Money // BT-113
+	DuePayable     money.Money // BT-115
+}
+
+// Party is the seller or the buyer. Country is as it was entered, a name or
+// a code; CountryCode is its ISO 3166 code, or "" if it is not known.
+type Party struct {
+	Name               string // BT-27, BT-44
+	TradingName        string // BT-28, BT-45
+	Address            string // BT-35, BT-50
+	Country            string
+	CountryCode        string // BT-40, BT-55
+	TaxID              string // BT-31, BT-48 if it is a VAT number, else BT-32
+	RegistrationNumber string // BT-30, BT-47
+	Email              string // BT-34, BT-49
+	Phone              string
+	PeppolID           string // BT-34, BT-49 on the Peppol network
+}
+
+// VATNumber reports whether p's tax ID is a VAT identifier, which starts
+// with a country code, rather than a local tax registration number.
+func (p Party) VATNumber() bool {
+	id := strings.TrimSpace(p.TaxID)
+	return len(id) > 2 && isUpperLetter(id[0]) && isUpperLetter(id[1])
+}
+
+func isUpperLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
+}
+
+// PaymentMeans is payment by credit transfer to the seller's account.
+type PaymentMeans struct {
+	IBAN          string // BT-84
+	AccountHolder string // BT-85
+	BIC           string // BT-86
+}
+
+// Line is an invoice line: Quantity units at UnitPrice, less Discount, make
+// NetAmount, in VAT Category at TaxRate.
+type Line struct {
+	ID        string      // BT-126
+	Name      string      // BT-153
+	Quantity  int         // BT-129
+	UnitPrice money.Money // BT-146
+	Discount  money.Money // BT-136
+	NetAmount money.Money // BT-131
+	Category  string      // BT-151
+	TaxRate   tax.Rate    // BT-152
+}
+
+// AllowanceCharge is a discount (BG-20) or, if Charge, a surcharge (BG-21)
+// on the whole invoice, on the lines in Category at TaxRate.
+type AllowanceCharge struct {
+	Charge   bool
+	Amount   money.Money
+	Reason   string
+	Category string
+	TaxRate  tax.Rate
+}
+
+// TaxSubtotal is the tax charged in one VAT category at one rate (BG-23).
+type TaxSubtotal struct {
+	Category string      // BT-118
+	Rate     tax.Rate    // BT-119
+	Taxable  money.Money // BT-116
+	Tax      money.Money // BT-117
+}
+
+// The VAT categories an invoice's lines fall in: standard-rated and
+// zero-rated VAT, and lines not subject to VAT at all, which carry no rate.
+const (
+	CategoryStandard   = "S"
+	CategoryZeroRated  = "Z"
+	CategoryNotSubject = "O"
+)
+
+// The exemption reason (BT-120) and its code (BT-121) for lines not subject
+// to VAT.
+const (
+	notSubjectReason     = "Not subject to VAT"
+	notSubjectReasonCode = "VATEX-EU-O"
+)
+
+// percent is the rate of tax in category, or "" for lines not subject to
+// VAT, which have none.
+func percent(category string, rate tax.Rate) string {
+	if category == CategoryNotSubject {
+		return ""
+	}
+	return rate.String()
+}
+
+// categoryNames describes each VAT category in problems.
+var categoryNames = map[string]string{
+	CategoryStandard:   "standard-rated",
+	CategoryZeroRated:  "zero-rated",
+	CategoryNotSubject: "not subject to VAT",
+}
+
+// Category is the VAT category of tax at rate.
+func Category(rate tax.Rate) string {
+	if rate == 0 {
+		return CategoryZeroRated
+	}
+	return CategoryStandard
+}
+
+// Problem is a business rule an invoice breaks, such as a mandatory field
+// left empty.
+type Problem struct {
+	Rule    string `json:"rule"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an invoice that cannot be sent as an e-invoice, with everything
+// wrong with it.
+type Error struct {
+	Code     string    `json:"error"`
+	Problems []Problem `json:"problems"`
+}
+
+// CodeInvalid is Error's code.
+const CodeInvalid = "invalid_einvoice"
+
+func (e *Error) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Message
+	}
+	return "invalid e-invoice: " + strings.Join(messages, "; ")
+}
+
+// Validate checks inv against the rules of EN 16931 it could break: the
+// mandatory fields, and totals that add up. It returns nil or an *Error
+// listing every problem.
+func Validate(inv Invoice) error {
+	return invalid(check(inv))
+}
+
+// ValidatePeppol checks inv against EN 16931 and the further rules of
+// Peppol BIS Billing 3.0, which needs both parties' Peppol IDs to deliver
+// it and a buyer reference for the buyer to route it by.
+func ValidatePeppol(inv Invoice) error {
+	problems := check(inv)
+	add := adder(&problems)
+
+	if strings.TrimSpace(inv.BuyerReference) == "" {
+		add("PEPPOL-EN16931-R003", "buyer.buyer_reference", "Buyer reference (BT-10) is missing: set the customer's buyer reference")
+	}
+	parties := []struct {
+		party        Party
+		rule, field  string
+		name, source string
+	}{
+		{inv.Seller, "PEPPOL-EN16931-R020", "seller.peppol_id", "Seller electronic address (BT-34)", "the company profile's"},
+		{inv.Buyer, "PEPPOL-EN16931-R010", "buyer.peppol_id", "Buyer electronic address (BT-49)", "the customer's"},
+	}
+	for _, p := range parties {
+		if p.party.PeppolID == "" {
+			add(p.rule, p.field, "%s is missing: set %s Peppol ID", p.name, p.source)
+		} else if _, _, err := ParticipantID(p.party.PeppolID); err != nil {
+			add("PEPPOL-EN16931-CL008", p.field, "%s is not valid: %v", p.name, err)
+		}
+	}
+	return invalid(problems)
+}
+
+func invalid(problems []Problem) error {
+	if len(problems) > 0 {
+		return &Error{Code: CodeInvalid, Problems: problems}
+	}
+	return nil
+}
+
+func adder(problems *[]Problem) func(rule, field, format string, args ...any) {
+	return func(rule, field, format string, args ...any) {
+		*problems = append(*problems, Problem{Rule: rule, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// check lists the EN 16931 rules inv breaks.
+func check(inv Invoice) []Problem {
+	var problems []Problem
+	add := adder(&problems)
+
+	if strings.TrimSpace(inv.Number) == "" {
+		add("BR-02", "number", "Invoice number (BT-1) is missing")
+	}
+	if inv.IssueDate.IsZero() {
+		add("BR-03", "issue_date", "Issue date (BT-2) is missing")
+	}
+	if len(inv.Currency) != 3 {
+		add("BR-05", "currency", "Currency (BT-5) must be an ISO 4217 code")
+	}
+	if inv.CreditNote && strings.TrimSpace(inv.Preceding) == "" {
+		add("BR-55", "invoice_number", "The credited invoice's number (BT-25) is missing")
+	}
+
+	if strings.TrimSpace(inv.Seller.Name) == "" {
+		add("BR-06", "seller.legal_name", "Seller name (BT-27) is missing: set the company profile's legal name")
+	}
+	if inv.Seller.CountryCode == "" {
+		add("BR-09", "seller.country", "Seller country (BT-40) is missing: set the company profile's country%s", countryHint(inv.Seller.Country))
+	}
+	if strings.TrimSpace(inv.Buyer.Name) == "" {
+		add("BR-07", "buyer.name", "Buyer name (BT-44) is missing: set the customer's name")
+	}
+	if inv.Buyer.CountryCode == "" {
+		add("BR-11", "buyer.country", "Buyer country (BT-55) is missing: set the customer's country%s", countryHint(inv.Buyer.Country))
+	}
+
+	if len(inv.Lines) == 0 {
+		add("BR-16", "items", "An invoice must have at least one line")
+	}
+	// Lines in each VAT category need the seller to be registered for VAT,
+	// and lines not subject to it must not name either party's VAT number
+	categories := map[string]bool{}
+	for _, line := range inv.Lines {
+		categories[line.Category] = true
+	}
+	for _, category := range []string{CategoryStandard, CategoryZeroRated} {
+		if categories[category] && strings.TrimSpace(inv.Seller.TaxID) == "" {
+			add("BR-"+category+"-02", "seller.tax_id", "Seller VAT identifier (BT-31) or tax registration (BT-32) is missing for %s lines: set the company profile's tax ID", categoryNames[category])
+		}
+	}
+	if categories[CategoryNotSubject] {
+		if inv.Seller.VATNumber() {
+			add("BR-O-02", "seller.tax_id", "Seller VAT identifier (BT-31) must not be given on an invoice with lines not subject to VAT: give their products a tax category")
+		}
+		if inv.Buyer.VATNumber() {
+			add("BR-O-02", "buyer.tax_id", "Buyer VAT identifier (BT-48) must not be given on an invoice with lines not subject to VAT: give their products a tax category")
+		}
+		if len(categories) > 1 {
+			add("BR-O-11", "items", "Lines not subject to VAT cannot be on an invoice with %s lines: give their products a tax category", categoryNames[otherCategory(categories)])
+		}
+	}
+	lineTotal := money.Zero(inv.Currency)
+	for i, line := range inv.Lines {
+		if strings.TrimSpace(line.Name) == "" {
+			add("BR-25", fmt.Sprintf("items[%d].name", i), "Line %d item name (BT-153) is missing", i+1)
+		}
+		if line.Quantity <= 0 {
+			add("BR-22", fmt.Sprintf("items[%d].quantity", i), "Line %d quantity (BT-129) must be positive", i+1)
+		}
+		if line.UnitPrice.IsNegative() {
+			add("BR-27", fmt.Sprintf("items[%d].unit_price", i), "Line %d price (BT-146) must not be negative", i+1)
+		}
+		if !equal(line.UnitPrice.Mul(int64(line.Quantity)).Sub(line.Discount), line.NetAmount) {
+			add("BT-131", fmt.Sprintf("items[%d].total_price", i), "Line %d net amount (BT-131) is not its quantity times its price less its discount", i+1)
+		}
+		lineTotal = lineTotal.Add(line.NetAmount)
+	}
+
+	if inv.DuePayable.IsPositive() && inv.DueDate.IsZero() && strings.TrimSpace(inv.PaymentTerms) == "" {
+		add("BR-CO-25", "due_date", "A due date (BT-9) or payment terms (BT-20) are required when an amount is due")
+	}
+	if inv.Payment != nil && strings.TrimSpace(inv.Payment.IBAN) == "" {
+		add("BR-61", "seller.iban", "The account (BT-84) to pay by credit transfer is missing: set the company profile's IBAN")
+	}
+
+	// The totals must add up
+	allowances, charges := money.Zero(inv.Currency), money.Zero(inv.Currency)
+	for _, ac := range inv.AllowanceCharges {
+		if ac.Charge {
+			charges = charges.Add(ac.Amount)
+		} else {
+			allowances = allowances.Add(ac.Amount)
+		}
+	}
+	taxTotal := money.Zero(inv.Currency)
+	for _, st := range inv.TaxSubtotals {
+		taxTotal = taxTotal.Add(st.Tax)
+	}
+	sums := []struct {
+		rule, field, name string
+		got, want         money.Money
+	}{
+		{"BR-CO-10", "subtotal", "Sum of line net amounts (BT-106)", inv.LineTotal, lineTotal},
+		{"BR-CO-11", "adjustments", "Sum of allowances (BT-107)", inv.AllowanceTotal, allowances},
+		{"BR-CO-12", "adjustments", "Sum of charges (BT-108)", inv.ChargeTotal, charges},
+		{"BR-CO-13", "subtotal", "Total without VAT (BT-109)", inv.TaxBasisTotal, lineTotal.Sub(allowances).Add(charges)},
+		{"BR-CO-14", "tax_total", "Total VAT (BT-110)", inv.TaxTotal, taxTotal},
+		{"BR-CO-15", "total_price", "Total with VAT (BT-112)", inv.GrandTotal, inv.TaxBasisTotal.Add(inv.TaxTotal)},
+		{"BR-CO-16", "amount_paid", "Amount due (BT-115)", inv.DuePayable, inv.GrandTotal.Sub(inv.Prepaid)},
+	}
+	for _, s := range sums {
+		if !equal(s.got, s.want) {
+			add(s.rule, s.field, "%s is %s but should be %s", s.name, s.got, s.want)
+		}
+	}
+
+	// Each category and rate's taxable amount is its lines less its
+	// allowances plus its charges
+	for _, st := range inv.TaxSubtotals {
+		taxable := money.Zero(inv.Currency)
+		for _, line := range inv.Lines {
+			if line.Category == st.Category && line.TaxRate == st.Rate {
+				taxable = taxable.Add(line.NetAmount)
+			}
+		}
+		for _, ac := range inv.AllowanceCharges {
+			if ac.Category != st.Category || ac.TaxRate != st.Rate {
+				continue
+			}
+			if ac.Charge {
+				taxable = taxable.Add(ac.Amount)
+			} else {
+				taxable = taxable.Sub(ac.Amount)
+			}
+		}
+		if !equal(st.Taxable, taxable) {
+			add("BR-"+st.Category+"-08", "tax_lines", "Taxable amount %s (BT-116) is %s but its lines come to %s", subtotalName(st), st.Taxable, taxable)
+		}
+	}
+
+	return problems
+}
+
+// otherCategory is a category of categories other than not subject to VAT.
+func otherCategory(categories map[string]bool) string {
+	for _, category := range []string{CategoryStandard, CategoryZeroRated} {
+		if categories[category] {
+			return category
+		}
+	}
+	return ""
+}
+
+// subtotalName names a tax subtotal in problems: "at 20.00%", or "not
+// subject to VAT".
+func subtotalName(st TaxSubtotal) string {
+	if st.Category == CategoryNotSubject {
+		return categoryNames[st.Category]
+	}
+	return fmt.Sprintf("at %s%%", st.Rate)
+}
+
+func equal(a, b money.Money) bool {
+	return a.Sub(b).IsZero()
+}
+
+// countryHint says what is wrong with a country that has no code.
+func countryHint(country string) string {
+	if strings.TrimSpace(country) == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (%q is not a known country name or ISO 3166 code)", country)
+}
@@ -0,0 +1,55 @@
+package einvoice
+
+import (
+	"fmt"
+	"strings"
+)
+
+// glnScheme is the Electronic Address Scheme of GS1 Global Location
+// Numbers, the most common Peppol participant IDs.
+const glnScheme = "0088"
+
+// ParticipantID splits a Peppol participant ID, written scheme:identifier
+// such as 0088:5790000435975, into its Electronic Address Scheme code and
+// the identifier. The check digit of a Global Location Number is checked,
+// as Peppol does.
+func ParticipantID(id string) (scheme, identifier string, err error) {
+	scheme, identifier, ok := strings.Cut(strings.TrimSpace(id), ":")
+	if !ok || len(scheme) != 4 || !digits(scheme) {
+		return "", "", fmt.Errorf("%q must be a four-digit scheme and an identifier, such as 0088:5790000435975", id)
+	}
+	if identifier == "" || strings.ContainsAny(identifier, " \t\r\n") {
+		return "", "", fmt.Errorf("%q must have an identifier without spaces after the scheme", id)
+	}
+	if scheme == glnScheme && !validGLN(identifier) {
+		return "", "", fmt.Errorf("%q is not a Global Location Number: it must be 13 digits with a valid check digit", id)
+	}
+	return scheme, identifier, nil
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// validGLN checks a GS1 Global Location Number: its digits weighted 3 and 1
+// alternately from the right, the check digit included, sum to a multiple of
+// 10.
+func validGLN(gln string) bool {
+	if len(gln) != 13 || !digits(gln) {
+		return false
+	}
+	sum := 0
+	for i := 0; i < 13; i++ {
+		d := int(gln[12-i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
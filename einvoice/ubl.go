@@ -0,0 +1,349 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"strconv"
+
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// Peppol BIS Billing 3.0 identifies itself by these.
+const (
+	peppolCustomization = "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0"
+	peppolProfile       = "urn:fdc:peppol.eu:2017:poacc:billing:01:1.0"
+	creditNoteType      = "381"
+	sepaCreditTransfer  = "58"
+	otherCreditTransfer = "30"
+)
+
+// UBL writes inv as an OASIS UBL 2.1 Invoice, or a CreditNote if it is one,
+// as Peppol BIS Billing 3.0 specifies. Empty elements are left out, as
+// Peppol forbids them.
+func UBL(inv Invoice) ([]byte, error) {
+	doc := ublDocument{
+		XMLName:         xml.Name{Local: "Invoice"},
+		Namespace:       "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
+		CAC:             "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		CBC:             "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		CustomizationID: peppolCustomization,
+		ProfileID:       peppolProfile,
+		ID:              inv.Number,
+		IssueDate:       inv.IssueDate.Format("2006-01-02"),
+		Note:            inv.Note,
+		Currency:        inv.Currency,
+		BuyerReference:  inv.BuyerReference,
+		Seller:          ublPartyOf(inv.Seller, true),
+		Buyer:           ublPartyOf(inv.Buyer, false),
+	}
+	if inv.CreditNote {
+		doc.XMLName.Local = "CreditNote"
+		doc.Namespace = "urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+		doc.CreditNoteTypeCode = creditNoteType
+		ref := &ublDocumentReference{ID: inv.Preceding}
+		if !inv.PrecedingDate.IsZero() {
+			ref.IssueDate = inv.PrecedingDate.Format("2006-01-02")
+		}
+		doc.BillingReference = &ublBillingReference{Invoice: ref}
+	} else {
+		doc.InvoiceTypeCode = invoiceType
+		if !inv.DueDate.IsZero() {
+			doc.DueDate = inv.DueDate.Format("2006-01-02")
+		}
+	}
+
+	if p := inv.Payment; p != nil {
+		means := &ublPaymentMeans{
+			Code:      otherCreditTransfer,
+			PaymentID: inv.PaymentReference,
+			Account:   &ublAccount{ID: p.IBAN, Name: p.AccountHolder},
+		}
+		if inv.Currency == "EUR" {
+			means.Code = sepaCreditTransfer
+		}
+		if p.BIC != "" {
+			means.Account.Branch = &ublID{ID: p.BIC}
+		}
+		doc.PaymentMeans = means
+	}
+	if inv.PaymentTerms != "" {
+		doc.PaymentTerms = &ublPaymentTerms{Note: inv.PaymentTerms}
+	}
+
+	for _, ac := range inv.AllowanceCharges {
+		doc.AllowanceCharges = append(doc.AllowanceCharges, ublAllowanceCharge{
+			ChargeIndicator: ac.Charge,
+			Reason:          ac.Reason,
+			Amount:          ublAmountOf(ac.Amount),
+			Category:        ublCategory(ac.Category, ac.TaxRate),
+		})
+	}
+
+	doc.TaxTotal.Amount = ublAmountOf(inv.TaxTotal)
+	for _, st := range inv.TaxSubtotals {
+		subtotal := ublTaxSubtotal{
+			Taxable:  ublAmountOf(st.Taxable),
+			Tax:      ublAmountOf(st.Tax),
+			Category: *ublCategory(st.Category, st.Rate),
+		}
+		if st.Category == CategoryNotSubject {
+			subtotal.Category.ExemptionReasonCode, subtotal.Category.ExemptionReason = notSubjectReasonCode, notSubjectReason
+		}
+		doc.TaxTotal.Subtotals = append(doc.TaxTotal.Subtotals, subtotal)
+	}
+
+	doc.Totals = ublMonetaryTotal{
+		LineExtension: ublAmountOf(inv.LineTotal),
+		TaxExclusive:  ublAmountOf(inv.TaxBasisTotal),
+		TaxInclusive:  ublAmountOf(inv.GrandTotal),
+		Payable:       ublAmountOf(inv.DuePayable),
+	}
+	if !inv.AllowanceTotal.IsZero() {
+		doc.Totals.AllowanceTotal = ublAmountRef(inv.AllowanceTotal)
+	}
+	if !inv.ChargeTotal.IsZero() {
+		doc.Totals.ChargeTotal = ublAmountRef(inv.ChargeTotal)
+	}
+	if !inv.Prepaid.IsZero() {
+		doc.Totals.Prepaid = ublAmountRef(inv.Prepaid)
+	}
+
+	for _, line := range inv.Lines {
+		l := ublLine{
+			ID:            line.ID,
+			LineExtension: ublAmountOf(line.NetAmount),
+			Item: ublItem{
+				Name:     line.Name,
+				Category: *ublCategory(line.Category, line.TaxRate),
+			},
+			Price: ublPrice{Amount: ublAmountOf(line.UnitPrice)},
+		}
+		quantity := &ublQuantity{UnitCode: unitCode, Value: strconv.Itoa(line.Quantity)}
+		if !line.Discount.IsZero() {
+			l.AllowanceCharges = []ublAllowanceCharge{{
+				ChargeIndicator: false,
+				Reason:          "Discount",
+				Amount:          ublAmountOf(line.Discount),
+			}}
+		}
+		if inv.CreditNote {
+			l.CreditedQuantity = quantity
+			doc.CreditNoteLines = append(doc.CreditNoteLines, l)
+		} else {
+			l.InvoicedQuantity = quantity
+			doc.InvoiceLines = append(doc.InvoiceLines, l)
+		}
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+func ublPartyOf(p Party, seller bool) ublParty {
+	party := ublParty{
+		Address: ublAddress{
+			Street:  oneLine(p.Address),
+			Country: ublCountry{Code: p.CountryCode},
+		},
+		LegalEntity: ublLegalEntity{Name: p.Name, CompanyID: p.RegistrationNumber},
+	}
+	if scheme, id, err := ParticipantID(p.PeppolID); err == nil {
+		party.Endpoint = &ublSchemedID{Scheme: scheme, Value: id}
+	}
+	if p.TradingName != "" {
+		party.Name = &ublName{Name: p.TradingName}
+	}
+	// The buyer's tax ID is given only if it is a VAT identifier, and the
+	// seller's is otherwise a local tax registration
+	switch {
+	case p.VATNumber():
+		party.TaxScheme = &ublPartyTaxScheme{CompanyID: p.TaxID, TaxScheme: ublID{ID: "VAT"}}
+	case p.TaxID != "" && seller:
+		party.TaxScheme = &ublPartyTaxScheme{CompanyID: p.TaxID, TaxScheme: ublID{ID: "TAX"}}
+	}
+	if p.Phone != "" || p.Email != "" {
+		party.Contact = &ublContact{Telephone: p.Phone, Email: p.Email}
+	}
+	return party
+}
+
+func ublCategory(category string, rate tax.Rate) *ublTaxCategory {
+	return &ublTaxCategory{ID: category, Percent: percent(category, rate), TaxScheme: ublID{ID: "VAT"}}
+}
+
+func ublAmountOf(m money.Money) ublAmount {
+	return ublAmount{Currency: m.Currency, Value: m.String()}
+}
+
+func ublAmountRef(m money.Money) *ublAmount {
+	a := ublAmountOf(m)
+	return &a
+}
+
+// The UBL elements a Peppol invoice or credit note uses, in the order the
+// schema has them.
+type ublDocument struct {
+	XMLName            xml.Name
+	Namespace          string               `xml:"xmlns,attr"`
+	CAC                string               `xml:"xmlns:cac,attr"`
+	CBC                string               `xml:"xmlns:cbc,attr"`
+	CustomizationID    string               `xml:"cbc:CustomizationID"`
+	ProfileID          string               `xml:"cbc:ProfileID"`
+	ID                 string               `xml:"cbc:ID"`
+	IssueDate          string               `xml:"cbc:IssueDate"`
+	DueDate            string               `xml:"cbc:DueDate,omitempty"`
+	InvoiceTypeCode    string               `xml:"cbc:InvoiceTypeCode,omitempty"`
+	CreditNoteTypeCode string               `xml:"cbc:CreditNoteTypeCode,omitempty"`
+	Note               string               `xml:"cbc:Note,omitempty"`
+	Currency           string               `xml:"cbc:DocumentCurrencyCode"`
+	BuyerReference     string               `xml:"cbc:BuyerReference,omitempty"`
+	BillingReference   *ublBillingReference `xml:"cac:BillingReference"`
+	Seller             ublParty             `xml:"cac:AccountingSupplierParty>cac:Party"`
+	Buyer              ublParty             `xml:"cac:AccountingCustomerParty>cac:Party"`
+	PaymentMeans       *ublPaymentMeans     `xml:"cac:PaymentMeans"`
+	PaymentTerms       *ublPaymentTerms     `xml:"cac:PaymentTerms"`
+	AllowanceCharges   []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	TaxTotal           ublTaxTotal          `xml:"cac:TaxTotal"`
+	Totals             ublMonetaryTotal     `xml:"cac:LegalMonetaryTotal"`
+	InvoiceLines       []ublLine            `xml:"cac:InvoiceLine"`
+	CreditNoteLines    []ublLine            `xml:"cac:CreditNoteLine"`
+}
+
+type ublBillingReference struct {
+	Invoice *ublDocumentReference `xml:"cac:InvoiceDocumentReference"`
+}
+
+type ublDocumentReference struct {
+	ID        string `xml:"cbc:ID"`
+	IssueDate string `xml:"cbc:IssueDate,omitempty"`
+}
+
+type ublParty struct {
+	Endpoint    *ublSchemedID      `xml:"cbc:EndpointID"`
+	Name        *ublName           `xml:"cac:PartyName"`
+	Address     ublAddress         `xml:"cac:PostalAddress"`
+	TaxScheme   *ublPartyTaxScheme `xml:"cac:PartyTaxScheme"`
+	LegalEntity ublLegalEntity     `xml:"cac:PartyLegalEntity"`
+	Contact     *ublContact        `xml:"cac:Contact"`
+}
+
+type ublSchemedID struct {
+	Scheme string `xml:"schemeID,attr"`
+	Value  string `xml:",chardata"`
+}
+
+type ublName struct {
+	Name string `xml:"cbc:Name"`
+}
+
+type ublAddress struct {
+	Street  string     `xml:"cbc:StreetName,omitempty"`
+	Country ublCountry `xml:"cac:Country"`
+}
+
+type ublCountry struct {
+	Code string `xml:"cbc:IdentificationCode"`
+}
+
+type ublPartyTaxScheme struct {
+	CompanyID string `xml:"cbc:CompanyID"`
+	TaxScheme ublID  `xml:"cac:TaxScheme"`
+}
+
+type ublID struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublLegalEntity struct {
+	Name      string `xml:"cbc:RegistrationName"`
+	CompanyID string `xml:"cbc:CompanyID,omitempty"`
+}
+
+type ublContact struct {
+	Telephone string `xml:"cbc:Telephone,omitempty"`
+	Email     string `xml:"cbc:ElectronicMail,omitempty"`
+}
+
+type ublPaymentMeans struct {
+	Code      string      `xml:"cbc:PaymentMeansCode"`
+	PaymentID string      `xml:"cbc:PaymentID,omitempty"`
+	Account   *ublAccount `xml:"cac:PayeeFinancialAccount"`
+}
+
+type ublAccount struct {
+	ID     string `xml:"cbc:ID"`
+	Name   string `xml:"cbc:Name,omitempty"`
+	Branch *ublID `xml:"cac:FinancialInstitutionBranch"`
+}
+
+type ublPaymentTerms struct {
+	Note string `xml:"cbc:Note"`
+}
+
+type ublAllowanceCharge struct {
+	ChargeIndicator bool            `xml:"cbc:ChargeIndicator"`
+	Reason          string          `xml:"cbc:AllowanceChargeReason,omitempty"`
+	Amount          ublAmount       `xml:"cbc:Amount"`
+	Category        *ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublTaxCategory struct {
+	ID                  string `xml:"cbc:ID"`
+	Percent             string `xml:"cbc:Percent,omitempty"`
+	ExemptionReasonCode string `xml:"cbc:TaxExemptionReasonCode,omitempty"`
+	ExemptionReason     string `xml:"cbc:TaxExemptionReason,omitempty"`
+	TaxScheme           ublID  `xml:"cac:TaxScheme"`
+}
+
+type ublTaxTotal struct {
+	Amount    ublAmount        `xml:"cbc:TaxAmount"`
+	Subtotals []ublTaxSubtotal `xml:"cac:TaxSubtotal"`
+}
+
+type ublTaxSubtotal struct {
+	Taxable  ublAmount      `xml:"cbc:TaxableAmount"`
+	Tax      ublAmount      `xml:"cbc:TaxAmount"`
+	Category ublTaxCategory `xml:"cac:TaxCategory"`
+}
+
+type ublMonetaryTotal struct {
+	LineExtension  ublAmount  `xml:"cbc:LineExtensionAmount"`
+	TaxExclusive   ublAmount  `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusive   ublAmount  `xml:"cbc:TaxInclusiveAmount"`
+	AllowanceTotal *ublAmount `xml:"cbc:AllowanceTotalAmount"`
+	ChargeTotal    *ublAmount `xml:"cbc:ChargeTotalAmount"`
+	Prepaid        *ublAmount `xml:"cbc:PrepaidAmount"`
+	Payable        ublAmount  `xml:"cbc:PayableAmount"`
+}
+
+type ublAmount struct {
+	Currency string `xml:"currencyID,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublLine struct {
+	ID               string               `xml:"cbc:ID"`
+	InvoicedQuantity *ublQuantity         `xml:"cbc:InvoicedQuantity"`
+	CreditedQuantity *ublQuantity         `xml:"cbc:CreditedQuantity"`
+	LineExtension    ublAmount            `xml:"cbc:LineExtensionAmount"`
+	AllowanceCharges []ublAllowanceCharge `xml:"cac:AllowanceCharge"`
+	Item             ublItem              `xml:"cac:Item"`
+	Price            ublPrice             `xml:"cac:Price"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublItem struct {
+	Name     string         `xml:"cbc:Name"`
+	Category ublTaxCategory `xml:"cac:ClassifiedTaxCategory"`
+}
+
+type ublPrice struct {
+	Amount ublAmount `xml:"cbc:PriceAmount"`
+}
@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+)
+
+// Audited entities.
+const (
+	auditCustomer         = "customer"
+	auditProduct          = "product"
+	auditTaxCategory      = "tax_category"
+	auditExchangeRate     = "exchange_rate"
+	auditNumberSeries     = "number_series"
+	auditInvoice          = "invoice"
+	auditPayment          = "payment"
+	auditCreditNote       = "credit_note"
+	auditQuote            = "quote"
+	auditRecurringInvoice = "recurring_invoice"
+	auditUser             = "user"
+	auditAPIToken         = "api_token"
+	auditOrganization     = "organization"
+	auditCompany          = "company"
+	auditPDFTemplate      = "pdf_template"
+)
+
+// Actors for writes that are not made by a request.
+const (
+	actorScheduler = "scheduler"
+	actorSystem    = "system"
+)
+
+// Actions recorded for writes that are more than a plain update.
+const (
+	actionPay      = "pay"
+	actionCredit   = "credit"
+	actionConvert  = "convert"
+	actionExpire   = "expire"
+	actionPause    = "pause"
+	actionResume   = "resume"
+	actionGenerate = "generate"
+
+	actionChangePassword = "change_password"
+	actionDisable        = "disable"
+	actionRevoke         = "revoke"
+
+	actionAddMember    = "add_member"
+	actionRemoveMember = "remove_member"
+	actionSetRole      = "set_role"
+)
+
+// defaultAuditLimit and maxAuditLimit bound the events listed at once.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type auditChild struct {
+	key   string
+	table string
+}
+
+// auditEntity says where an entity is stored: its table and the tables of its
+// lines, which reference it by <entity>_id and are recorded under key.
+// Secret columns are left out of its snapshots.
+type auditEntity struct {
+	table    string
+	children []auditChild
+	secret   []string
+}
+
+var auditEntities = map[string]auditEntity{
+	auditCustomer:     {table: "customers"},
+	auditProduct:      {table: "products"},
+	auditTaxCategory:  {table: "tax_categories", children: []auditChild{{"rules", "tax_rules"}}},
+	auditExchangeRate: {table: "exchange_rates"},
+	auditNumberSeries: {table: "number_series"},
+	auditInvoice: {table: "invoices", children: []auditChild{
+		{"items", "invoice_items"}, {"adjustments", "invoice_adjustments"},
+	}},
+	auditPayment:    {table: "payments"},
+	auditCreditNote: {table: "credit_notes", children: []auditChild{{"items", "credit_note_items"}}},
+	auditQuote: {table: "quotes", children: []auditChild{
+		{"items", "quote_items"}, {"adjustments", "quote_adjustments"},
+	}},
+	auditRecurringInvoice: {table: "recurring_invoices", children: []auditChild{
+		{"items", "recurring_invoice_items"}, {"adjustments", "recurring_invoice_adjustments"},
+	}},
+	auditUser:         {table: "users", secret: []string{"password_hash"}},
+	auditAPIToken:     {table: "api_tokens", secret: []string{"token_hash"}},
+	auditOrganization: {table: "organizations", children: []auditChild{{"members", "organization_members"}}},
+	auditCompany:      {table: "company_profiles"},
+	auditPDFTemplate:  {table: "pdf_templates"},
+}
+
+// auditActor is who made a write, and the organization whose audit log it is
+// recorded in. organizationID is 0 for writes made outside any organization.
+type auditActor struct {
+	name           string
+	organizationID int
+}
+
+// actor says who made request r: the signed-in user's email, followed by the
+// API token's name when one was used, in the organization r works in.
+func actor(r *http.Request) auditActor {
+	p := currentPrincipal(r)
+	if p == nil {
+		return auditActor{name: "anonymous"}
+	}
+	if p.TokenID != 0 {
+		return auditActor{fmt.Sprintf("%s (token %s)", p.User.Email, p.TokenName), p.OrganizationID}
+	}
+	return auditActor{p.User.Email, p.OrganizationID}
+}
+
+// snapshot reads the stored row of an entity and its lines for the audit log.
+// It returns nil if there is no such entity.
+func snapshot(q querier, entity string, id int64) (map[string]interface{}, error) {
+	e := auditEntities[entity]
+	rows, err := selectRows(q, fmt.Sprintf("SELECT * FROM %s WHERE id = ?", e.table), id)
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+
+	row := rows[0]
+	for _, column := range e.secret {
+		delete(row, column)
+	}
+	for _, child := range e.children {
+		lines, err := selectRows(q, fmt.Sprintf("SELECT * FROM %s WHERE %s_id = ? ORDER BY id", child.table, entity), id)
+		if err != nil {
+			return nil, err
+		}
+		row[child.key] = lines
+	}
+	return row, nil
+}
+
+// selectRows reads every column of the rows a query returns.
+func selectRows(q querier, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// recordAudit records action on an entity in the audit log. before is the
+// entity's snapshot from before the write, or nil for a create; the snapshot
+// after it is read from tx, so the event commits or rolls back with the write.
+func recordAudit(tx *sql.Tx, actor auditActor, entity string, id int64, action string, before map[string]interface{}) error {
+	after, err := snapshot(tx, entity, id)
+	if err != nil {
+		return err
+	}
+
+	var beforeJSON, afterJSON interface{}
+	if before != nil {
+		b, err := json.Marshal(before)
+		if err != nil {
+			return err
+		}
+		beforeJSON = string(b)
+	}
+	if after != nil {
+		b, err := json.Marshal(after)
+		if err != nil {
+			return err
+		}
+		afterJSON = string(b)
+	}
+
+	var organizationID interface{}
+	if actor.organizationID != 0 {
+		organizationID = actor.organizationID
+	}
+
+	_, err = tx.Exec("INSERT INTO audit_events (organization_id, actor, entity, entity_id, action, before_json, after_json) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		organizationID, actor.name, entity, id, action, beforeJSON, afterJSON)
+	return err
+}
+
+// execAudited runs a statement that writes one entity and records it in the
+// audit log, in a single transaction. id is 0 for an insert, whose new ID is
+// returned. It returns sql.ErrNoRows if the statement changes nothing.
+func (h *Handler) execAudited(r *http.Request, entity string, id int64, action string, query string, args ...interface{}) (int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	var before map[string]interface{}
+	if id != 0 {
+		if before, err = snapshot(tx, entity, id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return 0, sql.ErrNoRows
+	}
+	if id == 0 {
+		id, _ = result.LastInsertId()
+	}
+
+	if err := recordAudit(tx, actor(r), entity, id, action, before); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// upsertAudited runs an insert that may instead update the row found by
+// lookup, and records it in the audit log as a create or an update, in a
+// single transaction. It returns the row's ID.
+func (h *Handler) upsertAudited(r *http.Request, entity, lookup string, key []interface{}, query string, args ...interface{}) (int64, error) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	action := models.AuditCreate
+	var id int64
+	var before map[string]interface{}
+	err = tx.QueryRow(lookup, key...).Scan(&id)
+	if err == nil {
+		action = models.AuditUpdate
+		before, err = snapshot(tx, entity, id)
+	} else if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if _, err := tx.Exec(query, args...); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if action == models.AuditCreate {
+		if err := tx.QueryRow(lookup, key...).Scan(&id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err := recordAudit(tx, actor(r), entity, id, action, before); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// auditChanges lists the top-level fields that differ between two snapshots.
+func auditChanges(before, after json.RawMessage) (map[string]models.AuditChange, error) {
+	var b, a map[string]json.RawMessage
+	if before != nil {
+		if err := json.Unmarshal(before, &b); err != nil {
+			return nil, err
+		}
+	}
+	if after != nil {
+		if err := json.Unmarshal(after, &a); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]models.AuditChange{}
+	for field, value := range a {
+		if old, ok := b[field]; !ok || !bytes.Equal(old, value) {
+			changes[field] = models.AuditChange{Before: b[field], After: value}
+		}
+	}
+	for field, old := range b {
+		if _, ok := a[field]; !ok {
+			changes[field] = models.AuditChange{Before: old}
+		}
+	}
+	return changes, nil
+}
+
+// GetAuditEvents lists the organization's audit events, newest first. They
+// can be filtered by ?entity= and, with it, ?id=, and by ?actor=; ?limit=
+// caps how many are returned.
+func (h *Handler) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	entity := query.Get("entity")
+	if entity != "" {
+		if _, ok := auditEntities[entity]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown audit entity %q", entity), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var id int
+	if s := query.Get("id"); s != "" {
+		if entity == "" {
+			http.Error(w, "An id filter requires an entity", http.StatusBadRequest)
+			return
+		}
+		var err error
+		if id, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "Invalid entity ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	h.writeAuditEvents(w, r, entity, id)
+}
+
+// GetCustomerHistory lists the audit events for a customer.
+func (h *Handler) GetCustomerHistory(w http.ResponseWriter, r *http.Request) {
+	h.writeEntityHistory(w, r, auditCustomer, "Invalid customer ID")
+}
+
+// GetProductHistory lists the audit events for a product.
+func (h *Handler) GetProductHistory(w http.ResponseWriter, r *http.Request) {
+	h.writeEntityHistory(w, r, auditProduct, "Invalid product ID")
+}
+
+// GetInvoiceHistory lists the audit events for an invoice.
+func (h *Handler) GetInvoiceHistory(w http.ResponseWriter, r *http.Request) {
+	h.writeEntityHistory(w, r, auditInvoice, "Invalid invoice ID")
+}
+
+func (h *Handler) writeEntityHistory(w http.ResponseWriter, r *http.Request, entity, invalidID string) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, invalidID, http.StatusBadRequest)
+		return
+	}
+	h.writeAuditEvents(w, r, entity, id)
+}
+
+// writeAuditEvents responds with the events for an entity, or all entities if
+// it is empty, and for one of its IDs unless id is 0.
+func (h *Handler) writeAuditEvents(w http.ResponseWriter, r *http.Request, entity string, id int) {
+	limit := defaultAuditLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			http.Error(w, fmt.Sprintf("Limit must be between 1 and %d", maxAuditLimit), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	where := "WHERE organization_id = ?"
+	args := []interface{}{organizationID(r)}
+	if entity != "" {
+		where += " AND entity = ?"
+		args = append(args, entity)
+	}
+	if id != 0 {
+		where += " AND entity_id = ?"
+		args = append(args, id)
+	}
+	if a := r.URL.Query().Get("actor"); a != "" {
+		where += " AND actor = ?"
+		args = append(args, a)
+	}
+	args = append(args, limit)
+
+	rows, err := h.db.Query(`
+		SELECT id, actor, entity, entity_id, action, before_json, after_json, created_at
+		FROM audit_events `+where+`
+		ORDER BY id DESC LIMIT ?
+	`, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	events := []models.AuditEvent{}
+	for rows.Next() {
+		var e models.AuditEvent
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Entity, &e.EntityID, &e.Action, &before, &after, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		if e.Changes, err = auditChanges(e.Before, e.After); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"invoice-app/auth"
+	"invoice-app/models"
+)
+
+// auditRouter is invoiceRouter with the routes that change customers and
+// products and the one that lists the audit log, as main.go registers them.
+func auditRouter(h *Handler) *mux.Router {
+	r := invoiceRouter(h)
+	r.HandleFunc("/api/customers/{id}", h.Require(auth.EditCustomers, h.UpdateCustomer)).Methods("PUT")
+	r.HandleFunc("/api/customers/{id}", h.Require(auth.DeleteCustomers, h.DeleteCustomer)).Methods("DELETE")
+	r.HandleFunc("/api/products/{id}", h.Require(auth.EditProducts, h.UpdateProduct)).Methods("PUT")
+	r.HandleFunc("/api/products/{id}", h.Require(auth.DeleteProducts, h.DeleteProduct)).Methods("DELETE")
+	r.HandleFunc("/api/audit", h.Require(auth.ViewAudit, h.GetAuditEvents)).Methods("GET")
+	return r
+}
+
+// auditEvents lists an entity's audit events as the admin, newest first.
+func auditEvents(t *testing.T, router http.Handler, entity string, id int) []models.AuditEvent {
+	t.Helper()
+	w := serveAs(router, "admin-session", "1", "GET", fmt.Sprintf("/api/audit?entity=%s&id=%d", entity, id), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("listing the audit log: got %d %q", w.Code, w.Body.String())
+	}
+	var events []models.AuditEvent
+	if err := json.NewDecoder(w.Body).Decode(&events); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// snapshotField finds a field of a snapshot by a dotted path, such as
+// "items.0.quantity", and gives it as text, or "" if it is not there.
+func snapshotField(snapshot json.RawMessage, path string) string {
+	var value interface{}
+	if err := json.Unmarshal(snapshot, &value); err != nil {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i >= len(v) {
+				return ""
+			}
+			value = v[i]
+		default:
+			return ""
+		}
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func TestAuditSnapshots(t *testing.T) {
+	// Each write is made with customer 1, product 1 and, if invoice is set,
+	// an invoice for 3 of it less 1.00 coming to 34.80; path has the
+	// invoice's ID and then its line's
+	for _, tt := range []struct {
+		name         string
+		invoice      string // "draft" or "finalized", or "" for none
+		method, path string
+		body         string
+		entity       string
+		action       string // recorded, or "" if the write is refused and nothing is
+		before       map[string]string
+		after        map[string]string // nil if there is nothing after
+		changes      []string
+	}{
+		{
+			name:   "update customer",
+			method: "PUT", path: "/api/customers/1",
+			body:   `{"name": "Acme Ltd", "phone": "5551234", "address": "1 Main St", "country": "Germany"}`,
+			entity: auditCustomer, action: models.AuditUpdate,
+			before:  map[string]string{"name": "Acme", "address": "1 Main St"},
+			after:   map[string]string{"name": "Acme Ltd", "address": "1 Main St"},
+			changes: []string{"name"},
+		},
+		{
+			name:   "delete customer",
+			method: "DELETE", path: "/api/customers/1",
+			entity: auditCustomer, action: models.AuditDelete,
+			before: map[string]string{"name": "Acme", "country": "Germany"},
+		},
+		{
+			name:   "update product price",
+			method: "PUT", path: "/api/products/1",
+			body:   `{"name": "Support", "price": 12.5, "tax_category_id": 1}`,
+			entity: auditProduct, action: models.AuditUpdate,
+			before:  map[string]string{"name": "Support", "price": "1000"},
+			after:   map[string]string{"name": "Support", "price": "1250"},
+			changes: []string{"price"},
+		},
+		{
+			name:   "delete product",
+			method: "DELETE", path: "/api/products/1",
+			entity: auditProduct, action: models.AuditDelete,
+			before: map[string]string{"name": "Support", "price": "1000"},
+		},
+		{
+			// The invoice's lines are part of its snapshots
+			name:    "edit draft invoice line",
+			invoice: "draft",
+			method:  "PUT", path: "/api/invoices/%d/items/%d",
+			body:   `{"quantity": 1}`,
+			entity: auditInvoice, action: models.AuditUpdate,
+			before:  map[string]string{"status": "draft", "total_price": "3480", "items.0.quantity": "3"},
+			after:   map[string]string{"status": "draft", "total_price": "1080", "items.0.quantity": "1"},
+			changes: []string{"adjustments", "base_total", "items", "subtotal", "tax_total", "total_price"},
+		},
+		{
+			name:    "edit finalized invoice line",
+			invoice: "finalized",
+			method:  "PUT", path: "/api/invoices/%d/items/%d",
+			body:   `{"quantity": 1}`,
+			entity: auditInvoice,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			seedInvoicing(t, db)
+			router := auditRouter(New(db, nil))
+
+			id, path := 1, tt.path
+			if tt.invoice != "" {
+				id = issueInvoice(t, router, tt.invoice == "draft")
+				path = fmt.Sprintf(tt.path, id, getInvoice(t, router, id).Items[0].ID)
+			}
+			earlier := auditEvents(t, router, tt.entity, id)
+
+			w := serveAs(router, "admin-session", "1", tt.method, path, tt.body)
+			events := auditEvents(t, router, tt.entity, id)
+			if tt.action == "" {
+				if w.Code < 400 || len(events) != len(earlier) {
+					t.Fatalf("got %d and %d new events, want the write refused and none", w.Code, len(events)-len(earlier))
+				}
+				return
+			}
+			if w.Code >= 300 || len(events) != len(earlier)+1 {
+				t.Fatalf("got %d %q and %d new events, want 1", w.Code, w.Body.String(), len(events)-len(earlier))
+			}
+
+			e := events[0]
+			if e.Action != tt.action || e.Actor != "admin@example.com" {
+				t.Errorf("got %s by %s, want %s by admin@example.com", e.Action, e.Actor, tt.action)
+			}
+			for field, want := range tt.before {
+				if got := snapshotField(e.Before, field); got != want {
+					t.Errorf("before: %s is %q, want %q", field, got, want)
+				}
+			}
+			if tt.after == nil {
+				if string(e.After) != "null" && e.After != nil {
+					t.Errorf("after is %s, want nothing", e.After)
+				}
+			}
+			for field, want := range tt.after {
+				if got := snapshotField(e.After, field); got != want {
+					t.Errorf("after: %s is %q, want %q", field, got, want)
+				}
+			}
+			if tt.changes != nil {
+				var changed []string
+				for field := range e.Changes {
+					changed = append(changed, field)
+				}
+				sort.Strings(changed)
+				if strings.Join(changed, " ") != strings.Join(tt.changes, " ") {
+					t.Errorf("changed %v, want %v", changed, tt.changes)
+				}
+			}
+		})
+	}
+}
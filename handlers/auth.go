@@ -0,0 +1,745 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/auth"
+	"invoice-app/models"
+)
+
+const (
+	sessionCookie   = "invoice_session"
+	sessionLifetime = 24 * time.Hour
+
+	// tokenUseInterval is how often an API token's last_used_at is updated.
+	tokenUseInterval = time.Minute
+)
+
+// publicPaths are the API paths that can be called without signing in.
+var publicPaths = map[string]bool{
+	"/api/auth/login": true,
+}
+
+// sessionOnlyResources manage accounts and API tokens, so API tokens cannot
+// reach them whatever their scopes.
+var sessionOnlyResources = map[string]bool{
+	"auth":          true,
+	"users":         true,
+	"organizations": true,
+}
+
+// principal is who a request is made by: a signed-in user, or a user's API
+// token limited to Scopes. OrganizationID is the organization the request
+// works in, or 0 if the user is not a member of any, and User.Role is the
+// user's role there.
+type principal struct {
+	User           models.User
+	SessionID      int
+	TokenID        int
+	TokenName      string
+	Scopes         []string
+	OrganizationID int
+}
+
+type contextKey int
+
+const principalKey contextKey = 0
+
+// currentPrincipal returns who made r, or nil for a public path.
+func currentPrincipal(r *http.Request) *principal {
+	p, _ := r.Context().Value(principalKey).(*principal)
+	return p
+}
+
+// apiResource names the resource an API path belongs to, such as "invoices"
+// for /api/invoices/1/pdf.
+func apiResource(path string) string {
+	resource := strings.TrimPrefix(path, "/api/")
+	if i := strings.IndexByte(resource, '/'); i >= 0 {
+		resource = resource[:i]
+	}
+	return resource
+}
+
+// Authenticate is router middleware that rejects API requests without a
+// valid session cookie or API token, and those outside a token's scopes. It
+// also resolves the organization the request works in. Static files and
+// publicPaths are served to anyone.
+func (h *Handler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := h.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if p == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="invoice-app"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		if p.TokenID != 0 {
+			resource := apiResource(r.URL.Path)
+			write := r.Method != http.MethodGet && r.Method != http.MethodHead
+			if sessionOnlyResources[resource] {
+				forbidden(w, models.ForbiddenError{
+					Error:  "API tokens cannot manage accounts or tokens; sign in instead",
+					Reason: models.ForbiddenToken,
+				})
+				return
+			}
+			if !auth.Allows(p.Scopes, resource, write) {
+				access := auth.Read
+				if write {
+					access = auth.Write
+				}
+				scope := resource + ":" + access
+				forbidden(w, models.ForbiddenError{
+					Error:  fmt.Sprintf("API token lacks the %s scope", scope),
+					Reason: models.ForbiddenTokenScope,
+					Scope:  scope,
+				})
+				return
+			}
+		}
+
+		if p.OrganizationID, p.User.Role, err = h.resolveOrganization(r, p.User.ID); err != nil {
+			if err == errNotMember {
+				forbidden(w, models.ForbiddenError{
+					Error:  "You are not a member of this organization",
+					Reason: models.ForbiddenOrganization,
+				})
+			} else if _, ok := err.(requestError); ok {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey, p)))
+	})
+}
+
+// Require wraps a route's handler so that only users whose role grants
+// permission reach it, working in an organization. Every API route
+// registered in main.go is wrapped, so what each role may do can be read off
+// the routes.
+func (h *Handler) Require(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := currentPrincipal(r)
+		if p != nil && p.OrganizationID == 0 {
+			forbidden(w, models.ForbiddenError{
+				Error:  "You are not a member of any organization",
+				Reason: models.ForbiddenNoOrganization,
+			})
+			return
+		}
+		if p == nil || !auth.Can(p.User.Role, permission) {
+			role := ""
+			if p != nil {
+				role = p.User.Role
+			}
+			forbidden(w, models.ForbiddenError{
+				Error:      fmt.Sprintf("The %s role does not have the %s permission", role, permission),
+				Reason:     models.ForbiddenRole,
+				Permission: permission,
+				Role:       role,
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// forbidden refuses a request with 403 Forbidden and a JSON body giving the
+// reason.
+func forbidden(w http.ResponseWriter, body models.ForbiddenError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(body)
+}
+
+// authenticate finds who made r from its bearer token or session cookie. It
+// returns nil if neither is valid.
+func (h *Handler) authenticate(r *http.Request) (*principal, error) {
+	now := time.Now().UTC()
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return nil, nil
+		}
+
+		p := &principal{}
+		var scopes string
+		var expiresAt, lastUsedAt, revokedAt *time.Time
+		err := h.db.QueryRow(`
+			SELECT t.id, t.name, t.scopes, t.expires_at, t.last_used_at, t.revoked_at,
+			       u.id, u.email, u.name, u.created_at, u.disabled_at
+			FROM api_tokens t
+			JOIN users u ON t.user_id = u.id
+			WHERE t.token_hash = ?
+		`, auth.HashToken(strings.TrimSpace(token))).
+			Scan(&p.TokenID, &p.TokenName, &scopes, &expiresAt, &lastUsedAt, &revokedAt,
+				&p.User.ID, &p.User.Email, &p.User.Name, &p.User.CreatedAt, &p.User.DisabledAt)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if revokedAt != nil || expiresAt != nil && !now.Before(*expiresAt) || p.User.DisabledAt != nil {
+			return nil, nil
+		}
+		p.Scopes = strings.Fields(scopes)
+
+		if lastUsedAt == nil || now.Sub(*lastUsedAt) >= tokenUseInterval {
+			if _, err := h.db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", now, p.TokenID); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return nil, nil
+	}
+
+	p := &principal{}
+	var expiresAt time.Time
+	err = h.db.QueryRow(`
+		SELECT s.id, s.expires_at, u.id, u.email, u.name, u.created_at, u.disabled_at
+		FROM sessions s
+		JOIN users u ON s.user_id = u.id
+		WHERE s.token_hash = ?
+	`, auth.HashToken(cookie.Value)).
+		Scan(&p.SessionID, &expiresAt, &p.User.ID, &p.User.Email, &p.User.Name, &p.User.CreatedAt, &p.User.DisabledAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(expiresAt) || p.User.DisabledAt != nil {
+		return nil, nil
+	}
+	return p, nil
+}
+
+// secureRequest reports whether r reached the server over HTTPS, directly or
+// through a proxy, so session cookies can be marked Secure.
+func secureRequest(r *http.Request) bool {
+	return r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
+}
+
+// Login checks an email and password and starts a session, set as an
+// HttpOnly cookie.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var u models.User
+	var passwordHash string
+	err := h.db.QueryRow("SELECT id, email, name, password_hash, created_at, disabled_at FROM users WHERE email = ?",
+		strings.TrimSpace(req.Email)).Scan(&u.ID, &u.Email, &u.Name, &passwordHash, &u.CreatedAt, &u.DisabledAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Unknown accounts take as long to reject as wrong passwords
+	if err == sql.ErrNoRows {
+		auth.CheckNoPassword(req.Password)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+	if !auth.CheckPassword(passwordHash, req.Password) || u.DisabledAt != nil {
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := auth.NewToken("")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC()
+	expiresAt := now.Add(sessionLifetime)
+	if _, err := h.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", now); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.db.Exec("INSERT INTO sessions (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+		u.ID, auth.HashToken(token), expiresAt); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// Logout ends the current session and clears its cookie.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	p := currentPrincipal(r)
+	if _, err := h.db.Exec("DELETE FROM sessions WHERE id = ?", p.SessionID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureRequest(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetCurrentUser returns the signed-in user.
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	p := currentPrincipal(r)
+	u := p.User
+	u.Permissions = auth.Permissions(u.Role)
+	u.OrganizationID = p.OrganizationID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// ChangePassword sets a new password for the signed-in user and ends their
+// other sessions.
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p := currentPrincipal(r)
+	var passwordHash string
+	if err := h.db.QueryRow("SELECT password_hash FROM users WHERE id = ?", p.User.ID).Scan(&passwordHash); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !auth.CheckPassword(passwordHash, req.CurrentPassword) {
+		http.Error(w, "Current password is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	newHash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Invalid new password: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	before, err := snapshot(tx, auditUser, int64(p.User.ID))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = ? WHERE id = ?", newHash, p.User.ID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ? AND id != ?", p.User.ID, p.SessionID); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The hash is left out of audit snapshots, so only the action is recorded
+	if err := recordAudit(tx, actor(r), auditUser, int64(p.User.ID), actionChangePassword, before); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetUsers lists the members of the organization the request works in, with
+// their roles there.
+func (h *Handler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT u.id, u.email, u.name, m.role, u.created_at, u.disabled_at
+		FROM users u
+		JOIN organization_members m ON m.user_id = u.id
+		WHERE m.organization_id = ?
+		ORDER BY u.email
+	`, organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		if err := rows.Scan(&u.ID, &u.Email, &u.Name, &u.Role, &u.CreatedAt, &u.DisabledAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		users = append(users, u)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// CreateUser adds a user as a member of the organization the request works
+// in, with a role there. AddOrganizationMember gives them access to others.
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := models.User{Email: strings.TrimSpace(req.Email), Name: strings.TrimSpace(req.Name), Role: req.Role}
+	if !strings.Contains(u.Email, "@") {
+		http.Error(w, "A valid email address is required", http.StatusBadRequest)
+		return
+	}
+	if err := auth.ParseRole(u.Role); err != nil {
+		http.Error(w, "Invalid role: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", u.Email).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "A user with this email already exists", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		http.Error(w, "Invalid password: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO users (email, name, password_hash) VALUES (?, ?, ?)", u.Email, u.Name, passwordHash)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)",
+		organizationID(r), id, u.Role); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditUser, id, models.AuditCreate, nil); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	u.ID = int(id)
+	u.CreatedAt = time.Now()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(u)
+}
+
+// SetUserRole changes what a member of the organization the request works in
+// may do there. Their roles in other organizations are left alone; the change
+// takes effect on their next request.
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SetUserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := auth.ParseRole(req.Role); err != nil {
+		http.Error(w, "Invalid role: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Admins could otherwise lock every admin out by mistake
+	if id == currentPrincipal(r).User.ID {
+		http.Error(w, "You cannot change your own role", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditOrganization, int64(organizationID(r)), actionSetRole,
+		"UPDATE organization_members SET role = ? WHERE organization_id = ? AND user_id = ?",
+		req.Role, organizationID(r), id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// DisableUser stops a user from signing in, ending their sessions and
+// revoking their API tokens. Accounts reach every organization they are a
+// member of, so only users who are members of the organization the request
+// works in and of no other can be disabled; RemoveOrganizationMember takes
+// away others' access. Users are kept for the audit log rather than deleted.
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if id == currentPrincipal(r).User.ID {
+		http.Error(w, "You cannot disable your own account", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	role, err := memberRole(tx, organizationID(r), id)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var others int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM organization_members WHERE user_id = ? AND organization_id != ?",
+		id, organizationID(r)).Scan(&others); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	before, err := snapshot(tx, auditUser, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if before == nil || role == "" {
+		tx.Rollback()
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if others > 0 {
+		tx.Rollback()
+		http.Error(w, "User is also a member of other organizations; remove them from this one instead", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE users SET disabled_at = COALESCE(disabled_at, ?) WHERE id = ?", now, id); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", id); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("UPDATE api_tokens SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", now, id); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditUser, int64(id), actionDisable, before); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetAPITokens lists the signed-in user's API tokens, without their secrets.
+func (h *Handler) GetAPITokens(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query(`
+		SELECT id, name, scopes, expires_at, last_used_at, revoked_at, created_at
+		FROM api_tokens WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, currentPrincipal(r).User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	tokens := []models.APIToken{}
+	for rows.Next() {
+		var t models.APIToken
+		var scopes string
+		if err := rows.Scan(&t.ID, &t.Name, &scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		t.Scopes = strings.Fields(scopes)
+		tokens = append(tokens, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+// CreateAPIToken issues an API token for the signed-in user. The secret is
+// in the response and cannot be retrieved again.
+func (h *Handler) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateAPITokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t := models.APIToken{Name: strings.TrimSpace(req.Name), Scopes: req.Scopes, CreatedAt: time.Now()}
+	if t.Name == "" {
+		http.Error(w, "API token name is required", http.StatusBadRequest)
+		return
+	}
+	if len(t.Scopes) == 0 {
+		http.Error(w, "API token needs at least one scope", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range t.Scopes {
+		if err := auth.ParseScope(scope); err != nil {
+			http.Error(w, "Invalid scope: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 {
+			http.Error(w, "expires_in_days must be at least 1", http.StatusBadRequest)
+			return
+		}
+		expiresAt := time.Now().UTC().AddDate(0, 0, *req.ExpiresInDays)
+		t.ExpiresAt = &expiresAt
+	}
+
+	var err error
+	t.Token, err = auth.NewToken(auth.APITokenPrefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := h.execAudited(r, auditAPIToken, 0, models.AuditCreate,
+		"INSERT INTO api_tokens (user_id, name, token_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?)",
+		currentPrincipal(r).User.ID, t.Name, auth.HashToken(t.Token), strings.Join(t.Scopes, " "), t.ExpiresAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.ID = int(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// RevokeAPIToken revokes one of the signed-in user's API tokens.
+func (h *Handler) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid API token ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.execAudited(r, auditAPIToken, int64(id), actionRevoke,
+		"UPDATE api_tokens SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND user_id = ?",
+		time.Now().UTC(), id, currentPrincipal(r).User.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "API token not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
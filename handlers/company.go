@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+	"invoice-app/einvoice"
+	"invoice-app/models"
+)
+
+// logoDir holds uploaded logos, one file per organization.
+const logoDir = "./uploads/logos"
+
+// maxLogoSize bounds an uploaded logo in bytes.
+const maxLogoSize = 1 << 20
+
+// logoExtensions are the image types a logo may be, which are those gofpdf
+// can print, with the extension they are stored under.
+var logoExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+}
+
+var bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+
+// companyProfile reads an organization's company profile, and the path of
+// its logo or "" if it has none. Organizations that have not set one up get
+// an empty profile.
+func companyProfile(q rowQuerier, organizationID int) (*models.CompanyProfile, string, error) {
+	c := &models.CompanyProfile{}
+	var logoFile sql.NullString
+	err := q.QueryRow(`
+		SELECT legal_name, trading_name, address, country, tax_id, registration_number, email, phone, website,
+		       bank_name, account_holder, iban, bic, payment_instructions, peppol_id, logo_file, updated_at
+		FROM company_profiles WHERE organization_id = ?
+	`, organizationID).Scan(&c.LegalName, &c.TradingName, &c.Address, &c.Country, &c.TaxID, &c.RegistrationNumber, &c.Email, &c.Phone, &c.Website,
+		&c.BankName, &c.AccountHolder, &c.IBAN, &c.BIC, &c.PaymentInstructions, &c.PeppolID, &logoFile, &c.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return c, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !logoFile.Valid {
+		return c, "", nil
+	}
+	c.HasLogo = true
+	return c, filepath.Join(logoDir, logoFile.String), nil
+}
+
+// validIBAN checks an IBAN, without spaces and in upper case, by its length
+// and ISO 13616 check digits.
+func validIBAN(iban string) error {
+	if len(iban) < 15 || len(iban) > 34 {
+		return fmt.Errorf("IBAN must be 15 to 34 characters")
+	}
+	for i, c := range iban {
+		letter := c >= 'A' && c <= 'Z'
+		digit := c >= '0' && c <= '9'
+		if (i < 2 && !letter) || (i >= 2 && i < 4 && !digit) || (!letter && !digit) {
+			return fmt.Errorf("IBAN must be a country code, two check digits and letters or digits")
+		}
+	}
+
+	// Moving the first four characters to the end and reading letters as
+	// 10 to 35 leaves a number that is 1 modulo 97
+	var digits strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			fmt.Fprintf(&digits, "%d", c-'A'+10)
+		} else {
+			digits.WriteRune(c)
+		}
+	}
+	n, _ := new(big.Int).SetString(digits.String(), 10)
+	if new(big.Int).Mod(n, big.NewInt(97)).Int64() != 1 {
+		return fmt.Errorf("IBAN check digits do not match")
+	}
+	return nil
+}
+
+// formatIBAN writes an IBAN in groups of four, as it is usually printed.
+func formatIBAN(iban string) string {
+	var groups []string
+	for len(iban) > 4 {
+		groups = append(groups, iban[:4])
+		iban = iban[4:]
+	}
+	return strings.Join(append(groups, iban), " ")
+}
+
+// GetCompany returns the company profile of the organization the request
+// works in.
+func (h *Handler) GetCompany(w http.ResponseWriter, r *http.Request) {
+	c, _, err := companyProfile(h.db, organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// UpdateCompany replaces the company profile's details. The logo is kept;
+// it is changed through UploadCompanyLogo.
+func (h *Handler) UpdateCompany(w http.ResponseWriter, r *http.Request) {
+	var c models.CompanyProfile
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, field := range []*string{&c.LegalName, &c.TradingName, &c.Address, &c.Country, &c.TaxID, &c.RegistrationNumber,
+		&c.Email, &c.Phone, &c.Website, &c.BankName, &c.AccountHolder, &c.PaymentInstructions, &c.PeppolID} {
+		*field = strings.TrimSpace(*field)
+	}
+	// IBANs are often written in groups of four
+	c.IBAN = strings.ToUpper(strings.Join(strings.Fields(c.IBAN), ""))
+	c.BIC = strings.ToUpper(strings.TrimSpace(c.BIC))
+
+	if c.LegalName == "" {
+		http.Error(w, "Legal name is required", http.StatusBadRequest)
+		return
+	}
+	if c.Email != "" && !strings.Contains(c.Email, "@") {
+		http.Error(w, "Email must be a valid email address", http.StatusBadRequest)
+		return
+	}
+	if c.IBAN != "" {
+		if err := validIBAN(c.IBAN); err != nil {
+			http.Error(w, "Invalid IBAN: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if c.BIC != "" && !bicPattern.MatchString(c.BIC) {
+		http.Error(w, "BIC must be 8 or 11 letters and digits", http.StatusBadRequest)
+		return
+	}
+	if c.PeppolID != "" {
+		if _, _, err := einvoice.ParticipantID(c.PeppolID); err != nil {
+			http.Error(w, "Invalid Peppol ID: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err := h.upsertAudited(r, auditCompany, "SELECT id FROM company_profiles WHERE organization_id = ?",
+		[]interface{}{organizationID(r)}, `
+		INSERT INTO company_profiles (organization_id, legal_name, trading_name, address, country, tax_id, registration_number,
+			email, phone, website, bank_name, account_holder, iban, bic, payment_instructions, peppol_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (organization_id) DO UPDATE SET legal_name = excluded.legal_name, trading_name = excluded.trading_name,
+			address = excluded.address, country = excluded.country, tax_id = excluded.tax_id,
+			registration_number = excluded.registration_number, email = excluded.email, phone = excluded.phone,
+			website = excluded.website, bank_name = excluded.bank_name, account_holder = excluded.account_holder,
+			iban = excluded.iban, bic = excluded.bic, payment_instructions = excluded.payment_instructions,
+			peppol_id = excluded.peppol_id, updated_at = CURRENT_TIMESTAMP
+	`, organizationID(r), c.LegalName, c.TradingName, c.Address, c.Country, c.TaxID, c.RegistrationNumber,
+		c.Email, c.Phone, c.Website, c.BankName, c.AccountHolder, c.IBAN, c.BIC, c.PaymentInstructions, c.PeppolID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.GetCompany(w, r)
+}
+
+// UploadCompanyLogo stores the PNG or JPEG image in the multipart form field
+// "logo" as the organization's logo, replacing any earlier one.
+func (h *Handler) UploadCompanyLogo(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxLogoSize+64<<10)
+	file, _, err := r.FormFile("logo")
+	if err != nil {
+		http.Error(w, "Upload the logo as the multipart form field \"logo\" of at most 1 MB", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxLogoSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > maxLogoSize {
+		http.Error(w, "Logo must be at most 1 MB", http.StatusBadRequest)
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := logoExtensions[contentType]
+	if !ok {
+		http.Error(w, "Logo must be a PNG or JPEG image", http.StatusBadRequest)
+		return
+	}
+
+	// Check now that the image can be printed, rather than when a PDF is
+	// next generated; gofpdf cannot read interlaced PNGs, for one
+	check := gofpdf.New("P", "mm", "A4", "")
+	check.RegisterImageOptionsReader("logo", gofpdf.ImageOptions{ImageType: ext[1:]}, bytes.NewReader(data))
+	if err := check.Error(); err != nil {
+		http.Error(w, "Logo cannot be printed: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, oldPath, err := companyProfile(h.db, organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	name := fmt.Sprintf("organization-%d%s", organizationID(r), ext)
+	if err := writeFileAtomic(filepath.Join(logoDir, name), data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.upsertAudited(r, auditCompany, "SELECT id FROM company_profiles WHERE organization_id = ?",
+		[]interface{}{organizationID(r)}, `
+		INSERT INTO company_profiles (organization_id, logo_file, logo_content_type) VALUES (?, ?, ?)
+		ON CONFLICT (organization_id) DO UPDATE SET logo_file = excluded.logo_file,
+			logo_content_type = excluded.logo_content_type, updated_at = CURRENT_TIMESTAMP
+	`, organizationID(r), name, contentType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A logo of the other type was stored under another name
+	if oldPath != "" && oldPath != filepath.Join(logoDir, name) {
+		os.Remove(oldPath)
+	}
+
+	h.GetCompany(w, r)
+}
+
+// writeFileAtomic writes data to path through a temporary file, so readers
+// never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// GetCompanyLogo serves the organization's logo.
+func (h *Handler) GetCompanyLogo(w http.ResponseWriter, r *http.Request) {
+	var logoFile, contentType sql.NullString
+	err := h.db.QueryRow("SELECT logo_file, logo_content_type FROM company_profiles WHERE organization_id = ?", organizationID(r)).
+		Scan(&logoFile, &contentType)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !logoFile.Valid {
+		http.Error(w, "No logo has been uploaded", http.StatusNotFound)
+		return
+	}
+
+	data, err := os.ReadFile(filepath.Join(logoDir, logoFile.String))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Logo file is missing; upload it again", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType.String)
+	w.Write(data)
+}
+
+// DeleteCompanyLogo removes the organization's logo.
+func (h *Handler) DeleteCompanyLogo(w http.ResponseWriter, r *http.Request) {
+	var id int64
+	var logoFile sql.NullString
+	err := h.db.QueryRow("SELECT id, logo_file FROM company_profiles WHERE organization_id = ?", organizationID(r)).
+		Scan(&id, &logoFile)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !logoFile.Valid {
+		http.Error(w, "No logo has been uploaded", http.StatusNotFound)
+		return
+	}
+
+	_, err = h.execAudited(r, auditCompany, id, models.AuditUpdate,
+		"UPDATE company_profiles SET logo_file = NULL, logo_content_type = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND logo_file IS NOT NULL", id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "No logo has been uploaded", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := os.Remove(filepath.Join(logoDir, logoFile.String)); err != nil && !os.IsNotExist(err) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,527 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// defaultCreditNoteSeries numbers credit notes created without an explicit
+// series.
+const defaultCreditNoteSeries = "credit_note"
+
+// creditableItem is an invoice item with what its earlier credit notes have
+// already credited.
+type creditableItem struct {
+	models.InvoiceItem
+	creditedQuantity int
+	creditedDiscount money.Money
+	creditedAdjust   money.Money
+	creditedTax      money.Money
+}
+
+func (c creditableItem) remaining() int {
+	return c.Quantity - c.creditedQuantity
+}
+
+// credit returns the credit note item for quantity more of c. Amounts are
+// shares of the invoice item's, computed on the cumulative quantity credited
+// so that crediting every unit reverses the item exactly.
+func (c creditableItem) credit(quantity int) models.CreditNoteItem {
+	after := int64(c.creditedQuantity + quantity)
+	share := func(full, credited money.Money) money.Money {
+		return full.MulRatio(after, int64(c.Quantity)).Sub(credited)
+	}
+
+	discount := share(c.DiscountAmount, c.creditedDiscount)
+	return models.CreditNoteItem{
+		InvoiceItemID:    c.ID,
+		ProductID:        c.ProductID,
+		Quantity:         quantity,
+		UnitPrice:        c.UnitPrice,
+		DiscountAmount:   discount,
+		TotalPrice:       c.UnitPrice.Mul(int64(quantity)).Sub(discount),
+		AdjustmentAmount: share(c.AdjustmentAmount, c.creditedAdjust),
+		TaxRate:          c.TaxRate,
+		TaxAmount:        share(c.TaxAmount, c.creditedTax),
+		Untaxed:          c.Untaxed,
+	}
+}
+
+// creditableItems reads an invoice's items with what has been credited of each.
+func creditableItems(tx *sql.Tx, invoiceID int, currency string) ([]creditableItem, error) {
+	rows, err := tx.Query(`
+		SELECT ii.id, ii.product_id, ii.quantity, ii.unit_price, ii.discount_amount, ii.total_price, ii.adjustment_amount, ii.tax_rate, ii.tax_amount, ii.untaxed,
+		       COALESCE(SUM(cni.quantity), 0), COALESCE(SUM(cni.discount_amount), 0),
+		       COALESCE(SUM(cni.adjustment_amount), 0), COALESCE(SUM(cni.tax_amount), 0)
+		FROM invoice_items ii
+		LEFT JOIN credit_note_items cni ON cni.invoice_item_id = ii.id
+		WHERE ii.invoice_id = ?
+		GROUP BY ii.id
+		ORDER BY ii.id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []creditableItem
+	for rows.Next() {
+		var c creditableItem
+		err := rows.Scan(&c.ID, &c.ProductID, &c.Quantity, &c.UnitPrice, &c.DiscountAmount, &c.TotalPrice, &c.AdjustmentAmount, &c.TaxRate, &c.TaxAmount, &c.Untaxed,
+			&c.creditedQuantity, &c.creditedDiscount, &c.creditedAdjust, &c.creditedTax)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range []*money.Money{&c.UnitPrice, &c.DiscountAmount, &c.TotalPrice, &c.AdjustmentAmount, &c.TaxAmount,
+			&c.creditedDiscount, &c.creditedAdjust, &c.creditedTax} {
+			m.Currency = currency
+		}
+		items = append(items, c)
+	}
+
+	return items, rows.Err()
+}
+
+// creditNoteItems picks the items and quantities a request credits. With no
+// requested items, everything not yet credited is.
+func creditNoteItems(items []creditableItem, requested []models.CreateCreditNoteItem) ([]models.CreditNoteItem, error) {
+	var credited []models.CreditNoteItem
+	if len(requested) == 0 {
+		for _, item := range items {
+			if item.remaining() > 0 {
+				credited = append(credited, item.credit(item.remaining()))
+			}
+		}
+		if len(credited) == 0 {
+			return nil, requestError("Invoice has already been fully credited")
+		}
+		return credited, nil
+	}
+
+	byID := make(map[int]creditableItem, len(items))
+	for _, item := range items {
+		byID[item.ID] = item
+	}
+
+	seen := make(map[int]bool)
+	for i, req := range requested {
+		item, ok := byID[req.InvoiceItemID]
+		if !ok {
+			return nil, requestError(fmt.Sprintf("Item %d: invoice item %d is not on this invoice", i+1, req.InvoiceItemID))
+		}
+		if seen[req.InvoiceItemID] {
+			return nil, requestError(fmt.Sprintf("Item %d: invoice item %d is listed more than once", i+1, req.InvoiceItemID))
+		}
+		seen[req.InvoiceItemID] = true
+
+		if req.Quantity <= 0 {
+			return nil, requestError(fmt.Sprintf("Item %d: quantity must be positive", i+1))
+		}
+		if req.Quantity > item.remaining() {
+			return nil, requestError(fmt.Sprintf("Item %d: only %d of invoice item %d left to credit", i+1, item.remaining(), req.InvoiceItemID))
+		}
+		credited = append(credited, item.credit(req.Quantity))
+	}
+
+	return credited, nil
+}
+
+// CreateCreditNote issues a credit note against a finalized, sent or paid
+// invoice. The credited amount reduces the invoice's balance; once every
+// item has been credited in full the invoice becomes credited.
+func (h *Handler) CreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateCreditNoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	series := strings.TrimSpace(req.Series)
+	if series == "" {
+		series = defaultCreditNoteSeries
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var status, currency string
+	var rate money.ExchangeRate
+	err = tx.QueryRow("SELECT status, currency, exchange_rate FROM invoices WHERE id = ? AND organization_id = ?",
+		id, organizationID(r)).Scan(&status, &currency, &rate)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Only issued invoices can be credited; drafts are edited or voided instead
+	switch lifecycle.State(status) {
+	case lifecycle.StateFinalized, lifecycle.StateSent, lifecycle.StatePaid:
+	default:
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Cannot credit a %s invoice", status), http.StatusConflict)
+		return
+	}
+
+	items, err := creditableItems(tx, id, currency)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	credited, err := creditNoteItems(items, req.Items)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note := models.CreditNote{
+		InvoiceID:       id,
+		Reason:          strings.TrimSpace(req.Reason),
+		Subtotal:        money.Zero(currency),
+		AdjustmentTotal: money.Zero(currency),
+		TaxTotal:        money.Zero(currency),
+		Currency:        currency,
+		ExchangeRate:    rate,
+		CreatedAt:       time.Now(),
+		Items:           credited,
+	}
+	var taxedLines []tax.Line
+	for _, item := range credited {
+		note.Subtotal = note.Subtotal.Add(item.TotalPrice)
+		note.AdjustmentTotal = note.AdjustmentTotal.Add(item.AdjustmentAmount)
+		note.TaxTotal = note.TaxTotal.Add(item.TaxAmount)
+		taxedLines = append(taxedLines, tax.Line{Net: item.TotalPrice.Add(item.AdjustmentAmount), Rate: item.TaxRate, Tax: item.TaxAmount})
+	}
+	for _, summary := range tax.Summarize(taxedLines, currency) {
+		note.TaxLines = append(note.TaxLines, models.TaxLine{
+			Rate:          summary.Rate,
+			TaxableAmount: summary.Taxable,
+			TaxAmount:     summary.Tax,
+		})
+	}
+	note.TotalPrice = note.Subtotal.Add(note.AdjustmentTotal).Add(note.TaxTotal)
+	note.BaseTotal = note.TotalPrice.ConvertToBase(money.BaseCurrency, rate)
+
+	note.CreditNoteNumber, err = nextNumber(tx, organizationID(r), series, note.CreatedAt)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	before, err := snapshot(tx, auditInvoice, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec(`INSERT INTO credit_notes (organization_id, credit_note_number, invoice_id, reason, subtotal, adjustment_total, tax_total, total_price,
+			currency, exchange_rate, base_total)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		organizationID(r), note.CreditNoteNumber, id, note.Reason, note.Subtotal, note.AdjustmentTotal, note.TaxTotal, note.TotalPrice,
+		currency, rate, note.BaseTotal)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	noteID, _ := result.LastInsertId()
+
+	if err := insertCreditNoteLines(tx, noteID, &note); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE invoices SET amount_credited = amount_credited + ? WHERE id = ?", note.TotalPrice, id); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := settleCredit(tx, organizationID(r), id, note.CreatedAt); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = recordAudit(tx, actor(r), auditCreditNote, noteID, models.AuditCreate, nil)
+	if err == nil {
+		err = recordAudit(tx, actor(r), auditInvoice, int64(id), actionCredit, before)
+	}
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.loadCreditNote(organizationID(r), int(noteID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// insertCreditNoteLines writes the items and tax lines of a credit note.
+func insertCreditNoteLines(tx *sql.Tx, noteID int64, note *models.CreditNote) error {
+	for _, item := range note.Items {
+		_, err := tx.Exec(`
+			INSERT INTO credit_note_items (credit_note_id, invoice_item_id, quantity, unit_price,
+				discount_amount, total_price, adjustment_amount, tax_rate, tax_amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			noteID, item.InvoiceItemID, item.Quantity, item.UnitPrice,
+			item.DiscountAmount, item.TotalPrice, item.AdjustmentAmount, item.TaxRate, item.TaxAmount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, line := range note.TaxLines {
+		_, err := tx.Exec(
+			"INSERT INTO credit_note_tax_lines (credit_note_id, rate, taxable_amount, tax_amount) VALUES (?, ?, ?, ?)",
+			noteID, line.Rate, line.TaxableAmount, line.TaxAmount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// settleCredit moves an invoice to credited once credit notes cover all of
+// it, or to paid once payments cover what the credit notes leave.
+func settleCredit(tx *sql.Tx, organizationID, id int, at time.Time) error {
+	inv, err := invoiceState(tx, organizationID, id)
+	if err != nil {
+		return err
+	}
+
+	t, _ := lifecycle.Lookup(lifecycle.Credit)
+	if t.Check(inv) == nil {
+		return applyTransition(tx, id, inv, t, at)
+	}
+	return settleIfPaid(tx, organizationID, id, at)
+}
+
+// invoiceCreditNotes lists the credit notes issued against an invoice,
+// without their items.
+func (h *Handler) invoiceCreditNotes(invoiceID int) ([]models.CreditNote, error) {
+	return h.queryCreditNotes("WHERE cn.invoice_id = ?", invoiceID)
+}
+
+func (h *Handler) queryCreditNotes(where string, args ...interface{}) ([]models.CreditNote, error) {
+	rows, err := h.db.Query(`
+		SELECT cn.id, cn.credit_note_number, cn.invoice_id, i.invoice_number, cn.reason, cn.subtotal, cn.adjustment_total, cn.tax_total,
+		       cn.total_price, cn.currency, cn.exchange_rate, cn.base_total, cn.created_at
+		FROM credit_notes cn
+		JOIN invoices i ON cn.invoice_id = i.id
+		`+where+`
+		ORDER BY cn.created_at, cn.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []models.CreditNote
+	for rows.Next() {
+		var note models.CreditNote
+		err := rows.Scan(&note.ID, &note.CreditNoteNumber, &note.InvoiceID, &note.InvoiceNumber, &note.Reason, &note.Subtotal, &note.AdjustmentTotal, &note.TaxTotal,
+			&note.TotalPrice, &note.Currency, &note.ExchangeRate, &note.BaseTotal, &note.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		note.Subtotal.Currency = note.Currency
+		note.AdjustmentTotal.Currency = note.Currency
+		note.TaxTotal.Currency = note.Currency
+		note.TotalPrice.Currency = note.Currency
+		note.BaseTotal.Currency = money.BaseCurrency
+		notes = append(notes, note)
+	}
+
+	return notes, rows.Err()
+}
+
+// loadCreditNote reads a credit note of an organization with its items and
+// tax lines. It returns sql.ErrNoRows if there is no such credit note.
+func (h *Handler) loadCreditNote(organizationID, id int) (*models.CreditNote, error) {
+	notes, err := h.queryCreditNotes("WHERE cn.id = ? AND cn.organization_id = ?", id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(notes) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	note := notes[0]
+
+	rows, err := h.db.Query(`
+		SELECT cni.id, cni.credit_note_id, cni.invoice_item_id, ii.product_id, cni.quantity, cni.unit_price,
+		       cni.discount_amount, cni.total_price, cni.adjustment_amount, cni.tax_rate, cni.tax_amount,
+		       ii.untaxed, ii.product_name
+		FROM credit_note_items cni
+		JOIN invoice_items ii ON cni.invoice_item_id = ii.id
+		WHERE cni.credit_note_id = ?
+		ORDER BY cni.id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CreditNoteItem
+		var productName string
+		err := rows.Scan(&item.ID, &item.CreditNoteID, &item.InvoiceItemID, &item.ProductID, &item.Quantity, &item.UnitPrice,
+			&item.DiscountAmount, &item.TotalPrice, &item.AdjustmentAmount, &item.TaxRate, &item.TaxAmount,
+			&item.Untaxed, &productName)
+		if err != nil {
+			return nil, err
+		}
+		item.UnitPrice.Currency = note.Currency
+		item.DiscountAmount.Currency = note.Currency
+		item.TotalPrice.Currency = note.Currency
+		item.AdjustmentAmount.Currency = note.Currency
+		item.TaxAmount.Currency = note.Currency
+		item.Product = &models.ProductSnapshot{ID: item.ProductID, Name: productName}
+		note.Items = append(note.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	taxRows, err := h.db.Query(`
+		SELECT rate, taxable_amount, tax_amount FROM credit_note_tax_lines
+		WHERE credit_note_id = ?
+		ORDER BY rate DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer taxRows.Close()
+
+	for taxRows.Next() {
+		var line models.TaxLine
+		if err := taxRows.Scan(&line.Rate, &line.TaxableAmount, &line.TaxAmount); err != nil {
+			return nil, err
+		}
+		line.TaxableAmount.Currency = note.Currency
+		line.TaxAmount.Currency = note.Currency
+		note.TaxLines = append(note.TaxLines, line)
+	}
+
+	return &note, taxRows.Err()
+}
+
+func (h *Handler) GetCreditNotes(w http.ResponseWriter, r *http.Request) {
+	notes, err := h.queryCreditNotes("WHERE cn.organization_id = ?", organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notes == nil {
+		notes = []models.CreditNote{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func (h *Handler) GetInvoiceCreditNotes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err = h.db.QueryRow("SELECT 1 FROM invoices WHERE id = ? AND organization_id = ?", id, organizationID(r)).Scan(&exists)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	notes, err := h.invoiceCreditNotes(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if notes == nil {
+		notes = []models.CreditNote{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(notes)
+}
+
+func (h *Handler) GetCreditNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid credit note ID", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.loadCreditNote(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Credit note not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"invoice-app/models"
+)
+
+func TestCreateCreditNote(t *testing.T) {
+	// A credit of quantity of the invoice's line, or of everything left
+	// when quantity is 0, and the adjustment, tax and total of the credit
+	// note it makes, or "" when it is refused with code
+	type credit struct {
+		quantity               int
+		adjustment, tax, total string
+		code                   int
+	}
+	// The invoice is 3 at 10.00 less 1.00, so each third takes a third of
+	// the discount and tax; the shares round to the cent and the last
+	// credit takes what is left, so the credits add up to the invoice
+	for _, tt := range []struct {
+		name        string
+		draft       bool
+		paid        string // before crediting
+		credits     []credit
+		wantStatus  string
+		wantBalance string
+	}{
+		{
+			name:        "a third",
+			credits:     []credit{{1, "-0.33", "1.93", "11.60", http.StatusCreated}},
+			wantStatus:  "finalized",
+			wantBalance: "23.20",
+		},
+		{
+			name: "a third at a time",
+			credits: []credit{
+				{1, "-0.33", "1.93", "11.60", http.StatusCreated},
+				{1, "-0.34", "1.94", "11.60", http.StatusCreated},
+				{1, "-0.33", "1.93", "11.60", http.StatusCreated},
+			},
+			wantStatus:  "credited",
+			wantBalance: "0.00",
+		},
+		{
+			name: "two thirds, then the rest",
+			credits: []credit{
+				{2, "-0.67", "3.87", "23.20", http.StatusCreated},
+				{0, "-0.33", "1.93", "11.60", http.StatusCreated},
+			},
+			wantStatus:  "credited",
+			wantBalance: "0.00",
+		},
+		{
+			name: "more than is left",
+			credits: []credit{
+				{2, "-0.67", "3.87", "23.20", http.StatusCreated},
+				{2, "", "", "", http.StatusBadRequest},
+			},
+			wantStatus:  "finalized",
+			wantBalance: "11.60",
+		},
+		{
+			// The payment is owed back
+			name:        "all of a part-paid invoice",
+			paid:        "10.00",
+			credits:     []credit{{0, "-1.00", "5.80", "34.80", http.StatusCreated}},
+			wantStatus:  "credited",
+			wantBalance: "-10.00",
+		},
+		{
+			// Payments cover what the credit note leaves
+			name:        "the unpaid third",
+			paid:        "23.20",
+			credits:     []credit{{1, "-0.33", "1.93", "11.60", http.StatusCreated}},
+			wantStatus:  "paid",
+			wantBalance: "0.00",
+		},
+		{
+			name:        "draft",
+			draft:       true,
+			credits:     []credit{{0, "", "", "", http.StatusConflict}},
+			wantStatus:  "draft",
+			wantBalance: "34.80",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			seedInvoicing(t, db)
+			router := invoiceRouter(New(db, nil))
+			id := issueInvoice(t, router, tt.draft)
+			if tt.paid != "" {
+				if code := pay(router, id, tt.paid); code != http.StatusCreated {
+					t.Fatalf("paying %s: got %d", tt.paid, code)
+				}
+			}
+			itemID := getInvoice(t, router, id).Items[0].ID
+
+			for i, c := range tt.credits {
+				body := `{"reason": "Returned"}`
+				if c.quantity > 0 {
+					body = fmt.Sprintf(`{"reason": "Returned", "items": [{"invoice_item_id": %d, "quantity": %d}]}`, itemID, c.quantity)
+				}
+				w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/credit-notes", id), body)
+				if w.Code != c.code {
+					t.Fatalf("credit %d: got %d %q, want %d", i+1, w.Code, w.Body.String(), c.code)
+				}
+				if c.code != http.StatusCreated {
+					continue
+				}
+				var note models.CreditNote
+				if err := json.NewDecoder(w.Body).Decode(&note); err != nil {
+					t.Fatal(err)
+				}
+				if got := [3]string{note.AdjustmentTotal.String(), note.TaxTotal.String(), note.TotalPrice.String()}; got != [3]string{c.adjustment, c.tax, c.total} {
+					t.Errorf("credit %d: adjustment, tax and total %v, want %v", i+1, got, [3]string{c.adjustment, c.tax, c.total})
+				}
+			}
+
+			inv := getInvoice(t, router, id)
+			if inv.Status != tt.wantStatus || inv.BalanceDue.String() != tt.wantBalance {
+				t.Errorf("got %s with %s due, want %s with %s due", inv.Status, inv.BalanceDue, tt.wantStatus, tt.wantBalance)
+			}
+		})
+	}
+}
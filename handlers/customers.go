@@ -3,21 +3,40 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"invoice-app/einvoice"
 	"invoice-app/models"
+	"invoice-app/money"
 	"github.com/gorilla/mux"
 )
 
+// cleanEInvoicing trims the customer's Peppol ID and buyer reference, which
+// e-invoices are addressed with, and checks the Peppol ID.
+func cleanEInvoicing(c *models.Customer) error {
+	for _, field := range []*string{c.PeppolID, c.BuyerReference} {
+		if field != nil {
+			*field = strings.TrimSpace(*field)
+		}
+	}
+	if c.PeppolID != nil && *c.PeppolID != "" {
+		if _, _, err := einvoice.ParticipantID(*c.PeppolID); err != nil {
+			return fmt.Errorf("Invalid Peppol ID: %v", err)
+		}
+	}
+	return nil
+}
+
 func (h *Handler) GetCustomers(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, name, phone, address, country, created_at FROM customers"
-	var args []interface{}
+	query := "SELECT id, name, phone, address, country, currency, payment_terms, payment_term_days, NULLIF(peppol_id, ''), NULLIF(buyer_reference, ''), created_at FROM customers WHERE organization_id = ?"
+	args := []interface{}{organizationID(r)}
 	
 	if search := r.URL.Query().Get("search"); search != "" {
-		query += " WHERE name LIKE ? OR phone LIKE ?"
+		query += " AND (name LIKE ? OR phone LIKE ?)"
 		args = append(args, "%"+search+"%", "%"+search+"%")
 	}
 	
@@ -33,7 +52,7 @@ func (h *Handler) GetCustomers(w http.ResponseWriter, r *http.Request) {
 	var customers []models.Customer
 	for rows.Next() {
 		var c models.Customer
-		if err := rows.Scan(&c.ID, &c.Name, &c.Phone, &c.Address, &c.Country, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Phone, &c.Address, &c.Country, &c.Currency, &c.PaymentTerms, &c.PaymentTermDays, &c.PeppolID, &c.BuyerReference, &c.CreatedAt); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -53,8 +72,8 @@ func (h *Handler) GetCustomer(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var c models.Customer
-	err = h.db.QueryRow("SELECT id, name, phone, address, country, created_at FROM customers WHERE id = ?", id).
-		Scan(&c.ID, &c.Name, &c.Phone, &c.Address, &c.Country, &c.CreatedAt)
+	err = h.db.QueryRow("SELECT id, name, phone, address, country, currency, payment_terms, payment_term_days, NULLIF(peppol_id, ''), NULLIF(buyer_reference, ''), created_at FROM customers WHERE id = ? AND organization_id = ?", id, organizationID(r)).
+		Scan(&c.ID, &c.Name, &c.Phone, &c.Address, &c.Country, &c.Currency, &c.PaymentTerms, &c.PaymentTermDays, &c.PeppolID, &c.BuyerReference, &c.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Customer not found", http.StatusNotFound)
@@ -105,14 +124,37 @@ func (h *Handler) CreateCustomer(w http.ResponseWriter, r *http.Request) {
 	c.Address = strings.TrimSpace(c.Address)
 	c.Country = strings.TrimSpace(c.Country)
 
-	result, err := h.db.Exec("INSERT INTO customers (name, phone, address, country) VALUES (?, ?, ?, ?)", 
-		c.Name, c.Phone, c.Address, c.Country)
+	// Currency defaults to the base currency
+	c.Currency = strings.ToUpper(strings.TrimSpace(c.Currency))
+	if c.Currency == "" {
+		c.Currency = money.BaseCurrency
+	}
+	if !money.IsCurrencyCode(c.Currency) {
+		http.Error(w, "Customer currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+
+	// Payment terms default to Net 30
+	if c.PaymentTerms == "" {
+		c.PaymentTerms = models.PaymentTermsNet30
+	}
+	if _, err := resolvePaymentTerms(c.PaymentTerms, c.PaymentTermDays); err != nil {
+		http.Error(w, "Invalid payment terms: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := cleanEInvoicing(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.execAudited(r, auditCustomer, 0, models.AuditCreate,
+		"INSERT INTO customers (organization_id, name, phone, address, country, currency, payment_terms, payment_term_days, peppol_id, buyer_reference) VALUES (?, ?, ?, ?, ?, ?, ?, ?, COALESCE(?, ''), COALESCE(?, ''))",
+		organizationID(r), c.Name, c.Phone, c.Address, c.Country, c.Currency, c.PaymentTerms, c.PaymentTermDays, c.PeppolID, c.BuyerReference)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	c.ID = int(id)
 	c.CreatedAt = time.Now()
 
@@ -165,16 +207,44 @@ func (h *Handler) UpdateCustomer(w http.ResponseWriter, r *http.Request) {
 	c.Address = strings.TrimSpace(c.Address)
 	c.Country = strings.TrimSpace(c.Country)
 
-	result, err := h.db.Exec("UPDATE customers SET name = ?, phone = ?, address = ?, country = ? WHERE id = ?", 
-		c.Name, c.Phone, c.Address, c.Country, id)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// An omitted currency leaves the customer's current one unchanged
+	c.Currency = strings.ToUpper(strings.TrimSpace(c.Currency))
+	if c.Currency != "" && !money.IsCurrencyCode(c.Currency) {
+		http.Error(w, "Customer currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+
+	query := "UPDATE customers SET name = ?, phone = ?, address = ?, country = ?, currency = COALESCE(NULLIF(?, ''), currency)"
+	args := []interface{}{c.Name, c.Phone, c.Address, c.Country, c.Currency}
+
+	// Likewise omitted payment terms are left unchanged
+	if c.PaymentTerms != "" {
+		if _, err := resolvePaymentTerms(c.PaymentTerms, c.PaymentTermDays); err != nil {
+			http.Error(w, "Invalid payment terms: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		query += ", payment_terms = ?, payment_term_days = ?"
+		args = append(args, c.PaymentTerms, c.PaymentTermDays)
+	}
+
+	// And so is an omitted Peppol ID or buyer reference, while an empty
+	// one clears it
+	if err := cleanEInvoicing(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	query += ", peppol_id = COALESCE(?, peppol_id), buyer_reference = COALESCE(?, buyer_reference)"
+	args = append(args, c.PeppolID, c.BuyerReference)
+
+	query += " WHERE id = ? AND organization_id = ?"
+	args = append(args, id, organizationID(r))
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Customer not found", http.StatusNotFound)
+	if _, err := h.execAudited(r, auditCustomer, int64(id), models.AuditUpdate, query, args...); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -191,7 +261,7 @@ func (h *Handler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
 
 	// Check if customer has any invoices
 	var count int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM invoices WHERE customer_id = ?", id).Scan(&count)
+	err = h.db.QueryRow("SELECT COUNT(*) FROM invoices WHERE customer_id = ? AND organization_id = ?", id, organizationID(r)).Scan(&count)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -201,15 +271,33 @@ func (h *Handler) DeleteCustomer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM customers WHERE id = ?", id)
+	err = h.db.QueryRow("SELECT COUNT(*) FROM recurring_invoices WHERE customer_id = ? AND organization_id = ? AND status != 'finished'",
+		id, organizationID(r)).Scan(&count)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if count > 0 {
+		http.Error(w, "Cannot delete customer that has recurring invoices", http.StatusBadRequest)
+		return
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Customer not found", http.StatusNotFound)
+	err = h.db.QueryRow("SELECT COUNT(*) FROM quotes WHERE customer_id = ? AND organization_id = ?", id, organizationID(r)).Scan(&count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Cannot delete customer that has quotes", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditCustomer, int64(id), models.AuditDelete, "DELETE FROM customers WHERE id = ? AND organization_id = ?", id, organizationID(r)); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Customer not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// discountValue validates a discount or adjustment value and returns it as
+// stored: basis points for percentages, minor units of currency for fixed
+// amounts.
+func discountValue(discountType string, value json.Number, currency string) (int64, error) {
+	switch discountType {
+	case models.DiscountPercent:
+		rate, err := tax.ParseRate(value.String())
+		if err != nil {
+			return 0, fmt.Errorf("invalid percentage %q: must be between 0 and 100 with at most two decimals", value)
+		}
+		if rate == 0 {
+			return 0, fmt.Errorf("percentage must be greater than zero")
+		}
+		return int64(rate), nil
+	case models.DiscountFixed:
+		amount, err := money.Parse(value.String(), currency)
+		if err != nil {
+			return 0, err
+		}
+		if !amount.IsPositive() {
+			return 0, fmt.Errorf("fixed amount must be positive")
+		}
+		return amount.Amount, nil
+	default:
+		return 0, fmt.Errorf("type must be %q or %q", models.DiscountPercent, models.DiscountFixed)
+	}
+}
+
+// discountAmount returns the unsigned amount a stored discount takes off (or
+// a surcharge adds to) base.
+func discountAmount(base money.Money, discountType string, value int64) money.Money {
+	if discountType == models.DiscountPercent {
+		return base.MulRatio(value, 10000)
+	}
+	return money.New(value, base.Currency)
+}
+
+// formatDiscountValue is the inverse of discountValue, for API responses.
+func formatDiscountValue(discountType string, value int64, currency string) json.Number {
+	if discountType == models.DiscountPercent {
+		return json.Number(tax.Rate(value).String())
+	}
+	return json.Number(money.New(value, currency).String())
+}
+
+// discountLabel describes a discount for printed invoices, e.g. "10.00%".
+func discountLabel(discountType string, value json.Number) string {
+	if discountType == models.DiscountPercent {
+		return string(value) + "%"
+	}
+	return ""
+}
+
+func (h *Handler) invoiceAdjustments(invoiceID int, currency string) ([]models.InvoiceAdjustment, error) {
+	rows, err := h.db.Query(`
+		SELECT kind, type, value, description, amount FROM invoice_adjustments
+		WHERE invoice_id = ?
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjustments []models.InvoiceAdjustment
+	for rows.Next() {
+		var adj models.InvoiceAdjustment
+		var value int64
+		if err := rows.Scan(&adj.Kind, &adj.Type, &value, &adj.Description, &adj.Amount); err != nil {
+			return nil, err
+		}
+		adj.Value = formatDiscountValue(adj.Type, value, currency)
+		adj.Amount.Currency = currency
+		adjustments = append(adjustments, adj)
+	}
+
+	return adjustments, rows.Err()
+}
+
+// itemDiscount rebuilds an item's discount from its stored columns.
+func itemDiscount(discountType sql.NullString, value int64, currency string) *models.Discount {
+	if !discountType.Valid {
+		return nil
+	}
+	return &models.Discount{
+		Type:  discountType.String,
+		Value: formatDiscountValue(discountType.String, value, currency),
+	}
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+	"invoice-app/money"
+)
+
+var errItemNotFound = errors.New("invoice item not found")
+
+// draft is a draft invoice being edited: what it was created with, in the
+// form of a create request, and how each line was priced.
+type draft struct {
+	ID             int
+	OrganizationID int
+	Status         string
+	CustomerID     int
+	Currency       string
+	Rate           money.ExchangeRate
+	PaymentTerms   string
+	TermDays       *int // set only for custom terms
+	CreatedAt      time.Time
+	ItemIDs        []int // 0 for lines not yet saved
+	Items          []models.CreateInvoiceItem
+	Kept           []*models.InvoiceItem
+	Adjustments    []models.InvoiceAdjustment
+}
+
+// loadDraft reads invoice id of an organization for editing. It returns
+// sql.ErrNoRows if there is no such invoice.
+func loadDraft(tx *sql.Tx, organizationID, id int) (*draft, error) {
+	d := &draft{ID: id, OrganizationID: organizationID}
+	var customerID *int
+	var termDays int
+	err := tx.QueryRow(`SELECT status, customer_id, currency, exchange_rate, payment_terms, payment_term_days, created_at
+		FROM invoices WHERE id = ? AND organization_id = ?`, id, organizationID).
+		Scan(&d.Status, &customerID, &d.Currency, &d.Rate, &d.PaymentTerms, &termDays, &d.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if customerID != nil {
+		d.CustomerID = *customerID
+	}
+	if d.PaymentTerms == models.PaymentTermsCustom {
+		d.TermDays = &termDays
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, product_id, product_name, quantity, unit_price, discount_type, discount_value
+		FROM invoice_items WHERE invoice_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.InvoiceItem
+		var productName string
+		var discountType sql.NullString
+		var discountValue int64
+		if err := rows.Scan(&item.ID, &item.ProductID, &productName, &item.Quantity, &item.UnitPrice, &discountType, &discountValue); err != nil {
+			return nil, err
+		}
+		item.UnitPrice.Currency = d.Currency
+		item.Product = &models.ProductSnapshot{ID: item.ProductID, Name: productName}
+		d.ItemIDs = append(d.ItemIDs, item.ID)
+		d.Items = append(d.Items, models.CreateInvoiceItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Discount:  itemDiscount(discountType, discountValue, d.Currency),
+		})
+		d.Kept = append(d.Kept, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	adjRows, err := tx.Query("SELECT kind, type, value, description FROM invoice_adjustments WHERE invoice_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer adjRows.Close()
+
+	for adjRows.Next() {
+		var adj models.InvoiceAdjustment
+		var value int64
+		if err := adjRows.Scan(&adj.Kind, &adj.Type, &value, &adj.Description); err != nil {
+			return nil, err
+		}
+		adj.Value = formatDiscountValue(adj.Type, value, d.Currency)
+		d.Adjustments = append(d.Adjustments, adj)
+	}
+
+	return d, adjRows.Err()
+}
+
+// itemIndex finds the line with invoice item ID itemID.
+func (d *draft) itemIndex(itemID int) (int, error) {
+	for i, id := range d.ItemIDs {
+		if id == itemID {
+			return i, nil
+		}
+	}
+	return 0, errItemNotFound
+}
+
+// saveDraft prices d again and rewrites the invoice and its lines. The
+// invoice keeps its number and date; a new currency is converted at today's
+// rate and re-prices every line.
+func saveDraft(tx *sql.Tx, d *draft, currency string) error {
+	b, err := resolveBilling(tx, d.OrganizationID, d.CustomerID, currency, d.PaymentTerms, d.TermDays, time.Now())
+	if err != nil {
+		return err
+	}
+
+	kept := d.Kept
+	if b.Currency == d.Currency {
+		b.Rate = d.Rate
+	} else {
+		kept = nil
+	}
+
+	priced, err := repriceInvoice(tx, b, d.Items, kept, d.Adjustments)
+	if err != nil {
+		return err
+	}
+
+	// Lines are written again under the same IDs so they can still be
+	// addressed by the item endpoints
+	for i := range priced.Items {
+		if i < len(d.ItemIDs) {
+			priced.Items[i].ID = d.ItemIDs[i]
+		}
+	}
+
+	for _, table := range []string{"invoice_items", "invoice_adjustments", "invoice_tax_lines"} {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE invoice_id = ?", table), d.ID); err != nil {
+			return err
+		}
+	}
+	if err := insertInvoiceLines(tx, int64(d.ID), priced); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE invoices SET customer_id = ?, customer_name = ?, customer_phone = ?, customer_address = ?, customer_country = ?,
+			subtotal = ?, adjustment_total = ?, tax_total = ?, total_price = ?, currency = ?, exchange_rate = ?, base_total = ?,
+			payment_terms = ?, payment_term_days = ?, due_date = ?
+		WHERE id = ?`,
+		b.Customer.ID, b.Customer.Name, b.Customer.Phone, b.Customer.Address, b.Customer.Country,
+		priced.Subtotal, priced.AdjustmentTotal, priced.TaxTotal, priced.TotalPrice, b.Currency, b.Rate,
+		priced.TotalPrice.ConvertToBase(money.BaseCurrency, b.Rate),
+		b.PaymentTerms, b.TermDays, dueDate(d.CreatedAt, b.TermDays), d.ID)
+	return err
+}
+
+// editDraft applies edit to draft invoice id and saves it in one
+// transaction, then responds with the updated invoice. Invoices past draft
+// cannot be edited.
+func (h *Handler) editDraft(w http.ResponseWriter, r *http.Request, id int, status int, edit func(d *draft) (currency string, err error)) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d, err := loadDraft(tx, organizationID(r), id)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if lifecycle.State(d.Status) != lifecycle.StateDraft {
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Cannot edit a %s invoice; only drafts can be changed", d.Status), http.StatusConflict)
+		return
+	}
+
+	before, err := snapshot(tx, auditInvoice, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	currency, err := edit(d)
+	if err == nil {
+		err = saveDraft(tx, d, currency)
+	}
+	if err == nil {
+		err = recordAudit(tx, actor(r), auditInvoice, int64(id), models.AuditUpdate, before)
+	}
+	if err != nil {
+		tx.Rollback()
+		if err == errItemNotFound {
+			http.Error(w, "Invoice item not found", http.StatusNotFound)
+		} else if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inv, err := h.loadInvoice(organizationID(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(inv)
+}
+
+// UpdateInvoice changes the customer, currency, payment terms, items or
+// adjustments of a draft invoice and recomputes its totals.
+func (h *Handler) UpdateInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateInvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.editDraft(w, r, id, http.StatusOK, func(d *draft) (string, error) {
+		if req.CustomerID != nil {
+			d.CustomerID = *req.CustomerID
+		}
+		if req.PaymentTerms != "" {
+			d.PaymentTerms, d.TermDays = req.PaymentTerms, req.PaymentTermDays
+		}
+		if req.Items != nil {
+			d.Items, d.Kept, d.ItemIDs = *req.Items, nil, nil
+		}
+		if req.Adjustments != nil {
+			d.Adjustments = *req.Adjustments
+		}
+
+		currency := d.Currency
+		if req.Currency != "" {
+			currency = req.Currency
+		}
+		return currency, nil
+	})
+}
+
+// AddInvoiceItem adds a line to a draft invoice at the product's current
+// price.
+func (h *Handler) AddInvoiceItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateInvoiceItem
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.editDraft(w, r, id, http.StatusCreated, func(d *draft) (string, error) {
+		d.Items = append(d.Items, req)
+		d.Kept = append(d.Kept, nil)
+		d.ItemIDs = append(d.ItemIDs, 0)
+		return d.Currency, nil
+	})
+}
+
+// UpdateInvoiceItem replaces the quantity and discount of a line on a draft
+// invoice, and its product if product_id is given. The line keeps its unit
+// price unless its product changes.
+func (h *Handler) UpdateInvoiceItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(vars["itemId"])
+	if err != nil {
+		http.Error(w, "Invalid invoice item ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateInvoiceItem
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.editDraft(w, r, id, http.StatusOK, func(d *draft) (string, error) {
+		i, err := d.itemIndex(itemID)
+		if err != nil {
+			return "", err
+		}
+		if req.ProductID == 0 {
+			req.ProductID = d.Items[i].ProductID
+		}
+		if req.ProductID != d.Items[i].ProductID {
+			d.Kept[i] = nil
+		}
+		d.Items[i] = req
+		return d.Currency, nil
+	})
+}
+
+// DeleteInvoiceItem removes a line from a draft invoice.
+func (h *Handler) DeleteInvoiceItem(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+	itemID, err := strconv.Atoi(vars["itemId"])
+	if err != nil {
+		http.Error(w, "Invalid invoice item ID", http.StatusBadRequest)
+		return
+	}
+
+	h.editDraft(w, r, id, http.StatusOK, func(d *draft) (string, error) {
+		i, err := d.itemIndex(itemID)
+		if err != nil {
+			return "", err
+		}
+		d.Items = append(d.Items[:i], d.Items[i+1:]...)
+		d.Kept = append(d.Kept[:i], d.Kept[i+1:]...)
+		d.ItemIDs = append(d.ItemIDs[:i], d.ItemIDs[i+1:]...)
+		return d.Currency, nil
+	})
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestEditDraftInvoice(t *testing.T) {
+	// Each edit is made to an invoice of 3 and 2 of product 1 less 1.00,
+	// which comes to 58.80, and to its first or second line if line is set
+	edits := []struct {
+		name, method, path, body string
+		line                     int
+		want                     int
+		wantTotal                string // of a draft after the edit
+	}{
+		{"update", "PUT", "/api/invoices/%d", `{"customer_id": 1, "items": [{"product_id": 1, "quantity": 1}], "adjustments": [{"kind": "discount", "type": "fixed", "value": "1.00"}]}`, 0, http.StatusOK, "10.80"},
+		{"add item", "POST", "/api/invoices/%d/items", `{"product_id": 1, "quantity": 1}`, 0, http.StatusCreated, "70.80"},
+		{"update item", "PUT", "/api/invoices/%d/items/%d", `{"quantity": 1}`, 1, http.StatusOK, "34.80"},
+		{"remove item", "DELETE", "/api/invoices/%d/items/%d", "", 2, http.StatusOK, "34.80"},
+	}
+	states := []struct {
+		name        string
+		transitions []string
+		paid        bool
+		credited    bool
+	}{
+		{name: "draft"},
+		{name: "finalized", transitions: []string{"finalize"}},
+		{name: "sent", transitions: []string{"finalize", "send"}},
+		{name: "paid", transitions: []string{"finalize"}, paid: true},
+		{name: "void", transitions: []string{"finalize", "void"}},
+		{name: "credited", transitions: []string{"finalize"}, credited: true},
+	}
+
+	for _, state := range states {
+		for _, edit := range edits {
+			t.Run(state.name+"/"+edit.name, func(t *testing.T) {
+				db := testDB(t)
+				seedInvoicing(t, db)
+				router := invoiceRouter(New(db, nil))
+				id := issueInvoice(t, router, true)
+				if w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/items", id), `{"product_id": 1, "quantity": 2}`); w.Code != http.StatusCreated {
+					t.Fatalf("adding the second line: got %d %q", w.Code, w.Body.String())
+				}
+				for _, transition := range state.transitions {
+					if w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/transitions/%s", id, transition), ""); w.Code != http.StatusOK {
+						t.Fatalf("%s: got %d %q", transition, w.Code, w.Body.String())
+					}
+				}
+				if state.paid && pay(router, id, "58.80") != http.StatusCreated {
+					t.Fatal("paying the invoice failed")
+				}
+				if state.credited {
+					if w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/credit-notes", id), "{}"); w.Code != http.StatusCreated {
+						t.Fatalf("crediting: got %d %q", w.Code, w.Body.String())
+					}
+				}
+				before := getInvoice(t, router, id)
+				if before.Status != state.name {
+					t.Fatalf("invoice is %s, want %s", before.Status, state.name)
+				}
+
+				path := fmt.Sprintf(edit.path, id)
+				if edit.line > 0 {
+					path = fmt.Sprintf(edit.path, id, before.Items[edit.line-1].ID)
+				}
+				w := serveAs(router, "admin-session", "1", edit.method, path, edit.body)
+				want, wantTotal := edit.want, edit.wantTotal
+				if state.name != "draft" {
+					want, wantTotal = http.StatusConflict, "58.80"
+				}
+				if w.Code != want {
+					t.Errorf("got %d %q, want %d", w.Code, w.Body.String(), want)
+				}
+
+				after := getInvoice(t, router, id)
+				if after.Status != state.name || after.TotalPrice.String() != wantTotal {
+					t.Errorf("got %s at %s, want %s at %s", after.Status, after.TotalPrice, state.name, wantTotal)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/einvoice"
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/pdfrender"
+	"invoice-app/tax"
+)
+
+// formatFacturX asks for an invoice PDF as a Factur-X (ZUGFeRD) e-invoice.
+const formatFacturX = "factur-x"
+
+// facturXDisabled explains why a server whose PDFs do not embed their fonts
+// cannot send Factur-X.
+const facturXDisabled = "Factur-X PDFs are turned off on this server: PDF/A needs embedded fonts, so PDF_FONT_DIR must be set to a directory of TrueType fonts"
+
+// writeFacturX sends an invoice as a Factur-X PDF: PDF/A-3 with the invoice
+// inside as EN 16931 CII XML, which the buyer's software reads instead of
+// the pages.
+func (h *Handler) writeFacturX(w http.ResponseWriter, r *http.Request, data InvoicePDFData) {
+	if !pdfrender.EmbedsFonts(h.renderer) {
+		http.Error(w, facturXDisabled, http.StatusNotImplemented)
+		return
+	}
+
+	inv, ok := h.loadEInvoice(w, r, data.ID, einvoice.Validate)
+	if !ok {
+		return
+	}
+	xml, err := einvoice.CII(inv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !h.preparePDF(w, r, &data) {
+		return
+	}
+	pdf, ok := h.renderPDF(w, data)
+	if !ok {
+		return
+	}
+	pdf, err = pdfrender.PDFA3(pdf, pdfrender.Archive{
+		Title: data.Title() + " " + data.Number,
+		Attachments: []pdfrender.Attachment{{
+			Name:         einvoice.FacturXFilename,
+			MIMEType:     "text/xml",
+			Description:  "Factur-X invoice",
+			Relationship: "Alternative",
+			Data:         xml,
+		}},
+		Metadata: einvoice.FacturXMetadata,
+	})
+	if errors.Is(err, pdfrender.ErrFontsNotEmbedded) {
+		http.Error(w, facturXDisabled, http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		log.Println("Converting PDF to PDF/A-3:", err)
+		http.Error(w, "Failed to generate PDF", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=invoice_%s.pdf", data.Number))
+	w.Write(pdf)
+}
+
+// GenerateInvoiceUBL sends an invoice as Peppol BIS Billing 3.0 UBL XML,
+// the e-invoice public-sector buyers across Europe take over the Peppol
+// network.
+func (h *Handler) GenerateInvoiceUBL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	inv, ok := h.loadEInvoice(w, r, id, einvoice.ValidatePeppol)
+	if !ok {
+		return
+	}
+	h.writeUBL(w, inv, fmt.Sprintf("invoice_%s.xml", inv.Number))
+}
+
+// GenerateCreditNoteUBL sends a credit note as a Peppol BIS Billing 3.0 UBL
+// credit note, referring to the invoice it credits.
+func (h *Handler) GenerateCreditNoteUBL(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid credit note ID", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.loadCreditNote(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Credit note not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// The parties and how the buyer is referred to are the invoice's
+	credited, _, err := h.eInvoice(organizationID(r), note.InvoiceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	inv := einvoice.Invoice{
+		Number:           note.CreditNoteNumber,
+		IssueDate:        note.CreatedAt,
+		PaymentTerms:     "Deducted from invoice " + note.InvoiceNumber,
+		Currency:         note.Currency,
+		PaymentReference: credited.PaymentReference,
+		BuyerReference:   credited.BuyerReference,
+		Note:             note.Reason,
+		CreditNote:       true,
+		Preceding:        note.InvoiceNumber,
+		PrecedingDate:    credited.IssueDate,
+		Seller:           credited.Seller,
+		Buyer:            credited.Buyer,
+		Payment:          credited.Payment,
+	}
+
+	adjusted := map[vatGroup]money.Money{}
+	taxed := map[vatGroup]money.Money{}
+	var groups []vatGroup
+	for _, item := range note.Items {
+		line := einvoice.Line{
+			ID:        strconv.Itoa(len(inv.Lines) + 1),
+			Name:      item.Product.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Discount:  item.DiscountAmount,
+			NetAmount: item.TotalPrice,
+			Category:  vatCategory(item.TaxRate, item.Untaxed),
+			TaxRate:   item.TaxRate,
+		}
+		inv.Lines = append(inv.Lines, line)
+
+		group := vatGroup{line.Category, line.TaxRate}
+		if _, ok := adjusted[group]; !ok {
+			adjusted[group] = money.Zero(inv.Currency)
+			taxed[group] = money.Zero(inv.Currency)
+			groups = append(groups, group)
+		}
+		adjusted[group] = adjusted[group].Add(item.AdjustmentAmount)
+		taxed[group] = taxed[group].Add(item.TaxAmount)
+	}
+	// As on the PDF, the credit note's share of each of the invoice's
+	// adjustments
+	adjustments, err := h.invoiceAdjustments(note.InvoiceID, note.Currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	allowanceCharges(&inv, adjustments, credited.LineTotal, adjusted, groups)
+	taxSubtotals(&inv, groups, adjusted, taxed)
+	inv.LineTotal = note.Subtotal
+	inv.TaxBasisTotal = note.Subtotal.Add(note.AdjustmentTotal)
+	inv.TaxTotal = note.TaxTotal
+	inv.GrandTotal = note.TotalPrice
+	inv.Prepaid = money.Zero(inv.Currency)
+	inv.DuePayable = note.TotalPrice
+
+	if !checkEInvoice(w, inv, einvoice.ValidatePeppol) {
+		return
+	}
+	h.writeUBL(w, inv, fmt.Sprintf("credit_note_%s.xml", inv.Number))
+}
+
+func (h *Handler) writeUBL(w http.ResponseWriter, inv einvoice.Invoice, filename string) {
+	xml, err := einvoice.UBL(inv)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", "attachment; filename="+filename)
+	w.Write(xml)
+}
+
+// loadEInvoice loads an invoice as an e-invoice and checks it can be sent
+// as one, writing the error and returning false if it cannot: 409 for a
+// draft or void invoice, and 422 for one that validate rejects.
+func (h *Handler) loadEInvoice(w http.ResponseWriter, r *http.Request, id int, validate func(einvoice.Invoice) error) (einvoice.Invoice, bool) {
+	inv, status, err := h.eInvoice(organizationID(r), id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return inv, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return inv, false
+	}
+	if status == lifecycle.StateDraft || status == lifecycle.StateVoid {
+		http.Error(w, fmt.Sprintf("Cannot e-invoice a %s invoice; finalize it first", status), http.StatusConflict)
+		return inv, false
+	}
+	return inv, checkEInvoice(w, inv, validate)
+}
+
+// checkEInvoice validates an e-invoice, writing 422 listing every problem
+// and returning false if it is missing what the standard requires.
+func checkEInvoice(w http.ResponseWriter, inv einvoice.Invoice, validate func(einvoice.Invoice) error) bool {
+	err := validate(inv)
+	if err == nil {
+		return true
+	}
+	var invalid *einvoice.Error
+	if !errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(invalid)
+	return false
+}
+
+// eInvoice loads an organization's invoice, its seller and the customer as
+// billed, as an EN 16931 e-invoice, and the state the invoice is in.
+func (h *Handler) eInvoice(organizationID, id int) (einvoice.Invoice, lifecycle.State, error) {
+	var inv einvoice.Invoice
+	var status lifecycle.State
+	var subtotal, adjustmentTotal, taxTotal, total, paid money.Money
+	var terms string
+	var termDays int
+	var due sql.NullTime
+	var createdAt time.Time
+	var finalizedAt *time.Time
+	var customerName, customerAddress, customerCountry, customerPeppolID sql.NullString
+	err := h.db.QueryRow(`
+		SELECT i.invoice_number, i.status, i.currency, i.subtotal, i.adjustment_total, i.tax_total, i.total_price, i.amount_paid,
+		       i.payment_terms, i.payment_term_days, i.due_date, i.created_at, i.finalized_at,
+		       i.customer_name, i.customer_address, i.customer_country, c.peppol_id, COALESCE(c.buyer_reference, '')
+		FROM invoices i
+		LEFT JOIN customers c ON i.customer_id = c.id
+		WHERE i.id = ? AND i.organization_id = ?`, id, organizationID).
+		Scan(&inv.Number, &status, &inv.Currency, &subtotal, &adjustmentTotal, &taxTotal, &total, &paid,
+			&terms, &termDays, &due, &createdAt, &finalizedAt,
+			&customerName, &customerAddress, &customerCountry, &customerPeppolID, &inv.BuyerReference)
+	if err != nil {
+		return inv, "", err
+	}
+	for _, m := range []*money.Money{&subtotal, &adjustmentTotal, &taxTotal, &total, &paid} {
+		m.Currency = inv.Currency
+	}
+
+	// An invoice is issued when it is finalized
+	inv.IssueDate = createdAt
+	if finalizedAt != nil {
+		inv.IssueDate = *finalizedAt
+	}
+	if due.Valid {
+		inv.DueDate = due.Time
+	}
+	inv.PaymentTerms = paymentTermsLabel(terms, termDays)
+	inv.PaymentReference = inv.Number
+
+	company, _, err := companyProfile(h.db, organizationID)
+	if err != nil {
+		return inv, "", err
+	}
+	inv.Seller = einvoice.Party{
+		Name:               company.LegalName,
+		TradingName:        company.TradingName,
+		Address:            company.Address,
+		Country:            company.Country,
+		CountryCode:        einvoice.CountryCode(company.Country),
+		TaxID:              company.TaxID,
+		RegistrationNumber: company.RegistrationNumber,
+		Email:              company.Email,
+		Phone:              company.Phone,
+		PeppolID:           company.PeppolID,
+	}
+	if company.IBAN != "" {
+		inv.Payment = &einvoice.PaymentMeans{IBAN: company.IBAN, AccountHolder: company.AccountHolder, BIC: company.BIC}
+	}
+	inv.Buyer = einvoice.Party{
+		Name:        customerName.String,
+		Address:     customerAddress.String,
+		Country:     customerCountry.String,
+		CountryCode: einvoice.CountryCode(customerCountry.String),
+		// The customer is addressed where they receive e-invoices now
+		PeppolID: customerPeppolID.String,
+	}
+
+	// Lines in the order the PDF lists them, and the share of the
+	// invoice's adjustments and the tax each category and rate's lines took
+	rows, err := h.db.Query(`
+		SELECT quantity, unit_price, discount_amount, total_price, adjustment_amount, tax_rate, tax_amount, untaxed, product_name
+		FROM invoice_items
+		WHERE invoice_id = ?
+		ORDER BY product_name
+	`, id)
+	if err != nil {
+		return inv, "", err
+	}
+	defer rows.Close()
+
+	adjusted := map[vatGroup]money.Money{}
+	taxed := map[vatGroup]money.Money{}
+	var groups []vatGroup
+	for rows.Next() {
+		var line einvoice.Line
+		var adjustment, lineTax money.Money
+		var untaxed bool
+		if err := rows.Scan(&line.Quantity, &line.UnitPrice, &line.Discount, &line.NetAmount, &adjustment, &line.TaxRate, &lineTax, &untaxed, &line.Name); err != nil {
+			return inv, "", err
+		}
+		line.ID = strconv.Itoa(len(inv.Lines) + 1)
+		line.Category = vatCategory(line.TaxRate, untaxed)
+		line.UnitPrice.Currency = inv.Currency
+		line.Discount.Currency = inv.Currency
+		line.NetAmount.Currency = inv.Currency
+		adjustment.Currency = inv.Currency
+		lineTax.Currency = inv.Currency
+		inv.Lines = append(inv.Lines, line)
+
+		group := vatGroup{line.Category, line.TaxRate}
+		if _, ok := adjusted[group]; !ok {
+			adjusted[group] = money.Zero(inv.Currency)
+			taxed[group] = money.Zero(inv.Currency)
+			groups = append(groups, group)
+		}
+		adjusted[group] = adjusted[group].Add(adjustment)
+		taxed[group] = taxed[group].Add(lineTax)
+	}
+	if err := rows.Err(); err != nil {
+		return inv, "", err
+	}
+
+	// Each adjustment becomes a discount or surcharge on each category and
+	// rate
+	adjustments, err := h.invoiceAdjustments(id, inv.Currency)
+	if err != nil {
+		return inv, "", err
+	}
+	allowanceCharges(&inv, adjustments, subtotal, adjusted, groups)
+	taxSubtotals(&inv, groups, adjusted, taxed)
+
+	inv.LineTotal = subtotal
+	inv.TaxBasisTotal = subtotal.Add(adjustmentTotal)
+	inv.TaxTotal = taxTotal
+	inv.GrandTotal = total
+	inv.Prepaid = paid
+	inv.DuePayable = total.Sub(paid)
+	return inv, status, nil
+}
+
+// vatGroup is a VAT category and rate, which an e-invoice's discounts,
+// surcharges and tax are given for.
+type vatGroup struct {
+	Category string
+	Rate     tax.Rate
+}
+
+// vatCategory is the VAT category of a line taxed at rate, or not subject to
+// VAT if it was untaxed: its product had no tax category or rule.
+func vatCategory(rate tax.Rate, untaxed bool) string {
+	if untaxed {
+		return einvoice.CategoryNotSubject
+	}
+	return einvoice.Category(rate)
+}
+
+// allowanceCharges sets inv's discounts and surcharges: one for each of
+// adjustments, which were spread over lines coming to subtotal, on each of
+// groups, for its share of inv's lines in that group. A surcharge and a
+// discount on the same group stay apart rather than netting out. adjusted is
+// what the adjustments came to on each group's lines as stored, which tax was
+// charged on; the largest adjustment takes up the rounding so each group's
+// discounts and surcharges add up to it.
+func allowanceCharges(inv *einvoice.Invoice, adjustments []models.InvoiceAdjustment, subtotal money.Money, adjusted map[vatGroup]money.Money, groups []vatGroup) {
+	inv.AllowanceTotal = money.Zero(inv.Currency)
+	inv.ChargeTotal = money.Zero(inv.Currency)
+	if len(adjustments) == 0 {
+		return
+	}
+
+	net := lineTotals(inv)
+	largest := 0
+	for i, adj := range adjustments {
+		if magnitude(adj.Amount) > magnitude(adjustments[largest].Amount) {
+			largest = i
+		}
+	}
+
+	for _, group := range groups {
+		parts := make([]money.Money, len(adjustments))
+		sum := money.Zero(inv.Currency)
+		for i, adj := range adjustments {
+			parts[i] = money.Zero(inv.Currency)
+			if !subtotal.IsZero() {
+				parts[i] = adj.Amount.MulRatio(net[group].Amount, subtotal.Amount)
+			}
+			sum = sum.Add(parts[i])
+		}
+		parts[largest] = parts[largest].Add(adjusted[group].Sub(sum))
+
+		for i, part := range parts {
+			if part.IsZero() {
+				continue
+			}
+			ac := einvoice.AllowanceCharge{Charge: part.IsPositive(), Amount: part, Reason: adjustmentLabel(adjustments[i]), Category: group.Category, TaxRate: group.Rate}
+			if ac.Charge {
+				inv.ChargeTotal = inv.ChargeTotal.Add(part)
+			} else {
+				ac.Amount = part.Neg()
+				inv.AllowanceTotal = inv.AllowanceTotal.Add(ac.Amount)
+			}
+			inv.AllowanceCharges = append(inv.AllowanceCharges, ac)
+		}
+	}
+}
+
+// taxSubtotals sets inv's VAT breakdown, highest rate first: for each of
+// groups, what its lines and their share of the adjustments (adjusted) come
+// to, which tax was charged on, and the tax charged on its lines (taxed).
+func taxSubtotals(inv *einvoice.Invoice, groups []vatGroup, adjusted, taxed map[vatGroup]money.Money) {
+	net := lineTotals(inv)
+	for _, group := range groups {
+		inv.TaxSubtotals = append(inv.TaxSubtotals, einvoice.TaxSubtotal{
+			Category: group.Category,
+			Rate:     group.Rate,
+			Taxable:  net[group].Add(adjusted[group]),
+			Tax:      taxed[group],
+		})
+	}
+	sort.SliceStable(inv.TaxSubtotals, func(i, j int) bool {
+		return inv.TaxSubtotals[i].Rate > inv.TaxSubtotals[j].Rate
+	})
+}
+
+// lineTotals is what inv's lines come to in each VAT category and rate.
+func lineTotals(inv *einvoice.Invoice) map[vatGroup]money.Money {
+	net := map[vatGroup]money.Money{}
+	for _, line := range inv.Lines {
+		group := vatGroup{line.Category, line.TaxRate}
+		if _, ok := net[group]; !ok {
+			net[group] = money.Zero(inv.Currency)
+		}
+		net[group] = net[group].Add(line.NetAmount)
+	}
+	return net
+}
+
+// magnitude is m's amount in minor units, whatever its sign.
+func magnitude(m money.Money) int64 {
+	if m.IsNegative() {
+		return -m.Amount
+	}
+	return m.Amount
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"invoice-app/einvoice"
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+func eur(cents int64) money.Money {
+	return money.New(cents, "EUR")
+}
+
+// validEInvoice is an invoice in currency that passes EN 16931 and Peppol:
+// 290.00 at 20% and 30.00 at 0%, with a discount of 29.00 and a surcharge
+// of 5.00 on the 20% lines, and 49.20 of it paid.
+func validEInvoice(currency string) einvoice.Invoice {
+	amount := func(cents int64) money.Money { return money.New(cents, currency) }
+	return einvoice.Invoice{
+		Number:         "INV-2026-00001",
+		IssueDate:      time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		DueDate:        time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC),
+		PaymentTerms:   "Net 30 days",
+		Currency:       currency,
+		BuyerReference: "PO-4711",
+		Seller:         einvoice.Party{Name: "Acme GmbH", CountryCode: "DE", TaxID: "DE123456789", PeppolID: "0088:5790000435975"},
+		Buyer:          einvoice.Party{Name: "John Smith", CountryCode: "FR", PeppolID: "9957:FR12345678901"},
+		Payment:        &einvoice.PaymentMeans{IBAN: "DE89370400440532013000"},
+		Lines: []einvoice.Line{
+			{ID: "1", Name: "Consulting", Quantity: 3, UnitPrice: amount(10000), Discount: amount(1000), NetAmount: amount(29000), Category: "S", TaxRate: 2000},
+			{ID: "2", Name: "Books", Quantity: 2, UnitPrice: amount(1500), Discount: amount(0), NetAmount: amount(3000), Category: "Z", TaxRate: 0},
+		},
+		AllowanceCharges: []einvoice.AllowanceCharge{
+			{Amount: amount(2900), Reason: "Discount", Category: "S", TaxRate: 2000},
+			{Charge: true, Amount: amount(500), Reason: "Surcharge: Shipping", Category: "S", TaxRate: 2000},
+		},
+		TaxSubtotals: []einvoice.TaxSubtotal{
+			{Category: "S", Rate: 2000, Taxable: amount(26600), Tax: amount(5320)},
+			{Category: "Z", Rate: 0, Taxable: amount(3000), Tax: amount(0)},
+		},
+		LineTotal:      amount(32000),
+		AllowanceTotal: amount(2900),
+		ChargeTotal:    amount(500),
+		TaxBasisTotal:  amount(29600),
+		TaxTotal:       amount(5320),
+		GrandTotal:     amount(34920),
+		Prepaid:        amount(4920),
+		DuePayable:     amount(30000),
+	}
+}
+
+// notSubject makes inv's lines and adjustments not subject to VAT, from a
+// seller with no VAT number.
+func notSubject(inv *einvoice.Invoice) {
+	inv.Seller.TaxID = "12/345/67890"
+	for i := range inv.Lines {
+		inv.Lines[i].Category, inv.Lines[i].TaxRate = "O", 0
+	}
+	for i := range inv.AllowanceCharges {
+		inv.AllowanceCharges[i].Category, inv.AllowanceCharges[i].TaxRate = "O", 0
+	}
+	inv.TaxSubtotals = []einvoice.TaxSubtotal{{Category: "O", Taxable: eur(29600), Tax: eur(0)}}
+	inv.TaxTotal, inv.GrandTotal, inv.DuePayable = eur(0), eur(29600), eur(24680)
+}
+
+func TestCheckEInvoice(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		validate func(einvoice.Invoice) error
+		change   func(inv *einvoice.Invoice)
+		want     []string // the rules broken, or none if it passes
+	}{
+		{"valid", einvoice.Validate, func(inv *einvoice.Invoice) {}, nil},
+		{"valid for Peppol", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) {}, nil},
+		{"credit note", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.CreditNote, inv.Preceding = true, "INV-2025-00042" }, nil},
+		{"EN 16931 without a buyer reference", einvoice.Validate, func(inv *einvoice.Invoice) { inv.BuyerReference = "" }, nil},
+		{"surcharges exceed discounts", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) {
+			inv.AllowanceCharges[1].Amount = eur(4000)
+			inv.ChargeTotal = eur(4000)
+			inv.TaxSubtotals[0] = einvoice.TaxSubtotal{Category: "S", Rate: 2000, Taxable: eur(30100), Tax: eur(6020)}
+			inv.TaxBasisTotal, inv.TaxTotal, inv.GrandTotal, inv.DuePayable = eur(33100), eur(6020), eur(39120), eur(34200)
+		}, nil},
+
+		{"no number", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Number = " " }, []string{"BR-02"}},
+		{"no issue date", einvoice.Validate, func(inv *einvoice.Invoice) { inv.IssueDate = time.Time{} }, []string{"BR-03"}},
+		{"currency not a code", einvoice.Validate, func(inv *einvoice.Invoice) { *inv = validEInvoice("EURO") }, []string{"BR-05"}},
+		{"credit note without the invoice", einvoice.Validate, func(inv *einvoice.Invoice) { inv.CreditNote = true }, []string{"BR-55"}},
+		{"no seller name", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Seller.Name = "" }, []string{"BR-06"}},
+		{"no seller country", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Seller.CountryCode = "" }, []string{"BR-09"}},
+		{"no seller tax ID", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Seller.TaxID = "" }, []string{"BR-S-02", "BR-Z-02"}},
+		{"no seller tax ID, standard-rated lines", einvoice.Validate, func(inv *einvoice.Invoice) {
+			inv.Seller.TaxID = ""
+			inv.Lines[1].Category, inv.Lines[1].TaxRate = "S", 2000
+			inv.TaxSubtotals = []einvoice.TaxSubtotal{{Category: "S", Rate: 2000, Taxable: eur(29600), Tax: eur(5920)}}
+			inv.TaxTotal, inv.GrandTotal, inv.DuePayable = eur(5920), eur(35520), eur(30600)
+		}, []string{"BR-S-02"}},
+		{"no seller tax ID, zero-rated lines", einvoice.Validate, func(inv *einvoice.Invoice) {
+			inv.Seller.TaxID = ""
+			inv.Lines[0].Category, inv.Lines[0].TaxRate = "Z", 0
+			for i := range inv.AllowanceCharges {
+				inv.AllowanceCharges[i].Category, inv.AllowanceCharges[i].TaxRate = "Z", 0
+			}
+			inv.TaxSubtotals = []einvoice.TaxSubtotal{{Category: "Z", Rate: 0, Taxable: eur(29600), Tax: eur(0)}}
+			inv.TaxTotal, inv.GrandTotal, inv.DuePayable = eur(0), eur(29600), eur(24680)
+		}, []string{"BR-Z-02"}},
+		{"not subject to VAT", einvoice.ValidatePeppol, notSubject, nil},
+		{"not subject to VAT, seller has a VAT number", einvoice.Validate, func(inv *einvoice.Invoice) {
+			notSubject(inv)
+			inv.Seller.TaxID = "DE123456789"
+		}, []string{"BR-O-02"}},
+		{"not subject to VAT, buyer has a VAT number", einvoice.Validate, func(inv *einvoice.Invoice) {
+			notSubject(inv)
+			inv.Buyer.TaxID = "FR12345678901"
+		}, []string{"BR-O-02"}},
+		{"not subject to VAT with other categories", einvoice.Validate, func(inv *einvoice.Invoice) {
+			inv.Seller.TaxID = ""
+			inv.Lines[1].Category = "O"
+			inv.TaxSubtotals[1].Category = "O"
+		}, []string{"BR-O-11", "BR-S-02"}},
+		{"not subject to VAT taxable amount", einvoice.Validate, func(inv *einvoice.Invoice) {
+			notSubject(inv)
+			inv.TaxSubtotals[0].Taxable = eur(29000)
+		}, []string{"BR-O-08"}},
+		{"no buyer name", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Buyer.Name = "" }, []string{"BR-07"}},
+		{"no buyer country", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Buyer.CountryCode = "" }, []string{"BR-11"}},
+		{"no lines", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Lines = nil }, []string{"BR-16", "BR-CO-10", "BR-CO-13", "BR-S-08", "BR-Z-08"}},
+		{"no item name", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Lines[0].Name = "" }, []string{"BR-25"}},
+		{"no quantity", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Lines[1].Quantity = 0 }, []string{"BR-22", "BT-131"}},
+		{"negative price", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Lines[1].UnitPrice, inv.Lines[1].Discount = eur(-1500), eur(-6000) }, []string{"BR-27"}},
+		{"net amount does not add up", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Lines[0].Discount = eur(0) }, []string{"BT-131"}},
+		{"amount due without terms", einvoice.Validate, func(inv *einvoice.Invoice) { inv.DueDate, inv.PaymentTerms = time.Time{}, "" }, []string{"BR-CO-25"}},
+		{"credit transfer without an account", einvoice.Validate, func(inv *einvoice.Invoice) { inv.Payment.IBAN = "" }, []string{"BR-61"}},
+		{"line total", einvoice.Validate, func(inv *einvoice.Invoice) { inv.LineTotal = eur(33000) }, []string{"BR-CO-10"}},
+		{"allowance total", einvoice.Validate, func(inv *einvoice.Invoice) { inv.AllowanceTotal = eur(3000) }, []string{"BR-CO-11"}},
+		{"charge total", einvoice.Validate, func(inv *einvoice.Invoice) { inv.ChargeTotal = eur(600) }, []string{"BR-CO-12"}},
+		{"surcharges netted into a discount", einvoice.Validate, func(inv *einvoice.Invoice) {
+			inv.AllowanceCharges = inv.AllowanceCharges[:1]
+			inv.AllowanceCharges[0].Amount = eur(2400)
+		}, []string{"BR-CO-11", "BR-CO-12"}},
+		{"total without tax", einvoice.Validate, func(inv *einvoice.Invoice) { inv.TaxBasisTotal = eur(30000) }, []string{"BR-CO-13", "BR-CO-15"}},
+		{"tax total", einvoice.Validate, func(inv *einvoice.Invoice) { inv.TaxSubtotals[0].Tax = eur(5300) }, []string{"BR-CO-14"}},
+		{"grand total", einvoice.Validate, func(inv *einvoice.Invoice) { inv.GrandTotal, inv.Prepaid = eur(35000), eur(5000) }, []string{"BR-CO-15"}},
+		{"amount due", einvoice.Validate, func(inv *einvoice.Invoice) { inv.DuePayable = eur(29900) }, []string{"BR-CO-16"}},
+		{"standard-rated taxable amount", einvoice.Validate, func(inv *einvoice.Invoice) { inv.TaxSubtotals[0].Taxable = eur(27000) }, []string{"BR-S-08"}},
+		{"zero-rated taxable amount", einvoice.Validate, func(inv *einvoice.Invoice) { inv.TaxSubtotals[1].Taxable = eur(3100) }, []string{"BR-Z-08"}},
+
+		{"no buyer reference", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.BuyerReference = "" }, []string{"PEPPOL-EN16931-R003"}},
+		{"no seller Peppol ID", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.Seller.PeppolID = "" }, []string{"PEPPOL-EN16931-R020"}},
+		{"no buyer Peppol ID", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.Buyer.PeppolID = "" }, []string{"PEPPOL-EN16931-R010"}},
+		{"Peppol ID without a scheme", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.Buyer.PeppolID = "FR12345678901" }, []string{"PEPPOL-EN16931-CL008"}},
+		{"GLN check digit wrong", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.Seller.PeppolID = "0088:5790000435976" }, []string{"PEPPOL-EN16931-CL008"}},
+		{"Peppol rules on top of EN 16931", einvoice.ValidatePeppol, func(inv *einvoice.Invoice) { inv.Number, inv.BuyerReference = "", "" }, []string{"BR-02", "PEPPOL-EN16931-R003"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := validEInvoice("EUR")
+			tt.change(&inv)
+			w := httptest.NewRecorder()
+			ok := checkEInvoice(w, inv, tt.validate)
+
+			if tt.want == nil {
+				if !ok || w.Body.Len() > 0 {
+					t.Fatalf("rejected with %d %s", w.Code, w.Body)
+				}
+				return
+			}
+			if ok || w.Code != http.StatusUnprocessableEntity {
+				t.Fatalf("got %v and %d, want %d", ok, w.Code, http.StatusUnprocessableEntity)
+			}
+			var body einvoice.Error
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			var rules []string
+			for _, p := range body.Problems {
+				if p.Field == "" || p.Message == "" {
+					t.Errorf("%s has no field or message: %+v", p.Rule, p)
+				}
+				rules = append(rules, p.Rule)
+			}
+			sort.Strings(rules)
+			sort.Strings(tt.want)
+			if body.Code != einvoice.CodeInvalid || !reflect.DeepEqual(rules, tt.want) {
+				t.Errorf("got %s %v, want %s %v", body.Code, rules, einvoice.CodeInvalid, tt.want)
+			}
+		})
+	}
+
+	// Anything but a broken rule is the server's fault
+	w := httptest.NewRecorder()
+	if checkEInvoice(w, validEInvoice("EUR"), func(einvoice.Invoice) error { return errors.New("boom") }) || w.Code != http.StatusInternalServerError {
+		t.Errorf("got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+}
+
+func TestAllowanceChargesKeepSurchargesApart(t *testing.T) {
+	discount := models.InvoiceAdjustment{Kind: models.AdjustmentDiscount, Type: models.DiscountPercent, Value: "10", Amount: eur(-1500)}
+	shipping := models.InvoiceAdjustment{Kind: models.AdjustmentSurcharge, Type: models.DiscountFixed, Value: "30.00", Description: "Shipping", Amount: eur(3000)}
+	lines := func(amounts map[tax.Rate]int64) []einvoice.Line {
+		var lines []einvoice.Line
+		for _, rate := range []tax.Rate{2000, 700} {
+			if cents, ok := amounts[rate]; ok {
+				lines = append(lines, einvoice.Line{NetAmount: eur(cents), Category: "S", TaxRate: rate})
+			}
+		}
+		return lines
+	}
+	standard := func(rate tax.Rate) vatGroup { return vatGroup{einvoice.CategoryStandard, rate} }
+
+	for _, tt := range []struct {
+		name        string
+		lines       []einvoice.Line
+		adjustments []models.InvoiceAdjustment
+		subtotal    money.Money
+		adjusted    map[vatGroup]money.Money
+		want        []einvoice.AllowanceCharge
+	}{
+		{
+			// 10% off 150.00 and 30.00 shipping come to 15.00 more, 10.00 of
+			// it on the 20% lines and 5.00 on the 7% ones
+			name:        "surcharge larger than the discount",
+			lines:       lines(map[tax.Rate]int64{2000: 10000, 700: 5000}),
+			adjustments: []models.InvoiceAdjustment{discount, shipping},
+			subtotal:    eur(15000),
+			adjusted:    map[vatGroup]money.Money{standard(2000): eur(1000), standard(700): eur(500)},
+			want: []einvoice.AllowanceCharge{
+				{Amount: eur(1000), Reason: "Discount (10%)", Category: "S", TaxRate: 2000},
+				{Charge: true, Amount: eur(2000), Reason: "Surcharge: Shipping", Category: "S", TaxRate: 2000},
+				{Amount: eur(500), Reason: "Discount (10%)", Category: "S", TaxRate: 700},
+				{Charge: true, Amount: eur(1000), Reason: "Surcharge: Shipping", Category: "S", TaxRate: 700},
+			},
+		},
+		{
+			name:        "surcharge and discount cancel out",
+			lines:       lines(map[tax.Rate]int64{2000: 30000}),
+			adjustments: []models.InvoiceAdjustment{{Kind: models.AdjustmentDiscount, Amount: eur(-3000)}, shipping},
+			subtotal:    eur(30000),
+			adjusted:    map[vatGroup]money.Money{standard(2000): eur(0)},
+			want: []einvoice.AllowanceCharge{
+				{Amount: eur(3000), Reason: "Discount", Category: "S", TaxRate: 2000},
+				{Charge: true, Amount: eur(3000), Reason: "Surcharge: Shipping", Category: "S", TaxRate: 2000},
+			},
+		},
+		{
+			// The shares come to a cent off what was allocated; the discount,
+			// the larger, takes it up
+			name:        "rounding",
+			lines:       lines(map[tax.Rate]int64{2000: 3333, 700: 6667}),
+			adjustments: []models.InvoiceAdjustment{{Kind: models.AdjustmentDiscount, Amount: eur(-1000)}, {Kind: models.AdjustmentSurcharge, Amount: eur(500)}},
+			subtotal:    eur(10000),
+			adjusted:    map[vatGroup]money.Money{standard(2000): eur(-167), standard(700): eur(-333)},
+			want: []einvoice.AllowanceCharge{
+				{Amount: eur(334), Reason: "Discount", Category: "S", TaxRate: 2000},
+				{Charge: true, Amount: eur(167), Reason: "Surcharge", Category: "S", TaxRate: 2000},
+				{Amount: eur(666), Reason: "Discount", Category: "S", TaxRate: 700},
+				{Charge: true, Amount: eur(333), Reason: "Surcharge", Category: "S", TaxRate: 700},
+			},
+		},
+		{
+			// A credit note for the 20% lines of the first invoice
+			name:        "credit note",
+			lines:       lines(map[tax.Rate]int64{2000: 10000}),
+			adjustments: []models.InvoiceAdjustment{discount, shipping},
+			subtotal:    eur(15000),
+			adjusted:    map[vatGroup]money.Money{standard(2000): eur(1000)},
+			want: []einvoice.AllowanceCharge{
+				{Amount: eur(1000), Reason: "Discount (10%)", Category: "S", TaxRate: 2000},
+				{Charge: true, Amount: eur(2000), Reason: "Surcharge: Shipping", Category: "S", TaxRate: 2000},
+			},
+		},
+		{
+			// Lines at 0% under a rule and lines without one each take
+			// their share
+			name: "zero-rated and not subject to VAT",
+			lines: []einvoice.Line{
+				{NetAmount: eur(6000), Category: "Z"},
+				{NetAmount: eur(4000), Category: "O"},
+			},
+			adjustments: []models.InvoiceAdjustment{{Kind: models.AdjustmentDiscount, Amount: eur(-1000)}},
+			subtotal:    eur(10000),
+			adjusted:    map[vatGroup]money.Money{{"Z", 0}: eur(-600), {"O", 0}: eur(-400)},
+			want: []einvoice.AllowanceCharge{
+				{Amount: eur(600), Reason: "Discount", Category: "Z"},
+				{Amount: eur(400), Reason: "Discount", Category: "O"},
+			},
+		},
+		{
+			name:     "no adjustments",
+			lines:    lines(map[tax.Rate]int64{2000: 10000}),
+			subtotal: eur(10000),
+			adjusted: map[vatGroup]money.Money{standard(2000): eur(0)},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			inv := einvoice.Invoice{Currency: "EUR", Lines: tt.lines}
+			var groups []vatGroup
+			for _, line := range tt.lines {
+				groups = append(groups, vatGroup{line.Category, line.TaxRate})
+			}
+			allowanceCharges(&inv, tt.adjustments, tt.subtotal, tt.adjusted, groups)
+
+			if !reflect.DeepEqual(inv.AllowanceCharges, tt.want) {
+				t.Errorf("got %+v, want %+v", inv.AllowanceCharges, tt.want)
+			}
+
+			// Each group's discounts and surcharges come to what tax was
+			// charged on, as BR-S-08 checks, and the totals add them up
+			allowances, charges := eur(0), eur(0)
+			net := map[vatGroup]money.Money{}
+			for group := range tt.adjusted {
+				net[group] = eur(0)
+			}
+			for _, ac := range inv.AllowanceCharges {
+				if ac.Charge {
+					charges = charges.Add(ac.Amount)
+					group := vatGroup{ac.Category, ac.TaxRate}
+					net[group] = net[group].Add(ac.Amount)
+				} else {
+					allowances = allowances.Add(ac.Amount)
+					group := vatGroup{ac.Category, ac.TaxRate}
+					net[group] = net[group].Sub(ac.Amount)
+				}
+			}
+			for group, want := range tt.adjusted {
+				if !net[group].Sub(want).IsZero() {
+					t.Errorf("%s %s%%: adjustments come to %s, want %s", group.Category, group.Rate, net[group], want)
+				}
+			}
+			if inv.AllowanceTotal != allowances || inv.ChargeTotal != charges {
+				t.Errorf("totals %s and %s, want %s and %s", inv.AllowanceTotal, inv.ChargeTotal, allowances, charges)
+			}
+		})
+	}
+}
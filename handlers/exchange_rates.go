@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+	"invoice-app/money"
+)
+
+var errNoExchangeRate = errors.New("no exchange rate")
+
+// exchangeRate returns an organization's rate for currency in force on the
+// given day: the most recent rate whose effective date is not after it.
+func exchangeRate(q rowQuerier, organizationID int, currency string, on time.Time) (money.ExchangeRate, error) {
+	if currency == money.BaseCurrency {
+		return money.IdentityRate, nil
+	}
+
+	var rate money.ExchangeRate
+	err := q.QueryRow(`
+		SELECT rate FROM exchange_rates
+		WHERE organization_id = ? AND currency = ? AND effective_date <= ?
+		ORDER BY effective_date DESC
+		LIMIT 1
+	`, organizationID, currency, on.Format("2006-01-02")).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, errNoExchangeRate
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rate, nil
+}
+
+func (h *Handler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	query := "SELECT id, currency, rate, effective_date, created_at FROM exchange_rates WHERE organization_id = ?"
+	args := []interface{}{organizationID(r)}
+
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		query += " AND currency = ?"
+		args = append(args, strings.ToUpper(currency))
+	}
+
+	query += " ORDER BY currency, effective_date DESC"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var rates []models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var effectiveDate time.Time
+		if err := rows.Scan(&rate.ID, &rate.Currency, &rate.Rate, &effectiveDate, &rate.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rate.EffectiveDate = effectiveDate.Format("2006-01-02")
+		rates = append(rates, rate)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// CreateExchangeRate records the rate for a currency from a given date. A
+// second rate for the same currency and date replaces the first.
+func (h *Handler) CreateExchangeRate(w http.ResponseWriter, r *http.Request) {
+	var rate models.ExchangeRate
+	if err := json.NewDecoder(r.Body).Decode(&rate); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+	if !money.IsCurrencyCode(rate.Currency) {
+		http.Error(w, "Currency must be a three-letter ISO 4217 code", http.StatusBadRequest)
+		return
+	}
+	if rate.Currency == money.BaseCurrency {
+		http.Error(w, "Cannot set an exchange rate for the base currency", http.StatusBadRequest)
+		return
+	}
+	if rate.Rate <= 0 {
+		http.Error(w, "Exchange rate must be positive", http.StatusBadRequest)
+		return
+	}
+
+	if rate.EffectiveDate == "" {
+		rate.EffectiveDate = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", rate.EffectiveDate); err != nil {
+		http.Error(w, "Effective date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+
+	_, err := h.upsertAudited(r, auditExchangeRate,
+		"SELECT id FROM exchange_rates WHERE organization_id = ? AND currency = ? AND effective_date = ?",
+		[]interface{}{organizationID(r), rate.Currency, rate.EffectiveDate}, `
+		INSERT INTO exchange_rates (organization_id, currency, rate, effective_date) VALUES (?, ?, ?, ?)
+		ON CONFLICT (organization_id, currency, effective_date) DO UPDATE SET rate = excluded.rate
+	`, organizationID(r), rate.Currency, rate.Rate, rate.EffectiveDate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.QueryRow("SELECT id, created_at FROM exchange_rates WHERE organization_id = ? AND currency = ? AND effective_date = ?",
+		organizationID(r), rate.Currency, rate.EffectiveDate).Scan(&rate.ID, &rate.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rate)
+}
+
+func (h *Handler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid exchange rate ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditExchangeRate, int64(id), models.AuditDelete, "DELETE FROM exchange_rates WHERE id = ? AND organization_id = ?", id, organizationID(r)); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Exchange rate not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
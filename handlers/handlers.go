@@ -8,23 +8,25 @@ import (
 	"time"
 
 	"invoice-app/models"
+	"invoice-app/pdfrender"
 	"github.com/gorilla/mux"
 )
 
 type Handler struct {
-	db *sql.DB
+	db       *sql.DB
+	renderer pdfrender.Renderer
 }
 
-func New(db *sql.DB) *Handler {
-	return &Handler{db: db}
+func New(db *sql.DB, renderer pdfrender.Renderer) *Handler {
+	return &Handler{db: db, renderer: renderer}
 }
 
 func (h *Handler) GetProducts(w http.ResponseWriter, r *http.Request) {
-	query := "SELECT id, name, price, created_at FROM products"
-	var args []interface{}
+	query := "SELECT id, name, price, tax_category_id, created_at FROM products WHERE organization_id = ?"
+	args := []interface{}{organizationID(r)}
 	
 	if search := r.URL.Query().Get("search"); search != "" {
-		query += " WHERE name LIKE ?"
+		query += " AND name LIKE ?"
 		args = append(args, "%"+search+"%")
 	}
 	
@@ -40,7 +42,7 @@ func (h *Handler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	var products []models.Product
 	for rows.Next() {
 		var p models.Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.TaxCategoryID, &p.CreatedAt); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -60,8 +62,8 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var p models.Product
-	err = h.db.QueryRow("SELECT id, name, price, created_at FROM products WHERE id = ?", id).
-		Scan(&p.ID, &p.Name, &p.Price, &p.CreatedAt)
+	err = h.db.QueryRow("SELECT id, name, price, tax_category_id, created_at FROM products WHERE id = ? AND organization_id = ?", id, organizationID(r)).
+		Scan(&p.ID, &p.Name, &p.Price, &p.TaxCategoryID, &p.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Product not found", http.StatusNotFound)
@@ -86,13 +88,25 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Product name is required", http.StatusBadRequest)
 		return
 	}
-	if p.Price <= 0 {
+	if !p.Price.IsPositive() {
 		http.Error(w, "Product price must be positive", http.StatusBadRequest)
 		return
 	}
+	if p.TaxCategoryID != nil {
+		var categoryExists int
+		if err := h.db.QueryRow("SELECT COUNT(*) FROM tax_categories WHERE id = ? AND organization_id = ?",
+			*p.TaxCategoryID, organizationID(r)).Scan(&categoryExists); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if categoryExists == 0 {
+			http.Error(w, "Tax category not found", http.StatusBadRequest)
+			return
+		}
+	}
 
 	var exists int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM products WHERE name = ?", p.Name).Scan(&exists)
+	err := h.db.QueryRow("SELECT COUNT(*) FROM products WHERE organization_id = ? AND name = ?", organizationID(r), p.Name).Scan(&exists)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -102,13 +116,14 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec("INSERT INTO products (name, price) VALUES (?, ?)", p.Name, p.Price)
+	id, err := h.execAudited(r, auditProduct, 0, models.AuditCreate,
+		"INSERT INTO products (organization_id, name, price, tax_category_id) VALUES (?, ?, ?, ?)",
+		organizationID(r), p.Name, p.Price, p.TaxCategoryID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	id, _ := result.LastInsertId()
 	p.ID = int(id)
 	p.CreatedAt = time.Now()
 
@@ -135,13 +150,26 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Product name is required", http.StatusBadRequest)
 		return
 	}
-	if p.Price <= 0 {
+	if !p.Price.IsPositive() {
 		http.Error(w, "Product price must be positive", http.StatusBadRequest)
 		return
 	}
+	if p.TaxCategoryID != nil {
+		var categoryExists int
+		if err := h.db.QueryRow("SELECT COUNT(*) FROM tax_categories WHERE id = ? AND organization_id = ?",
+			*p.TaxCategoryID, organizationID(r)).Scan(&categoryExists); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if categoryExists == 0 {
+			http.Error(w, "Tax category not found", http.StatusBadRequest)
+			return
+		}
+	}
 
 	var exists int
-	err = h.db.QueryRow("SELECT COUNT(*) FROM products WHERE name = ? AND id != ?", p.Name, id).Scan(&exists)
+	err = h.db.QueryRow("SELECT COUNT(*) FROM products WHERE organization_id = ? AND name = ? AND id != ?",
+		organizationID(r), p.Name, id).Scan(&exists)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -151,15 +179,15 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.db.Exec("UPDATE products SET name = ?, price = ? WHERE id = ?", p.Name, p.Price, id)
+	_, err = h.execAudited(r, auditProduct, int64(id), models.AuditUpdate,
+		"UPDATE products SET name = ?, price = ?, tax_category_id = ? WHERE id = ? AND organization_id = ?",
+		p.Name, p.Price, p.TaxCategoryID, id, organizationID(r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Product not found", http.StatusNotFound)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -178,26 +206,52 @@ func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	err = h.db.QueryRow(`
 		SELECT COUNT(*) FROM invoice_items ii
 		JOIN invoices i ON ii.invoice_id = i.id
-		WHERE ii.product_id = ? AND i.status != 'deleted'
-	`, id).Scan(&count)
+		WHERE ii.product_id = ? AND i.organization_id = ? AND i.status != 'void'
+	`, id, organizationID(r)).Scan(&count)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	if count > 0 {
-		http.Error(w, "Cannot delete product that is used in non-deleted invoices", http.StatusBadRequest)
+		http.Error(w, "Cannot delete product that is used in invoices that are not void", http.StatusBadRequest)
 		return
 	}
 
-	result, err := h.db.Exec("DELETE FROM products WHERE id = ?", id)
+	err = h.db.QueryRow(`
+		SELECT COUNT(*) FROM recurring_invoice_items rii
+		JOIN recurring_invoices ri ON rii.recurring_invoice_id = ri.id
+		WHERE rii.product_id = ? AND ri.organization_id = ? AND ri.status != 'finished'
+	`, id, organizationID(r)).Scan(&count)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if count > 0 {
+		http.Error(w, "Cannot delete product that is used in recurring invoices", http.StatusBadRequest)
+		return
+	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Product not found", http.StatusNotFound)
+	err = h.db.QueryRow(`
+		SELECT COUNT(*) FROM quote_items qi
+		JOIN quotes q ON qi.quote_id = q.id
+		WHERE qi.product_id = ? AND q.organization_id = ?
+	`, id, organizationID(r)).Scan(&count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Cannot delete product that is used in quotes", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditProduct, int64(id), models.AuditDelete,
+		"DELETE FROM products WHERE id = ? AND organization_id = ?", id, organizationID(r)); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
@@ -9,17 +9,19 @@ import (
 	"strings"
 	"time"
 
+	"invoice-app/lifecycle"
 	"invoice-app/models"
+	"invoice-app/money"
 	"github.com/gorilla/mux"
 )
 
 func (h *Handler) GetInvoices(w http.ResponseWriter, r *http.Request) {
-	query := `SELECT i.id, i.customer_id, i.total_price, i.status, i.created_at, i.processed_at, 
-	                 c.name, c.phone, c.address, c.country
+	query := `SELECT i.id, i.invoice_number, i.customer_id, i.subtotal, i.adjustment_total, i.tax_total, i.total_price, i.currency, i.exchange_rate, i.base_total,
+	                 i.status, i.payment_terms, i.payment_term_days, i.due_date, i.amount_paid, i.amount_credited, i.created_at, i.finalized_at, i.sent_at, i.paid_at, i.voided_at, i.credited_at, 
+	                 i.customer_name, i.customer_phone, i.customer_address, i.customer_country
 	          FROM invoices i 
-	          LEFT JOIN customers c ON i.customer_id = c.id 
-	          WHERE 1=1`
-	var args []interface{}
+	          WHERE i.organization_id = ?`
+	args := []interface{}{organizationID(r)}
 
 	if createdFrom := r.URL.Query().Get("created_from"); createdFrom != "" {
 		query += " AND i.created_at >= ?"
@@ -29,13 +31,13 @@ func (h *Handler) GetInvoices(w http.ResponseWriter, r *http.Request) {
 		query += " AND i.created_at <= ?"
 		args = append(args, createdTo)
 	}
-	if processedFrom := r.URL.Query().Get("processed_from"); processedFrom != "" {
-		query += " AND i.processed_at >= ?"
-		args = append(args, processedFrom)
+	if finalizedFrom := r.URL.Query().Get("finalized_from"); finalizedFrom != "" {
+		query += " AND i.finalized_at >= ?"
+		args = append(args, finalizedFrom)
 	}
-	if processedTo := r.URL.Query().Get("processed_to"); processedTo != "" {
-		query += " AND i.processed_at <= ?"
-		args = append(args, processedTo)
+	if finalizedTo := r.URL.Query().Get("finalized_to"); finalizedTo != "" {
+		query += " AND i.finalized_at <= ?"
+		args = append(args, finalizedTo)
 	}
 	if status := r.URL.Query().Get("status"); status != "" {
 		statuses := strings.Split(status, ",")
@@ -46,23 +48,55 @@ func (h *Handler) GetInvoices(w http.ResponseWriter, r *http.Request) {
 		}
 		query += fmt.Sprintf(" AND i.status IN (%s)", strings.Join(placeholders, ","))
 	}
+	// Price filters compare totals in the base currency so that invoices in
+	// different currencies can be ranked together
 	if priceFrom := r.URL.Query().Get("price_from"); priceFrom != "" {
-		query += " AND i.total_price >= ?"
-		args = append(args, priceFrom)
+		amount, err := money.Parse(priceFrom, money.BaseCurrency)
+		if err != nil {
+			http.Error(w, "Invalid price_from: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		query += " AND i.base_total >= ?"
+		args = append(args, amount)
 	}
 	if priceTo := r.URL.Query().Get("price_to"); priceTo != "" {
-		query += " AND i.total_price <= ?"
-		args = append(args, priceTo)
+		amount, err := money.Parse(priceTo, money.BaseCurrency)
+		if err != nil {
+			http.Error(w, "Invalid price_to: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		query += " AND i.base_total <= ?"
+		args = append(args, amount)
+	}
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		query += " AND i.currency = ?"
+		args = append(args, strings.ToUpper(currency))
+	}
+	if overdue := r.URL.Query().Get("overdue"); overdue != "" {
+		want, err := strconv.ParseBool(overdue)
+		if err != nil {
+			http.Error(w, "Invalid overdue: must be true or false", http.StatusBadRequest)
+			return
+		}
+		condition := "(i.due_date < ? AND i.status IN (?, ?))"
+		if !want {
+			condition = "NOT " + condition
+		}
+		query += " AND " + condition
+		args = append(args, time.Now().Format("2006-01-02"), lifecycle.StateFinalized, lifecycle.StateSent)
+	}
+	if number := r.URL.Query().Get("invoice_number"); number != "" {
+		query += " AND i.invoice_number LIKE ?"
+		args = append(args, "%"+number+"%")
 	}
 	if customerQuery := r.URL.Query().Get("customer_query"); customerQuery != "" {
-		query += " AND c.name LIKE ?"
+		query += " AND i.customer_name LIKE ?"
 		args = append(args, "%"+customerQuery+"%")
 	}
 	if productQuery := r.URL.Query().Get("product_query"); productQuery != "" {
 		query += ` AND i.id IN (
 			SELECT DISTINCT ii.invoice_id FROM invoice_items ii
-			JOIN products p ON ii.product_id = p.id
-			WHERE p.name LIKE ?
+			WHERE ii.product_name LIKE ?
 		)`
 		args = append(args, "%"+productQuery+"%")
 	}
@@ -76,26 +110,30 @@ func (h *Handler) GetInvoices(w http.ResponseWriter, r *http.Request) {
 	}
 	defer rows.Close()
 
+	today := time.Now()
 	var invoices []models.Invoice
 	for rows.Next() {
 		var inv models.Invoice
+		var due sql.NullTime
 		var customerName, customerPhone, customerAddress, customerCountry sql.NullString
-		if err := rows.Scan(&inv.ID, &inv.CustomerID, &inv.TotalPrice, &inv.Status, &inv.CreatedAt, &inv.ProcessedAt, 
+		if err := rows.Scan(&inv.ID, &inv.InvoiceNumber, &inv.CustomerID, &inv.Subtotal, &inv.AdjustmentTotal, &inv.TaxTotal, &inv.TotalPrice, &inv.Currency, &inv.ExchangeRate, &inv.BaseTotal,
+			&inv.Status, &inv.PaymentTerms, &inv.PaymentTermDays, &due, &inv.AmountPaid, &inv.AmountCredited, &inv.CreatedAt, &inv.FinalizedAt, &inv.SentAt, &inv.PaidAt, &inv.VoidedAt, &inv.CreditedAt,
 			&customerName, &customerPhone, &customerAddress, &customerCountry); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		inv.Subtotal.Currency = inv.Currency
+		inv.AdjustmentTotal.Currency = inv.Currency
+		inv.TaxTotal.Currency = inv.Currency
+		inv.TotalPrice.Currency = inv.Currency
+		inv.BaseTotal.Currency = money.BaseCurrency
+		inv.AmountPaid.Currency = inv.Currency
+		inv.AmountCredited.Currency = inv.Currency
+		inv.BalanceDue = inv.TotalPrice.Sub(inv.AmountPaid).Sub(inv.AmountCredited)
+		inv.DueDate = formatDate(due)
+		inv.Overdue = isOverdue(inv.Status, inv.DueDate, today)
 		
-		// Add customer info if available
-		if inv.CustomerID != nil && customerName.Valid {
-			inv.Customer = &models.Customer{
-				ID:      *inv.CustomerID,
-				Name:    customerName.String,
-				Phone:   customerPhone.String,
-				Address: customerAddress.String,
-				Country: customerCountry.String,
-			}
-		}
+		inv.Customer = customerSnapshot(inv.CustomerID, customerName, customerPhone, customerAddress, customerCountry)
 		
 		invoices = append(invoices, inv)
 	}
@@ -111,91 +149,192 @@ func (h *Handler) CreateInvoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate customer ID
-	if req.CustomerID == 0 {
-		http.Error(w, "Customer ID is required", http.StatusBadRequest)
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Verify customer exists
-	var customerExists int
-	err := h.db.QueryRow("SELECT COUNT(*) FROM customers WHERE id = ?", req.CustomerID).Scan(&customerExists)
+	invoice, err := createInvoice(tx, organizationID(r), req, time.Now())
 	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditInvoice, int64(invoice.ID), models.AuditCreate, nil); err != nil {
+		tx.Rollback()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	if customerExists == 0 {
-		http.Error(w, "Customer not found", http.StatusBadRequest)
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	tx, err := h.db.Begin()
+	// Read the invoice back so the response carries its item IDs
+	created, err := h.loadInvoice(organizationID(r), invoice.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	totalPrice := 0.0
-	var items []models.InvoiceItem
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
 
-	for _, item := range req.Items {
-		var product models.Product
-		err := tx.QueryRow("SELECT id, name, price FROM products WHERE id = ?", item.ProductID).
-			Scan(&product.ID, &product.Name, &product.Price)
-		if err != nil {
-			tx.Rollback()
-			http.Error(w, "Product not found", http.StatusBadRequest)
-			return
-		}
+// createInvoice writes a draft invoice for req in an organization, dated
+// createdAt, which decides the exchange rate, number and due date. Invalid
+// requests are reported as a requestError. Recurring invoices are created the
+// same way by the scheduler.
+func createInvoice(tx *sql.Tx, organizationID int, req models.CreateInvoiceRequest, createdAt time.Time) (*models.Invoice, error) {
+	b, err := resolveBilling(tx, organizationID, req.CustomerID, req.Currency, req.PaymentTerms, req.PaymentTermDays, createdAt)
+	if err != nil {
+		return nil, err
+	}
 
-		itemTotal := product.Price * float64(item.Quantity)
-		totalPrice += itemTotal
+	priced, err := priceInvoice(tx, b, req.Items, req.Adjustments)
+	if err != nil {
+		return nil, err
+	}
 
-		items = append(items, models.InvoiceItem{
-			ProductID:  item.ProductID,
-			Quantity:   item.Quantity,
-			UnitPrice:  product.Price,
-			TotalPrice: itemTotal,
-		})
+	return insertInvoice(tx, b, priced, req.Series, createdAt)
+}
+
+// billing is which organization bills whom for an invoice or quote, in which
+// currency and at what rate, and the payment terms it carries.
+type billing struct {
+	OrganizationID int
+	Customer       models.CustomerSnapshot
+	Currency       string
+	Rate           money.ExchangeRate
+	PaymentTerms   string
+	TermDays       int
+}
+
+// resolveBilling looks up the organization's customer and applies the
+// currency and payment terms requested, falling back to the customer's own.
+// The exchange rate is the organization's one effective at at.
+func resolveBilling(tx *sql.Tx, organizationID, customerID int, currency, paymentTerms string, paymentTermDays *int, at time.Time) (*billing, error) {
+	// Validate customer ID
+	if customerID == 0 {
+		return nil, requestError("Customer ID is required")
+	}
+
+	// Verify customer exists; its country decides which tax rules apply and
+	// its currency is the invoice currency unless the request overrides it.
+	// The invoice keeps a snapshot of who it was billed to.
+	b := &billing{OrganizationID: organizationID, Customer: models.CustomerSnapshot{ID: customerID}}
+	var customerCurrency, customerTerms string
+	var customerTermDays *int
+	err := tx.QueryRow("SELECT name, phone, address, country, currency, payment_terms, payment_term_days FROM customers WHERE id = ? AND organization_id = ?",
+		customerID, organizationID).
+		Scan(&b.Customer.Name, &b.Customer.Phone, &b.Customer.Address, &b.Customer.Country, &customerCurrency, &customerTerms, &customerTermDays)
+	if err == sql.ErrNoRows {
+		return nil, requestError("Customer not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.Currency = customerCurrency
+	if currency != "" {
+		b.Currency = strings.ToUpper(strings.TrimSpace(currency))
+		if !money.IsCurrencyCode(b.Currency) {
+			return nil, requestError("Currency must be a three-letter ISO 4217 code")
+		}
 	}
 
-	result, err := tx.Exec("INSERT INTO invoices (customer_id, total_price, status) VALUES (?, ?, 'created')", req.CustomerID, totalPrice)
+	// The customer's payment terms apply unless the request overrides them
+	b.PaymentTerms = customerTerms
+	termDays := customerTermDays
+	if paymentTerms != "" {
+		b.PaymentTerms, termDays = paymentTerms, paymentTermDays
+	}
+	b.TermDays, err = resolvePaymentTerms(b.PaymentTerms, termDays)
 	if err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, requestError("Invalid payment terms: " + err.Error())
 	}
 
-	invoiceID, _ := result.LastInsertId()
+	// Product prices are kept in the base currency and converted at the rate
+	// effective on the invoice date
+	b.Rate, err = exchangeRate(tx, organizationID, b.Currency, at)
+	if err == errNoExchangeRate {
+		return nil, requestError(fmt.Sprintf("No exchange rate for %s effective on %s", b.Currency, at.Format("2006-01-02")))
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	for _, item := range items {
-		_, err = tx.Exec(
-			"INSERT INTO invoice_items (invoice_id, product_id, quantity, unit_price, total_price) VALUES (?, ?, ?, ?, ?)",
-			invoiceID, item.ProductID, item.Quantity, item.UnitPrice, item.TotalPrice,
-		)
-		if err != nil {
-			tx.Rollback()
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	return b, nil
+}
+
+// insertInvoice writes a draft invoice with priced lines, numbered from the
+// billing organization's series (the default series if empty) and dated
+// createdAt.
+func insertInvoice(tx *sql.Tx, b *billing, priced *pricedInvoice, series string, createdAt time.Time) (*models.Invoice, error) {
+	series = strings.TrimSpace(series)
+	if series == "" {
+		series = defaultInvoiceSeries
 	}
 
-	if err := tx.Commit(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	baseTotal := priced.TotalPrice.ConvertToBase(money.BaseCurrency, b.Rate)
+
+	invoiceNumber, err := nextNumber(tx, b.OrganizationID, series, createdAt)
+	if err != nil {
+		return nil, err
 	}
 
-	invoice := models.Invoice{
-		ID:         int(invoiceID),
-		TotalPrice: totalPrice,
-		Status:     "created",
-		CreatedAt:  time.Now(),
-		Items:      items,
+	due := dueDate(createdAt, b.TermDays)
+
+	result, err := tx.Exec(`INSERT INTO invoices (organization_id, invoice_number, customer_id, customer_name, customer_phone, customer_address, customer_country,
+			subtotal, adjustment_total, tax_total, total_price, currency, exchange_rate, base_total,
+			status, payment_terms, payment_term_days, due_date, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		b.OrganizationID, invoiceNumber, b.Customer.ID, b.Customer.Name, b.Customer.Phone, b.Customer.Address, b.Customer.Country,
+		priced.Subtotal, priced.AdjustmentTotal, priced.TaxTotal, priced.TotalPrice, b.Currency, b.Rate, baseTotal,
+		lifecycle.StateDraft, b.PaymentTerms, b.TermDays, due, createdAt)
+	if err != nil {
+		return nil, err
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(invoice)
+	invoiceID, _ := result.LastInsertId()
+
+	if err := insertInvoiceLines(tx, invoiceID, priced); err != nil {
+		return nil, err
+	}
+
+	customer := b.Customer
+	return &models.Invoice{
+		ID:              int(invoiceID),
+		InvoiceNumber:   invoiceNumber,
+		CustomerID:      &customer.ID,
+		Customer:        &customer,
+		Subtotal:        priced.Subtotal,
+		AdjustmentTotal: priced.AdjustmentTotal,
+		TaxTotal:        priced.TaxTotal,
+		TotalPrice:      priced.TotalPrice,
+		Currency:        b.Currency,
+		ExchangeRate:    b.Rate,
+		BaseTotal:       baseTotal,
+		Status:          string(lifecycle.StateDraft),
+		PaymentTerms:    b.PaymentTerms,
+		PaymentTermDays: b.TermDays,
+		DueDate:         due,
+		AmountPaid:      money.Zero(b.Currency),
+		AmountCredited:  money.Zero(b.Currency),
+		BalanceDue:      priced.TotalPrice,
+		CreatedAt:       createdAt,
+		Items:           priced.Items,
+		Adjustments:     priced.Adjustments,
+		TaxLines:        priced.TaxLines,
+	}, nil
 }
 
 func (h *Handler) GetInvoice(w http.ResponseWriter, r *http.Request) {
@@ -206,16 +345,29 @@ func (h *Handler) GetInvoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var inv models.Invoice
-	var customerName, customerPhone, customerAddress, customerCountry sql.NullString
-	err = h.db.QueryRow(`
-		SELECT i.id, i.customer_id, i.total_price, i.status, i.created_at, i.processed_at,
-		       c.name, c.phone, c.address, c.country
-		FROM invoices i 
-		LEFT JOIN customers c ON i.customer_id = c.id 
-		WHERE i.id = ?`, id).
-		Scan(&inv.ID, &inv.CustomerID, &inv.TotalPrice, &inv.Status, &inv.CreatedAt, &inv.ProcessedAt,
-			&customerName, &customerPhone, &customerAddress, &customerCountry)
+	h.writeInvoice(w, organizationID(r), id)
+}
+
+// GetInvoiceByNumber looks an invoice up by its invoice number.
+func (h *Handler) GetInvoiceByNumber(w http.ResponseWriter, r *http.Request) {
+	number := mux.Vars(r)["number"]
+
+	var id int
+	err := h.db.QueryRow("SELECT id FROM invoices WHERE organization_id = ? AND invoice_number = ?", organizationID(r), number).Scan(&id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeInvoice(w, organizationID(r), id)
+}
+
+func (h *Handler) writeInvoice(w http.ResponseWriter, organizationID, id int) {
+	inv, err := h.loadInvoice(organizationID, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Invoice not found", http.StatusNotFound)
@@ -225,50 +377,146 @@ func (h *Handler) GetInvoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add customer info if available
-	if inv.CustomerID != nil && customerName.Valid {
-		inv.Customer = &models.Customer{
-			ID:      *inv.CustomerID,
-			Name:    customerName.String,
-			Phone:   customerPhone.String,
-			Address: customerAddress.String,
-			Country: customerCountry.String,
-		}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inv)
+}
+
+// loadInvoice reads an organization's invoice with the customer and product details it was
+// issued with, its items, adjustments, tax lines, payments and credit notes. It returns sql.ErrNoRows if there is no such invoice.
+func (h *Handler) loadInvoice(organizationID, id int) (*models.Invoice, error) {
+	var inv models.Invoice
+	var due sql.NullTime
+	var customerName, customerPhone, customerAddress, customerCountry sql.NullString
+	err := h.db.QueryRow(`
+		SELECT i.id, i.invoice_number, i.customer_id, i.subtotal, i.adjustment_total, i.tax_total, i.total_price, i.currency, i.exchange_rate, i.base_total,
+		       i.status, i.payment_terms, i.payment_term_days, i.due_date, i.amount_paid, i.amount_credited, i.created_at, i.finalized_at, i.sent_at, i.paid_at, i.voided_at, i.credited_at,
+		       i.customer_name, i.customer_phone, i.customer_address, i.customer_country, i.recurring_invoice_id
+		FROM invoices i 
+		WHERE i.id = ? AND i.organization_id = ?`, id, organizationID).
+		Scan(&inv.ID, &inv.InvoiceNumber, &inv.CustomerID, &inv.Subtotal, &inv.AdjustmentTotal, &inv.TaxTotal, &inv.TotalPrice, &inv.Currency, &inv.ExchangeRate, &inv.BaseTotal,
+			&inv.Status, &inv.PaymentTerms, &inv.PaymentTermDays, &due, &inv.AmountPaid, &inv.AmountCredited, &inv.CreatedAt, &inv.FinalizedAt, &inv.SentAt, &inv.PaidAt, &inv.VoidedAt, &inv.CreditedAt,
+			&customerName, &customerPhone, &customerAddress, &customerCountry, &inv.RecurringInvoiceID)
+	if err != nil {
+		return nil, err
 	}
+	inv.Subtotal.Currency = inv.Currency
+	inv.AdjustmentTotal.Currency = inv.Currency
+	inv.TaxTotal.Currency = inv.Currency
+	inv.TotalPrice.Currency = inv.Currency
+	inv.BaseTotal.Currency = money.BaseCurrency
+	inv.AmountPaid.Currency = inv.Currency
+	inv.AmountCredited.Currency = inv.Currency
+	inv.BalanceDue = inv.TotalPrice.Sub(inv.AmountPaid).Sub(inv.AmountCredited)
+	inv.DueDate = formatDate(due)
+	inv.Overdue = isOverdue(inv.Status, inv.DueDate, time.Now())
+
+	inv.Customer = customerSnapshot(inv.CustomerID, customerName, customerPhone, customerAddress, customerCountry)
 
 	rows, err := h.db.Query(`
-		SELECT ii.id, ii.invoice_id, ii.product_id, ii.quantity, ii.unit_price, ii.total_price,
-		       p.id, p.name, p.price
+		SELECT ii.id, ii.invoice_id, ii.product_id, ii.quantity, ii.unit_price,
+		       ii.discount_type, ii.discount_value, ii.discount_amount, ii.total_price, ii.adjustment_amount, ii.tax_rate, ii.tax_amount,
+		       ii.untaxed, ii.product_name
 		FROM invoice_items ii
-		JOIN products p ON ii.product_id = p.id
 		WHERE ii.invoice_id = ?
 	`, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
 	var items []models.InvoiceItem
 	for rows.Next() {
 		var item models.InvoiceItem
-		var product models.Product
-		err := rows.Scan(&item.ID, &item.InvoiceID, &item.ProductID, &item.Quantity, &item.UnitPrice, &item.TotalPrice,
-			&product.ID, &product.Name, &product.Price)
+		var productName string
+		var discountType sql.NullString
+		var discountValue int64
+		err := rows.Scan(&item.ID, &item.InvoiceID, &item.ProductID, &item.Quantity, &item.UnitPrice,
+			&discountType, &discountValue, &item.DiscountAmount, &item.TotalPrice, &item.AdjustmentAmount, &item.TaxRate, &item.TaxAmount,
+			&item.Untaxed, &productName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return nil, err
 		}
-		item.Product = &product
+		item.Discount = itemDiscount(discountType, discountValue, inv.Currency)
+		item.UnitPrice.Currency = inv.Currency
+		item.DiscountAmount.Currency = inv.Currency
+		item.TotalPrice.Currency = inv.Currency
+		item.AdjustmentAmount.Currency = inv.Currency
+		item.TaxAmount.Currency = inv.Currency
+		item.Product = &models.ProductSnapshot{ID: item.ProductID, Name: productName}
 		items = append(items, item)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
 	inv.Items = items
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(inv)
+	inv.Adjustments, err = h.invoiceAdjustments(id, inv.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.TaxLines, err = h.invoiceTaxLines(id, inv.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.Payments, err = h.invoicePayments(id, inv.Currency)
+	if err != nil {
+		return nil, err
+	}
+
+	inv.CreditNotes, err = h.invoiceCreditNotes(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
+
+// customerSnapshot builds the billed-to details stored on an invoice, or nil
+// if the invoice has no customer.
+func customerSnapshot(id *int, name, phone, address, country sql.NullString) *models.CustomerSnapshot {
+	if id == nil || !name.Valid {
+		return nil
+	}
+	return &models.CustomerSnapshot{
+		ID:      *id,
+		Name:    name.String,
+		Phone:   phone.String,
+		Address: address.String,
+		Country: country.String,
+	}
+}
+
+func (h *Handler) invoiceTaxLines(invoiceID int, currency string) ([]models.TaxLine, error) {
+	rows, err := h.db.Query(`
+		SELECT rate, taxable_amount, tax_amount FROM invoice_tax_lines
+		WHERE invoice_id = ?
+		ORDER BY rate DESC
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []models.TaxLine
+	for rows.Next() {
+		var line models.TaxLine
+		if err := rows.Scan(&line.Rate, &line.TaxableAmount, &line.TaxAmount); err != nil {
+			return nil, err
+		}
+		line.TaxableAmount.Currency = currency
+		line.TaxAmount.Currency = currency
+		lines = append(lines, line)
+	}
+
+	return lines, rows.Err()
 }
 
+// UpdateInvoiceStatus moves an invoice to the requested status through the
+// lifecycle transition that leads there from its current one.
 func (h *Handler) UpdateInvoiceStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -283,13 +531,13 @@ func (h *Handler) UpdateInvoiceStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Status != "created" && req.Status != "processed" && req.Status != "deleted" {
+	if !lifecycle.IsState(req.Status) {
 		http.Error(w, "Invalid status", http.StatusBadRequest)
 		return
 	}
+	target := lifecycle.State(req.Status)
 
-	var currentStatus string
-	err = h.db.QueryRow("SELECT status FROM invoices WHERE id = ?", id).Scan(&currentStatus)
+	inv, err := invoiceState(h.db, organizationID(r), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Invoice not found", http.StatusNotFound)
@@ -299,27 +547,16 @@ func (h *Handler) UpdateInvoiceStatus(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if currentStatus == "processed" && req.Status == "created" {
-		http.Error(w, "Cannot change status from processed to created", http.StatusBadRequest)
-		return
-	}
-
-	query := "UPDATE invoices SET status = ?"
-	args := []interface{}{req.Status}
-
-	if req.Status == "processed" {
-		query += ", processed_at = ?"
-		args = append(args, time.Now())
-	}
-
-	query += " WHERE id = ?"
-	args = append(args, id)
-
-	_, err = h.db.Exec(query, args...)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	t, ok := lifecycle.LeadingTo(inv.State, target)
+	if !ok {
+		writeTransitionError(w, &lifecycle.Error{
+			Code:   lifecycle.CodeInvalidState,
+			From:   inv.State,
+			To:     target,
+			Reason: fmt.Sprintf("no transition from %s to %s", inv.State, target),
+		})
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-}
\ No newline at end of file
+	h.transitionInvoice(w, r, id, t)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/lifecycle"
+)
+
+// timestampColumns records when an invoice entered each state.
+var timestampColumns = map[lifecycle.State]string{
+	lifecycle.StateFinalized: "finalized_at",
+	lifecycle.StateSent:      "sent_at",
+	lifecycle.StatePaid:      "paid_at",
+	lifecycle.StateVoid:      "voided_at",
+	lifecycle.StateCredited:  "credited_at",
+}
+
+// invoiceState reads what the lifecycle guards need to know about an
+// organization's invoice. It returns sql.ErrNoRows if there is no such
+// invoice.
+func invoiceState(q rowQuerier, organizationID, id int) (lifecycle.Invoice, error) {
+	var inv lifecycle.Invoice
+	var currency string
+	err := q.QueryRow(`
+		SELECT status, currency, total_price, amount_paid, amount_credited,
+		       (SELECT COUNT(*) FROM invoice_items WHERE invoice_id = invoices.id)
+		FROM invoices WHERE id = ? AND organization_id = ?
+	`, id, organizationID).Scan(&inv.State, &currency, &inv.TotalPrice, &inv.AmountPaid, &inv.AmountCredited, &inv.ItemCount)
+	if err != nil {
+		return inv, err
+	}
+	inv.TotalPrice.Currency = currency
+	inv.AmountPaid.Currency = currency
+	inv.AmountCredited.Currency = currency
+	return inv, nil
+}
+
+// applyTransition moves an invoice through t, stamping the time it entered
+// the new state. It returns a *lifecycle.Error if t is not allowed.
+func applyTransition(tx *sql.Tx, id int, inv lifecycle.Invoice, t lifecycle.Transition, at time.Time) error {
+	if err := t.Check(inv); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(fmt.Sprintf("UPDATE invoices SET status = ?, %s = ? WHERE id = ?", timestampColumns[t.To]),
+		t.To, at, id)
+	if err != nil || t.To != lifecycle.StateFinalized {
+		return err
+	}
+
+	// A draft's due date runs from when it was created; once finalized the
+	// invoice is issued, and it is due its payment terms after that
+	var termDays int
+	if err := tx.QueryRow("SELECT payment_term_days FROM invoices WHERE id = ?", id).Scan(&termDays); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE invoices SET due_date = ? WHERE id = ?", dueDate(at, termDays), id)
+	return err
+}
+
+// writeTransitionError reports a rejected transition as 409 Conflict with a
+// JSON body naming the transition and the reason.
+func writeTransitionError(w http.ResponseWriter, err *lifecycle.Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(err)
+}
+
+// GetInvoiceTransitions lists the transitions out of an invoice's current
+// state and whether each is allowed now.
+func (h *Handler) GetInvoiceTransitions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := invoiceState(h.db, organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status      lifecycle.State    `json:"status"`
+		Transitions []lifecycle.Option `json:"transitions"`
+	}{inv.State, lifecycle.Options(inv)})
+}
+
+// ApplyInvoiceTransition applies a named transition and returns the updated
+// invoice.
+func (h *Handler) ApplyInvoiceTransition(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	t, ok := lifecycle.Lookup(vars["transition"])
+	if !ok {
+		http.Error(w, "Unknown transition", http.StatusNotFound)
+		return
+	}
+
+	h.transitionInvoice(w, r, id, t)
+}
+
+// transitionInvoice applies t to an invoice and writes the updated invoice.
+func (h *Handler) transitionInvoice(w http.ResponseWriter, r *http.Request, id int, t lifecycle.Transition) {
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inv, err := invoiceState(tx, organizationID(r), id)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	before, err := snapshot(tx, auditInvoice, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := applyTransition(tx, id, inv, t, time.Now()); err != nil {
+		tx.Rollback()
+		if transitionErr, ok := err.(*lifecycle.Error); ok {
+			writeTransitionError(w, transitionErr)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditInvoice, int64(id), t.Name, before); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeInvoice(w, organizationID(r), id)
+}
+
+// settleIfPaid marks an organization's open invoice paid once its payments
+// and credit notes cover it.
+func settleIfPaid(tx *sql.Tx, organizationID, id int, at time.Time) error {
+	inv, err := invoiceState(tx, organizationID, id)
+	if err != nil {
+		return err
+	}
+	if !lifecycle.Open(inv.State) || inv.Balance().IsPositive() {
+		return nil
+	}
+
+	t, _ := lifecycle.Lookup(lifecycle.MarkPaid)
+	return applyTransition(tx, id, inv, t, at)
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+	"invoice-app/numbering"
+)
+
+// defaultInvoiceSeries numbers invoices created without an explicit series.
+const defaultInvoiceSeries = "invoice"
+
+// defaultNumberSeries are the series every new organization starts with,
+// as the migrations set them up for the first.
+var defaultNumberSeries = []models.NumberSeries{
+	{Name: defaultInvoiceSeries, Pattern: "INV-{YYYY}-{seq:5}"},
+	{Name: defaultCreditNoteSeries, Pattern: "CN-{YYYY}-{seq:5}"},
+	{Name: defaultQuoteSeries, Pattern: "QUO-{YYYY}-{seq:5}"},
+}
+
+// nextNumber allocates the next number of an organization's series for a
+// document dated at. It must run in the transaction that inserts the
+// document: the counter is only advanced if that transaction commits, so
+// numbers have no gaps.
+func nextNumber(tx *sql.Tx, organizationID int, series string, at time.Time) (string, error) {
+	var seriesID int
+	var text string
+	err := tx.QueryRow("SELECT id, pattern FROM number_series WHERE organization_id = ? AND name = ?",
+		organizationID, series).Scan(&seriesID, &text)
+	if err == sql.ErrNoRows {
+		return "", requestError(fmt.Sprintf("Number series %q not found", series))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	pattern, err := numbering.Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("number series %q: %v", series, err)
+	}
+	period := pattern.Period(at)
+
+	_, err = tx.Exec(`
+		INSERT INTO number_counters (series_id, period, last_value) VALUES (?, ?, 1)
+		ON CONFLICT (series_id, period) DO UPDATE SET last_value = last_value + 1
+	`, seriesID, period)
+	if err != nil {
+		return "", err
+	}
+
+	var seq int64
+	err = tx.QueryRow("SELECT last_value FROM number_counters WHERE series_id = ? AND period = ?", seriesID, period).Scan(&seq)
+	if err != nil {
+		return "", err
+	}
+
+	return pattern.Format(at, seq), nil
+}
+
+// previewNumber returns the number the next document in a series dated at
+// would get, without allocating it.
+func (h *Handler) previewNumber(seriesID int, pattern numbering.Pattern, at time.Time) (string, error) {
+	var last int64
+	err := h.db.QueryRow("SELECT last_value FROM number_counters WHERE series_id = ? AND period = ?",
+		seriesID, pattern.Period(at)).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	return pattern.Format(at, last+1), nil
+}
+
+func (h *Handler) GetNumberSeries(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT id, name, pattern, created_at FROM number_series WHERE organization_id = ? ORDER BY name",
+		organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var series []models.NumberSeries
+	for rows.Next() {
+		var s models.NumberSeries
+		if err := rows.Scan(&s.ID, &s.Name, &s.Pattern, &s.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		series = append(series, s)
+	}
+	rows.Close()
+
+	for i := range series {
+		pattern, err := numbering.Parse(series[i].Pattern)
+		if err != nil {
+			continue
+		}
+		series[i].NextNumber, err = h.previewNumber(series[i].ID, pattern, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(series)
+}
+
+// SetNumberSeries creates the named series or changes its pattern. Counters
+// are kept, so a changed pattern continues from the last number issued in the
+// current period.
+func (h *Handler) SetNumberSeries(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(mux.Vars(r)["name"])
+	if name == "" {
+		http.Error(w, "Number series name is required", http.StatusBadRequest)
+		return
+	}
+
+	var s models.NumberSeries
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.Pattern = strings.TrimSpace(s.Pattern)
+	pattern, err := numbering.Parse(s.Pattern)
+	if err != nil {
+		http.Error(w, "Invalid pattern: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.upsertAudited(r, auditNumberSeries, "SELECT id FROM number_series WHERE organization_id = ? AND name = ?",
+		[]interface{}{organizationID(r), name}, `
+		INSERT INTO number_series (organization_id, name, pattern) VALUES (?, ?, ?)
+		ON CONFLICT (organization_id, name) DO UPDATE SET pattern = excluded.pattern
+	`, organizationID(r), name, s.Pattern)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.QueryRow("SELECT id, name, created_at FROM number_series WHERE organization_id = ? AND name = ?", organizationID(r), name).
+		Scan(&s.ID, &s.Name, &s.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.NextNumber, err = h.previewNumber(s.ID, pattern, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"invoice-app/database"
+)
+
+// testDB opens a migrated database of its own for a test.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.OpenFile(filepath.Join(t.TempDir(), "invoice.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNextNumberConcurrent(t *testing.T) {
+	db := testDB(t)
+	at := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	// Every fourth transaction rolls back, giving its number back
+	const n = 20
+	var mu sync.Mutex
+	var numbers []string
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tx, err := db.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+			number, err := nextNumber(tx, 1, defaultInvoiceSeries, at)
+			if err != nil {
+				tx.Rollback()
+				errs <- err
+				return
+			}
+			if i%4 == 3 {
+				tx.Rollback()
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				errs <- err
+				return
+			}
+			mu.Lock()
+			numbers = append(numbers, number)
+			mu.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	sort.Strings(numbers)
+	want := n - n/4
+	if len(numbers) != want {
+		t.Fatalf("got %d numbers, want %d", len(numbers), want)
+	}
+	for i, number := range numbers {
+		if number != fmt.Sprintf("INV-2026-%05d", i+1) {
+			t.Fatalf("numbers = %v, want INV-2026-00001 to INV-2026-%05d without gaps or repeats", numbers, want)
+		}
+	}
+}
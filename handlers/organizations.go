@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"invoice-app/auth"
+	"invoice-app/models"
+)
+
+// organizationHeader picks which of the user's organizations a request works
+// in. Without it, requests work in the first organization the user joined.
+const organizationHeader = "X-Organization-ID"
+
+var errNotMember = errors.New("not a member of the organization")
+
+// resolveOrganization returns the organization request r by a user works in,
+// and the user's role there: the one named by organizationHeader, which the
+// user must be a member of, or else the user's first. It returns 0 if the
+// user is in no organization.
+func (h *Handler) resolveOrganization(r *http.Request, userID int) (int, string, error) {
+	if header := r.Header.Get(organizationHeader); header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil {
+			return 0, "", requestError("Invalid " + organizationHeader + " header")
+		}
+		role, err := memberRole(h.db, id, userID)
+		if err != nil {
+			return 0, "", err
+		}
+		if role == "" {
+			return 0, "", errNotMember
+		}
+		return id, role, nil
+	}
+
+	var id int
+	var role string
+	err := h.db.QueryRow("SELECT organization_id, role FROM organization_members WHERE user_id = ? ORDER BY organization_id LIMIT 1",
+		userID).Scan(&id, &role)
+	if err == sql.ErrNoRows {
+		return 0, "", nil
+	}
+	return id, role, err
+}
+
+// memberRole returns a user's role in an organization, or "" if they are not
+// a member of it.
+func memberRole(q rowQuerier, organizationID, userID int) (string, error) {
+	var role string
+	err := q.QueryRow("SELECT role FROM organization_members WHERE organization_id = ? AND user_id = ?",
+		organizationID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return role, err
+}
+
+// organizationID returns the organization request r works in. Every query in
+// this package that reads or writes an organization's records is limited to
+// it.
+func organizationID(r *http.Request) int {
+	return currentPrincipal(r).OrganizationID
+}
+
+// GetOrganizations lists the organizations the signed-in user is a member of.
+func (h *Handler) GetOrganizations(w http.ResponseWriter, r *http.Request) {
+	p := currentPrincipal(r)
+	rows, err := h.db.Query(`
+		SELECT o.id, o.name, o.created_at
+		FROM organizations o
+		JOIN organization_members m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.id
+	`, p.User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	organizations := []models.Organization{}
+	for rows.Next() {
+		var o models.Organization
+		if err := rows.Scan(&o.ID, &o.Name, &o.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		o.Current = o.ID == p.OrganizationID
+		organizations = append(organizations, o)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(organizations)
+}
+
+// CreateOrganization adds an organization with the signed-in user as its
+// first member, an admin, and the default number series.
+func (h *Handler) CreateOrganization(w http.ResponseWriter, r *http.Request) {
+	var o models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		http.Error(w, "Organization name is required", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM organizations WHERE name = ?", o.Name).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "An organization with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO organizations (name) VALUES (?)", o.Name)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)",
+		id, currentPrincipal(r).User.ID, auth.Admin); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, s := range defaultNumberSeries {
+		if _, err := tx.Exec("INSERT INTO number_series (organization_id, name, pattern) VALUES (?, ?, ?)",
+			id, s.Name, s.Pattern); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := recordAudit(tx, auditActor{actor(r).name, int(id)}, auditOrganization, id, models.AuditCreate, nil); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.db.QueryRow("SELECT id, created_at FROM organizations WHERE id = ?", id).Scan(&o.ID, &o.CreatedAt); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(o)
+}
+
+// UpdateOrganization renames the organization the request works in.
+func (h *Handler) UpdateOrganization(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	var o models.Organization
+	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	o.Name = strings.TrimSpace(o.Name)
+	if o.Name == "" {
+		http.Error(w, "Organization name is required", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	if err := h.db.QueryRow("SELECT COUNT(*) FROM organizations WHERE name = ? AND id != ?", o.Name, id).Scan(&exists); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "An organization with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditOrganization, int64(id), models.AuditUpdate,
+		"UPDATE organizations SET name = ? WHERE id = ?", o.Name, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// AddOrganizationMember gives an existing user, found by email, access to the
+// organization the request works in with a role there. It does not change
+// what they may do in their other organizations.
+func (h *Handler) AddOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.OrganizationMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := auth.ParseRole(req.Role); err != nil {
+		http.Error(w, "Invalid role: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	err := h.db.QueryRow("SELECT id FROM users WHERE email = ?", strings.TrimSpace(req.Email)).Scan(&userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	role, err := memberRole(h.db, id, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if role != "" {
+		http.Error(w, "User is already a member of this organization", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditOrganization, int64(id), actionAddMember,
+		"INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, ?)", id, userID, req.Role); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// RemoveOrganizationMember takes a user's access to the organization the
+// request works in away. Their account and other memberships are kept.
+func (h *Handler) RemoveOrganizationMember(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.memberOrganization(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	// Otherwise the last admin could lock everyone out by mistake
+	if userID == currentPrincipal(r).User.ID {
+		http.Error(w, "You cannot remove yourself from an organization", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditOrganization, int64(id), actionRemoveMember,
+		"DELETE FROM organization_members WHERE organization_id = ? AND user_id = ?", id, userID); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "User is not a member of this organization", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// memberOrganization reads the organization ID from the path and checks it is
+// the one the request works in, so members of one organization cannot change
+// another. It writes the error response and returns false if not.
+func (h *Handler) memberOrganization(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if id != organizationID(r) {
+		http.Error(w, "Organization not found; select it with the "+organizationHeader+" header", http.StatusNotFound)
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/auth"
+	"invoice-app/models"
+)
+
+// memberRouter serves the routes that manage users and memberships, as
+// main.go registers them.
+func memberRouter(h *Handler) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(h.Authenticate)
+	r.HandleFunc("/api/auth/me", h.GetCurrentUser).Methods("GET")
+	r.HandleFunc("/api/users/{id}", h.Require(auth.ManageUsers, h.DisableUser)).Methods("DELETE")
+	r.HandleFunc("/api/users/{id}/role", h.Require(auth.ManageUsers, h.SetUserRole)).Methods("PUT")
+	r.HandleFunc("/api/organizations/{id}/members", h.Require(auth.ManageUsers, h.AddOrganizationMember)).Methods("POST")
+	return r
+}
+
+// serveAs makes a request with the session of the user whose session token
+// is token, working in organization.
+func serveAs(router http.Handler, token, organization, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.AddCookie(&http.Cookie{Name: sessionCookie, Value: token})
+	req.Header.Set(organizationHeader, organization)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMemberRolesArePerOrganization(t *testing.T) {
+	db := testDB(t)
+	router := memberRouter(New(db, nil))
+
+	// Alice is an admin of the first organization, Mallory of a second, and
+	// Carol is only in the second
+	mustExec(t, db, "INSERT INTO organizations (id, name) VALUES (2, 'Other')")
+	for i, u := range []struct {
+		email, token string
+		organization int
+	}{
+		{"alice@example.com", "alice-session", 1},
+		{"mallory@example.com", "mallory-session", 2},
+		{"carol@example.com", "carol-session", 2},
+	} {
+		mustExec(t, db, "INSERT INTO users (id, email, name, password_hash) VALUES (?, ?, '', '')", i+1, u.email)
+		mustExec(t, db, "INSERT INTO organization_members (organization_id, user_id, role) VALUES (?, ?, 'admin')", u.organization, i+1)
+		mustExec(t, db, "INSERT INTO sessions (user_id, token_hash, expires_at) VALUES (?, ?, ?)",
+			i+1, auth.HashToken(u.token), time.Now().Add(time.Hour))
+	}
+
+	for _, tt := range []struct {
+		name         string
+		method, path string
+		body         string
+		want         int
+	}{
+		{"add unknown email", "POST", "/api/organizations/2/members", `{"email": "nobody@example.com", "role": "clerk"}`, http.StatusBadRequest},
+		{"add without role", "POST", "/api/organizations/2/members", `{"email": "alice@example.com"}`, http.StatusBadRequest},
+		{"add by email", "POST", "/api/organizations/2/members", `{"email": "alice@example.com", "role": "read_only"}`, http.StatusOK},
+		{"add twice", "POST", "/api/organizations/2/members", `{"email": "alice@example.com", "role": "clerk"}`, http.StatusBadRequest},
+		{"set role", "PUT", "/api/users/1/role", `{"role": "clerk"}`, http.StatusOK},
+		{"disable member of another organization", "DELETE", "/api/users/1", "", http.StatusConflict},
+		{"disable member of this organization alone", "DELETE", "/api/users/3", "", http.StatusOK},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := serveAs(router, "mallory-session", "2", tt.method, tt.path, tt.body); w.Code != tt.want {
+				t.Errorf("got %d %q, want %d", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+
+	// Mallory's changes only reach Alice's membership of the second
+	// organization, and Alice can still sign in
+	for organization, want := range map[string]string{"1": auth.Admin, "2": auth.Clerk} {
+		w := serveAs(router, "alice-session", organization, "GET", "/api/auth/me", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("organization %s: got %d %q", organization, w.Code, w.Body.String())
+		}
+		var u models.User
+		if err := json.NewDecoder(w.Body).Decode(&u); err != nil {
+			t.Fatal(err)
+		}
+		if u.Role != want {
+			t.Errorf("organization %s: role %q, want %q", organization, u.Role, want)
+		}
+	}
+
+	// An admin of one organization cannot act on another's members
+	if w := serveAs(router, "mallory-session", "1", "PUT", "/api/users/1/role", `{"role": "read_only"}`); w.Code != http.StatusForbidden {
+		t.Errorf("changing a role in an organization Mallory is not in: got %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+	"invoice-app/money"
+)
+
+var paymentMethods = map[string]bool{
+	models.PaymentBankTransfer: true,
+	models.PaymentCard:         true,
+	models.PaymentCash:         true,
+	models.PaymentCheque:       true,
+	models.PaymentOther:        true,
+}
+
+// paymentMethodLabel describes a payment method as printed on invoices.
+func paymentMethodLabel(method string) string {
+	switch method {
+	case models.PaymentBankTransfer:
+		return "Bank transfer"
+	case models.PaymentCard:
+		return "Card"
+	case models.PaymentCash:
+		return "Cash"
+	case models.PaymentCheque:
+		return "Cheque"
+	}
+	return "Other"
+}
+
+func (h *Handler) invoicePayments(invoiceID int, currency string) ([]models.Payment, error) {
+	rows, err := h.db.Query(`
+		SELECT id, invoice_id, amount, payment_date, method, reference, created_at
+		FROM payments WHERE invoice_id = ?
+		ORDER BY payment_date, id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		var p models.Payment
+		var paymentDate time.Time
+		if err := rows.Scan(&p.ID, &p.InvoiceID, &p.Amount, &paymentDate, &p.Method, &p.Reference, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		p.Amount.Currency = currency
+		p.PaymentDate = paymentDate.Format("2006-01-02")
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
+
+func (h *Handler) GetPayments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var currency string
+	err = h.db.QueryRow("SELECT currency FROM invoices WHERE id = ? AND organization_id = ?", id, organizationID(r)).Scan(&currency)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	payments, err := h.invoicePayments(id, currency)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payments)
+}
+
+// CreatePayment records money received against an invoice. Payments may be
+// partial or exceed the balance; once the balance reaches zero an open
+// invoice is marked paid. The response is the updated invoice.
+func (h *Handler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreatePaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req.Method = strings.TrimSpace(req.Method)
+	if !paymentMethods[req.Method] {
+		http.Error(w, "Payment method must be one of bank_transfer, card, cash, cheque or other", http.StatusBadRequest)
+		return
+	}
+
+	// Payment date defaults to today and cannot be in the future
+	today := time.Now().Format("2006-01-02")
+	if req.PaymentDate == "" {
+		req.PaymentDate = today
+	}
+	if _, err := time.Parse("2006-01-02", req.PaymentDate); err != nil {
+		http.Error(w, "Payment date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	if req.PaymentDate > today {
+		http.Error(w, "Payment date cannot be in the future", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var status, currency string
+	err = tx.QueryRow("SELECT status, currency FROM invoices WHERE id = ? AND organization_id = ?", id, organizationID(r)).Scan(&status, &currency)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Payments are taken once an invoice has been issued, including over-payments
+	// of paid invoices, but not against drafts or cancelled invoices
+	switch lifecycle.State(status) {
+	case lifecycle.StateDraft, lifecycle.StateVoid, lifecycle.StateCredited:
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Cannot record a payment against a %s invoice", status), http.StatusConflict)
+		return
+	}
+
+	amount, err := money.Parse(req.Amount.String(), currency)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, "Invalid amount: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !amount.IsPositive() {
+		tx.Rollback()
+		http.Error(w, "Payment amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	before, err := snapshot(tx, auditInvoice, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("INSERT INTO payments (invoice_id, amount, payment_date, method, reference) VALUES (?, ?, ?, ?, ?)",
+		id, amount, req.PaymentDate, req.Method, strings.TrimSpace(req.Reference))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	paymentID, _ := result.LastInsertId()
+
+	if _, err := tx.Exec("UPDATE invoices SET amount_paid = amount_paid + ? WHERE id = ? AND organization_id = ?",
+		amount, id, organizationID(r)); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := settleIfPaid(tx, organizationID(r), id, time.Now()); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = recordAudit(tx, actor(r), auditPayment, paymentID, models.AuditCreate, nil)
+	if err == nil {
+		err = recordAudit(tx, actor(r), auditInvoice, int64(id), actionPay, before)
+	}
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	inv, err := h.loadInvoice(organizationID(r), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inv)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/auth"
+	"invoice-app/models"
+)
+
+// invoiceRouter serves the routes that issue, edit, pay and credit
+// invoices, as main.go registers them.
+func invoiceRouter(h *Handler) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(h.Authenticate)
+	r.HandleFunc("/api/invoices", h.Require(auth.EditInvoices, h.CreateInvoice)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}", h.Require(auth.ViewRecords, h.GetInvoice)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}", h.Require(auth.EditInvoices, h.UpdateInvoice)).Methods("PUT")
+	r.HandleFunc("/api/invoices/{id}/items", h.Require(auth.EditInvoices, h.AddInvoiceItem)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/items/{itemId}", h.Require(auth.EditInvoices, h.UpdateInvoiceItem)).Methods("PUT")
+	r.HandleFunc("/api/invoices/{id}/items/{itemId}", h.Require(auth.EditInvoices, h.DeleteInvoiceItem)).Methods("DELETE")
+	r.HandleFunc("/api/invoices/{id}/transitions/{transition}", h.Require(auth.ChangeInvoiceStatus, h.ApplyInvoiceTransition)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/payments", h.Require(auth.RecordPayments, h.CreatePayment)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/credit-notes", h.Require(auth.IssueCreditNotes, h.CreateCreditNote)).Methods("POST")
+	return r
+}
+
+// seedInvoicing adds to the first organization an admin signed in as
+// "admin-session", customer 1, and product 1 at 10.00 taxed at 20%.
+func seedInvoicing(t *testing.T, db *sql.DB) {
+	t.Helper()
+	mustExec(t, db, "INSERT INTO users (id, email, name, password_hash) VALUES (1, 'admin@example.com', '', '')")
+	mustExec(t, db, "INSERT INTO organization_members (organization_id, user_id, role) VALUES (1, 1, 'admin')")
+	mustExec(t, db, "INSERT INTO sessions (user_id, token_hash, expires_at) VALUES (1, ?, ?)",
+		auth.HashToken("admin-session"), time.Now().Add(time.Hour))
+	mustExec(t, db, "INSERT INTO customers (id, organization_id, name, phone, address, country) VALUES (1, 1, 'Acme', '5551234', '1 Main St', 'Germany')")
+	mustExec(t, db, "INSERT INTO tax_categories (id, organization_id, name) VALUES (1, 1, 'Standard')")
+	mustExec(t, db, "INSERT INTO tax_rules (tax_category_id, country, rate) VALUES (1, '*', 2000)")
+	mustExec(t, db, "INSERT INTO products (id, organization_id, name, price, tax_category_id) VALUES (1, 1, 'Support', 1000, 1)")
+}
+
+// issueInvoice creates an invoice for 3 of product 1 less a discount of
+// 1.00, which comes to 29.00 and 5.80 tax, and finalizes it unless draft.
+func issueInvoice(t *testing.T, router http.Handler, draft bool) int {
+	t.Helper()
+	w := serveAs(router, "admin-session", "1", "POST", "/api/invoices",
+		`{"customer_id": 1, "items": [{"product_id": 1, "quantity": 3}], "adjustments": [{"kind": "discount", "type": "fixed", "value": "1.00"}]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating the invoice: got %d %q", w.Code, w.Body.String())
+	}
+	var inv models.Invoice
+	if err := json.NewDecoder(w.Body).Decode(&inv); err != nil {
+		t.Fatal(err)
+	}
+	if !draft {
+		if w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/transitions/finalize", inv.ID), ""); w.Code != http.StatusOK {
+			t.Fatalf("finalizing the invoice: got %d %q", w.Code, w.Body.String())
+		}
+	}
+	return inv.ID
+}
+
+// getInvoice reads an invoice as the admin.
+func getInvoice(t *testing.T, router http.Handler, id int) models.Invoice {
+	t.Helper()
+	w := serveAs(router, "admin-session", "1", "GET", fmt.Sprintf("/api/invoices/%d", id), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("reading invoice %d: got %d %q", id, w.Code, w.Body.String())
+	}
+	var inv models.Invoice
+	if err := json.NewDecoder(w.Body).Decode(&inv); err != nil {
+		t.Fatal(err)
+	}
+	return inv
+}
+
+// pay records a payment of amount against an invoice as the admin.
+func pay(router http.Handler, id int, amount string) int {
+	w := serveAs(router, "admin-session", "1", "POST", fmt.Sprintf("/api/invoices/%d/payments", id),
+		fmt.Sprintf(`{"amount": %s, "method": "bank_transfer"}`, amount))
+	return w.Code
+}
+
+func TestCreatePayment(t *testing.T) {
+	type payment struct {
+		amount string
+		want   int
+	}
+	for _, tt := range []struct {
+		name        string
+		draft       bool
+		payments    []payment
+		wantStatus  string
+		wantBalance string
+	}{
+		{"paid in full", false, []payment{{"34.80", http.StatusCreated}}, "paid", "0.00"},
+		{"paid in parts", false, []payment{{"10.00", http.StatusCreated}, {"24.80", http.StatusCreated}}, "paid", "0.00"},
+		{"part paid", false, []payment{{"10.00", http.StatusCreated}}, "finalized", "24.80"},
+		{"over-payment", false, []payment{{"50.00", http.StatusCreated}}, "paid", "-15.20"},
+		{"over-payment of a paid invoice", false, []payment{{"34.80", http.StatusCreated}, {"5.00", http.StatusCreated}}, "paid", "-5.00"},
+		{"nothing", false, []payment{{"0", http.StatusBadRequest}}, "finalized", "34.80"},
+		{"negative", false, []payment{{"-5.00", http.StatusBadRequest}}, "finalized", "34.80"},
+		{"more decimals than the currency", false, []payment{{"10.005", http.StatusBadRequest}}, "finalized", "34.80"},
+		{"draft", true, []payment{{"34.80", http.StatusConflict}}, "draft", "34.80"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testDB(t)
+			seedInvoicing(t, db)
+			router := invoiceRouter(New(db, nil))
+			id := issueInvoice(t, router, tt.draft)
+
+			for _, p := range tt.payments {
+				if got := pay(router, id, p.amount); got != p.want {
+					t.Errorf("paying %s: got %d, want %d", p.amount, got, p.want)
+				}
+			}
+
+			inv := getInvoice(t, router, id)
+			if inv.Status != tt.wantStatus || inv.BalanceDue.String() != tt.wantBalance {
+				t.Errorf("got %s with %s due, want %s with %s due", inv.Status, inv.BalanceDue, tt.wantStatus, tt.wantBalance)
+			}
+			if tt.wantStatus == "paid" && inv.PaidAt == nil {
+				t.Error("paid without a paid date")
+			}
+		})
+	}
+}
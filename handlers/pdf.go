@@ -3,37 +3,150 @@ package handlers
 import (
 	"bytes"
 	"database/sql"
+	"encoding/base64"
 	"fmt"
 	"html/template"
+	"log"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/templates"
 	"github.com/gorilla/mux"
-	"github.com/jung-kurt/gofpdf"
 )
 
 type InvoicePDFData struct {
-	ID          int
-	TotalPrice  float64
-	Status      string
-	CreatedAt   string
-	ProcessedAt string
-	Items       []InvoiceItemPDF
-	TotalItems  int
-	GeneratedAt string
-	Customer    *models.Customer
+	ID           int
+	Number       string
+	Subtotal     money.Money
+	TaxTotal     money.Money
+	TotalPrice   money.Money
+	Currency     string
+	ExchangeRate money.ExchangeRate // shown only when Currency is not the base currency
+	Adjustments  []models.InvoiceAdjustment
+	Status       string
+	CreatedAt    string
+	FinalizedAt  string
+	DueDate      string
+	PaymentTerms string
+	Overdue      bool
+	Items        []InvoiceItemPDF
+	TaxLines     []models.TaxLine
+	Payments     []models.Payment
+	AmountPaid   money.Money
+	Credited     money.Money
+	BalanceDue   money.Money
+	TotalItems   int
+	GeneratedAt  string
+	Customer     *models.CustomerSnapshot
+
+	// The seller, and the path of their logo or "" if they have none or the
+	// template leaves it out.
+	Company *models.CompanyProfile
+	Logo    string
+
+	// The style the document is rendered in.
+	Template *models.PDFTemplate
+
+	// Set only for credit notes: the number of the invoice credited and why.
+	CreditedInvoice string
+	Reason          string
+
+	// Set only for quotes: the last day the quote may be accepted.
+	ValidUntil string
+}
+
+func (d InvoicePDFData) BaseCurrency() string {
+	return money.BaseCurrency
+}
+
+// HasSeller reports whether the seller's details have been filled in and
+// the template shows them.
+func (d InvoicePDFData) HasSeller() bool {
+	return d.Template.Fields.Seller && d.Company != nil && d.Company.LegalName != ""
+}
+
+// HasPaymentInstructions reports whether d is an invoice, the seller has
+// said how to pay it and the template shows how.
+func (d InvoicePDFData) HasPaymentInstructions() bool {
+	if d.IsCreditNote() || d.IsQuote() || d.Company == nil || !d.Template.Fields.PaymentInstructions {
+		return false
+	}
+	c := d.Company
+	return c.BankName != "" || c.AccountHolder != "" || c.IBAN != "" || c.BIC != "" || c.PaymentInstructions != ""
+}
+
+// CSSFont is the template's font as a CSS font-family.
+func (d InvoicePDFData) CSSFont() template.CSS {
+	return template.CSS(pdfFonts[d.Template.Font])
+}
+
+// LogoURI is the logo as a data URI, so the HTML stands alone, or "" if
+// there is none.
+func (d InvoicePDFData) LogoURI() template.URL {
+	if d.Logo == "" {
+		return ""
+	}
+	image, err := os.ReadFile(d.Logo)
+	if err != nil {
+		return ""
+	}
+	return template.URL("data:" + http.DetectContentType(image) + ";base64," + base64.StdEncoding.EncodeToString(image))
+}
+
+// IsCreditNote reports whether d is a credit note rather than an invoice.
+func (d InvoicePDFData) IsCreditNote() bool {
+	return d.CreditedInvoice != ""
+}
+
+// IsQuote reports whether d is a quote rather than an invoice.
+func (d InvoicePDFData) IsQuote() bool {
+	return d.ValidUntil != ""
 }
 
+// Title is the document heading.
+func (d InvoicePDFData) Title() string {
+	if d.IsCreditNote() {
+		return "CREDIT NOTE"
+	}
+	if d.IsQuote() {
+		return "QUOTE"
+	}
+	return "INVOICE"
+}
+
+// RunningTotal is the sum of the line totals of the items up to the i-th,
+// carried forward from one page to the next. It is zero with no items.
+func (d InvoicePDFData) RunningTotal(i int) money.Money {
+	items := d.Items
+	if i+1 < len(items) {
+		items = items[:i+1]
+	}
+	total := money.Zero(d.Currency)
+	for _, item := range items {
+		total = total.Add(item.TotalPrice)
+	}
+	return total
+}
+
+// InvoiceItemPDF is one printed line. LineAmount is Quantity × UnitPrice;
+// a line discount is printed as its own row below it.
 type InvoiceItemPDF struct {
-	ProductName string
-	Quantity    int
-	UnitPrice   float64
-	TotalPrice  float64
+	ProductName    string
+	Quantity       int
+	UnitPrice      money.Money
+	LineAmount     money.Money
+	DiscountLabel  string
+	DiscountAmount money.Money
+	TotalPrice     money.Money
 }
 
+// GenerateInvoicePDF renders an invoice. With ?format=factur-x it is sent as
+// a Factur-X e-invoice, PDF/A-3 with the invoice's XML inside.
 func (h *Handler) GenerateInvoicePDF(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -41,53 +154,82 @@ func (h *Handler) GenerateInvoicePDF(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
 		return
 	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != formatFacturX {
+		http.Error(w, fmt.Sprintf("Unknown format %q; use %s or leave it out", format, formatFacturX), http.StatusBadRequest)
+		return
+	}
+
+	pdfData, err := h.invoicePDFData(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if format == formatFacturX {
+		h.writeFacturX(w, r, pdfData)
+		return
+	}
+	h.writePDF(w, r, pdfData, fmt.Sprintf("invoice_%s.pdf", pdfData.Number))
+}
 
+// invoicePDFData loads an organization's invoice as it is printed.
+func (h *Handler) invoicePDFData(organizationID, id int) (InvoicePDFData, error) {
 	// Fetch invoice data with customer information
 	var invoice struct {
-		ID          int
-		CustomerID  *int
-		TotalPrice  float64
-		Status      string
-		CreatedAt   time.Time
-		ProcessedAt *time.Time
-		Customer    *models.Customer
+		ID            int
+		InvoiceNumber string
+		CustomerID    *int
+		Subtotal      money.Money
+		TaxTotal      money.Money
+		TotalPrice    money.Money
+		AmountPaid    money.Money
+		Credited      money.Money
+		Currency      string
+		ExchangeRate  money.ExchangeRate
+		Status        string
+		PaymentTerms  string
+		TermDays      int
+		DueDate       sql.NullTime
+		CreatedAt     time.Time
+		FinalizedAt   *time.Time
+		Customer      *models.CustomerSnapshot
 	}
 	var customerName, customerPhone, customerAddress, customerCountry sql.NullString
-	err = h.db.QueryRow(`
-		SELECT i.id, i.customer_id, i.total_price, i.status, i.created_at, i.processed_at,
-		       c.name, c.phone, c.address, c.country
+	err := h.db.QueryRow(`
+		SELECT i.id, i.invoice_number, i.customer_id, i.subtotal, i.tax_total, i.total_price, i.amount_paid, i.amount_credited, i.currency, i.exchange_rate, i.status,
+		       i.payment_terms, i.payment_term_days, i.due_date, i.created_at, i.finalized_at,
+		       i.customer_name, i.customer_phone, i.customer_address, i.customer_country
 		FROM invoices i 
-		LEFT JOIN customers c ON i.customer_id = c.id 
-		WHERE i.id = ?`, id).
-		Scan(&invoice.ID, &invoice.CustomerID, &invoice.TotalPrice, &invoice.Status, &invoice.CreatedAt, &invoice.ProcessedAt,
+		WHERE i.id = ? AND i.organization_id = ?`, id, organizationID).
+		Scan(&invoice.ID, &invoice.InvoiceNumber, &invoice.CustomerID, &invoice.Subtotal, &invoice.TaxTotal, &invoice.TotalPrice, &invoice.AmountPaid, &invoice.Credited, &invoice.Currency, &invoice.ExchangeRate, &invoice.Status,
+			&invoice.PaymentTerms, &invoice.TermDays, &invoice.DueDate, &invoice.CreatedAt, &invoice.FinalizedAt,
 			&customerName, &customerPhone, &customerAddress, &customerCountry)
 	if err != nil {
-		http.Error(w, "Invoice not found", http.StatusNotFound)
-		return
+		return InvoicePDFData{}, err
 	}
+	invoice.Subtotal.Currency = invoice.Currency
+	invoice.TaxTotal.Currency = invoice.Currency
+	invoice.TotalPrice.Currency = invoice.Currency
+	invoice.AmountPaid.Currency = invoice.Currency
+	invoice.Credited.Currency = invoice.Currency
 
-	// Add customer info if available
-	if invoice.CustomerID != nil && customerName.Valid {
-		invoice.Customer = &models.Customer{
-			ID:      *invoice.CustomerID,
-			Name:    customerName.String,
-			Phone:   customerPhone.String,
-			Address: customerAddress.String,
-			Country: customerCountry.String,
-		}
-	}
+	// Bill to the customer as they were when the invoice was created
+	invoice.Customer = customerSnapshot(invoice.CustomerID, customerName, customerPhone, customerAddress, customerCountry)
 
 	// Fetch invoice items
 	rows, err := h.db.Query(`
-		SELECT ii.quantity, ii.unit_price, ii.total_price, p.name
+		SELECT ii.quantity, ii.unit_price, ii.discount_type, ii.discount_value, ii.discount_amount, ii.total_price, ii.product_name
 		FROM invoice_items ii
-		JOIN products p ON ii.product_id = p.id
 		WHERE ii.invoice_id = ?
-		ORDER BY p.name
+		ORDER BY ii.product_name
 	`, id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return InvoicePDFData{}, err
 	}
 	defer rows.Close()
 
@@ -96,159 +238,313 @@ func (h *Handler) GenerateInvoicePDF(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var item InvoiceItemPDF
-		err := rows.Scan(&item.Quantity, &item.UnitPrice, &item.TotalPrice, &item.ProductName)
+		var discountType sql.NullString
+		var discountValue int64
+		err := rows.Scan(&item.Quantity, &item.UnitPrice, &discountType, &discountValue, &item.DiscountAmount, &item.TotalPrice, &item.ProductName)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return InvoicePDFData{}, err
+		}
+		item.UnitPrice.Currency = invoice.Currency
+		item.DiscountAmount.Currency = invoice.Currency
+		item.TotalPrice.Currency = invoice.Currency
+		item.LineAmount = item.UnitPrice.Mul(int64(item.Quantity))
+		if discount := itemDiscount(discountType, discountValue, invoice.Currency); discount != nil {
+			item.DiscountLabel = strings.TrimSpace("Discount " + discountLabel(discount.Type, discount.Value))
 		}
 		items = append(items, item)
 		totalItems += item.Quantity
 	}
 
+	adjustments, err := h.invoiceAdjustments(id, invoice.Currency)
+	if err != nil {
+		return InvoicePDFData{}, err
+	}
+
+	taxLines, err := h.invoiceTaxLines(id, invoice.Currency)
+	if err != nil {
+		return InvoicePDFData{}, err
+	}
+
+	payments, err := h.invoicePayments(id, invoice.Currency)
+	if err != nil {
+		return InvoicePDFData{}, err
+	}
+
 	// Prepare data for template
 	pdfData := InvoicePDFData{
-		ID:          invoice.ID,
-		TotalPrice:  invoice.TotalPrice,
-		Status:      invoice.Status,
-		CreatedAt:   invoice.CreatedAt.Format("January 2, 2006 3:04 PM"),
-		Items:       items,
-		TotalItems:  totalItems,
-		GeneratedAt: time.Now().Format("January 2, 2006 at 3:04 PM"),
-		Customer:    invoice.Customer,
+		ID:           invoice.ID,
+		Number:       invoice.InvoiceNumber,
+		Subtotal:     invoice.Subtotal,
+		TaxTotal:     invoice.TaxTotal,
+		TotalPrice:   invoice.TotalPrice,
+		Currency:     invoice.Currency,
+		ExchangeRate: invoice.ExchangeRate,
+		Adjustments:  adjustments,
+		TaxLines:     taxLines,
+		Payments:     payments,
+		AmountPaid:   invoice.AmountPaid,
+		Credited:     invoice.Credited,
+		BalanceDue:   invoice.TotalPrice.Sub(invoice.AmountPaid).Sub(invoice.Credited),
+		Status:       invoice.Status,
+		CreatedAt:    invoice.CreatedAt.Format("January 2, 2006 3:04 PM"),
+		PaymentTerms: paymentTermsLabel(invoice.PaymentTerms, invoice.TermDays),
+		Overdue:      isOverdue(invoice.Status, formatDate(invoice.DueDate), time.Now()),
+		Items:        items,
+		TotalItems:   totalItems,
+		GeneratedAt:  time.Now().Format("January 2, 2006 at 3:04 PM"),
+		Customer:     invoice.Customer,
 	}
 	
-	if invoice.ProcessedAt != nil {
-		pdfData.ProcessedAt = invoice.ProcessedAt.Format("January 2, 2006 3:04 PM")
+	if invoice.FinalizedAt != nil {
+		pdfData.FinalizedAt = invoice.FinalizedAt.Format("January 2, 2006 3:04 PM")
+	}
+	if invoice.DueDate.Valid {
+		pdfData.DueDate = invoice.DueDate.Time.Format("January 2, 2006")
 	}
 
-	// Generate HTML from template
-	htmlContent, err := h.generateInvoiceHTML(pdfData)
+	return pdfData, rows.Err()
+}
+
+// GenerateCreditNotePDF renders a credit note with the invoice layout, headed
+// CREDIT NOTE and referring to the invoice it credits.
+func (h *Handler) GenerateCreditNotePDF(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Failed to generate invoice HTML", http.StatusInternalServerError)
+		http.Error(w, "Invalid credit note ID", http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.loadCreditNote(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Credit note not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	invoice, err := h.loadInvoice(organizationID(r), note.InvoiceID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var items []InvoiceItemPDF
+	totalItems := 0
+	for _, item := range note.Items {
+		pdfItem := InvoiceItemPDF{
+			ProductName:    item.Product.Name,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.UnitPrice,
+			LineAmount:     item.UnitPrice.Mul(int64(item.Quantity)),
+			DiscountAmount: item.DiscountAmount,
+			TotalPrice:     item.TotalPrice,
+		}
+		if !item.DiscountAmount.IsZero() {
+			pdfItem.DiscountLabel = "Discount"
+		}
+		items = append(items, pdfItem)
+		totalItems += item.Quantity
+	}
+
+	// The credit note carries its share of the invoice's adjustments as one line
+	var adjustments []models.InvoiceAdjustment
+	if !note.AdjustmentTotal.IsZero() {
+		kind := models.AdjustmentSurcharge
+		if note.AdjustmentTotal.IsNegative() {
+			kind = models.AdjustmentDiscount
+		}
+		adjustments = append(adjustments, models.InvoiceAdjustment{
+			Kind:        kind,
+			Type:        models.DiscountFixed,
+			Description: "Invoice adjustments",
+			Amount:      note.AdjustmentTotal,
+		})
+	}
+
+	pdfData := InvoicePDFData{
+		ID:              note.ID,
+		Number:          note.CreditNoteNumber,
+		Subtotal:        note.Subtotal,
+		TaxTotal:        note.TaxTotal,
+		TotalPrice:      note.TotalPrice,
+		Currency:        note.Currency,
+		ExchangeRate:    note.ExchangeRate,
+		Adjustments:     adjustments,
+		TaxLines:        note.TaxLines,
+		CreatedAt:       note.CreatedAt.Format("January 2, 2006 3:04 PM"),
+		Items:           items,
+		TotalItems:      totalItems,
+		GeneratedAt:     time.Now().Format("January 2, 2006 at 3:04 PM"),
+		Customer:        invoice.Customer,
+		CreditedInvoice: note.InvoiceNumber,
+		Reason:          note.Reason,
+	}
+
+	h.writePDF(w, r, pdfData, fmt.Sprintf("credit_note_%s.pdf", pdfData.Number))
+}
+
+// GenerateQuotePDF renders a quote with the invoice layout, headed QUOTE and
+// showing how long it is valid.
+func (h *Handler) GenerateQuotePDF(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
 		return
 	}
 
-	// Convert HTML to PDF using a simple approach
-	pdf := h.htmlToPDF(htmlContent, pdfData)
+	if err := expireQuotes(h.db, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	quote, err := h.loadQuote(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var items []InvoiceItemPDF
+	totalItems := 0
+	for _, item := range quote.Items {
+		pdfItem := InvoiceItemPDF{
+			ProductName:    item.Product.Name,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.UnitPrice,
+			LineAmount:     item.UnitPrice.Mul(int64(item.Quantity)),
+			DiscountAmount: item.DiscountAmount,
+			TotalPrice:     item.TotalPrice,
+		}
+		if item.Discount != nil {
+			pdfItem.DiscountLabel = strings.TrimSpace("Discount " + discountLabel(item.Discount.Type, item.Discount.Value))
+		}
+		items = append(items, pdfItem)
+		totalItems += item.Quantity
+	}
+
+	validUntil, _ := time.Parse("2006-01-02", quote.ExpiresOn)
+
+	pdfData := InvoicePDFData{
+		ID:           quote.ID,
+		Number:       quote.QuoteNumber,
+		Subtotal:     quote.Subtotal,
+		TaxTotal:     quote.TaxTotal,
+		TotalPrice:   quote.TotalPrice,
+		Currency:     quote.Currency,
+		ExchangeRate: quote.ExchangeRate,
+		Adjustments:  quote.Adjustments,
+		TaxLines:     quote.TaxLines,
+		Status:       quote.Status,
+		CreatedAt:    quote.CreatedAt.Format("January 2, 2006 3:04 PM"),
+		PaymentTerms: paymentTermsLabel(quote.PaymentTerms, quote.PaymentTermDays),
+		Items:        items,
+		TotalItems:   totalItems,
+		GeneratedAt:  time.Now().Format("January 2, 2006 at 3:04 PM"),
+		Customer:     quote.Customer,
+		ValidUntil:   validUntil.Format("January 2, 2006"),
+	}
+
+	h.writePDF(w, r, pdfData, fmt.Sprintf("quote_%s.pdf", pdfData.Number))
+}
+
+// writePDF renders data in the template the request names with ?template=,
+// or else the organization's default, and sends it as a PDF download.
+func (h *Handler) writePDF(w http.ResponseWriter, r *http.Request, data InvoicePDFData, filename string) {
+	if !h.preparePDF(w, r, &data) {
+		return
+	}
+	h.sendPDF(w, data, "attachment; filename="+filename)
+}
+
+// preparePDF gives data the template the request names and the seller,
+// writing the error and returning false if it cannot.
+func (h *Handler) preparePDF(w http.ResponseWriter, r *http.Request, data *InvoicePDFData) bool {
+	var err error
+	data.Template, err = h.pdfTemplate(organizationID(r), r.URL.Query().Get("template"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return false
+	}
+
+	if err := h.loadSeller(data, organizationID(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// loadSeller fills in the organization's company profile and logo, leaving
+// the logo out if data's template does not show it.
+func (h *Handler) loadSeller(data *InvoicePDFData, organizationID int) error {
+	var err error
+	data.Company, data.Logo, err = companyProfile(h.db, organizationID)
+	if err != nil {
+		return err
+	}
+	// A logo file removed behind our back is left out rather than failing
+	if _, err := os.Stat(data.Logo); data.Logo != "" && (err != nil || !data.Template.Fields.Logo) {
+		data.Logo = ""
+	}
+	return nil
+}
+
+// sendPDF renders data, which has its template and seller, and sends it with
+// the given Content-Disposition.
+func (h *Handler) sendPDF(w http.ResponseWriter, data InvoicePDFData, disposition string) {
+	pdf, ok := h.renderPDF(w, data)
+	if !ok {
+		return
+	}
 
 	// Set response headers
 	w.Header().Set("Content-Type", "application/pdf")
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=invoice_%06d.pdf", pdfData.ID))
+	w.Header().Set("Content-Disposition", disposition)
 	
 	// Output PDF
-	err = pdf.Output(w)
+	w.Write(pdf)
+}
+
+// renderPDF renders data, which has its template and seller, writing the
+// error and returning false if it cannot.
+func (h *Handler) renderPDF(w http.ResponseWriter, data InvoicePDFData) ([]byte, bool) {
+	// Generate HTML from template
+	htmlContent, err := h.generateInvoiceHTML(data)
 	if err != nil {
+		http.Error(w, "Failed to generate invoice HTML", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	// Render into a buffer first so a failure can still be reported
+	var pdf bytes.Buffer
+	if err := h.renderer.Render(&pdf, htmlContent); err != nil {
+		log.Println("Rendering PDF:", err)
 		http.Error(w, "Failed to generate PDF", http.StatusInternalServerError)
-		return
+		return nil, false
 	}
+	return pdf.Bytes(), true
 }
 
 func (h *Handler) generateInvoiceHTML(data InvoicePDFData) (string, error) {
 	// Define template functions
 	funcMap := template.FuncMap{
-		"toUpper": strings.ToUpper,
-	}
-
-	// Read the template file
-	tmplContent := `<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <style>
-        body { font-family: Arial, sans-serif; margin: 40px; }
-        .header { text-align: center; margin-bottom: 30px; }
-        .header h1 { color: #2c3e50; }
-        .info-grid { display: grid; grid-template-columns: repeat(2, 1fr); gap: 20px; margin-bottom: 30px; }
-        .info-box { background: #f8f9fa; padding: 15px; border-radius: 5px; }
-        .info-label { color: #666; font-size: 12px; text-transform: uppercase; }
-        .info-value { font-size: 16px; font-weight: bold; color: #2c3e50; }
-        .status-created { color: #3b82f6; }
-        .status-processed { color: #22c55e; }
-        .status-deleted { color: #ef4444; }
-        table { width: 100%; border-collapse: collapse; margin: 20px 0; }
-        th { background: #2c3e50; color: white; padding: 10px; text-align: left; }
-        td { padding: 10px; border-bottom: 1px solid #ddd; }
-        tr:nth-child(even) { background: #f8f9fa; }
-        .total-section { text-align: right; margin-top: 30px; }
-        .total-box { display: inline-block; background: #2c3e50; color: white; padding: 15px 30px; border-radius: 5px; }
-        .footer { margin-top: 50px; text-align: center; color: #666; }
-    </style>
-</head>
-<body>
-    <div class="header">
-        <h1>INVOICE</h1>
-    </div>
-    
-    {{if .Customer}}
-    <div style="margin-bottom: 30px; padding: 20px; background: #f8f9fa; border-radius: 8px;">
-        <h2 style="color: #2c3e50; margin-bottom: 15px;">BILL TO:</h2>
-        <div style="font-size: 16px; font-weight: bold; margin-bottom: 8px;">{{.Customer.Name}}</div>
-        <div style="margin-bottom: 4px;">Phone: {{.Customer.Phone}}</div>
-        <div style="margin-bottom: 4px;">Address: {{.Customer.Address}}</div>
-        <div>Country: {{.Customer.Country}}</div>
-    </div>
-    {{end}}
-    
-    <div class="info-grid">
-        <div class="info-box">
-            <div class="info-label">Invoice Number</div>
-            <div class="info-value">#{{printf "%06d" .ID}}</div>
-        </div>
-        <div class="info-box">
-            <div class="info-label">Status</div>
-            <div class="info-value status-{{.Status}}">{{.Status | toUpper}}</div>
-        </div>
-        <div class="info-box">
-            <div class="info-label">Created Date</div>
-            <div class="info-value">{{.CreatedAt}}</div>
-        </div>
-        {{if .ProcessedAt}}
-        <div class="info-box">
-            <div class="info-label">Processed Date</div>
-            <div class="info-value">{{.ProcessedAt}}</div>
-        </div>
-        {{end}}
-    </div>
-    
-    <h2>Invoice Items</h2>
-    <table>
-        <thead>
-            <tr>
-                <th>Product</th>
-                <th style="text-align: center;">Quantity</th>
-                <th style="text-align: right;">Unit Price</th>
-                <th style="text-align: right;">Total</th>
-            </tr>
-        </thead>
-        <tbody>
-            {{range .Items}}
-            <tr>
-                <td>{{.ProductName}}</td>
-                <td style="text-align: center;">{{.Quantity}}</td>
-                <td style="text-align: right;">${{printf "%.2f" .UnitPrice}}</td>
-                <td style="text-align: right;">${{printf "%.2f" .TotalPrice}}</td>
-            </tr>
-            {{end}}
-        </tbody>
-    </table>
-    
-    <p>Total Items: <strong>{{.TotalItems}}</strong></p>
-    
-    <div class="total-section">
-        <div class="total-box">
-            <div>Invoice Total</div>
-            <div style="font-size: 24px;">${{printf "%.2f" .TotalPrice}}</div>
-        </div>
-    </div>
-    
-    <div class="footer">
-        <p>PDF generated on {{.GeneratedAt}}</p>
-        <p style="font-size: 16px; color: #2c3e50;">Thank you for your business!</p>
-    </div>
-</body>
-</html>`
-
-	tmpl, err := template.New("invoice").Funcs(funcMap).Parse(tmplContent)
+		"toUpper":            strings.ToUpper,
+		"adjustmentLabel":    adjustmentLabel,
+		"paymentMethodLabel": paymentMethodLabel,
+		"formatIBAN":         formatIBAN,
+	}
+
+	tmpl, err := template.New("invoice").Funcs(funcMap).Parse(templates.Invoice)
 	if err != nil {
 		return "", err
 	}
@@ -262,132 +558,18 @@ func (h *Handler) generateInvoiceHTML(data InvoicePDFData) (string, error) {
 	return buf.String(), nil
 }
 
-// Simple HTML to PDF conversion using gofpdf
-func (h *Handler) htmlToPDF(htmlContent string, data InvoicePDFData) *gofpdf.Fpdf {
-	pdf := gofpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
-	
-	// Since gofpdf doesn't directly support HTML, we'll create a structured PDF
-	// that matches the HTML template layout
-	
-	// Header
-	pdf.SetFont("Arial", "B", 24)
-	pdf.Cell(190, 12, "INVOICE")
-	pdf.Ln(20)
-	
-	// Customer Information Section
-	if data.Customer != nil {
-		pdf.SetFont("Arial", "B", 14)
-		pdf.SetTextColor(44, 62, 80)
-		pdf.Cell(190, 8, "BILL TO:")
-		pdf.Ln(10)
-		
-		pdf.SetFont("Arial", "B", 12)
-		pdf.SetTextColor(0, 0, 0)
-		pdf.Cell(190, 6, data.Customer.Name)
-		pdf.Ln(6)
-		
-		pdf.SetFont("Arial", "", 10)
-		pdf.SetTextColor(70, 70, 70)
-		pdf.Cell(190, 5, fmt.Sprintf("Phone: %s", data.Customer.Phone))
-		pdf.Ln(5)
-		pdf.Cell(190, 5, fmt.Sprintf("Address: %s", data.Customer.Address))
-		pdf.Ln(5)
-		pdf.Cell(190, 5, fmt.Sprintf("Country: %s", data.Customer.Country))
-		pdf.Ln(15)
+// adjustmentLabel describes an invoice-level adjustment, e.g.
+// "Discount: Loyalty (5.00%)" or "Surcharge".
+func adjustmentLabel(adj models.InvoiceAdjustment) string {
+	label := "Discount"
+	if adj.Kind == models.AdjustmentSurcharge {
+		label = "Surcharge"
 	}
-	
-	// Invoice Info Grid
-	pdf.SetFont("Arial", "", 9)
-	pdf.SetTextColor(102, 102, 102)
-	pdf.Cell(47.5, 5, "INVOICE NUMBER")
-	pdf.Cell(47.5, 5, "STATUS")
-	pdf.Cell(47.5, 5, "CREATED DATE")
-	if data.ProcessedAt != "" {
-		pdf.Cell(47.5, 5, "PROCESSED DATE")
-	}
-	pdf.Ln(5)
-	
-	pdf.SetFont("Arial", "B", 12)
-	pdf.SetTextColor(44, 62, 80)
-	pdf.Cell(47.5, 8, fmt.Sprintf("#%06d", data.ID))
-	
-	// Status color
-	switch data.Status {
-	case "created":
-		pdf.SetTextColor(59, 130, 246)
-	case "processed":
-		pdf.SetTextColor(34, 197, 94)
-	case "deleted":
-		pdf.SetTextColor(239, 68, 68)
-	}
-	pdf.Cell(47.5, 8, strings.ToUpper(data.Status))
-	
-	pdf.SetTextColor(44, 62, 80)
-	pdf.Cell(47.5, 8, data.CreatedAt)
-	if data.ProcessedAt != "" {
-		pdf.Cell(47.5, 8, data.ProcessedAt)
+	if adj.Description != "" {
+		label += ": " + adj.Description
 	}
-	pdf.Ln(15)
-	
-	// Invoice Items
-	pdf.SetFont("Arial", "B", 14)
-	pdf.Cell(190, 8, "Invoice Items")
-	pdf.Ln(10)
-	
-	// Table Header
-	pdf.SetFont("Arial", "B", 10)
-	pdf.SetFillColor(44, 62, 80)
-	pdf.SetTextColor(255, 255, 255)
-	pdf.CellFormat(90, 8, "Product", "1", 0, "L", true, 0, "")
-	pdf.CellFormat(30, 8, "Quantity", "1", 0, "C", true, 0, "")
-	pdf.CellFormat(35, 8, "Unit Price", "1", 0, "R", true, 0, "")
-	pdf.CellFormat(35, 8, "Total", "1", 0, "R", true, 0, "")
-	pdf.Ln(8)
-	
-	// Table Rows
-	pdf.SetTextColor(0, 0, 0)
-	pdf.SetFont("Arial", "", 10)
-	for i, item := range data.Items {
-		if i%2 == 0 {
-			pdf.SetFillColor(248, 249, 250)
-		} else {
-			pdf.SetFillColor(255, 255, 255)
-		}
-		pdf.CellFormat(90, 8, item.ProductName, "LR", 0, "L", true, 0, "")
-		pdf.CellFormat(30, 8, fmt.Sprintf("%d", item.Quantity), "LR", 0, "C", true, 0, "")
-		pdf.CellFormat(35, 8, fmt.Sprintf("$%.2f", item.UnitPrice), "LR", 0, "R", true, 0, "")
-		pdf.CellFormat(35, 8, fmt.Sprintf("$%.2f", item.TotalPrice), "LR", 0, "R", true, 0, "")
-		pdf.Ln(8)
+	if pct := discountLabel(adj.Type, adj.Value); pct != "" {
+		label += " (" + pct + ")"
 	}
-	pdf.Cell(190, 0, "")
-	
-	// Total Items
-	pdf.Ln(10)
-	pdf.SetFont("Arial", "", 11)
-	pdf.Cell(190, 6, fmt.Sprintf("Total Items: %d", data.TotalItems))
-	
-	// Total Box
-	pdf.Ln(15)
-	pdf.SetX(130)
-	pdf.SetFillColor(44, 62, 80)
-	pdf.SetTextColor(255, 255, 255)
-	pdf.SetFont("Arial", "", 12)
-	pdf.CellFormat(60, 8, "Invoice Total", "1", 0, "C", true, 0, "")
-	pdf.Ln(8)
-	pdf.SetX(130)
-	pdf.SetFont("Arial", "B", 18)
-	pdf.CellFormat(60, 10, fmt.Sprintf("$%.2f", data.TotalPrice), "1", 0, "C", true, 0, "")
-	
-	// Footer
-	pdf.SetY(-40)
-	pdf.SetTextColor(102, 102, 102)
-	pdf.SetFont("Arial", "I", 9)
-	pdf.Cell(190, 5, fmt.Sprintf("PDF generated on %s", data.GeneratedAt))
-	pdf.Ln(5)
-	pdf.SetFont("Arial", "", 12)
-	pdf.SetTextColor(44, 62, 80)
-	pdf.Cell(190, 5, "Thank you for your business!")
-	
-	return pdf
-}
\ No newline at end of file
+	return label
+}
@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// pdfFonts are the fonts a template may use, which are the core PDF fonts,
+// with the CSS font-family each stands for in the HTML.
+var pdfFonts = map[string]string{
+	"helvetica": "Helvetica, Arial, sans-serif",
+	"times":     "'Times New Roman', Times, serif",
+	"courier":   "'Courier New', Courier, monospace",
+}
+
+var pdfLayouts = map[string]bool{
+	models.PDFLayoutClassic: true,
+	models.PDFLayoutModern:  true,
+	models.PDFLayoutCompact: true,
+}
+
+var colorPattern = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+
+const maxFooterText = 500
+
+const pdfTemplateColumns = `id, name, layout, primary_color, accent_color, font, footer_text,
+	show_logo, show_seller, show_customer_details, show_payment_terms, show_tax_breakdown, show_item_count,
+	show_payments, show_payment_instructions, show_generated_at, is_default, created_at, updated_at`
+
+// defaultPDFTemplate is the style documents are rendered in until their
+// organization sets a default template, and the one new templates start
+// from.
+func defaultPDFTemplate() *models.PDFTemplate {
+	return &models.PDFTemplate{
+		Name:         "Standard",
+		Layout:       models.PDFLayoutClassic,
+		PrimaryColor: "#2c3e50",
+		AccentColor:  "#f8f9fa",
+		Font:         "helvetica",
+		FooterText:   "Thank you for your business!",
+		Fields: models.PDFTemplateFields{
+			Logo:                true,
+			Seller:              true,
+			CustomerDetails:     true,
+			PaymentTerms:        true,
+			TaxBreakdown:        true,
+			ItemCount:           true,
+			Payments:            true,
+			PaymentInstructions: true,
+			GeneratedAt:         true,
+		},
+	}
+}
+
+// pdfTemplateDest is where a row of pdfTemplateColumns is scanned into t.
+func pdfTemplateDest(t *models.PDFTemplate) []interface{} {
+	f := &t.Fields
+	return []interface{}{&t.ID, &t.Name, &t.Layout, &t.PrimaryColor, &t.AccentColor, &t.Font, &t.FooterText,
+		&f.Logo, &f.Seller, &f.CustomerDetails, &f.PaymentTerms, &f.TaxBreakdown, &f.ItemCount,
+		&f.Payments, &f.PaymentInstructions, &f.GeneratedAt, &t.IsDefault, &t.CreatedAt, &t.UpdatedAt}
+}
+
+func (h *Handler) loadPDFTemplate(organizationID, id int) (*models.PDFTemplate, error) {
+	t := &models.PDFTemplate{}
+	err := h.db.QueryRow("SELECT "+pdfTemplateColumns+" FROM pdf_templates WHERE id = ? AND organization_id = ?",
+		id, organizationID).Scan(pdfTemplateDest(t)...)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// pdfTemplate is the template a document is rendered in: the one with the
+// given ID, or with none the organization's default or else the built-in
+// style. An ID that is not one of the organization's templates is
+// sql.ErrNoRows.
+func (h *Handler) pdfTemplate(organizationID int, id string) (*models.PDFTemplate, error) {
+	if id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, sql.ErrNoRows
+		}
+		return h.loadPDFTemplate(organizationID, n)
+	}
+
+	t := &models.PDFTemplate{}
+	err := h.db.QueryRow("SELECT "+pdfTemplateColumns+" FROM pdf_templates WHERE organization_id = ? AND is_default = 1",
+		organizationID).Scan(pdfTemplateDest(t)...)
+	if err == sql.ErrNoRows {
+		return defaultPDFTemplate(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// validatePDFTemplate tidies t's settings and checks them.
+func validatePDFTemplate(t *models.PDFTemplate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Layout = strings.ToLower(strings.TrimSpace(t.Layout))
+	t.PrimaryColor = strings.ToLower(strings.TrimSpace(t.PrimaryColor))
+	t.AccentColor = strings.ToLower(strings.TrimSpace(t.AccentColor))
+	t.Font = strings.ToLower(strings.TrimSpace(t.Font))
+	t.FooterText = strings.TrimSpace(t.FooterText)
+
+	if t.Name == "" {
+		return errors.New("PDF template name is required")
+	}
+	if !pdfLayouts[t.Layout] {
+		return errors.New("Layout must be one of classic, modern or compact")
+	}
+	if !colorPattern.MatchString(t.PrimaryColor) || !colorPattern.MatchString(t.AccentColor) {
+		return errors.New("Colors must be written as #rrggbb")
+	}
+	if _, ok := pdfFonts[t.Font]; !ok {
+		return errors.New("Font must be one of helvetica, times or courier")
+	}
+	if len(t.FooterText) > maxFooterText {
+		return errors.New("Footer text must be at most 500 characters")
+	}
+	return nil
+}
+
+func (h *Handler) GetPDFTemplates(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT "+pdfTemplateColumns+" FROM pdf_templates WHERE organization_id = ? ORDER BY name",
+		organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var pdfTemplates []models.PDFTemplate
+	for rows.Next() {
+		var t models.PDFTemplate
+		if err := rows.Scan(pdfTemplateDest(&t)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pdfTemplates = append(pdfTemplates, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pdfTemplates)
+}
+
+func (h *Handler) GetPDFTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid PDF template ID", http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.loadPDFTemplate(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// CreatePDFTemplate stores a template. Settings left out of the request are
+// those of the built-in style, and an organization's first template becomes
+// its default.
+func (h *Handler) CreatePDFTemplate(w http.ResponseWriter, r *http.Request) {
+	t := defaultPDFTemplate()
+	t.Name = ""
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePDFTemplate(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM pdf_templates WHERE organization_id = ? AND name = ?", organizationID(r), t.Name).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "PDF template with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	f := t.Fields
+	id, err := h.execAudited(r, auditPDFTemplate, 0, models.AuditCreate, `
+		INSERT INTO pdf_templates (organization_id, name, layout, primary_color, accent_color, font, footer_text,
+			show_logo, show_seller, show_customer_details, show_payment_terms, show_tax_breakdown, show_item_count,
+			show_payments, show_payment_instructions, show_generated_at, is_default)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NOT EXISTS (SELECT 1 FROM pdf_templates WHERE organization_id = ?))
+	`, organizationID(r), t.Name, t.Layout, t.PrimaryColor, t.AccentColor, t.Font, t.FooterText,
+		f.Logo, f.Seller, f.CustomerDetails, f.PaymentTerms, f.TaxBreakdown, f.ItemCount,
+		f.Payments, f.PaymentInstructions, f.GeneratedAt, organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	t, err = h.loadPDFTemplate(organizationID(r), int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// UpdatePDFTemplate changes the settings given in the request and keeps the
+// rest.
+func (h *Handler) UpdatePDFTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid PDF template ID", http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.loadPDFTemplate(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePDFTemplate(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM pdf_templates WHERE organization_id = ? AND name = ? AND id != ?",
+		organizationID(r), t.Name, id).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "PDF template with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	f := t.Fields
+	_, err = h.execAudited(r, auditPDFTemplate, int64(id), models.AuditUpdate, `
+		UPDATE pdf_templates SET name = ?, layout = ?, primary_color = ?, accent_color = ?, font = ?, footer_text = ?,
+			show_logo = ?, show_seller = ?, show_customer_details = ?, show_payment_terms = ?, show_tax_breakdown = ?,
+			show_item_count = ?, show_payments = ?, show_payment_instructions = ?, show_generated_at = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND organization_id = ?
+	`, t.Name, t.Layout, t.PrimaryColor, t.AccentColor, t.Font, t.FooterText,
+		f.Logo, f.Seller, f.CustomerDetails, f.PaymentTerms, f.TaxBreakdown,
+		f.ItemCount, f.Payments, f.PaymentInstructions, f.GeneratedAt, id, organizationID(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.GetPDFTemplate(w, r)
+}
+
+// DeletePDFTemplate removes a template. Deleting the default leaves the
+// organization's documents in the built-in style.
+func (h *Handler) DeletePDFTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid PDF template ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.execAudited(r, auditPDFTemplate, int64(id), models.AuditDelete, "DELETE FROM pdf_templates WHERE id = ? AND organization_id = ?", id, organizationID(r)); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetDefaultPDFTemplate makes a template the one the organization's
+// documents are rendered in, in place of its current default.
+func (h *Handler) SetDefaultPDFTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid PDF template ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Both templates change, so both are audited
+	var ids []int64
+	rows, err := tx.Query("SELECT id FROM pdf_templates WHERE organization_id = ? AND (id = ? OR is_default = 1) ORDER BY id = ?",
+		organizationID(r), id, id)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for rows.Next() {
+		var templateID int64
+		if err := rows.Scan(&templateID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, templateID)
+	}
+	rows.Close()
+
+	if len(ids) == 0 || ids[len(ids)-1] != int64(id) {
+		tx.Rollback()
+		http.Error(w, "PDF template not found", http.StatusNotFound)
+		return
+	}
+
+	for _, templateID := range ids {
+		before, err := snapshot(tx, auditPDFTemplate, templateID)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if _, err := tx.Exec("UPDATE pdf_templates SET is_default = (id = ?), updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			id, templateID); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := recordAudit(tx, actor(r), auditPDFTemplate, templateID, models.AuditUpdate, before); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.GetPDFTemplate(w, r)
+}
+
+// PreviewPDFTemplate renders a stored template; see previewPDF.
+func (h *Handler) PreviewPDFTemplate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid PDF template ID", http.StatusBadRequest)
+		return
+	}
+
+	t, err := h.loadPDFTemplate(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "PDF template not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.previewPDF(w, r, t)
+}
+
+// PreviewUnsavedPDFTemplate renders the template in the request body
+// without storing it, so it can be tried out while it is edited; see
+// previewPDF.
+func (h *Handler) PreviewUnsavedPDFTemplate(w http.ResponseWriter, r *http.Request) {
+	t := defaultPDFTemplate()
+	if err := json.NewDecoder(r.Body).Decode(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validatePDFTemplate(t); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.previewPDF(w, r, t)
+}
+
+// previewPDF renders t against the invoice given by ?invoice_id=, or a
+// sample invoice without one, as a PDF to show in the browser or with
+// ?format=html as the HTML.
+func (h *Handler) previewPDF(w http.ResponseWriter, r *http.Request, t *models.PDFTemplate) {
+	data := samplePDFData()
+	if invoiceID := r.URL.Query().Get("invoice_id"); invoiceID != "" {
+		id, err := strconv.Atoi(invoiceID)
+		if err != nil {
+			http.Error(w, "Invalid invoice ID", http.StatusBadRequest)
+			return
+		}
+		data, err = h.invoicePDFData(organizationID(r), id)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Invoice not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	data.Template = t
+	if err := h.loadSeller(&data, organizationID(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "pdf":
+		h.sendPDF(w, data, "inline; filename=preview.pdf")
+	case "html":
+		htmlContent, err := h.generateInvoiceHTML(data)
+		if err != nil {
+			http.Error(w, "Failed to generate invoice HTML", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(htmlContent))
+	default:
+		http.Error(w, "Format must be pdf or html", http.StatusBadRequest)
+	}
+}
+
+// samplePDFData is an invoice to preview templates against, with a line
+// discount, tax and a part payment so that every part of the layout shows.
+func samplePDFData() InvoicePDFData {
+	currency := money.BaseCurrency
+	amount := func(minor int64) money.Money { return money.New(minor, currency) }
+	now := time.Now()
+
+	items := []InvoiceItemPDF{
+		{ProductName: "Consulting", Quantity: 12, UnitPrice: amount(9500), LineAmount: amount(114000), TotalPrice: amount(114000)},
+		{ProductName: "Software licence", Quantity: 2, UnitPrice: amount(25000), LineAmount: amount(50000),
+			DiscountLabel: "Discount 10%", DiscountAmount: amount(5000), TotalPrice: amount(45000)},
+		{ProductName: "Support plan", Quantity: 1, UnitPrice: amount(9900), LineAmount: amount(9900), TotalPrice: amount(9900)},
+	}
+	subtotal := amount(168900)
+	taxTotal := amount(33780)
+	total := subtotal.Add(taxTotal)
+	paid := amount(100000)
+
+	return InvoicePDFData{
+		Number:       "INV-SAMPLE-00001",
+		Subtotal:     subtotal,
+		TaxTotal:     taxTotal,
+		TotalPrice:   total,
+		Currency:     currency,
+		ExchangeRate: money.IdentityRate,
+		TaxLines:     []models.TaxLine{{Rate: tax.Rate(2000), TaxableAmount: subtotal, TaxAmount: taxTotal}},
+		Payments: []models.Payment{
+			{Amount: paid, PaymentDate: now.Format("2006-01-02"), Method: models.PaymentBankTransfer, Reference: "Part payment"},
+		},
+		AmountPaid:   paid,
+		Credited:     money.Zero(currency),
+		BalanceDue:   total.Sub(paid),
+		Status:       string(lifecycle.StateSent),
+		CreatedAt:    now.Format("January 2, 2006 3:04 PM"),
+		FinalizedAt:  now.Format("January 2, 2006 3:04 PM"),
+		DueDate:      now.AddDate(0, 0, 30).Format("January 2, 2006"),
+		PaymentTerms: paymentTermsLabel(models.PaymentTermsNet30, 30),
+		Items:        items,
+		TotalItems:   15,
+		GeneratedAt:  now.Format("January 2, 2006 at 3:04 PM"),
+		Customer: &models.CustomerSnapshot{
+			Name:    "Sample Customer Ltd",
+			Phone:   "+44 20 7946 0000",
+			Address: "1 Example Street, London",
+			Country: "United Kingdom",
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"invoice-app/money"
+)
+
+func TestRunningTotal(t *testing.T) {
+	items := []InvoiceItemPDF{{TotalPrice: eur(1000)}, {TotalPrice: eur(250)}, {TotalPrice: eur(-100)}}
+	tests := []struct {
+		name  string
+		items []InvoiceItemPDF
+		i     int
+		want  money.Money
+	}{
+		{"empty invoice", nil, 0, eur(0)},
+		{"page break at the first item", items, 0, eur(1000)},
+		{"page break at the second item", items, 1, eur(1250)},
+		{"last item", items, 2, eur(1150)},
+		{"past the last item", items, 5, eur(1150)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := InvoicePDFData{Currency: "EUR", Items: tt.items}
+			if got := d.RunningTotal(tt.i); got != tt.want {
+				t.Errorf("RunningTotal(%d) = %v, want %v", tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvoiceHTMLRunningTotals(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []InvoiceItemPDF
+		want  []string // the running total carried from each item
+	}{
+		{"empty invoice", nil, nil},
+		{"one item", []InvoiceItemPDF{{ProductName: "Books", Quantity: 1, UnitPrice: eur(1500), LineAmount: eur(1500), TotalPrice: eur(1500)}}, []string{"€15.00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := InvoicePDFData{Currency: "EUR", Number: "INV-2026-00001", Items: tt.items, Template: defaultPDFTemplate()}
+			html, err := (&Handler{}).generateInvoiceHTML(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, part := range strings.Split(html, `data-running-total="`)[1:] {
+				got = append(got, part[:strings.Index(part, `"`)])
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("running totals %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
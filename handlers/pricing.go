@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"invoice-app/models"
+	"invoice-app/money"
+	"invoice-app/tax"
+)
+
+// requestError is a validation failure caused by the client's input; the
+// handler reports it as 400 Bad Request rather than 500.
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+// pricedInvoice is an invoice's lines, adjustments and totals as computed
+// from a request, ready to be written by insertInvoiceLines.
+type pricedInvoice struct {
+	Items           []models.InvoiceItem
+	Adjustments     []models.InvoiceAdjustment
+	TaxLines        []models.TaxLine
+	Subtotal        money.Money
+	AdjustmentTotal money.Money
+	TaxTotal        money.Money
+	TotalPrice      money.Money
+
+	// Stored discount values, parallel to Items and Adjustments.
+	itemDiscountValues []int64
+	adjustmentValues   []int64
+}
+
+// priceInvoice prices each requested item at the billing organization's
+// current product price converted to the billing currency, applies line
+// discounts, then invoice-level adjustments, and finally computes tax per line
+// for the customer's country.
+//
+// Invoice-level adjustments are spread over the lines in proportion to their
+// totals so that each line's taxable amount reflects its share.
+func priceInvoice(q rowQuerier, b *billing,
+	reqItems []models.CreateInvoiceItem, reqAdjustments []models.InvoiceAdjustment) (*pricedInvoice, error) {
+	return repriceInvoice(q, b, reqItems, nil, reqAdjustments)
+}
+
+// repriceInvoice is priceInvoice for an invoice being edited. kept[i], if
+// set, is the line reqItems[i] was priced as before; it keeps that unit price
+// and product name instead of taking the product's current ones. Discounts,
+// adjustments and tax are computed afresh for every line.
+func repriceInvoice(q rowQuerier, b *billing,
+	reqItems []models.CreateInvoiceItem, kept []*models.InvoiceItem, reqAdjustments []models.InvoiceAdjustment) (*pricedInvoice, error) {
+	country, currency, rate := b.Customer.Country, b.Currency, b.Rate
+
+	p := &pricedInvoice{
+		Subtotal:        money.Zero(currency),
+		AdjustmentTotal: money.Zero(currency),
+		TaxTotal:        money.Zero(currency),
+	}
+
+	for i, item := range reqItems {
+		if item.Quantity <= 0 {
+			return nil, requestError(fmt.Sprintf("Item %d: quantity must be positive", i+1))
+		}
+
+		var product models.Product
+		err := q.QueryRow("SELECT id, name, price, tax_category_id FROM products WHERE id = ? AND organization_id = ?",
+			item.ProductID, b.OrganizationID).
+			Scan(&product.ID, &product.Name, &product.Price, &product.TaxCategoryID)
+		if err == sql.ErrNoRows {
+			return nil, requestError("Product not found")
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		lineTaxRate, taxed, err := taxRate(q, product.TaxCategoryID, country)
+		if err != nil {
+			return nil, err
+		}
+
+		unitPrice := product.Price.Convert(currency, rate)
+		if i < len(kept) && kept[i] != nil {
+			unitPrice, product.Name = kept[i].UnitPrice, kept[i].Product.Name
+		}
+		gross := unitPrice.Mul(int64(item.Quantity))
+
+		discount := money.Zero(currency)
+		var discountStored int64
+		var lineDiscount *models.Discount
+		if item.Discount != nil {
+			discountStored, err = discountValue(item.Discount.Type, item.Discount.Value, currency)
+			if err != nil {
+				return nil, requestError(fmt.Sprintf("Item %d discount: %v", i+1, err))
+			}
+			discount = discountAmount(gross, item.Discount.Type, discountStored)
+			if discount.Amount > gross.Amount {
+				return nil, requestError(fmt.Sprintf("Item %d: discount exceeds the line total", i+1))
+			}
+			lineDiscount = &models.Discount{
+				Type:  item.Discount.Type,
+				Value: formatDiscountValue(item.Discount.Type, discountStored, currency),
+			}
+		}
+
+		lineTotal := gross.Sub(discount)
+		p.Subtotal = p.Subtotal.Add(lineTotal)
+		p.Items = append(p.Items, models.InvoiceItem{
+			ProductID:      item.ProductID,
+			Quantity:       item.Quantity,
+			UnitPrice:      unitPrice,
+			Discount:       lineDiscount,
+			DiscountAmount: discount,
+			TotalPrice:     lineTotal,
+			TaxRate:        lineTaxRate,
+			Untaxed:        !taxed,
+			Product:        &models.ProductSnapshot{ID: product.ID, Name: product.Name},
+		})
+		p.itemDiscountValues = append(p.itemDiscountValues, discountStored)
+	}
+
+	// Percentage adjustments all apply to the subtotal; they do not compound
+	for i, adj := range reqAdjustments {
+		if adj.Kind != models.AdjustmentDiscount && adj.Kind != models.AdjustmentSurcharge {
+			return nil, requestError(fmt.Sprintf("Adjustment %d: kind must be %q or %q", i+1, models.AdjustmentDiscount, models.AdjustmentSurcharge))
+		}
+
+		stored, err := discountValue(adj.Type, adj.Value, currency)
+		if err != nil {
+			return nil, requestError(fmt.Sprintf("Adjustment %d: %v", i+1, err))
+		}
+
+		amount := discountAmount(p.Subtotal, adj.Type, stored)
+		if adj.Kind == models.AdjustmentDiscount {
+			amount = amount.Neg()
+		}
+		p.AdjustmentTotal = p.AdjustmentTotal.Add(amount)
+
+		p.Adjustments = append(p.Adjustments, models.InvoiceAdjustment{
+			Kind:        adj.Kind,
+			Type:        adj.Type,
+			Value:       formatDiscountValue(adj.Type, stored, currency),
+			Description: strings.TrimSpace(adj.Description),
+			Amount:      amount,
+		})
+		p.adjustmentValues = append(p.adjustmentValues, stored)
+	}
+
+	if p.Subtotal.Add(p.AdjustmentTotal).IsNegative() {
+		return nil, requestError("Invoice discounts exceed the subtotal")
+	}
+
+	weights := make([]int64, len(p.Items))
+	for i, item := range p.Items {
+		weights[i] = item.TotalPrice.Amount
+	}
+	shares := p.AdjustmentTotal.Allocate(weights)
+
+	var taxedLines []tax.Line
+	for i := range p.Items {
+		item := &p.Items[i]
+		item.AdjustmentAmount = shares[i]
+		line := tax.NewLine(item.TotalPrice.Add(item.AdjustmentAmount), item.TaxRate)
+		item.TaxAmount = line.Tax
+		p.TaxTotal = p.TaxTotal.Add(line.Tax)
+		taxedLines = append(taxedLines, line)
+	}
+
+	for _, summary := range tax.Summarize(taxedLines, currency) {
+		p.TaxLines = append(p.TaxLines, models.TaxLine{
+			Rate:          summary.Rate,
+			TaxableAmount: summary.Taxable,
+			TaxAmount:     summary.Tax,
+		})
+	}
+
+	p.TotalPrice = p.Subtotal.Add(p.AdjustmentTotal).Add(p.TaxTotal)
+
+	return p, nil
+}
+
+// insertInvoiceLines writes the items, adjustments and tax lines of a priced
+// invoice, with each item's product name as it was priced.
+func insertInvoiceLines(tx *sql.Tx, invoiceID int64, p *pricedInvoice) error {
+	return insertPricedLines(tx, "invoice", invoiceID, p)
+}
+
+// insertQuoteLines writes the lines of a priced quote as insertInvoiceLines
+// does for an invoice.
+func insertQuoteLines(tx *sql.Tx, quoteID int64, p *pricedInvoice) error {
+	return insertPricedLines(tx, "quote", quoteID, p)
+}
+
+// insertPricedLines writes p's lines to the items, adjustments and tax lines
+// tables of document, "invoice" or "quote", which share one layout. Items
+// with an ID are written under it; the others are given a new one.
+func insertPricedLines(tx *sql.Tx, document string, id int64, p *pricedInvoice) error {
+	for i, item := range p.Items {
+		var discountType interface{}
+		if item.Discount != nil {
+			discountType = item.Discount.Type
+		}
+
+		_, err := tx.Exec(fmt.Sprintf(`
+			INSERT INTO %[1]s_items (id, %[1]s_id, product_id, product_name, quantity, unit_price,
+				discount_type, discount_value, discount_amount, total_price, adjustment_amount, tax_rate, tax_amount, untaxed)
+			VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, document),
+			item.ID, id, item.ProductID, item.Product.Name, item.Quantity, item.UnitPrice,
+			discountType, p.itemDiscountValues[i], item.DiscountAmount, item.TotalPrice, item.AdjustmentAmount, item.TaxRate, item.TaxAmount, item.Untaxed,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, adj := range p.Adjustments {
+		_, err := tx.Exec(
+			fmt.Sprintf("INSERT INTO %[1]s_adjustments (%[1]s_id, kind, type, value, description, amount) VALUES (?, ?, ?, ?, ?, ?)", document),
+			id, adj.Kind, adj.Type, p.adjustmentValues[i], adj.Description, adj.Amount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, line := range p.TaxLines {
+		_, err := tx.Exec(
+			fmt.Sprintf("INSERT INTO %[1]s_tax_lines (%[1]s_id, rate, taxable_amount, tax_amount) VALUES (?, ?, ?, ?)", document),
+			id, line.Rate, line.TaxableAmount, line.TaxAmount,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
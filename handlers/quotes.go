@@ -0,0 +1,622 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+	"invoice-app/money"
+)
+
+// defaultQuoteSeries numbers quotes created without an explicit series.
+const defaultQuoteSeries = "quote"
+
+// quoteValidityDays is how long a quote is valid when no expiry is given.
+const quoteValidityDays = 30
+
+// quoteMoves lists the statuses a quote may be moved to by hand from each
+// status. Quotes become expired on their own once their expiry date passes.
+var quoteMoves = map[string][]string{
+	models.QuoteDraft: {models.QuoteSent},
+	models.QuoteSent:  {models.QuoteAccepted, models.QuoteRejected},
+}
+
+var quoteTimestampColumns = map[string]string{
+	models.QuoteSent:     "sent_at",
+	models.QuoteAccepted: "accepted_at",
+	models.QuoteRejected: "rejected_at",
+}
+
+// querier runs queries on a database or within a transaction.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// expireQuotes marks draft and sent quotes whose expiry date is before now's
+// date as expired. Quote handlers call it first so they never act on a quote
+// that has lapsed.
+func expireQuotes(db *sql.DB, now time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT id, organization_id FROM quotes WHERE status IN (?, ?) AND expires_on < ?",
+		models.QuoteDraft, models.QuoteSent, now.Format("2006-01-02"))
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var ids []int64
+	organizations := make(map[int64]int)
+	for rows.Next() {
+		var id int64
+		var organizationID int
+		if err := rows.Scan(&id, &organizationID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		ids = append(ids, id)
+		organizations[id] = organizationID
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Each quote is expired on its own so the audit log records it
+	for _, id := range ids {
+		before, err := snapshot(tx, auditQuote, id)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec("UPDATE quotes SET status = ?, expired_at = ? WHERE id = ?", models.QuoteExpired, now, id); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := recordAudit(tx, auditActor{actorSystem, organizations[id]}, auditQuote, id, actionExpire, before); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (h *Handler) queryQuotes(where string, args ...interface{}) ([]models.Quote, error) {
+	rows, err := h.db.Query(`
+		SELECT q.id, q.quote_number, q.customer_id, q.customer_name, q.customer_phone, q.customer_address, q.customer_country,
+		       q.subtotal, q.adjustment_total, q.tax_total, q.total_price, q.currency, q.exchange_rate, q.base_total,
+		       q.status, q.payment_terms, q.payment_term_days, q.expires_on, q.invoice_id, i.invoice_number,
+		       q.created_at, q.sent_at, q.accepted_at, q.rejected_at, q.expired_at
+		FROM quotes q
+		LEFT JOIN invoices i ON q.invoice_id = i.id
+		`+where+`
+		ORDER BY q.created_at DESC, q.id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var quotes []models.Quote
+	for rows.Next() {
+		var q models.Quote
+		var customerName, customerPhone, customerAddress, customerCountry, invoiceNumber sql.NullString
+		var expiresOn time.Time
+		err := rows.Scan(&q.ID, &q.QuoteNumber, &q.CustomerID, &customerName, &customerPhone, &customerAddress, &customerCountry,
+			&q.Subtotal, &q.AdjustmentTotal, &q.TaxTotal, &q.TotalPrice, &q.Currency, &q.ExchangeRate, &q.BaseTotal,
+			&q.Status, &q.PaymentTerms, &q.PaymentTermDays, &expiresOn, &q.InvoiceID, &invoiceNumber,
+			&q.CreatedAt, &q.SentAt, &q.AcceptedAt, &q.RejectedAt, &q.ExpiredAt)
+		if err != nil {
+			return nil, err
+		}
+		q.Subtotal.Currency = q.Currency
+		q.AdjustmentTotal.Currency = q.Currency
+		q.TaxTotal.Currency = q.Currency
+		q.TotalPrice.Currency = q.Currency
+		q.BaseTotal.Currency = money.BaseCurrency
+		q.ExpiresOn = expiresOn.Format("2006-01-02")
+		q.InvoiceNumber = invoiceNumber.String
+		q.Customer = customerSnapshot(&q.CustomerID, customerName, customerPhone, customerAddress, customerCountry)
+		quotes = append(quotes, q)
+	}
+
+	return quotes, rows.Err()
+}
+
+// quotedLines reads a quote's items, adjustments and tax lines as they were
+// priced, ready to be written to an invoice by insertInvoiceLines.
+func quotedLines(q querier, quoteID int, currency string) (*pricedInvoice, error) {
+	p := &pricedInvoice{}
+
+	rows, err := q.Query(`
+		SELECT id, product_id, product_name, quantity, unit_price, discount_type, discount_value, discount_amount,
+		       total_price, adjustment_amount, tax_rate, tax_amount, untaxed
+		FROM quote_items WHERE quote_id = ?
+		ORDER BY id
+	`, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.InvoiceItem
+		var productName string
+		var discountType sql.NullString
+		var discountValue int64
+		err := rows.Scan(&item.ID, &item.ProductID, &productName, &item.Quantity, &item.UnitPrice, &discountType, &discountValue, &item.DiscountAmount,
+			&item.TotalPrice, &item.AdjustmentAmount, &item.TaxRate, &item.TaxAmount, &item.Untaxed)
+		if err != nil {
+			return nil, err
+		}
+		item.Discount = itemDiscount(discountType, discountValue, currency)
+		item.UnitPrice.Currency = currency
+		item.DiscountAmount.Currency = currency
+		item.TotalPrice.Currency = currency
+		item.AdjustmentAmount.Currency = currency
+		item.TaxAmount.Currency = currency
+		item.Product = &models.ProductSnapshot{ID: item.ProductID, Name: productName}
+		p.Items = append(p.Items, item)
+		p.itemDiscountValues = append(p.itemDiscountValues, discountValue)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	adjRows, err := q.Query(`
+		SELECT kind, type, value, description, amount FROM quote_adjustments
+		WHERE quote_id = ?
+		ORDER BY id
+	`, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer adjRows.Close()
+
+	for adjRows.Next() {
+		var adj models.InvoiceAdjustment
+		var value int64
+		if err := adjRows.Scan(&adj.Kind, &adj.Type, &value, &adj.Description, &adj.Amount); err != nil {
+			return nil, err
+		}
+		adj.Value = formatDiscountValue(adj.Type, value, currency)
+		adj.Amount.Currency = currency
+		p.Adjustments = append(p.Adjustments, adj)
+		p.adjustmentValues = append(p.adjustmentValues, value)
+	}
+	if err := adjRows.Err(); err != nil {
+		return nil, err
+	}
+	adjRows.Close()
+
+	taxRows, err := q.Query(`
+		SELECT rate, taxable_amount, tax_amount FROM quote_tax_lines
+		WHERE quote_id = ?
+		ORDER BY rate DESC
+	`, quoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer taxRows.Close()
+
+	for taxRows.Next() {
+		var line models.TaxLine
+		if err := taxRows.Scan(&line.Rate, &line.TaxableAmount, &line.TaxAmount); err != nil {
+			return nil, err
+		}
+		line.TaxableAmount.Currency = currency
+		line.TaxAmount.Currency = currency
+		p.TaxLines = append(p.TaxLines, line)
+	}
+
+	return p, taxRows.Err()
+}
+
+// loadQuote reads a quote of an organization with its lines. It returns
+// sql.ErrNoRows if there is no such quote.
+func (h *Handler) loadQuote(organizationID, id int) (*models.Quote, error) {
+	quotes, err := h.queryQuotes("WHERE q.id = ? AND q.organization_id = ?", id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(quotes) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	q := quotes[0]
+
+	lines, err := quotedLines(h.db, id, q.Currency)
+	if err != nil {
+		return nil, err
+	}
+	q.Items, q.Adjustments, q.TaxLines = lines.Items, lines.Adjustments, lines.TaxLines
+
+	return &q, nil
+}
+
+func (h *Handler) GetQuotes(w http.ResponseWriter, r *http.Request) {
+	if err := expireQuotes(h.db, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	where := "WHERE q.organization_id = ?"
+	args := []interface{}{organizationID(r)}
+	if status := r.URL.Query().Get("status"); status != "" {
+		where += " AND q.status = ?"
+		args = append(args, status)
+	}
+	if customerID := r.URL.Query().Get("customer_id"); customerID != "" {
+		where += " AND q.customer_id = ?"
+		args = append(args, customerID)
+	}
+
+	quotes, err := h.queryQuotes(where, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if quotes == nil {
+		quotes = []models.Quote{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quotes)
+}
+
+func (h *Handler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := expireQuotes(h.db, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeQuote(w, organizationID(r), id, http.StatusOK)
+}
+
+func (h *Handler) writeQuote(w http.ResponseWriter, organizationID, id int, status int) {
+	q, err := h.loadQuote(organizationID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(q)
+}
+
+// CreateQuote prices a quote exactly as CreateInvoice prices an invoice and
+// saves it as a draft.
+func (h *Handler) CreateQuote(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	createdAt := time.Now()
+	today := createdAt.Format("2006-01-02")
+	expiresOn := strings.TrimSpace(req.ExpiresOn)
+	if expiresOn == "" {
+		expiresOn = createdAt.AddDate(0, 0, quoteValidityDays).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", expiresOn); err != nil {
+		http.Error(w, "Expiry date must be in YYYY-MM-DD format", http.StatusBadRequest)
+		return
+	}
+	if expiresOn < today {
+		http.Error(w, "Expiry date cannot be in the past", http.StatusBadRequest)
+		return
+	}
+
+	series := strings.TrimSpace(req.Series)
+	if series == "" {
+		series = defaultQuoteSeries
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := createQuote(tx, organizationID(r), req, series, expiresOn, createdAt)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditQuote, id, models.AuditCreate, nil); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeQuote(w, organizationID(r), int(id), http.StatusCreated)
+}
+
+func createQuote(tx *sql.Tx, organizationID int, req models.CreateQuoteRequest, series, expiresOn string, createdAt time.Time) (int64, error) {
+	b, err := resolveBilling(tx, organizationID, req.CustomerID, req.Currency, req.PaymentTerms, req.PaymentTermDays, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	priced, err := priceInvoice(tx, b, req.Items, req.Adjustments)
+	if err != nil {
+		return 0, err
+	}
+
+	quoteNumber, err := nextNumber(tx, organizationID, series, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(`INSERT INTO quotes (organization_id, quote_number, customer_id, customer_name, customer_phone, customer_address, customer_country,
+			subtotal, adjustment_total, tax_total, total_price, currency, exchange_rate, base_total,
+			status, payment_terms, payment_term_days, expires_on, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		organizationID, quoteNumber, b.Customer.ID, b.Customer.Name, b.Customer.Phone, b.Customer.Address, b.Customer.Country,
+		priced.Subtotal, priced.AdjustmentTotal, priced.TaxTotal, priced.TotalPrice, b.Currency, b.Rate, priced.TotalPrice.ConvertToBase(money.BaseCurrency, b.Rate),
+		models.QuoteDraft, b.PaymentTerms, b.TermDays, expiresOn, createdAt)
+	if err != nil {
+		return 0, err
+	}
+
+	id, _ := result.LastInsertId()
+	if err := insertQuoteLines(tx, id, priced); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateQuoteStatus sends a draft quote, or records a sent quote as accepted
+// or rejected by the customer.
+func (h *Handler) UpdateQuoteStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := expireQuotes(h.db, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var status string
+	err = h.db.QueryRow("SELECT status FROM quotes WHERE id = ? AND organization_id = ?", id, organizationID(r)).Scan(&status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	column, ok := quoteTimestampColumns[req.Status]
+	if !ok {
+		http.Error(w, "Status must be sent, accepted or rejected", http.StatusBadRequest)
+		return
+	}
+	if !quoteMoveAllowed(status, req.Status) {
+		http.Error(w, fmt.Sprintf("Cannot move a quote from %s to %s", status, req.Status), http.StatusConflict)
+		return
+	}
+
+	_, err = h.execAudited(r, auditQuote, int64(id), models.AuditUpdate,
+		fmt.Sprintf("UPDATE quotes SET status = ?, %s = ? WHERE id = ? AND status = ?", column),
+		req.Status, time.Now(), id, status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote was changed by another request; try again", http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeQuote(w, organizationID(r), id, http.StatusOK)
+}
+
+func quoteMoveAllowed(from, to string) bool {
+	for _, status := range quoteMoves[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ConvertQuote creates a draft invoice from a sent or accepted quote with
+// its quoted lines, prices, tax, currency, exchange rate and payment terms,
+// billed to the customer as the quote has them: the name, phone, address and
+// country it was made out to. A sent quote is accepted by converting it.
+// Each quote converts once.
+func (h *Handler) ConvertQuote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid quote ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ConvertQuoteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := expireQuotes(h.db, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The invoice is billed to the customer as quoted, even if they have
+	// changed or been deleted since
+	var status, currency, paymentTerms string
+	var customerID, termDays int
+	var customerName, customerPhone, customerAddress, customerCountry sql.NullString
+	var rate money.ExchangeRate
+	var invoiceID *int
+	err = tx.QueryRow(`SELECT status, customer_id, customer_name, customer_phone, customer_address, customer_country,
+		       currency, exchange_rate, payment_terms, payment_term_days, invoice_id
+		FROM quotes WHERE id = ? AND organization_id = ?`, id, organizationID(r)).
+		Scan(&status, &customerID, &customerName, &customerPhone, &customerAddress, &customerCountry,
+			&currency, &rate, &paymentTerms, &termDays, &invoiceID)
+	if err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			http.Error(w, "Quote not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if invoiceID != nil {
+		tx.Rollback()
+		http.Error(w, "Quote has already been converted into an invoice", http.StatusConflict)
+		return
+	}
+	if status != models.QuoteSent && status != models.QuoteAccepted {
+		tx.Rollback()
+		http.Error(w, fmt.Sprintf("Cannot convert a quote that is %s", status), http.StatusConflict)
+		return
+	}
+
+	customer := customerSnapshot(&customerID, customerName, customerPhone, customerAddress, customerCountry)
+	if customer == nil {
+		tx.Rollback()
+		http.Error(w, "Quote has no customer details to invoice", http.StatusConflict)
+		return
+	}
+	b := &billing{
+		OrganizationID: organizationID(r),
+		Customer:       *customer,
+		Currency:       currency,
+		Rate:           rate,
+		PaymentTerms:   paymentTerms,
+		TermDays:       termDays,
+	}
+
+	priced, err := quotedLines(tx, id, currency)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = tx.QueryRow("SELECT subtotal, adjustment_total, tax_total, total_price FROM quotes WHERE id = ?", id).
+		Scan(&priced.Subtotal, &priced.AdjustmentTotal, &priced.TaxTotal, &priced.TotalPrice)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	priced.Subtotal.Currency = currency
+	priced.AdjustmentTotal.Currency = currency
+	priced.TaxTotal.Currency = currency
+	priced.TotalPrice.Currency = currency
+
+	// The invoice's items are new rows, not the quote's
+	for i := range priced.Items {
+		priced.Items[i].ID = 0
+	}
+
+	before, err := snapshot(tx, auditQuote, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	invoice, err := insertInvoice(tx, b, priced, req.Series, now)
+	if err != nil {
+		tx.Rollback()
+		if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	_, err = tx.Exec("UPDATE quotes SET status = ?, accepted_at = COALESCE(accepted_at, ?), invoice_id = ? WHERE id = ?",
+		models.QuoteAccepted, now, invoice.ID, id)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = recordAudit(tx, actor(r), auditInvoice, int64(invoice.ID), models.AuditCreate, nil)
+	if err == nil {
+		err = recordAudit(tx, actor(r), auditQuote, int64(id), actionConvert, before)
+	}
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	created, err := h.loadInvoice(organizationID(r), invoice.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
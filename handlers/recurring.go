@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+	"invoice-app/schedule"
+)
+
+// Recurring invoices run in UTC. Start and end dates are whole days, so a
+// schedule may run at any time up to the end of its end date.
+
+// maxPreviewRuns caps the count accepted by the preview endpoint.
+const maxPreviewRuns = 100
+
+// maxCatchUpRuns caps the missed runs a recurring invoice makes at once, so
+// an outage does not leave a frequent schedule with an invoice per minute.
+const maxCatchUpRuns = 12
+
+// recurringSchedule returns ri's schedule and the last instant it may run,
+// which is zero when it has no end date.
+func recurringSchedule(ri *models.RecurringInvoice) (schedule.Schedule, time.Time, error) {
+	start, err := time.Parse("2006-01-02", ri.StartDate)
+	if err != nil {
+		return nil, time.Time{}, requestError("Start date must be in YYYY-MM-DD format")
+	}
+
+	var until time.Time
+	if ri.EndDate != "" {
+		end, err := time.Parse("2006-01-02", ri.EndDate)
+		if err != nil {
+			return nil, time.Time{}, requestError("End date must be in YYYY-MM-DD format")
+		}
+		if end.Before(start) {
+			return nil, time.Time{}, requestError("End date cannot be before the start date")
+		}
+		until = end.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	s, err := schedule.Parse(ri.Interval, ri.Cron, start)
+	if err != nil {
+		return nil, time.Time{}, requestError("Invalid schedule: " + err.Error())
+	}
+	return s, until, nil
+}
+
+// nextRun returns the first run of s after t, or nil if there is none by until.
+func nextRun(s schedule.Schedule, until, t time.Time) *time.Time {
+	runs := schedule.Upcoming(s, t, until, 1)
+	if len(runs) == 0 {
+		return nil
+	}
+	return &runs[0]
+}
+
+// invoiceRequest is the request that creates one invoice from ri.
+func invoiceRequest(ri *models.RecurringInvoice) models.CreateInvoiceRequest {
+	req := models.CreateInvoiceRequest{
+		CustomerID:      ri.CustomerID,
+		Currency:        ri.Currency,
+		Series:          ri.Series,
+		PaymentTerms:    ri.PaymentTerms,
+		PaymentTermDays: ri.PaymentTermDays,
+		Items:           ri.Items,
+	}
+	for _, adj := range ri.Adjustments {
+		req.Adjustments = append(req.Adjustments, models.InvoiceAdjustment{
+			Kind:        adj.Kind,
+			Type:        adj.Type,
+			Value:       adj.Value,
+			Description: adj.Description,
+		})
+	}
+	return req
+}
+
+func (h *Handler) queryRecurringInvoices(where string, args ...interface{}) ([]models.RecurringInvoice, error) {
+	rows, err := h.db.Query(`
+		SELECT ri.id, ri.organization_id, ri.customer_id, c.name, ri.currency, ri.series, ri.payment_terms, ri.payment_term_days,
+		       ri.interval, ri.cron, ri.start_date, ri.end_date, ri.status, ri.next_run_at, ri.last_run_at,
+		       ri.last_error, ri.created_at
+		FROM recurring_invoices ri
+		JOIN customers c ON ri.customer_id = c.id
+		`+where+`
+		ORDER BY ri.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recurring []models.RecurringInvoice
+	for rows.Next() {
+		var ri models.RecurringInvoice
+		var currency, series, paymentTerms sql.NullString
+		var startDate time.Time
+		var endDate *time.Time
+		err := rows.Scan(&ri.ID, &ri.OrganizationID, &ri.CustomerID, &ri.CustomerName, &currency, &series, &paymentTerms, &ri.PaymentTermDays,
+			&ri.Interval, &ri.Cron, &startDate, &endDate, &ri.Status, &ri.NextRunAt, &ri.LastRunAt,
+			&ri.LastError, &ri.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ri.Currency = currency.String
+		ri.Series = series.String
+		ri.PaymentTerms = paymentTerms.String
+		ri.StartDate = startDate.Format("2006-01-02")
+		if endDate != nil {
+			ri.EndDate = endDate.Format("2006-01-02")
+		}
+		recurring = append(recurring, ri)
+	}
+
+	return recurring, rows.Err()
+}
+
+// loadRecurringInvoice reads a recurring invoice of an organization with its
+// items and adjustments. It returns sql.ErrNoRows if there is no such
+// recurring invoice.
+func (h *Handler) loadRecurringInvoice(organizationID, id int) (*models.RecurringInvoice, error) {
+	recurring, err := h.queryRecurringInvoices("WHERE ri.id = ? AND ri.organization_id = ?", id, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	if len(recurring) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	ri := recurring[0]
+
+	rows, err := h.db.Query(`
+		SELECT product_id, quantity, discount_type, discount_value
+		FROM recurring_invoice_items WHERE recurring_invoice_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.CreateInvoiceItem
+		var discountType sql.NullString
+		var discountValue string
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &discountType, &discountValue); err != nil {
+			return nil, err
+		}
+		if discountType.Valid {
+			item.Discount = &models.Discount{Type: discountType.String, Value: json.Number(discountValue)}
+		}
+		ri.Items = append(ri.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	adjRows, err := h.db.Query(`
+		SELECT kind, type, value, description
+		FROM recurring_invoice_adjustments WHERE recurring_invoice_id = ?
+		ORDER BY id
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer adjRows.Close()
+
+	for adjRows.Next() {
+		var adj models.RecurringAdjustment
+		var value string
+		if err := adjRows.Scan(&adj.Kind, &adj.Type, &value, &adj.Description); err != nil {
+			return nil, err
+		}
+		adj.Value = json.Number(value)
+		ri.Adjustments = append(ri.Adjustments, adj)
+	}
+
+	return &ri, adjRows.Err()
+}
+
+func (h *Handler) GetRecurringInvoices(w http.ResponseWriter, r *http.Request) {
+	where := "WHERE ri.organization_id = ?"
+	args := []interface{}{organizationID(r)}
+	if status := r.URL.Query().Get("status"); status != "" {
+		where += " AND ri.status = ?"
+		args = append(args, status)
+	}
+
+	recurring, err := h.queryRecurringInvoices(where, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if recurring == nil {
+		recurring = []models.RecurringInvoice{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recurring)
+}
+
+func (h *Handler) GetRecurringInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recurring invoice ID", http.StatusBadRequest)
+		return
+	}
+	h.writeRecurringInvoice(w, organizationID(r), id, http.StatusOK)
+}
+
+func (h *Handler) writeRecurringInvoice(w http.ResponseWriter, organizationID, id int, status int) {
+	ri, err := h.loadRecurringInvoice(organizationID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recurring invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ri)
+}
+
+// CreateRecurringInvoice stores a recurring invoice. The invoice it describes
+// is priced once without being saved so that mistakes in it are reported now
+// rather than when it first runs.
+func (h *Handler) CreateRecurringInvoice(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateRecurringInvoiceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ri := &models.RecurringInvoice{
+		CustomerID:      req.CustomerID,
+		Currency:        strings.ToUpper(strings.TrimSpace(req.Currency)),
+		Series:          strings.TrimSpace(req.Series),
+		PaymentTerms:    req.PaymentTerms,
+		PaymentTermDays: req.PaymentTermDays,
+		Interval:        strings.TrimSpace(req.Interval),
+		Cron:            strings.Join(strings.Fields(req.Cron), " "),
+		StartDate:       strings.TrimSpace(req.StartDate),
+		EndDate:         strings.TrimSpace(req.EndDate),
+		Status:          models.RecurringActive,
+		Items:           req.Items,
+		Adjustments:     req.Adjustments,
+	}
+	if ri.PaymentTerms == "" {
+		ri.PaymentTermDays = nil
+	}
+	if ri.StartDate == "" {
+		http.Error(w, "Start date is required", http.StatusBadRequest)
+		return
+	}
+	if len(ri.Items) == 0 {
+		http.Error(w, "At least one item is required", http.StatusBadRequest)
+		return
+	}
+
+	s, until, err := recurringSchedule(ri)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The first run is on the start date, or the first time the cron
+	// expression matches from then on
+	start, _ := time.Parse("2006-01-02", ri.StartDate)
+	next := nextRun(s, until, start.Add(-time.Nanosecond))
+	if next == nil {
+		http.Error(w, "Schedule has no runs before its end date", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, err = createInvoice(tx, organizationID(r), invoiceRequest(ri), time.Now())
+	tx.Rollback()
+	if err != nil {
+		if _, ok := err.(requestError); ok {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	tx, err = h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var endDate interface{}
+	if ri.EndDate != "" {
+		endDate = ri.EndDate
+	}
+	result, err := tx.Exec(`INSERT INTO recurring_invoices (organization_id, customer_id, currency, series, payment_terms, payment_term_days,
+			interval, cron, start_date, end_date, status, next_run_at)
+		VALUES (?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?, ?, ?, ?, ?, ?)`,
+		organizationID(r), ri.CustomerID, ri.Currency, ri.Series, ri.PaymentTerms, ri.PaymentTermDays,
+		ri.Interval, ri.Cron, ri.StartDate, endDate, ri.Status, *next)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, _ := result.LastInsertId()
+
+	for _, item := range ri.Items {
+		var discountType interface{}
+		discountValue := ""
+		if item.Discount != nil {
+			discountType, discountValue = item.Discount.Type, item.Discount.Value.String()
+		}
+		_, err := tx.Exec("INSERT INTO recurring_invoice_items (recurring_invoice_id, product_id, quantity, discount_type, discount_value) VALUES (?, ?, ?, ?, ?)",
+			id, item.ProductID, item.Quantity, discountType, discountValue)
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for _, adj := range ri.Adjustments {
+		_, err := tx.Exec("INSERT INTO recurring_invoice_adjustments (recurring_invoice_id, kind, type, value, description) VALUES (?, ?, ?, ?, ?)",
+			id, adj.Kind, adj.Type, adj.Value.String(), strings.TrimSpace(adj.Description))
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := recordAudit(tx, actor(r), auditRecurringInvoice, id, models.AuditCreate, nil); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeRecurringInvoice(w, organizationID(r), int(id), http.StatusCreated)
+}
+
+// PauseRecurringInvoice stops an active recurring invoice from running.
+func (h *Handler) PauseRecurringInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recurring invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.execAudited(r, auditRecurringInvoice, int64(id), actionPause,
+		"UPDATE recurring_invoices SET status = ? WHERE id = ? AND organization_id = ? AND status = ?",
+		models.RecurringPaused, id, organizationID(r), models.RecurringActive)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.recurringStatusConflict(w, r, id, actionPause)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeRecurringInvoice(w, organizationID(r), id, http.StatusOK)
+}
+
+// ResumeRecurringInvoice restarts a paused recurring invoice from its next
+// run after now; runs missed while it was paused are skipped, not caught up.
+func (h *Handler) ResumeRecurringInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recurring invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	ri, err := h.loadRecurringInvoice(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recurring invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if ri.Status != models.RecurringPaused {
+		h.recurringStatusConflict(w, r, id, actionResume)
+		return
+	}
+
+	s, until, err := recurringSchedule(ri)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := models.RecurringActive
+	next := nextRun(s, until, time.Now().UTC())
+	if next == nil {
+		status = models.RecurringFinished
+	}
+
+	_, err = h.execAudited(r, auditRecurringInvoice, int64(id), actionResume,
+		"UPDATE recurring_invoices SET status = ?, next_run_at = ? WHERE id = ? AND organization_id = ? AND status = ?",
+		status, next, id, organizationID(r), models.RecurringPaused)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			h.recurringStatusConflict(w, r, id, actionResume)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	h.writeRecurringInvoice(w, organizationID(r), id, http.StatusOK)
+}
+
+// recurringStatusConflict reports that action cannot be applied to recurring
+// invoice id in its current status, or that it does not exist.
+func (h *Handler) recurringStatusConflict(w http.ResponseWriter, r *http.Request, id int, action string) {
+	var status string
+	err := h.db.QueryRow("SELECT status FROM recurring_invoices WHERE id = ? AND organization_id = ?", id, organizationID(r)).Scan(&status)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Recurring invoice not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Cannot %s a %s recurring invoice", action, status), http.StatusConflict)
+}
+
+// PreviewRecurringInvoice lists the next runs of a recurring invoice, ten by
+// default or count if given. A paused recurring invoice lists the runs it
+// would make if resumed now; a finished one has none.
+func (h *Handler) PreviewRecurringInvoice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid recurring invoice ID", http.StatusBadRequest)
+		return
+	}
+
+	count := 10
+	if c := r.URL.Query().Get("count"); c != "" {
+		count, err = strconv.Atoi(c)
+		if err != nil || count <= 0 || count > maxPreviewRuns {
+			http.Error(w, fmt.Sprintf("Count must be between 1 and %d", maxPreviewRuns), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ri, err := h.loadRecurringInvoice(organizationID(r), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Recurring invoice not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	s, until, err := recurringSchedule(ri)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var runAt []time.Time
+	switch {
+	case ri.Status == models.RecurringActive && ri.NextRunAt != nil:
+		// next_run_at may be overdue if the scheduler has yet to catch up
+		runAt = schedule.Upcoming(s, ri.NextRunAt.Add(-time.Nanosecond), until, count)
+	case ri.Status == models.RecurringPaused:
+		runAt = schedule.Upcoming(s, time.Now().UTC(), until, count)
+	}
+
+	runs := []models.RecurringRun{}
+	for _, t := range runAt {
+		runs = append(runs, models.RecurringRun{RunAt: t})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// RunRecurringInvoices generates the invoices of due recurring invoices now
+// and then every interval until ctx is done. Runs missed while the server was
+// down are made in order, each dated when it was due.
+func (h *Handler) RunRecurringInvoices(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if err := h.generateDueInvoices(time.Now().UTC()); err != nil {
+			log.Println("Recurring invoices:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// generateDueInvoices makes every run of active recurring invoices due by
+// now. A recurring invoice whose run fails keeps the error in last_error and
+// is tried again next time; the others carry on.
+func (h *Handler) generateDueInvoices(now time.Time) error {
+	due, err := h.queryRecurringInvoices("WHERE ri.status = ? AND ri.next_run_at IS NOT NULL", models.RecurringActive)
+	if err != nil {
+		return err
+	}
+
+	for _, ri := range due {
+		if ri.NextRunAt.After(now) {
+			continue
+		}
+		if err := h.catchUpRecurringInvoice(ri.OrganizationID, ri.ID, now); err != nil {
+			log.Printf("Recurring invoice %d: %v", ri.ID, err)
+			// Not audited: a failing run would log an event every tick
+			if _, err := h.db.Exec("UPDATE recurring_invoices SET last_error = ? WHERE id = ?", err.Error(), ri.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// catchUpRecurringInvoice makes each run of recurring invoice id due by now,
+// up to the latest maxCatchUpRuns, one transaction per run, so a failure
+// keeps the runs already made. The invoices belong to the recurring invoice's
+// organization.
+func (h *Handler) catchUpRecurringInvoice(organizationID, id int, now time.Time) error {
+	ri, err := h.loadRecurringInvoice(organizationID, id)
+	if err != nil {
+		return err
+	}
+
+	s, until, err := recurringSchedule(ri)
+	if err != nil {
+		return err
+	}
+
+	// Only the latest runs are made; earlier ones are skipped
+	if ri.Status == models.RecurringActive && ri.NextRunAt != nil {
+		last := now
+		if !until.IsZero() && until.Before(now) {
+			last = until
+		}
+		runs, skipped := schedule.Missed(s, *ri.NextRunAt, last, maxCatchUpRuns)
+		if skipped > 0 {
+			log.Printf("Recurring invoice %d: skipping %d missed runs before %s", id, skipped, runs[0].Format(time.RFC3339))
+			ri.NextRunAt = &runs[0]
+		}
+	}
+
+	for ri.Status == models.RecurringActive && ri.NextRunAt != nil && !ri.NextRunAt.After(now) {
+		runAt := *ri.NextRunAt
+		next := nextRun(s, until, runAt)
+		status := models.RecurringActive
+		if next == nil {
+			status = models.RecurringFinished
+		}
+
+		tx, err := h.db.Begin()
+		if err != nil {
+			return err
+		}
+
+		before, err := snapshot(tx, auditRecurringInvoice, int64(id))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		invoice, err := createInvoice(tx, organizationID, invoiceRequest(ri), runAt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if _, err := tx.Exec("UPDATE invoices SET recurring_invoice_id = ? WHERE id = ?", id, invoice.ID); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Only advance a recurring invoice still active at this run, in case it
+		// was paused meanwhile
+		result, err := tx.Exec(`UPDATE recurring_invoices SET status = ?, next_run_at = ?, last_run_at = ?, last_error = ''
+			WHERE id = ? AND status = ?`,
+			status, next, runAt, id, models.RecurringActive)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			tx.Rollback()
+			return nil
+		}
+
+		scheduler := auditActor{actorScheduler, organizationID}
+		if err := recordAudit(tx, scheduler, auditInvoice, int64(invoice.ID), models.AuditCreate, nil); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := recordAudit(tx, scheduler, auditRecurringInvoice, int64(id), actionGenerate, before); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		ri.Status, ri.NextRunAt = status, next
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...interface{}) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatchUpRecurringInvoiceCapsMissedRuns(t *testing.T) {
+	db := testDB(t)
+	h := New(db, nil)
+
+	// An hourly schedule last run a week ago
+	mustExec(t, db, "INSERT INTO customers (id, organization_id, name, phone, address, country) VALUES (1, 1, 'Acme', '5551234', '1 Main St', 'United States')")
+	mustExec(t, db, "INSERT INTO products (id, organization_id, name, price) VALUES (1, 1, 'Support', 1000)")
+	mustExec(t, db, `INSERT INTO recurring_invoices (id, organization_id, customer_id, interval, cron, start_date, status, next_run_at)
+		VALUES (1, 1, 1, 'cron', '0 * * * *', '2026-03-01', 'active', ?)`, time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC))
+	mustExec(t, db, "INSERT INTO recurring_invoice_items (recurring_invoice_id, product_id, quantity) VALUES (1, 1, 1)")
+
+	now := time.Date(2026, 3, 9, 0, 30, 0, 0, time.UTC)
+	if err := h.catchUpRecurringInvoice(1, 1, now); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	var first time.Time
+	if err := db.QueryRow("SELECT COUNT(*) FROM invoices WHERE recurring_invoice_id = 1").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT created_at FROM invoices WHERE recurring_invoice_id = 1 ORDER BY created_at LIMIT 1").Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	if count != maxCatchUpRuns {
+		t.Errorf("made %d invoices, want %d", count, maxCatchUpRuns)
+	}
+	if want := time.Date(2026, 3, 8, 13, 0, 0, 0, time.UTC); !first.Equal(want) {
+		t.Errorf("first invoice dated %s, want %s", first, want)
+	}
+
+	var next time.Time
+	if err := db.QueryRow("SELECT next_run_at FROM recurring_invoices WHERE id = 1").Scan(&next); err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 9, 1, 0, 0, 0, time.UTC); !next.Equal(want) {
+		t.Errorf("next run at %s, want %s", next, want)
+	}
+}
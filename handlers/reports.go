@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"invoice-app/models"
+	"invoice-app/money"
+)
+
+// creditNoteStatus is the status credit notes are reported under.
+const creditNoteStatus = "credit_note"
+
+// GetInvoiceTotals totals invoices per currency and status, each also
+// expressed in the base currency at the rate the invoice was issued at.
+// Credit notes are reported under their own status with negative totals, so
+// the base total is net of them. Drafts and void invoices are left out
+// unless asked for through the status filter.
+func (h *Handler) GetInvoiceTotals(w http.ResponseWriter, r *http.Request) {
+	query := `SELECT currency, status, COUNT(*), SUM(total_price), SUM(base_total)
+	          FROM (
+	              SELECT organization_id, currency, status, total_price, base_total, created_at FROM invoices
+	              UNION ALL
+	              SELECT organization_id, currency, '` + creditNoteStatus + `', -total_price, -base_total, created_at FROM credit_notes
+	          )
+	          WHERE organization_id = ?`
+	args := []interface{}{organizationID(r)}
+
+	if createdFrom := r.URL.Query().Get("created_from"); createdFrom != "" {
+		query += " AND created_at >= ?"
+		args = append(args, createdFrom)
+	}
+	if createdTo := r.URL.Query().Get("created_to"); createdTo != "" {
+		query += " AND created_at <= ?"
+		args = append(args, createdTo)
+	}
+	if status := r.URL.Query().Get("status"); status != "" {
+		statuses := strings.Split(status, ",")
+		placeholders := make([]string, len(statuses))
+		for i, s := range statuses {
+			placeholders[i] = "?"
+			args = append(args, s)
+		}
+		query += fmt.Sprintf(" AND status IN (%s)", strings.Join(placeholders, ","))
+	} else {
+		query += " AND status NOT IN ('draft', 'void')"
+	}
+
+	query += " GROUP BY currency, status ORDER BY currency, status"
+
+	rows, err := h.db.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	report := models.InvoiceTotalsReport{
+		BaseCurrency: money.BaseCurrency,
+		Totals:       []models.CurrencyTotal{},
+		BaseTotal:    money.Zero(money.BaseCurrency),
+	}
+	for rows.Next() {
+		var total models.CurrencyTotal
+		if err := rows.Scan(&total.Currency, &total.Status, &total.Count, &total.Total, &total.BaseTotal); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		total.Total.Currency = total.Currency
+		total.BaseTotal.Currency = money.BaseCurrency
+		report.BaseTotal = report.BaseTotal.Add(total.BaseTotal)
+		report.Totals = append(report.Totals, total)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
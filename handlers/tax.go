@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"invoice-app/models"
+	"invoice-app/tax"
+)
+
+// rowQuerier is satisfied by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// taxRate finds the rate for a product's tax category in the customer's
+// country, falling back to the category's "*" rule. Products without a
+// category, or categories without a matching rule, are not taxed: taxed is
+// false for them, where a rule of 0% is taxed at a rate of zero.
+func taxRate(q rowQuerier, categoryID *int, country string) (rate tax.Rate, taxed bool, err error) {
+	if categoryID == nil {
+		return 0, false, nil
+	}
+
+	err = q.QueryRow(`
+		SELECT rate FROM tax_rules
+		WHERE tax_category_id = ? AND (country = ? OR country = '*')
+		ORDER BY country = '*'
+		LIMIT 1
+	`, *categoryID, strings.TrimSpace(country)).Scan(&rate)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return rate, true, nil
+}
+
+func (h *Handler) taxRules(categoryID int) ([]models.TaxRule, error) {
+	rows, err := h.db.Query(`
+		SELECT id, tax_category_id, country, rate, created_at
+		FROM tax_rules WHERE tax_category_id = ?
+		ORDER BY country = '*', country
+	`, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.TaxRule{}
+	for rows.Next() {
+		var rule models.TaxRule
+		if err := rows.Scan(&rule.ID, &rule.TaxCategoryID, &rule.Country, &rule.Rate, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+func (h *Handler) GetTaxCategories(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.db.Query("SELECT id, name, description, created_at FROM tax_categories WHERE organization_id = ? ORDER BY name",
+		organizationID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var categories []models.TaxCategory
+	for rows.Next() {
+		var c models.TaxCategory
+		if err := rows.Scan(&c.ID, &c.Name, &c.Description, &c.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		categories = append(categories, c)
+	}
+	rows.Close()
+
+	for i := range categories {
+		rules, err := h.taxRules(categories[i].ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		categories[i].Rules = rules
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categories)
+}
+
+func (h *Handler) CreateTaxCategory(w http.ResponseWriter, r *http.Request) {
+	var c models.TaxCategory
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" {
+		http.Error(w, "Tax category name is required", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err := h.db.QueryRow("SELECT COUNT(*) FROM tax_categories WHERE organization_id = ? AND name = ?", organizationID(r), c.Name).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "Tax category with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	id, err := h.execAudited(r, auditTaxCategory, 0, models.AuditCreate,
+		"INSERT INTO tax_categories (organization_id, name, description) VALUES (?, ?, ?)", organizationID(r), c.Name, c.Description)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.ID = int(id)
+	c.CreatedAt = time.Now()
+	c.Rules = []models.TaxRule{}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (h *Handler) UpdateTaxCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid tax category ID", http.StatusBadRequest)
+		return
+	}
+
+	var c models.TaxCategory
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.Name = strings.TrimSpace(c.Name)
+	c.Description = strings.TrimSpace(c.Description)
+	if c.Name == "" {
+		http.Error(w, "Tax category name is required", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM tax_categories WHERE organization_id = ? AND name = ? AND id != ?",
+		organizationID(r), c.Name, id).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists > 0 {
+		http.Error(w, "Tax category with this name already exists", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.execAudited(r, auditTaxCategory, int64(id), models.AuditUpdate,
+		"UPDATE tax_categories SET name = ?, description = ? WHERE id = ? AND organization_id = ?",
+		c.Name, c.Description, id, organizationID(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tax category not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) DeleteTaxCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid tax category ID", http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM products WHERE tax_category_id = ? AND organization_id = ?", id, organizationID(r)).Scan(&count)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count > 0 {
+		http.Error(w, "Cannot delete tax category that is assigned to products", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.db.Begin()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	before, err := snapshot(tx, auditTaxCategory, int64(id))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM tax_rules WHERE tax_category_id IN (SELECT id FROM tax_categories WHERE id = ? AND organization_id = ?)",
+		id, organizationID(r)); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := tx.Exec("DELETE FROM tax_categories WHERE id = ? AND organization_id = ?", id, organizationID(r))
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	if rowsAffected == 0 {
+		tx.Rollback()
+		http.Error(w, "Tax category not found", http.StatusNotFound)
+		return
+	}
+
+	if err := recordAudit(tx, actor(r), auditTaxCategory, int64(id), models.AuditDelete, before); err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetTaxRule creates or replaces the rate for a category in one country.
+func (h *Handler) SetTaxRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	categoryID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid tax category ID", http.StatusBadRequest)
+		return
+	}
+
+	var rule models.TaxRule
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule.Country = strings.TrimSpace(rule.Country)
+	if rule.Country == "" {
+		http.Error(w, "Tax rule country is required (use \"*\" for all other countries)", http.StatusBadRequest)
+		return
+	}
+
+	var exists int
+	err = h.db.QueryRow("SELECT COUNT(*) FROM tax_categories WHERE id = ? AND organization_id = ?", categoryID, organizationID(r)).Scan(&exists)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if exists == 0 {
+		http.Error(w, "Tax category not found", http.StatusNotFound)
+		return
+	}
+
+	// Rules are recorded in the audit log as part of their category
+	_, err = h.execAudited(r, auditTaxCategory, int64(categoryID), models.AuditUpdate, `
+		INSERT INTO tax_rules (tax_category_id, country, rate) VALUES (?, ?, ?)
+		ON CONFLICT (tax_category_id, country) DO UPDATE SET rate = excluded.rate
+	`, categoryID, rule.Country, rule.Rate)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = h.db.QueryRow(`
+		SELECT id, tax_category_id, country, rate, created_at FROM tax_rules
+		WHERE tax_category_id = ? AND country = ?
+	`, categoryID, rule.Country).Scan(&rule.ID, &rule.TaxCategoryID, &rule.Country, &rule.Rate, &rule.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *Handler) DeleteTaxRule(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	categoryID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid tax category ID", http.StatusBadRequest)
+		return
+	}
+	ruleID, err := strconv.Atoi(vars["ruleId"])
+	if err != nil {
+		http.Error(w, "Invalid tax rule ID", http.StatusBadRequest)
+		return
+	}
+
+	_, err = h.execAudited(r, auditTaxCategory, int64(categoryID), models.AuditUpdate,
+		"DELETE FROM tax_rules WHERE id = ? AND tax_category_id IN (SELECT id FROM tax_categories WHERE id = ? AND organization_id = ?)",
+		ruleID, categoryID, organizationID(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Tax rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
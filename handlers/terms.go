@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"invoice-app/lifecycle"
+	"invoice-app/models"
+)
+
+const maxPaymentTermDays = 365
+
+// paymentTermDays is the number of days allowed by each standard term.
+var paymentTermDays = map[string]int{
+	models.PaymentTermsDueOnReceipt: 0,
+	models.PaymentTermsNet15:        15,
+	models.PaymentTermsNet30:        30,
+	models.PaymentTermsNet60:        60,
+}
+
+// resolvePaymentTerms validates payment terms and returns the number of days
+// they allow. Days must be given for custom terms and only for them.
+func resolvePaymentTerms(terms string, days *int) (int, error) {
+	if terms == models.PaymentTermsCustom {
+		if days == nil || *days < 0 || *days > maxPaymentTermDays {
+			return 0, fmt.Errorf("custom payment terms need payment_term_days between 0 and %d", maxPaymentTermDays)
+		}
+		return *days, nil
+	}
+
+	standard, ok := paymentTermDays[terms]
+	if !ok {
+		return 0, fmt.Errorf("payment terms must be one of %s, %s, %s, %s or %s",
+			models.PaymentTermsDueOnReceipt, models.PaymentTermsNet15, models.PaymentTermsNet30,
+			models.PaymentTermsNet60, models.PaymentTermsCustom)
+	}
+	if days != nil {
+		return 0, fmt.Errorf("payment_term_days can only be set for custom payment terms")
+	}
+	return standard, nil
+}
+
+// paymentTermsLabel describes payment terms as printed on invoices.
+func paymentTermsLabel(terms string, days int) string {
+	if terms == models.PaymentTermsDueOnReceipt || days == 0 {
+		return "Due on receipt"
+	}
+	return fmt.Sprintf("Net %d", days)
+}
+
+// dueDate returns the date an invoice issued at createdAt with the given
+// terms falls due, as YYYY-MM-DD.
+func dueDate(createdAt time.Time, days int) string {
+	return createdAt.AddDate(0, 0, days).Format("2006-01-02")
+}
+
+// isOverdue reports whether an invoice is unpaid past its due date.
+func isOverdue(status, due string, today time.Time) bool {
+	if due == "" || due >= today.Format("2006-01-02") {
+		return false
+	}
+	return lifecycle.Open(lifecycle.State(status))
+}
+
+// formatDate formats a nullable DATE column as YYYY-MM-DD, or "" if null.
+func formatDate(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format("2006-01-02")
+}
@@ -13,24 +13,31 @@ func main() {
 	defer db.Close()
 
 	customers := []struct {
-		name    string
-		phone   string
-		address string
-		country string
+		name     string
+		phone    string
+		address  string
+		country  string
+		currency string
 	}{
-		{"John Smith", "+1-555-0123", "123 Main St, Anytown", "United States"},
-		{"Sarah Johnson", "+44-20-7946-0958", "456 Oak Ave, London", "United Kingdom"},
-		{"Miguel Rodriguez", "+34-91-123-4567", "789 Plaza Mayor, Madrid", "Spain"},
-		{"Emma Chen", "+86-10-1234-5678", "321 Beijing Road, Shanghai", "China"},
-		{"Ahmed Hassan", "+971-4-123-4567", "654 Sheikh Zayed Road, Dubai", "United Arab Emirates"},
-		{"Anna Kowalski", "+48-22-123-4567", "987 Marszałkowska Street, Warsaw", "Poland"},
-		{"Carlos Silva", "+55-11-1234-5678", "147 Rua Augusta, São Paulo", "Brazil"},
-		{"Yuki Tanaka", "+81-3-1234-5678", "258 Shibuya Crossing, Tokyo", "Japan"},
+		{"John Smith", "+1-555-0123", "123 Main St, Anytown", "United States", "USD"},
+		{"Sarah Johnson", "+44-20-7946-0958", "456 Oak Ave, London", "United Kingdom", "GBP"},
+		{"Miguel Rodriguez", "+34-91-123-4567", "789 Plaza Mayor, Madrid", "Spain", "EUR"},
+		{"Emma Chen", "+86-10-1234-5678", "321 Beijing Road, Shanghai", "China", "CNY"},
+		{"Ahmed Hassan", "+971-4-123-4567", "654 Sheikh Zayed Road, Dubai", "United Arab Emirates", "AED"},
+		{"Anna Kowalski", "+48-22-123-4567", "987 Marszałkowska Street, Warsaw", "Poland", "PLN"},
+		{"Carlos Silva", "+55-11-1234-5678", "147 Rua Augusta, São Paulo", "Brazil", "BRL"},
+		{"Yuki Tanaka", "+81-3-1234-5678", "258 Shibuya Crossing, Tokyo", "Japan", "JPY"},
+	}
+
+	// Requests only see the customers of the organization they work in
+	var organizationID int
+	if err := db.QueryRow("SELECT MIN(id) FROM organizations").Scan(&organizationID); err != nil {
+		log.Fatal("Failed to find the first organization:", err)
 	}
 
 	for _, c := range customers {
-		_, err := db.Exec("INSERT INTO customers (name, phone, address, country) VALUES (?, ?, ?, ?)", 
-			c.name, c.phone, c.address, c.country)
+		_, err := db.Exec("INSERT INTO customers (organization_id, name, phone, address, country, currency) VALUES (?, ?, ?, ?, ?, ?)",
+			organizationID, c.name, c.phone, c.address, c.country, c.currency)
 		if err != nil {
 			log.Printf("Error inserting customer %s: %v", c.name, err)
 		} else {
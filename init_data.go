@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"invoice-app/database"
+	"invoice-app/money"
 )
 
 func main() {
@@ -14,24 +15,30 @@ func main() {
 
 	products := []struct {
 		name  string
-		price float64
+		price money.Money
 	}{
-		{"Laptop", 999.99},
-		{"Wireless Mouse", 29.99},
-		{"USB-C Hub", 49.99},
-		{"Monitor 27\"", 299.99},
-		{"Keyboard", 79.99},
-		{"Webcam HD", 89.99},
-		{"Desk Lamp", 39.99},
-		{"Phone Stand", 19.99},
+		{"Laptop", money.New(99999, money.DefaultCurrency)},
+		{"Wireless Mouse", money.New(2999, money.DefaultCurrency)},
+		{"USB-C Hub", money.New(4999, money.DefaultCurrency)},
+		{"Monitor 27\"", money.New(29999, money.DefaultCurrency)},
+		{"Keyboard", money.New(7999, money.DefaultCurrency)},
+		{"Webcam HD", money.New(8999, money.DefaultCurrency)},
+		{"Desk Lamp", money.New(3999, money.DefaultCurrency)},
+		{"Phone Stand", money.New(1999, money.DefaultCurrency)},
+	}
+
+	// Requests only see the products of the organization they work in
+	var organizationID int
+	if err := db.QueryRow("SELECT MIN(id) FROM organizations").Scan(&organizationID); err != nil {
+		log.Fatal("Failed to find the first organization:", err)
 	}
 
 	for _, p := range products {
-		_, err := db.Exec("INSERT INTO products (name, price) VALUES (?, ?)", p.name, p.price)
+		_, err := db.Exec("INSERT INTO products (organization_id, name, price) VALUES (?, ?, ?)", organizationID, p.name, p.price)
 		if err != nil {
 			log.Printf("Error inserting product %s: %v", p.name, err)
 		} else {
-			log.Printf("Inserted product: %s - $%.2f", p.name, p.price)
+			log.Printf("Inserted product: %s - $%s", p.name, p.price)
 		}
 	}
 
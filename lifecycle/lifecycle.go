@@ -0,0 +1,222 @@
+package lifecycle
+
+import (
+	"fmt"
+
+	"invoice-app/money"
+)
+
+// State is an invoice status.
+type State string
+
+const (
+	StateDraft     State = "draft"
+	StateFinalized State = "finalized"
+	StateSent      State = "sent"
+	StatePaid      State = "paid"
+	StateVoid      State = "void"
+	StateCredited  State = "credited"
+)
+
+var states = []State{StateDraft, StateFinalized, StateSent, StatePaid, StateVoid, StateCredited}
+
+// IsState reports whether s names a state.
+func IsState(s string) bool {
+	for _, state := range states {
+		if string(state) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Open reports whether an invoice in state s has been issued and is still
+// awaiting payment.
+func Open(s State) bool {
+	return s == StateFinalized || s == StateSent
+}
+
+// Invoice is what the guards need to know about an invoice.
+type Invoice struct {
+	State          State
+	ItemCount      int
+	TotalPrice     money.Money
+	AmountPaid     money.Money
+	AmountCredited money.Money
+}
+
+// Balance is what is still owed on inv after its payments and credit notes.
+func (inv Invoice) Balance() money.Money {
+	return inv.TotalPrice.Sub(inv.AmountPaid).Sub(inv.AmountCredited)
+}
+
+// Transition moves an invoice from one of From to To, provided its guard
+// allows it.
+type Transition struct {
+	Name  string
+	From  []State
+	To    State
+	guard func(Invoice) string
+}
+
+const (
+	Finalize = "finalize"
+	Send     = "send"
+	MarkPaid = "mark_paid"
+	Void     = "void"
+	Credit   = "credit"
+)
+
+var transitions = []Transition{
+	{
+		Name: Finalize,
+		From: []State{StateDraft},
+		To:   StateFinalized,
+		guard: func(inv Invoice) string {
+			if inv.ItemCount == 0 {
+				return "invoice has no items"
+			}
+			return ""
+		},
+	},
+	{
+		Name: Send,
+		From: []State{StateFinalized},
+		To:   StateSent,
+	},
+	{
+		Name: MarkPaid,
+		From: []State{StateFinalized, StateSent},
+		To:   StatePaid,
+		guard: func(inv Invoice) string {
+			if inv.Balance().IsPositive() {
+				return fmt.Sprintf("balance of %s is still due", inv.Balance().Format())
+			}
+			return ""
+		},
+	},
+	{
+		Name: Void,
+		From: []State{StateDraft, StateFinalized, StateSent},
+		To:   StateVoid,
+		guard: func(inv Invoice) string {
+			if !inv.AmountPaid.IsZero() {
+				return "invoice has payments recorded against it"
+			}
+			if !inv.AmountCredited.IsZero() {
+				return "invoice has credit notes issued against it"
+			}
+			return ""
+		},
+	},
+	{
+		Name: Credit,
+		From: []State{StateFinalized, StateSent, StatePaid},
+		To:   StateCredited,
+		guard: func(inv Invoice) string {
+			if inv.AmountCredited.Sub(inv.TotalPrice).IsNegative() {
+				return "invoice has not been fully credited; issue a credit note"
+			}
+			return ""
+		},
+	},
+}
+
+// Lookup finds a transition by name.
+func Lookup(name string) (Transition, bool) {
+	for _, t := range transitions {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// LeadingTo finds the transition from state from to state to, if any.
+func LeadingTo(from, to State) (Transition, bool) {
+	for _, t := range transitions {
+		if t.To == to && t.startsFrom(from) {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+func (t Transition) startsFrom(s State) bool {
+	for _, from := range t.From {
+		if from == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Error codes reported by Check.
+const (
+	CodeInvalidState = "invalid_state"
+	CodeGuardFailed  = "guard_failed"
+)
+
+// Error is a rejected transition.
+type Error struct {
+	Code       string `json:"error"`
+	Transition string `json:"transition,omitempty"`
+	From       State  `json:"from"`
+	To         State  `json:"to"`
+	Reason     string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cannot %s invoice: %s", e.Transition, e.Reason)
+}
+
+// Check returns nil if t can be applied to inv, or an *Error saying why not.
+func (t Transition) Check(inv Invoice) error {
+	if !t.startsFrom(inv.State) {
+		return &Error{
+			Code:       CodeInvalidState,
+			Transition: t.Name,
+			From:       inv.State,
+			To:         t.To,
+			Reason:     fmt.Sprintf("not allowed from %s", inv.State),
+		}
+	}
+	if t.guard != nil {
+		if reason := t.guard(inv); reason != "" {
+			return &Error{
+				Code:       CodeGuardFailed,
+				Transition: t.Name,
+				From:       inv.State,
+				To:         t.To,
+				Reason:     reason,
+			}
+		}
+	}
+	return nil
+}
+
+// Option is a transition out of an invoice's current state, with the reason
+// its guard blocks it if it does.
+type Option struct {
+	Name    string `json:"name"`
+	To      State  `json:"to"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Options lists the transitions out of inv's current state.
+func Options(inv Invoice) []Option {
+	options := []Option{}
+	for _, t := range transitions {
+		if !t.startsFrom(inv.State) {
+			continue
+		}
+		option := Option{Name: t.Name, To: t.To, Allowed: true}
+		if err := t.Check(inv); err != nil {
+			option.Allowed = false
+			option.Reason = err.(*Error).Reason
+		}
+		options = append(options, option)
+	}
+	return options
+}
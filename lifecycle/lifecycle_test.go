@@ -0,0 +1,169 @@
+package lifecycle
+
+import (
+	"testing"
+
+	"invoice-app/money"
+)
+
+func eur(amount int64) money.Money {
+	return money.New(amount, "EUR")
+}
+
+// invoice is an issued invoice of 100.00 with one item, nothing paid and
+// nothing credited, in state s.
+func invoice(s State) Invoice {
+	return Invoice{State: s, ItemCount: 1, TotalPrice: eur(10000), AmountPaid: eur(0), AmountCredited: eur(0)}
+}
+
+func TestCheck(t *testing.T) {
+	empty := invoice(StateDraft)
+	empty.ItemCount = 0
+	partlyPaid := invoice(StateSent)
+	partlyPaid.AmountPaid = eur(4000)
+	paidAndCredited := invoice(StateSent)
+	paidAndCredited.AmountPaid = eur(6000)
+	paidAndCredited.AmountCredited = eur(4000)
+	overpaid := invoice(StateFinalized)
+	overpaid.AmountPaid = eur(12000)
+	partlyCredited := invoice(StatePaid)
+	partlyCredited.AmountCredited = eur(9999)
+	credited := invoice(StatePaid)
+	credited.AmountCredited = eur(10000)
+	creditedDraft := invoice(StateFinalized)
+	creditedDraft.AmountCredited = eur(100)
+
+	tests := []struct {
+		name       string
+		transition string
+		inv        Invoice
+		wantCode   string
+	}{
+		{"finalize draft", Finalize, invoice(StateDraft), ""},
+		{"finalize empty draft", Finalize, empty, CodeGuardFailed},
+		{"finalize twice", Finalize, invoice(StateFinalized), CodeInvalidState},
+		{"send finalized", Send, invoice(StateFinalized), ""},
+		{"send draft", Send, invoice(StateDraft), CodeInvalidState},
+		{"send sent", Send, invoice(StateSent), CodeInvalidState},
+		{"mark unpaid paid", MarkPaid, invoice(StateSent), CodeGuardFailed},
+		{"mark partly paid paid", MarkPaid, partlyPaid, CodeGuardFailed},
+		{"mark paid and credited paid", MarkPaid, paidAndCredited, ""},
+		{"mark overpaid paid", MarkPaid, overpaid, ""},
+		{"mark draft paid", MarkPaid, invoice(StateDraft), CodeInvalidState},
+		{"void draft", Void, invoice(StateDraft), ""},
+		{"void sent", Void, invoice(StateSent), ""},
+		{"void with payments", Void, partlyPaid, CodeGuardFailed},
+		{"void with credit notes", Void, creditedDraft, CodeGuardFailed},
+		{"void paid", Void, invoice(StatePaid), CodeInvalidState},
+		{"void void", Void, invoice(StateVoid), CodeInvalidState},
+		{"credit uncredited", Credit, invoice(StatePaid), CodeGuardFailed},
+		{"credit partly credited", Credit, partlyCredited, CodeGuardFailed},
+		{"credit fully credited", Credit, credited, ""},
+		{"credit draft", Credit, invoice(StateDraft), CodeInvalidState},
+		{"credit credited", Credit, invoice(StateCredited), CodeInvalidState},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transition, ok := Lookup(tt.transition)
+			if !ok {
+				t.Fatalf("Lookup(%q) found nothing", tt.transition)
+			}
+			err := transition.Check(tt.inv)
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Check = %v, want nil", err)
+				}
+				return
+			}
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("Check = %v, want *Error with code %s", err, tt.wantCode)
+			}
+			if e.Code != tt.wantCode || e.Transition != tt.transition || e.From != tt.inv.State || e.To != transition.To || e.Reason == "" {
+				t.Errorf("Check = %+v, want code %s from %s to %s with a reason", e, tt.wantCode, tt.inv.State, transition.To)
+			}
+		})
+	}
+}
+
+func TestMarkPaidReason(t *testing.T) {
+	inv := invoice(StateSent)
+	inv.AmountPaid = eur(2550)
+	transition, _ := Lookup(MarkPaid)
+	err := transition.Check(inv)
+	if err == nil || err.(*Error).Reason != "balance of €74.50 is still due" {
+		t.Errorf("Check = %v, want the balance due in the reason", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range []string{Finalize, Send, MarkPaid, Void, Credit} {
+		if transition, ok := Lookup(name); !ok || transition.Name != name {
+			t.Errorf("Lookup(%q) = %v, %v", name, transition.Name, ok)
+		}
+	}
+	if _, ok := Lookup("reopen"); ok {
+		t.Error("Lookup found a transition that does not exist")
+	}
+}
+
+func TestLeadingTo(t *testing.T) {
+	tests := []struct {
+		from, to State
+		want     string
+	}{
+		{StateDraft, StateFinalized, Finalize},
+		{StateFinalized, StateSent, Send},
+		{StateSent, StatePaid, MarkPaid},
+		{StateFinalized, StatePaid, MarkPaid},
+		{StateDraft, StateVoid, Void},
+		{StatePaid, StateCredited, Credit},
+		{StateDraft, StatePaid, ""},
+		{StatePaid, StateDraft, ""},
+		{StateVoid, StateFinalized, ""},
+	}
+	for _, tt := range tests {
+		transition, ok := LeadingTo(tt.from, tt.to)
+		if ok != (tt.want != "") || transition.Name != tt.want {
+			t.Errorf("LeadingTo(%s, %s) = %q, %v, want %q", tt.from, tt.to, transition.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	options := Options(invoice(StateSent))
+	want := []Option{
+		{Name: MarkPaid, To: StatePaid, Allowed: false, Reason: "balance of €100.00 is still due"},
+		{Name: Void, To: StateVoid, Allowed: true},
+		{Name: Credit, To: StateCredited, Allowed: false, Reason: "invoice has not been fully credited; issue a credit note"},
+	}
+	if len(options) != len(want) {
+		t.Fatalf("Options = %+v, want %+v", options, want)
+	}
+	for i := range want {
+		if options[i] != want[i] {
+			t.Errorf("Options[%d] = %+v, want %+v", i, options[i], want[i])
+		}
+	}
+
+	// Nothing leads out of a void invoice, and the list is empty rather than nil
+	if options := Options(invoice(StateVoid)); options == nil || len(options) != 0 {
+		t.Errorf("Options(void) = %#v, want an empty list", options)
+	}
+}
+
+func TestStates(t *testing.T) {
+	for _, s := range states {
+		if !IsState(string(s)) {
+			t.Errorf("IsState(%q) = false", s)
+		}
+	}
+	if IsState("overdue") {
+		t.Error("IsState(\"overdue\") = true")
+	}
+	for s, want := range map[State]bool{StateDraft: false, StateFinalized: true, StateSent: true, StatePaid: false, StateVoid: false, StateCredited: false} {
+		if Open(s) != want {
+			t.Errorf("Open(%s) = %v, want %v", s, !want, want)
+		}
+	}
+}
@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"invoice-app/auth"
 	"invoice-app/database"
 	"invoice-app/handlers"
+	"invoice-app/pdfrender"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
@@ -17,37 +23,157 @@ func main() {
 	}
 	defer db.Close()
 
-	h := handlers.New(db)
+	// PDFs are rendered from HTML in pure Go, in the TrueType fonts in
+	// PDF_FONT_DIR if it is set, unless PDF_RENDERER asks for wkhtmltopdf,
+	// found on the PATH or at WKHTMLTOPDF_PATH
+	renderer, err := pdfrender.New(pdfrender.Config{
+		Backend:         os.Getenv("PDF_RENDERER"),
+		WkhtmltopdfPath: os.Getenv("WKHTMLTOPDF_PATH"),
+		FontDir:         os.Getenv("PDF_FONT_DIR"),
+	})
+	if err != nil {
+		log.Fatal("Failed to set up PDF rendering:", err)
+	}
+	if !pdfrender.EmbedsFonts(renderer) {
+		log.Println("Factur-X PDFs are turned off: PDF/A needs embedded fonts, so set PDF_FONT_DIR to a directory of TrueType fonts")
+	}
+
+	h := handlers.New(db, renderer)
 	r := mux.NewRouter()
 
-	r.HandleFunc("/api/customers", h.GetCustomers).Methods("GET")
-	r.HandleFunc("/api/customers", h.CreateCustomer).Methods("POST")
-	r.HandleFunc("/api/customers/{id}", h.GetCustomer).Methods("GET")
-	r.HandleFunc("/api/customers/{id}", h.UpdateCustomer).Methods("PUT")
-	r.HandleFunc("/api/customers/{id}", h.DeleteCustomer).Methods("DELETE")
+	// Every API request must be signed in or carry an API token
+	r.Use(h.Authenticate)
+
+	// Any signed-in user can manage their own session, password and tokens,
+	// and list the organizations they can work in
+	r.HandleFunc("/api/auth/login", h.Login).Methods("POST")
+	r.HandleFunc("/api/auth/logout", h.Logout).Methods("POST")
+	r.HandleFunc("/api/auth/me", h.GetCurrentUser).Methods("GET")
+	r.HandleFunc("/api/auth/password", h.ChangePassword).Methods("PUT")
+	r.HandleFunc("/api/auth/tokens", h.GetAPITokens).Methods("GET")
+	r.HandleFunc("/api/auth/tokens", h.CreateAPIToken).Methods("POST")
+	r.HandleFunc("/api/auth/tokens/{id}", h.RevokeAPIToken).Methods("DELETE")
+	r.HandleFunc("/api/organizations", h.GetOrganizations).Methods("GET")
+
+	// Every other API route needs a permission its user's role in the
+	// organization grants
+	r.HandleFunc("/api/users", h.Require(auth.ManageUsers, h.GetUsers)).Methods("GET")
+	r.HandleFunc("/api/users", h.Require(auth.ManageUsers, h.CreateUser)).Methods("POST")
+	r.HandleFunc("/api/users/{id}", h.Require(auth.ManageUsers, h.DisableUser)).Methods("DELETE")
+	r.HandleFunc("/api/users/{id}/role", h.Require(auth.ManageUsers, h.SetUserRole)).Methods("PUT")
+
+	r.HandleFunc("/api/organizations", h.Require(auth.ManageOrganizations, h.CreateOrganization)).Methods("POST")
+	r.HandleFunc("/api/organizations/{id}", h.Require(auth.ManageOrganizations, h.UpdateOrganization)).Methods("PUT")
+	r.HandleFunc("/api/organizations/{id}/members", h.Require(auth.ManageUsers, h.AddOrganizationMember)).Methods("POST")
+	r.HandleFunc("/api/organizations/{id}/members/{userId}", h.Require(auth.ManageUsers, h.RemoveOrganizationMember)).Methods("DELETE")
+
+	r.HandleFunc("/api/customers", h.Require(auth.ViewRecords, h.GetCustomers)).Methods("GET")
+	r.HandleFunc("/api/customers", h.Require(auth.EditCustomers, h.CreateCustomer)).Methods("POST")
+	r.HandleFunc("/api/customers/{id}", h.Require(auth.ViewRecords, h.GetCustomer)).Methods("GET")
+	r.HandleFunc("/api/customers/{id}", h.Require(auth.EditCustomers, h.UpdateCustomer)).Methods("PUT")
+	r.HandleFunc("/api/customers/{id}", h.Require(auth.DeleteCustomers, h.DeleteCustomer)).Methods("DELETE")
+	r.HandleFunc("/api/customers/{id}/history", h.Require(auth.ViewAudit, h.GetCustomerHistory)).Methods("GET")
+
+	r.HandleFunc("/api/products", h.Require(auth.ViewRecords, h.GetProducts)).Methods("GET")
+	r.HandleFunc("/api/products", h.Require(auth.EditProducts, h.CreateProduct)).Methods("POST")
+	r.HandleFunc("/api/products/{id}", h.Require(auth.ViewRecords, h.GetProduct)).Methods("GET")
+	r.HandleFunc("/api/products/{id}", h.Require(auth.EditProducts, h.UpdateProduct)).Methods("PUT")
+	r.HandleFunc("/api/products/{id}", h.Require(auth.DeleteProducts, h.DeleteProduct)).Methods("DELETE")
+	r.HandleFunc("/api/products/{id}/history", h.Require(auth.ViewAudit, h.GetProductHistory)).Methods("GET")
+
+	r.HandleFunc("/api/tax-categories", h.Require(auth.ViewRecords, h.GetTaxCategories)).Methods("GET")
+	r.HandleFunc("/api/tax-categories", h.Require(auth.ManageSettings, h.CreateTaxCategory)).Methods("POST")
+	r.HandleFunc("/api/tax-categories/{id}", h.Require(auth.ManageSettings, h.UpdateTaxCategory)).Methods("PUT")
+	r.HandleFunc("/api/tax-categories/{id}", h.Require(auth.ManageSettings, h.DeleteTaxCategory)).Methods("DELETE")
+	r.HandleFunc("/api/tax-categories/{id}/rules", h.Require(auth.ManageSettings, h.SetTaxRule)).Methods("PUT")
+	r.HandleFunc("/api/tax-categories/{id}/rules/{ruleId}", h.Require(auth.ManageSettings, h.DeleteTaxRule)).Methods("DELETE")
 
-	r.HandleFunc("/api/products", h.GetProducts).Methods("GET")
-	r.HandleFunc("/api/products", h.CreateProduct).Methods("POST")
-	r.HandleFunc("/api/products/{id}", h.GetProduct).Methods("GET")
-	r.HandleFunc("/api/products/{id}", h.UpdateProduct).Methods("PUT")
-	r.HandleFunc("/api/products/{id}", h.DeleteProduct).Methods("DELETE")
+	r.HandleFunc("/api/exchange-rates", h.Require(auth.ViewRecords, h.GetExchangeRates)).Methods("GET")
+	r.HandleFunc("/api/exchange-rates", h.Require(auth.ManageSettings, h.CreateExchangeRate)).Methods("POST")
+	r.HandleFunc("/api/exchange-rates/{id}", h.Require(auth.ManageSettings, h.DeleteExchangeRate)).Methods("DELETE")
 
-	r.HandleFunc("/api/invoices", h.GetInvoices).Methods("GET")
-	r.HandleFunc("/api/invoices", h.CreateInvoice).Methods("POST")
-	r.HandleFunc("/api/invoices/{id}", h.GetInvoice).Methods("GET")
-	r.HandleFunc("/api/invoices/{id}/status", h.UpdateInvoiceStatus).Methods("PUT")
-	r.HandleFunc("/api/invoices/{id}/pdf", h.GenerateInvoicePDF).Methods("GET")
+	r.HandleFunc("/api/reports/invoice-totals", h.Require(auth.ViewRecords, h.GetInvoiceTotals)).Methods("GET")
+
+	r.HandleFunc("/api/audit", h.Require(auth.ViewAudit, h.GetAuditEvents)).Methods("GET")
+
+	r.HandleFunc("/api/number-series", h.Require(auth.ViewRecords, h.GetNumberSeries)).Methods("GET")
+	r.HandleFunc("/api/number-series/{name}", h.Require(auth.ManageSettings, h.SetNumberSeries)).Methods("PUT")
+
+	r.HandleFunc("/api/company", h.Require(auth.ViewRecords, h.GetCompany)).Methods("GET")
+	r.HandleFunc("/api/company", h.Require(auth.ManageSettings, h.UpdateCompany)).Methods("PUT")
+	r.HandleFunc("/api/company/logo", h.Require(auth.ViewRecords, h.GetCompanyLogo)).Methods("GET")
+	r.HandleFunc("/api/company/logo", h.Require(auth.ManageSettings, h.UploadCompanyLogo)).Methods("PUT")
+	r.HandleFunc("/api/company/logo", h.Require(auth.ManageSettings, h.DeleteCompanyLogo)).Methods("DELETE")
+
+	r.HandleFunc("/api/pdf-templates", h.Require(auth.ViewRecords, h.GetPDFTemplates)).Methods("GET")
+	r.HandleFunc("/api/pdf-templates", h.Require(auth.ManageSettings, h.CreatePDFTemplate)).Methods("POST")
+	r.HandleFunc("/api/pdf-templates/preview", h.Require(auth.ViewRecords, h.PreviewUnsavedPDFTemplate)).Methods("POST")
+	r.HandleFunc("/api/pdf-templates/{id}", h.Require(auth.ViewRecords, h.GetPDFTemplate)).Methods("GET")
+	r.HandleFunc("/api/pdf-templates/{id}", h.Require(auth.ManageSettings, h.UpdatePDFTemplate)).Methods("PUT")
+	r.HandleFunc("/api/pdf-templates/{id}", h.Require(auth.ManageSettings, h.DeletePDFTemplate)).Methods("DELETE")
+	r.HandleFunc("/api/pdf-templates/{id}/default", h.Require(auth.ManageSettings, h.SetDefaultPDFTemplate)).Methods("POST")
+	r.HandleFunc("/api/pdf-templates/{id}/preview", h.Require(auth.ViewRecords, h.PreviewPDFTemplate)).Methods("GET")
+
+	r.HandleFunc("/api/invoices", h.Require(auth.ViewRecords, h.GetInvoices)).Methods("GET")
+	r.HandleFunc("/api/invoices", h.Require(auth.EditInvoices, h.CreateInvoice)).Methods("POST")
+	r.HandleFunc("/api/invoices/by-number/{number}", h.Require(auth.ViewRecords, h.GetInvoiceByNumber)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}", h.Require(auth.ViewRecords, h.GetInvoice)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}", h.Require(auth.EditInvoices, h.UpdateInvoice)).Methods("PUT")
+	r.HandleFunc("/api/invoices/{id}/items", h.Require(auth.EditInvoices, h.AddInvoiceItem)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/items/{itemId}", h.Require(auth.EditInvoices, h.UpdateInvoiceItem)).Methods("PUT")
+	r.HandleFunc("/api/invoices/{id}/items/{itemId}", h.Require(auth.EditInvoices, h.DeleteInvoiceItem)).Methods("DELETE")
+	r.HandleFunc("/api/invoices/{id}/status", h.Require(auth.ChangeInvoiceStatus, h.UpdateInvoiceStatus)).Methods("PUT")
+	r.HandleFunc("/api/invoices/{id}/transitions", h.Require(auth.ViewRecords, h.GetInvoiceTransitions)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/transitions/{transition}", h.Require(auth.ChangeInvoiceStatus, h.ApplyInvoiceTransition)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/pdf", h.Require(auth.ViewRecords, h.GenerateInvoicePDF)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/ubl", h.Require(auth.ViewRecords, h.GenerateInvoiceUBL)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/history", h.Require(auth.ViewAudit, h.GetInvoiceHistory)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/payments", h.Require(auth.ViewRecords, h.GetPayments)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/payments", h.Require(auth.RecordPayments, h.CreatePayment)).Methods("POST")
+	r.HandleFunc("/api/invoices/{id}/credit-notes", h.Require(auth.ViewRecords, h.GetInvoiceCreditNotes)).Methods("GET")
+	r.HandleFunc("/api/invoices/{id}/credit-notes", h.Require(auth.IssueCreditNotes, h.CreateCreditNote)).Methods("POST")
+
+	r.HandleFunc("/api/credit-notes", h.Require(auth.ViewRecords, h.GetCreditNotes)).Methods("GET")
+	r.HandleFunc("/api/credit-notes/{id}", h.Require(auth.ViewRecords, h.GetCreditNote)).Methods("GET")
+	r.HandleFunc("/api/credit-notes/{id}/pdf", h.Require(auth.ViewRecords, h.GenerateCreditNotePDF)).Methods("GET")
+	r.HandleFunc("/api/credit-notes/{id}/ubl", h.Require(auth.ViewRecords, h.GenerateCreditNoteUBL)).Methods("GET")
+
+	r.HandleFunc("/api/quotes", h.Require(auth.ViewRecords, h.GetQuotes)).Methods("GET")
+	r.HandleFunc("/api/quotes", h.Require(auth.EditQuotes, h.CreateQuote)).Methods("POST")
+	r.HandleFunc("/api/quotes/{id}", h.Require(auth.ViewRecords, h.GetQuote)).Methods("GET")
+	r.HandleFunc("/api/quotes/{id}/status", h.Require(auth.ChangeQuoteStatus, h.UpdateQuoteStatus)).Methods("PUT")
+	r.HandleFunc("/api/quotes/{id}/convert", h.Require(auth.ChangeQuoteStatus, h.ConvertQuote)).Methods("POST")
+	r.HandleFunc("/api/quotes/{id}/pdf", h.Require(auth.ViewRecords, h.GenerateQuotePDF)).Methods("GET")
+
+	r.HandleFunc("/api/recurring-invoices", h.Require(auth.ViewRecords, h.GetRecurringInvoices)).Methods("GET")
+	r.HandleFunc("/api/recurring-invoices", h.Require(auth.ManageRecurring, h.CreateRecurringInvoice)).Methods("POST")
+	r.HandleFunc("/api/recurring-invoices/{id}", h.Require(auth.ViewRecords, h.GetRecurringInvoice)).Methods("GET")
+	r.HandleFunc("/api/recurring-invoices/{id}/pause", h.Require(auth.ManageRecurring, h.PauseRecurringInvoice)).Methods("POST")
+	r.HandleFunc("/api/recurring-invoices/{id}/resume", h.Require(auth.ManageRecurring, h.ResumeRecurringInvoice)).Methods("POST")
+	r.HandleFunc("/api/recurring-invoices/{id}/preview", h.Require(auth.ViewRecords, h.PreviewRecurringInvoice)).Methods("GET")
 
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("./static/")))
 
+	// The SPA is served from this origin; other origins are allowed only if
+	// listed, comma-separated, in CORS_ALLOWED_ORIGINS
+	var origins []string
+	for _, origin := range strings.Split(os.Getenv("CORS_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
 	c := cors.New(cors.Options{
-		AllowedOrigins: []string{"*"},
-		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
-		AllowedHeaders: []string{"Content-Type"},
+		AllowedOrigins:   origins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Organization-ID"},
+		AllowCredentials: true,
 	})
 
 	handler := c.Handler(r)
 
+	// Generate invoices from recurring invoices as they fall due
+	go h.RunRecurringInvoices(context.Background(), time.Minute)
+
 	log.Println("Server starting on :9080")
 	if err := http.ListenAndServe(":9080", handler); err != nil {
 		log.Fatal("Server failed to start:", err)
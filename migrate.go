@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"invoice-app/database"
+)
+
+// Usage: go run migrate.go [up|down|status]
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: go run migrate.go [up|down|status]")
+		os.Exit(2)
+	}
+
+	db, err := database.Open()
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := database.MigrateUp(db)
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal("Migration failed: ", err)
+		}
+		if len(applied) == 0 {
+			log.Println("Database is up to date")
+		}
+	case "down":
+		reverted, err := database.MigrateDown(db)
+		if err != nil {
+			log.Fatal("Rollback failed: ", err)
+		}
+		if reverted == nil {
+			log.Println("No migrations to revert")
+		} else {
+			log.Printf("Reverted migration %04d_%s", reverted.Version, reverted.Name)
+		}
+	case "status":
+		statuses, err := database.Status(db)
+		if err != nil {
+			log.Fatal("Failed to read migration status: ", err)
+		}
+		for _, s := range statuses {
+			if s.Applied {
+				fmt.Printf("%04d_%-40s applied %s\n", s.Version, s.Name, s.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%04d_%-40s pending\n", s.Version, s.Name)
+			}
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\nUsage: go run migrate.go [up|down|status]\n", os.Args[1])
+		os.Exit(2)
+	}
+}
@@ -1,56 +1,623 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
+
+	"invoice-app/money"
+	"invoice-app/tax"
 )
 
+// Customer.PaymentTermDays is only set for custom payment terms. PeppolID and
+// BuyerReference are only set when the customer has one, and an update that
+// omits them leaves them unchanged.
 type Customer struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Phone     string    `json:"phone"`
-	Address   string    `json:"address"`
-	Country   string    `json:"country"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int       `json:"id"`
+	Name            string    `json:"name"`
+	Phone           string    `json:"phone"`
+	Address         string    `json:"address"`
+	Country         string    `json:"country"`
+	Currency        string    `json:"currency"`
+	PaymentTerms    string    `json:"payment_terms,omitempty"`
+	PaymentTermDays *int      `json:"payment_term_days,omitempty"`
+	PeppolID        *string   `json:"peppol_id,omitempty"`
+	BuyerReference  *string   `json:"buyer_reference,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
 }
 
+const (
+	PaymentTermsDueOnReceipt = "due_on_receipt"
+	PaymentTermsNet15        = "net_15"
+	PaymentTermsNet30        = "net_30"
+	PaymentTermsNet60        = "net_60"
+	PaymentTermsCustom       = "custom"
+)
+
 type Product struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            int         `json:"id"`
+	Name          string      `json:"name"`
+	Price         money.Money `json:"price"`
+	TaxCategoryID *int        `json:"tax_category_id,omitempty"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+type TaxCategory struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	Rules       []TaxRule `json:"rules"`
+}
+
+// TaxRule sets the rate for a tax category in one country. Country "*"
+// applies wherever no country-specific rule exists.
+type TaxRule struct {
+	ID            int       `json:"id"`
+	TaxCategoryID int       `json:"tax_category_id"`
+	Country       string    `json:"country"`
+	Rate          tax.Rate  `json:"rate"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ExchangeRate is the number of units of Currency per unit of the base
+// currency from EffectiveDate until the next rate for that currency.
+type ExchangeRate struct {
+	ID            int                `json:"id"`
+	Currency      string             `json:"currency"`
+	Rate          money.ExchangeRate `json:"rate"`
+	EffectiveDate string             `json:"effective_date"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+// NumberSeries numbers documents from Pattern; NextNumber previews the number
+// the next document issued today would get.
+type NumberSeries struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Pattern    string    `json:"pattern"`
+	NextNumber string    `json:"next_number"`
+	CreatedAt  time.Time `json:"created_at"`
 }
 
+// Invoice amounts are all in Currency. TotalPrice is Subtotal +
+// AdjustmentTotal + TaxTotal, where AdjustmentTotal is the signed sum of the
+// invoice-level discounts and surcharges. ExchangeRate is the rate the
+// invoice was priced at, in units of Currency per unit of the base currency,
+// and BaseTotal is TotalPrice in the base currency. DueDate is the issue date
+// plus PaymentTermDays, formatted as YYYY-MM-DD. BalanceDue is TotalPrice
+// less AmountPaid and AmountCredited and is negative when the invoice has
+// been over-paid.
 type Invoice struct {
-	ID          int              `json:"id"`
-	CustomerID  *int             `json:"customer_id,omitempty"`
-	Customer    *Customer        `json:"customer,omitempty"`
-	TotalPrice  float64          `json:"total_price"`
-	Status      string           `json:"status"`
-	CreatedAt   time.Time        `json:"created_at"`
-	ProcessedAt *time.Time       `json:"processed_at,omitempty"`
-	Items       []InvoiceItem    `json:"items,omitempty"`
+	ID              int                 `json:"id"`
+	InvoiceNumber   string              `json:"invoice_number"`
+	CustomerID      *int                `json:"customer_id,omitempty"`
+	Customer        *CustomerSnapshot   `json:"customer,omitempty"`
+	Subtotal        money.Money         `json:"subtotal"`
+	AdjustmentTotal money.Money         `json:"adjustment_total"`
+	TaxTotal        money.Money         `json:"tax_total"`
+	TotalPrice      money.Money         `json:"total_price"`
+	Currency        string              `json:"currency"`
+	ExchangeRate    money.ExchangeRate  `json:"exchange_rate"`
+	BaseTotal       money.Money         `json:"base_total"`
+	Status          string              `json:"status"`
+	PaymentTerms    string              `json:"payment_terms"`
+	PaymentTermDays int                 `json:"payment_term_days"`
+	DueDate         string              `json:"due_date"`
+	Overdue         bool                `json:"overdue"`
+	AmountPaid      money.Money         `json:"amount_paid"`
+	AmountCredited  money.Money         `json:"amount_credited"`
+	BalanceDue      money.Money         `json:"balance_due"`
+	CreatedAt       time.Time           `json:"created_at"`
+	FinalizedAt     *time.Time          `json:"finalized_at,omitempty"`
+	SentAt          *time.Time          `json:"sent_at,omitempty"`
+	PaidAt          *time.Time          `json:"paid_at,omitempty"`
+	VoidedAt        *time.Time          `json:"voided_at,omitempty"`
+	CreditedAt      *time.Time          `json:"credited_at,omitempty"`
+	Items           []InvoiceItem       `json:"items,omitempty"`
+	Adjustments     []InvoiceAdjustment `json:"adjustments,omitempty"`
+	TaxLines        []TaxLine           `json:"tax_lines,omitempty"`
+	Payments        []Payment           `json:"payments,omitempty"`
+	CreditNotes     []CreditNote        `json:"credit_notes,omitempty"`
+
+	// RecurringInvoiceID is the recurring invoice this one was generated
+	// from, if any.
+	RecurringInvoiceID *int `json:"recurring_invoice_id,omitempty"`
 }
 
+// InvoiceItem.TotalPrice is Quantity × UnitPrice less the line discount.
+// AdjustmentAmount is the line's share of the invoice-level adjustments;
+// tax is charged on TotalPrice + AdjustmentAmount. Untaxed is set when the
+// product had no tax category, or no rule for the customer's country, as
+// against a rule of 0%.
 type InvoiceItem struct {
-	ID         int     `json:"id"`
-	InvoiceID  int     `json:"invoice_id"`
-	ProductID  int     `json:"product_id"`
-	Quantity   int     `json:"quantity"`
-	UnitPrice  float64 `json:"unit_price"`
-	TotalPrice float64 `json:"total_price"`
-	Product    *Product `json:"product,omitempty"`
+	ID               int              `json:"id"`
+	InvoiceID        int              `json:"invoice_id,omitempty"`
+	ProductID        int              `json:"product_id"`
+	Quantity         int              `json:"quantity"`
+	UnitPrice        money.Money      `json:"unit_price"`
+	Discount         *Discount        `json:"discount,omitempty"`
+	DiscountAmount   money.Money      `json:"discount_amount"`
+	TotalPrice       money.Money      `json:"total_price"`
+	AdjustmentAmount money.Money      `json:"adjustment_amount"`
+	TaxRate          tax.Rate         `json:"tax_rate"`
+	TaxAmount        money.Money      `json:"tax_amount"`
+	Product          *ProductSnapshot `json:"product,omitempty"`
+	Untaxed          bool             `json:"untaxed,omitempty"`
+}
+
+// CustomerSnapshot is who an invoice was billed to, as the customer stood
+// when the invoice was created.
+type CustomerSnapshot struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Phone   string `json:"phone"`
+	Address string `json:"address"`
+	Country string `json:"country"`
+}
+
+// ProductSnapshot is a product as it was named when it was invoiced.
+type ProductSnapshot struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+const (
+	DiscountPercent = "percent"
+	DiscountFixed   = "fixed"
+)
+
+// Discount is a percentage (Value 10 = 10%) or a fixed amount in the
+// invoice currency.
+type Discount struct {
+	Type  string      `json:"type"`
+	Value json.Number `json:"value"`
+}
+
+const (
+	AdjustmentDiscount  = "discount"
+	AdjustmentSurcharge = "surcharge"
+)
+
+// InvoiceAdjustment is an invoice-level discount or surcharge. Percentages
+// apply to the invoice subtotal. Amount is signed: negative for discounts.
+type InvoiceAdjustment struct {
+	Kind        string      `json:"kind"`
+	Type        string      `json:"type"`
+	Value       json.Number `json:"value"`
+	Description string      `json:"description,omitempty"`
+	Amount      money.Money `json:"amount"`
+}
+
+// TaxLine summarizes the tax charged at one rate on an invoice.
+type TaxLine struct {
+	Rate          tax.Rate    `json:"rate"`
+	TaxableAmount money.Money `json:"taxable_amount"`
+	TaxAmount     money.Money `json:"tax_amount"`
 }
 
+// CreateInvoiceRequest.PaymentTerms overrides the customer's payment terms.
 type CreateInvoiceRequest struct {
-	CustomerID int                 `json:"customer_id"`
-	Items      []CreateInvoiceItem `json:"items"`
+	CustomerID      int                 `json:"customer_id"`
+	Currency        string              `json:"currency,omitempty"`
+	Series          string              `json:"series,omitempty"`
+	PaymentTerms    string              `json:"payment_terms,omitempty"`
+	PaymentTermDays *int                `json:"payment_term_days,omitempty"`
+	Items           []CreateInvoiceItem `json:"items"`
+	Adjustments     []InvoiceAdjustment `json:"adjustments,omitempty"`
 }
 
 type CreateInvoiceItem struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int       `json:"product_id"`
+	Quantity  int       `json:"quantity"`
+	Discount  *Discount `json:"discount,omitempty"`
+}
+
+// CurrencyTotal is one row of the invoice totals report.
+type CurrencyTotal struct {
+	Currency  string      `json:"currency"`
+	Status    string      `json:"status"`
+	Count     int         `json:"count"`
+	Total     money.Money `json:"total"`
+	BaseTotal money.Money `json:"base_total"`
+}
+
+type InvoiceTotalsReport struct {
+	BaseCurrency string          `json:"base_currency"`
+	Totals       []CurrencyTotal `json:"totals"`
+	BaseTotal    money.Money     `json:"base_total"`
+}
+
+const (
+	PaymentBankTransfer = "bank_transfer"
+	PaymentCard         = "card"
+	PaymentCash         = "cash"
+	PaymentCheque       = "cheque"
+	PaymentOther        = "other"
+)
+
+// Payment is money received against an invoice, in the invoice currency.
+type Payment struct {
+	ID          int         `json:"id"`
+	InvoiceID   int         `json:"invoice_id"`
+	Amount      money.Money `json:"amount"`
+	PaymentDate string      `json:"payment_date"`
+	Method      string      `json:"method"`
+	Reference   string      `json:"reference,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// CreatePaymentRequest.Amount is read in the invoice currency, so it is kept
+// as a json.Number until that is known.
+type CreatePaymentRequest struct {
+	Amount      json.Number `json:"amount"`
+	PaymentDate string      `json:"payment_date,omitempty"`
+	Method      string      `json:"method"`
+	Reference   string      `json:"reference,omitempty"`
+}
+
+// CreditNote reverses all or part of an invoice. Its amounts are positive,
+// in the invoice's currency and at the invoice's exchange rate; reports count
+// them as negative.
+type CreditNote struct {
+	ID               int                `json:"id"`
+	CreditNoteNumber string             `json:"credit_note_number"`
+	InvoiceID        int                `json:"invoice_id"`
+	InvoiceNumber    string             `json:"invoice_number"`
+	Reason           string             `json:"reason,omitempty"`
+	Subtotal         money.Money        `json:"subtotal"`
+	AdjustmentTotal  money.Money        `json:"adjustment_total"`
+	TaxTotal         money.Money        `json:"tax_total"`
+	TotalPrice       money.Money        `json:"total_price"`
+	Currency         string             `json:"currency"`
+	ExchangeRate     money.ExchangeRate `json:"exchange_rate"`
+	BaseTotal        money.Money        `json:"base_total"`
+	CreatedAt        time.Time          `json:"created_at"`
+	Items            []CreditNoteItem   `json:"items,omitempty"`
+	TaxLines         []TaxLine          `json:"tax_lines,omitempty"`
+}
+
+// CreditNoteItem credits Quantity of an invoice item. Its amounts are that
+// share of the invoice item's, and it is Untaxed if that was.
+type CreditNoteItem struct {
+	ID               int              `json:"id"`
+	CreditNoteID     int              `json:"credit_note_id"`
+	InvoiceItemID    int              `json:"invoice_item_id"`
+	ProductID        int              `json:"product_id"`
+	Quantity         int              `json:"quantity"`
+	UnitPrice        money.Money      `json:"unit_price"`
+	DiscountAmount   money.Money      `json:"discount_amount"`
+	TotalPrice       money.Money      `json:"total_price"`
+	AdjustmentAmount money.Money      `json:"adjustment_amount"`
+	TaxRate          tax.Rate         `json:"tax_rate"`
+	TaxAmount        money.Money      `json:"tax_amount"`
+	Product          *ProductSnapshot `json:"product,omitempty"`
+	Untaxed          bool             `json:"untaxed,omitempty"`
+}
+
+// CreateCreditNoteRequest credits the listed items, or everything not yet
+// credited when Items is empty.
+type CreateCreditNoteRequest struct {
+	Reason string                 `json:"reason,omitempty"`
+	Series string                 `json:"series,omitempty"`
+	Items  []CreateCreditNoteItem `json:"items,omitempty"`
+}
+
+type CreateCreditNoteItem struct {
+	InvoiceItemID int `json:"invoice_item_id"`
+	Quantity      int `json:"quantity"`
+}
+
+const (
+	RecurringActive   = "active"
+	RecurringPaused   = "paused"
+	RecurringFinished = "finished"
+)
+
+// RecurringInvoice is a template the scheduler turns into a draft invoice at
+// each run of its schedule. Empty Currency, Series and PaymentTerms use the
+// customer's and the defaults at the time of the run. NextRunAt is nil once
+// the schedule has finished; LastError says why the last attempt failed.
+type RecurringInvoice struct {
+	ID              int                   `json:"id"`
+	OrganizationID  int                   `json:"-"`
+	CustomerID      int                   `json:"customer_id"`
+	CustomerName    string                `json:"customer_name"`
+	Currency        string                `json:"currency,omitempty"`
+	Series          string                `json:"series,omitempty"`
+	PaymentTerms    string                `json:"payment_terms,omitempty"`
+	PaymentTermDays *int                  `json:"payment_term_days,omitempty"`
+	Interval        string                `json:"interval"`
+	Cron            string                `json:"cron,omitempty"`
+	StartDate       string                `json:"start_date"`
+	EndDate         string                `json:"end_date,omitempty"`
+	Status          string                `json:"status"`
+	NextRunAt       *time.Time            `json:"next_run_at"`
+	LastRunAt       *time.Time            `json:"last_run_at,omitempty"`
+	LastError       string                `json:"last_error,omitempty"`
+	CreatedAt       time.Time             `json:"created_at"`
+	Items           []CreateInvoiceItem   `json:"items,omitempty"`
+	Adjustments     []RecurringAdjustment `json:"adjustments,omitempty"`
+}
+
+// RecurringAdjustment is an invoice-level discount or surcharge applied to
+// every invoice generated from a recurring invoice.
+type RecurringAdjustment struct {
+	Kind        string      `json:"kind"`
+	Type        string      `json:"type"`
+	Value       json.Number `json:"value"`
+	Description string      `json:"description,omitempty"`
+}
+
+// CreateRecurringInvoiceRequest describes the invoices to generate as for
+// CreateInvoiceRequest, and when: Interval is monthly, quarterly or cron,
+// with Cron holding a five-field cron expression for the latter. StartDate
+// and EndDate are YYYY-MM-DD; EndDate is optional and inclusive.
+type CreateRecurringInvoiceRequest struct {
+	CustomerID      int                   `json:"customer_id"`
+	Currency        string                `json:"currency,omitempty"`
+	Series          string                `json:"series,omitempty"`
+	PaymentTerms    string                `json:"payment_terms,omitempty"`
+	PaymentTermDays *int                  `json:"payment_term_days,omitempty"`
+	Items           []CreateInvoiceItem   `json:"items"`
+	Adjustments     []RecurringAdjustment `json:"adjustments,omitempty"`
+	Interval        string                `json:"interval"`
+	Cron            string                `json:"cron,omitempty"`
+	StartDate       string                `json:"start_date"`
+	EndDate         string                `json:"end_date,omitempty"`
+}
+
+// RecurringRun is an upcoming run of a recurring invoice.
+type RecurringRun struct {
+	RunAt time.Time `json:"run_at"`
+}
+
+const (
+	QuoteDraft    = "draft"
+	QuoteSent     = "sent"
+	QuoteAccepted = "accepted"
+	QuoteRejected = "rejected"
+	QuoteExpired  = "expired"
+)
+
+// Quote is an offer priced like an invoice. It expires at the end of
+// ExpiresOn unless accepted or rejected first; an accepted quote converts
+// into an invoice at the quoted prices, recorded in InvoiceID.
+type Quote struct {
+	ID              int                 `json:"id"`
+	QuoteNumber     string              `json:"quote_number"`
+	CustomerID      int                 `json:"customer_id"`
+	Customer        *CustomerSnapshot   `json:"customer,omitempty"`
+	Subtotal        money.Money         `json:"subtotal"`
+	AdjustmentTotal money.Money         `json:"adjustment_total"`
+	TaxTotal        money.Money         `json:"tax_total"`
+	TotalPrice      money.Money         `json:"total_price"`
+	Currency        string              `json:"currency"`
+	ExchangeRate    money.ExchangeRate  `json:"exchange_rate"`
+	BaseTotal       money.Money         `json:"base_total"`
+	Status          string              `json:"status"`
+	PaymentTerms    string              `json:"payment_terms"`
+	PaymentTermDays int                 `json:"payment_term_days"`
+	ExpiresOn       string              `json:"expires_on"`
+	InvoiceID       *int                `json:"invoice_id,omitempty"`
+	InvoiceNumber   string              `json:"invoice_number,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+	SentAt          *time.Time          `json:"sent_at,omitempty"`
+	AcceptedAt      *time.Time          `json:"accepted_at,omitempty"`
+	RejectedAt      *time.Time          `json:"rejected_at,omitempty"`
+	ExpiredAt       *time.Time          `json:"expired_at,omitempty"`
+	Items           []InvoiceItem       `json:"items,omitempty"`
+	Adjustments     []InvoiceAdjustment `json:"adjustments,omitempty"`
+	TaxLines        []TaxLine           `json:"tax_lines,omitempty"`
+}
+
+// CreateQuoteRequest is priced as CreateInvoiceRequest. Series numbers the
+// quote; ExpiresOn is YYYY-MM-DD and defaults to 30 days from today.
+type CreateQuoteRequest struct {
+	CustomerID      int                 `json:"customer_id"`
+	Currency        string              `json:"currency,omitempty"`
+	Series          string              `json:"series,omitempty"`
+	PaymentTerms    string              `json:"payment_terms,omitempty"`
+	PaymentTermDays *int                `json:"payment_term_days,omitempty"`
+	ExpiresOn       string              `json:"expires_on,omitempty"`
+	Items           []CreateInvoiceItem `json:"items"`
+	Adjustments     []InvoiceAdjustment `json:"adjustments,omitempty"`
+}
+
+// ConvertQuoteRequest.Series numbers the invoice created from a quote.
+type ConvertQuoteRequest struct {
+	Series string `json:"series,omitempty"`
+}
+
+// UpdateInvoiceRequest changes a draft invoice; omitted fields are left as
+// they are. Items and Adjustments, when given, replace all of the invoice's.
+type UpdateInvoiceRequest struct {
+	CustomerID      *int                 `json:"customer_id,omitempty"`
+	Currency        string               `json:"currency,omitempty"`
+	PaymentTerms    string               `json:"payment_terms,omitempty"`
+	PaymentTermDays *int                 `json:"payment_term_days,omitempty"`
+	Items           *[]CreateInvoiceItem `json:"items,omitempty"`
+	Adjustments     *[]InvoiceAdjustment `json:"adjustments,omitempty"`
 }
 
 type UpdateStatusRequest struct {
 	Status string `json:"status"`
-}
\ No newline at end of file
+}
+
+// Audit actions for plain writes. Other writes are recorded under the name of
+// the operation, such as an invoice transition.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+)
+
+// AuditEvent records one write to an entity. Before and After are the
+// entity's stored row, with its lines, as JSON with amounts in minor units;
+// Before is null for a create and After for a delete. Changes lists the
+// fields that differ between them.
+type AuditEvent struct {
+	ID        int                    `json:"id"`
+	Actor     string                 `json:"actor"`
+	Entity    string                 `json:"entity"`
+	EntityID  int                    `json:"entity_id"`
+	Action    string                 `json:"action"`
+	Before    json.RawMessage        `json:"before"`
+	After     json.RawMessage        `json:"after"`
+	Changes   map[string]AuditChange `json:"changes"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+type AuditChange struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// User is an account, which can be a member of several organizations. Role
+// is the user's role in the organization a request works in.
+type User struct {
+	ID         int        `json:"id"`
+	Email      string     `json:"email"`
+	Name       string     `json:"name"`
+	Role       string     `json:"role,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+
+	// Permissions the role grants and the organization the request works
+	// in; only filled in for the signed-in user
+	Permissions    []string `json:"permissions,omitempty"`
+	OrganizationID int      `json:"organization_id,omitempty"`
+}
+
+type CreateUserRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type SetUserRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// Organization is a company whose books are kept on this server. Current is
+// set on the organization a request works in.
+type Organization struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrganizationMemberRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// Reasons a request can be refused with 403 Forbidden
+const (
+	ForbiddenRole       = "role_not_permitted"
+	ForbiddenTokenScope = "token_scope_missing"
+	ForbiddenToken      = "token_not_allowed"
+
+	ForbiddenOrganization   = "organization_not_member"
+	ForbiddenNoOrganization = "no_organization"
+)
+
+// ForbiddenError is the body of a 403 Forbidden response, so clients can
+// tell why without parsing the message.
+type ForbiddenError struct {
+	Error      string `json:"error"`
+	Reason     string `json:"reason"`
+	Permission string `json:"permission,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Scope      string `json:"scope,omitempty"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// APIToken lets scripts call the API as a user, limited to its Scopes. Token
+// is the secret itself and is only returned when the token is created.
+type APIToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPITokenRequest.ExpiresInDays is optional; without it the token
+// lasts until revoked.
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays *int     `json:"expires_in_days,omitempty"`
+}
+
+// CompanyProfile is the organization as the seller on its documents. HasLogo
+// reports whether a logo has been uploaded; it is served separately.
+type CompanyProfile struct {
+	LegalName           string     `json:"legal_name"`
+	TradingName         string     `json:"trading_name"`
+	Address             string     `json:"address"`
+	Country             string     `json:"country"`
+	TaxID               string     `json:"tax_id"`
+	RegistrationNumber  string     `json:"registration_number"`
+	Email               string     `json:"email"`
+	Phone               string     `json:"phone"`
+	Website             string     `json:"website"`
+	BankName            string     `json:"bank_name"`
+	AccountHolder       string     `json:"account_holder"`
+	IBAN                string     `json:"iban"`
+	BIC                 string     `json:"bic"`
+	PaymentInstructions string     `json:"payment_instructions"`
+	PeppolID            string     `json:"peppol_id"`
+	HasLogo             bool       `json:"has_logo"`
+	UpdatedAt           *time.Time `json:"updated_at"`
+}
+
+// PDF template layouts
+const (
+	PDFLayoutClassic = "classic"
+	PDFLayoutModern  = "modern"
+	PDFLayoutCompact = "compact"
+)
+
+// PDFTemplate styles the PDFs of invoices, credit notes and quotes. Colors
+// are "#rrggbb"; Font is one of the core PDF fonts.
+type PDFTemplate struct {
+	ID           int               `json:"id"`
+	Name         string            `json:"name"`
+	Layout       string            `json:"layout"`
+	PrimaryColor string            `json:"primary_color"`
+	AccentColor  string            `json:"accent_color"`
+	Font         string            `json:"font"`
+	FooterText   string            `json:"footer_text"`
+	Fields       PDFTemplateFields `json:"fields"`
+	IsDefault    bool              `json:"is_default"`
+	CreatedAt    *time.Time        `json:"created_at"`
+	UpdatedAt    *time.Time        `json:"updated_at"`
+}
+
+// PDFTemplateFields are the optional parts of a document a template shows.
+type PDFTemplateFields struct {
+	Logo                bool `json:"logo"`
+	Seller              bool `json:"seller"`
+	CustomerDetails     bool `json:"customer_details"`
+	PaymentTerms        bool `json:"payment_terms"`
+	TaxBreakdown        bool `json:"tax_breakdown"`
+	ItemCount           bool `json:"item_count"`
+	Payments            bool `json:"payments"`
+	PaymentInstructions bool `json:"payment_instructions"`
+	GeneratedAt         bool `json:"generated_at"`
+}
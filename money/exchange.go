@@ -0,0 +1,151 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BaseCurrency is the currency product prices are kept in and reports are
+// totalled in.
+const BaseCurrency = DefaultCurrency
+
+// RateScale is the fixed-point scale of an ExchangeRate.
+const RateScale = 1000000
+
+// ExchangeRate is the number of units of a quote currency bought by one unit
+// of the base currency, held with six decimal places: 0.921500 EUR per USD
+// is stored as 921500.
+type ExchangeRate int64
+
+// IdentityRate converts a currency to itself.
+const IdentityRate ExchangeRate = RateScale
+
+func ParseExchangeRate(s string) (ExchangeRate, error) {
+	text := strings.TrimSpace(s)
+	whole, frac, hasPoint := strings.Cut(text, ".")
+	if whole == "" || hasPoint && frac == "" || len(frac) > 6 {
+		return 0, fmt.Errorf("invalid exchange rate %q: use a positive number with at most six decimals", s)
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid exchange rate %q", s)
+		}
+	}
+
+	frac += strings.Repeat("0", 6-len(frac))
+	scaled, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || scaled <= 0 {
+		return 0, fmt.Errorf("exchange rate %q must be positive", s)
+	}
+
+	return ExchangeRate(scaled), nil
+}
+
+func (r ExchangeRate) String() string {
+	return fmt.Sprintf("%d.%06d", int64(r)/RateScale, int64(r)%RateScale)
+}
+
+func (r ExchangeRate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseExchangeRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
+
+// Convert expresses a base-currency amount in currency to, where rate is the
+// number of units of to per unit of m's currency. The result is rounded to
+// the target currency's minor unit.
+func (m Money) Convert(to string, rate ExchangeRate) Money {
+	converted := m.MulRatio(int64(rate)*pow10(Digits(to)), RateScale*pow10(Digits(m.currency())))
+	converted.Currency = to
+	return converted
+}
+
+// ConvertToBase is the inverse of Convert: m is in the quote currency and the
+// result is in base, where rate is the number of units of m's currency per
+// unit of base.
+func (m Money) ConvertToBase(base string, rate ExchangeRate) Money {
+	converted := m.MulRatio(RateScale*pow10(Digits(base)), int64(rate)*pow10(Digits(m.currency())))
+	converted.Currency = base
+	return converted
+}
+
+// IsCurrencyCode reports whether code looks like an ISO 4217 code.
+func IsCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+var symbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "CN¥",
+	"INR": "₹",
+	"BRL": "R$",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"PLN": "zł",
+}
+
+// Format renders the amount for people: currency symbol, thousands
+// separators and the currency's fraction digits, e.g. "$1,234.50",
+// "¥1,235" or "AED 99.00" for currencies without a known symbol.
+func (m Money) Format() string {
+	text := m.String()
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign = "-"
+		text = text[1:]
+	}
+
+	whole, frac, hasFrac := strings.Cut(text, ".")
+	var grouped strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(r)
+	}
+	number := grouped.String()
+	if hasFrac {
+		number += "." + frac
+	}
+
+	currency := m.currency()
+	if symbol, ok := symbols[currency]; ok {
+		return sign + symbol + number
+	}
+	return sign + currency + " " + number
+}
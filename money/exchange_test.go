@@ -0,0 +1,83 @@
+package money
+
+import "testing"
+
+func TestParseExchangeRate(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    ExchangeRate
+		wantErr bool
+	}{
+		{"0.9215", 921500, false},
+		{"1", IdentityRate, false},
+		{" 149.123456 ", 149123456, false},
+		{"0", 0, true},
+		{"0.000000", 0, true},
+		{"-1", 0, true},
+		{"1.1234567", 0, true},
+		{"1.", 0, true},
+		{".5", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseExchangeRate(tt.text)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseExchangeRate(%q) = %v, want an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseExchangeRate(%q) = %v, %v, want %v", tt.text, got, err, tt.want)
+		}
+	}
+
+	if got := ExchangeRate(921500).String(); got != "0.921500" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		amount Money
+		to     string
+		rate   ExchangeRate
+		want   Money
+	}{
+		{New(10000, "USD"), "EUR", 921500, New(9215, "EUR")},
+		{New(1999, "USD"), "JPY", 149500000, New(2989, "JPY")},
+		{New(1, "USD"), "EUR", 921500, New(1, "EUR")},
+		{New(1000, "USD"), "KWD", 307000, New(3070, "KWD")},
+		{New(-10000, "USD"), "EUR", 921500, New(-9215, "EUR")},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.Convert(tt.to, tt.rate); got != tt.want {
+			t.Errorf("%v.Convert(%s, %v) = %v, want %v", tt.amount, tt.to, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestConvertToBase(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   ExchangeRate
+		want   Money
+	}{
+		{New(9215, "EUR"), 921500, New(10000, BaseCurrency)},
+		{New(2989, "JPY"), 149500000, New(1999, BaseCurrency)},
+		{New(100, "USD"), IdentityRate, New(100, BaseCurrency)},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.ConvertToBase(BaseCurrency, tt.rate); got != tt.want {
+			t.Errorf("%v.ConvertToBase(%v) = %v, want %v", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestIsCurrencyCode(t *testing.T) {
+	for code, want := range map[string]bool{"EUR": true, "usd": false, "EU": false, "EURO": false, "E1R": false} {
+		if got := IsCurrencyCode(code); got != want {
+			t.Errorf("IsCurrencyCode(%q) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency assumed for amounts that do not carry one,
+// such as product prices and legacy rows.
+const DefaultCurrency = "USD"
+
+// Currencies whose minor unit is not the usual 1/100.
+var minorUnitDigits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// Money is an exact monetary amount held as an integer count of the
+// currency's minor unit (cents for USD, yen for JPY).
+//
+// In JSON a Money is written as a plain decimal number with exactly the
+// currency's number of fraction digits, so 1999 cents encodes as 19.99. The
+// currency code travels in a sibling "currency" field of the enclosing
+// object. In SQL only the integer amount is stored.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Digits returns the number of fraction digits used by a currency.
+func Digits(currency string) int {
+	if d, ok := minorUnitDigits[strings.ToUpper(currency)]; ok {
+		return d
+	}
+	return 2
+}
+
+func (m Money) currency() string {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+// Parse reads a decimal string such as "1234.5" or "-0.99" without going
+// through float64. It rejects more fraction digits than the currency has.
+func Parse(s, currency string) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	digits := Digits(currency)
+
+	text := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(text, "-") {
+		negative = true
+		text = text[1:]
+	} else if strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(text, ".")
+	if whole == "" && frac == "" || hasPoint && frac == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > digits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", s, digits, currency)
+	}
+	for _, part := range []string{whole, frac} {
+		for _, r := range part {
+			if r < '0' || r > '9' {
+				return Money{}, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	frac += strings.Repeat("0", digits-len(frac))
+	amount, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+func (m Money) mustMatch(o Money) {
+	if m.currency() != o.currency() {
+		panic(fmt.Sprintf("money: currency mismatch %s and %s", m.currency(), o.currency()))
+	}
+}
+
+// Add returns m+o. Both amounts must be in the same currency.
+func (m Money) Add(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount + o.Amount, Currency: m.currency()}
+}
+
+// Sub returns m-o. Both amounts must be in the same currency.
+func (m Money) Sub(o Money) Money {
+	m.mustMatch(o)
+	return Money{Amount: m.Amount - o.Amount, Currency: m.currency()}
+}
+
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.currency()}
+}
+
+// MulRatio returns m*num/den rounded half away from zero, e.g.
+// MulRatio(2000, 10000) for 20%.
+func (m Money) MulRatio(num, den int64) Money {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num))
+	divisor := big.NewInt(den)
+	quotient, remainder := new(big.Int).QuoRem(product, divisor, new(big.Int))
+
+	// Round half away from zero: compare 2*|remainder| against |den|.
+	remainder.Abs(remainder).Mul(remainder, big.NewInt(2))
+	if remainder.Cmp(new(big.Int).Abs(divisor)) >= 0 {
+		if (product.Sign() < 0) != (divisor.Sign() < 0) {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: m.currency()}
+}
+
+// Allocate splits m across parts in proportion to weights, using the
+// largest-remainder method so the parts always sum exactly to m. When all
+// weights are zero the whole amount goes to the first part.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	for i := range parts {
+		parts[i] = Zero(m.currency())
+	}
+	if len(weights) == 0 {
+		return parts
+	}
+
+	total := big.NewInt(0)
+	for _, w := range weights {
+		total.Add(total, big.NewInt(w))
+	}
+	if total.Sign() == 0 {
+		parts[0].Amount = m.Amount
+		return parts
+	}
+
+	sign := int64(1)
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	allocated := int64(0)
+	for i, w := range weights {
+		share, remainder := new(big.Int).QuoRem(new(big.Int).Mul(big.NewInt(amount), big.NewInt(w)), total, new(big.Int))
+		parts[i].Amount = share.Int64()
+		remainders[i] = remainder
+		allocated += share.Int64()
+	}
+
+	// Hand out what truncation left over, one minor unit at a time, to the
+	// parts that lost the most.
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	for i := 0; allocated < amount; i++ {
+		parts[order[i%len(order)]].Amount++
+		allocated++
+	}
+
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+	return parts
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.currency()}
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// Zero returns a zero amount in the given currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// String formats the amount as a plain decimal, e.g. "1234.50".
+func (m Money) String() string {
+	digits := Digits(m.currency())
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if digits == 0 {
+		return sign + strconv.FormatInt(amount, 10)
+	}
+
+	text := strconv.FormatInt(amount, 10)
+	if len(text) <= digits {
+		text = strings.Repeat("0", digits-len(text)+1) + text
+	}
+	return sign + text[:len(text)-digits] + "." + text[len(text)-digits:]
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a numeric string. The amount is
+// read in m.Currency (or DefaultCurrency when unset).
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := Parse(text, m.currency())
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value stores the integer minor-unit amount.
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan reads an integer minor-unit amount. The currency is left untouched;
+// callers set it from the row's currency column.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case int64:
+		m.Amount = v
+	case nil:
+		m.Amount = 0
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	return nil
+}
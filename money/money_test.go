@@ -0,0 +1,231 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text     string
+		currency string
+		want     int64
+		wantErr  bool
+	}{
+		{"19.99", "USD", 1999, false},
+		{"1234.5", "USD", 123450, false},
+		{"7", "USD", 700, false},
+		{".5", "USD", 50, false},
+		{" -0.99 ", "USD", -99, false},
+		{"+3.10", "EUR", 310, false},
+		{"1235", "JPY", 1235, false},
+		{"1.234", "BHD", 1234, false},
+		{"", "", 0, true},
+		{"1.", "USD", 0, true},
+		{".", "USD", 0, true},
+		{"1.999", "USD", 0, true},
+		{"1.5", "JPY", 0, true},
+		{"1,000.00", "USD", 0, true},
+		{"1e3", "USD", 0, true},
+		{"--1", "USD", 0, true},
+		{"99999999999999999999", "USD", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, tt.currency)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Parse(%q, %q) = %v, want an error", tt.text, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q, %q): %v", tt.text, tt.currency, err)
+			continue
+		}
+		if got.Amount != tt.want || got.Currency != tt.currency {
+			t.Errorf("Parse(%q, %q) = %d %s, want %d %s", tt.text, tt.currency, got.Amount, got.Currency, tt.want, tt.currency)
+		}
+	}
+}
+
+func TestParseDefaultsCurrency(t *testing.T) {
+	got, err := Parse("1.50", "")
+	if err != nil || got != New(150, DefaultCurrency) {
+		t.Errorf("Parse(\"1.50\", \"\") = %v, %v, want 150 %s", got, err, DefaultCurrency)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(1999, "USD"), "19.99"},
+		{New(5, "USD"), "0.05"},
+		{New(0, "USD"), "0.00"},
+		{New(-7, "EUR"), "-0.07"},
+		{New(-123456, "EUR"), "-1234.56"},
+		{New(1235, "JPY"), "1235"},
+		{New(1234, "KWD"), "1.234"},
+		{New(42, ""), "0.42"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(123450, "USD"), "$1,234.50"},
+		{New(123456789, "EUR"), "€1,234,567.89"},
+		{New(-100, "GBP"), "-£1.00"},
+		{New(1235, "JPY"), "¥1,235"},
+		{New(9900, "AED"), "AED 99.00"},
+		{New(99, "USD"), "$0.99"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Format(); got != tt.want {
+			t.Errorf("%#v.Format() = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestMulRatio(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{1000, 2000, 10000, 200},
+		// Half a cent rounds away from zero
+		{25, 1, 10, 3},
+		{-25, 1, 10, -3},
+		{24, 1, 10, 2},
+		{-24, 1, 10, -2},
+		{25, -1, 10, -3},
+		{1, 1, 3, 0},
+		{2, 1, 3, 1},
+		// Products beyond int64 are exact
+		{1 << 40, 1 << 30, 1 << 32, 1 << 38},
+	}
+	for _, tt := range tests {
+		if got := New(tt.amount, "USD").MulRatio(tt.num, tt.den); got.Amount != tt.want {
+			t.Errorf("%d.MulRatio(%d, %d) = %d, want %d", tt.amount, tt.num, tt.den, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{-100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		// Equal remainders go to the earlier part
+		{1000, []int64{1999, 1, 0}, []int64{1000, 0, 0}},
+		{5, []int64{1, 3}, []int64{1, 4}},
+		{7, []int64{0, 0}, []int64{7, 0}},
+		{0, []int64{5, 5}, []int64{0, 0}},
+		{2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{42, nil, []int64{}},
+	}
+	for _, tt := range tests {
+		parts := New(tt.amount, "EUR").Allocate(tt.weights)
+		if len(parts) != len(tt.want) {
+			t.Errorf("%d.Allocate(%v) has %d parts, want %d", tt.amount, tt.weights, len(parts), len(tt.want))
+			continue
+		}
+		sum := int64(0)
+		for _, part := range parts {
+			sum += part.Amount
+		}
+		for i, part := range parts {
+			if part.Amount != tt.want[i] || part.Currency != "EUR" {
+				t.Errorf("%d.Allocate(%v) = %v, want %v", tt.amount, tt.weights, parts, tt.want)
+				break
+			}
+		}
+		if len(parts) > 0 && sum != tt.amount {
+			t.Errorf("%d.Allocate(%v) sums to %d", tt.amount, tt.weights, sum)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := New(1050, "EUR"), New(75, "EUR")
+	if got := a.Add(b); got != New(1125, "EUR") {
+		t.Errorf("Add = %v", got)
+	}
+	if got := b.Sub(a); got != New(-975, "EUR") || !got.IsNegative() {
+		t.Errorf("Sub = %v", got)
+	}
+	if got := b.Mul(3); got != New(225, "EUR") {
+		t.Errorf("Mul = %v", got)
+	}
+	if got := a.Neg(); got != New(-1050, "EUR") {
+		t.Errorf("Neg = %v", got)
+	}
+	if !Zero("EUR").IsZero() || Zero("EUR").IsPositive() || !a.IsPositive() {
+		t.Error("IsZero and IsPositive disagree with the amounts")
+	}
+	// A missing currency is the default one
+	if got := New(1, "").Add(New(2, DefaultCurrency)); got != New(3, DefaultCurrency) {
+		t.Errorf("Add without a currency = %v", got)
+	}
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("adding EUR to USD did not panic")
+		}
+	}()
+	New(1, "EUR").Add(New(1, "USD"))
+}
+
+func TestJSON(t *testing.T) {
+	var item struct {
+		Price Money `json:"price"`
+	}
+	for _, text := range []string{`{"price": 19.99}`, `{"price": "19.99"}`} {
+		item.Price = Money{}
+		if err := json.Unmarshal([]byte(text), &item); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", text, err)
+		}
+		if item.Price != New(1999, DefaultCurrency) {
+			t.Errorf("Unmarshal(%s) = %v", text, item.Price)
+		}
+	}
+
+	item.Price = Money{Currency: "JPY"}
+	if err := json.Unmarshal([]byte(`{"price": 1.5}`), &item); err == nil {
+		t.Error("Unmarshal accepted 1.5 JPY")
+	}
+
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{New(5, "USD")})
+	if err != nil || string(data) != `{"price":0.05}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	m := Money{Currency: "EUR"}
+	if err := m.Scan(int64(1234)); err != nil || m != New(1234, "EUR") {
+		t.Errorf("Scan(1234) = %v, %v", m, err)
+	}
+	if err := m.Scan(nil); err != nil || m != New(0, "EUR") {
+		t.Errorf("Scan(nil) = %v, %v", m, err)
+	}
+	if err := m.Scan("12.34"); err == nil {
+		t.Error("Scan accepted a string")
+	}
+}
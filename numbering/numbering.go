@@ -0,0 +1,143 @@
+package numbering
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultWidth is the number of digits {seq} is padded to when the pattern
+// does not give one.
+const defaultWidth = 1
+
+const maxWidth = 12
+
+// Pattern formats document numbers such as "INV-{YYYY}-{seq:5}". It supports
+// the placeholders {YYYY}, {YY}, {MM} and {seq} or {seq:N}, where N is the
+// zero-padded width of the sequence number. Everything else is copied as is.
+//
+// A pattern containing a year is counted per year, otherwise there is one
+// counter for the whole series; see Period.
+type Pattern struct {
+	text  string
+	parts []part
+	year  bool
+}
+
+type part struct {
+	literal string
+	token   string
+	width   int
+}
+
+// Parse checks a pattern. It must contain exactly one {seq} and literal text
+// may only use letters, digits and "-", "_" or "." so that numbers can be used
+// in URLs and file names.
+func Parse(text string) (Pattern, error) {
+	p := Pattern{text: text}
+	seqCount := 0
+
+	rest := text
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			open = len(rest)
+		}
+		if open > 0 {
+			literal := rest[:open]
+			for _, r := range literal {
+				if !isLiteralRune(r) {
+					return Pattern{}, fmt.Errorf("invalid character %q in pattern", r)
+				}
+			}
+			p.parts = append(p.parts, part{literal: literal})
+			rest = rest[open:]
+			continue
+		}
+
+		end := strings.IndexByte(rest, '}')
+		if end < 0 {
+			return Pattern{}, fmt.Errorf("unclosed placeholder in pattern")
+		}
+		token := rest[1:end]
+		rest = rest[end+1:]
+
+		switch {
+		case token == "YYYY" || token == "YY":
+			p.year = true
+			p.parts = append(p.parts, part{token: token})
+		case token == "MM":
+			p.parts = append(p.parts, part{token: token})
+		case token == "seq" || strings.HasPrefix(token, "seq:"):
+			width := defaultWidth
+			if token != "seq" {
+				n, err := strconv.Atoi(strings.TrimPrefix(token, "seq:"))
+				if err != nil || n < 1 || n > maxWidth {
+					return Pattern{}, fmt.Errorf("invalid sequence width in {%s}: must be between 1 and %d", token, maxWidth)
+				}
+				width = n
+			}
+			seqCount++
+			p.parts = append(p.parts, part{token: "seq", width: width})
+		default:
+			return Pattern{}, fmt.Errorf("unknown placeholder {%s}", token)
+		}
+	}
+
+	if seqCount != 1 {
+		return Pattern{}, fmt.Errorf("pattern must contain {seq} exactly once")
+	}
+	if p.hasMonth() && !p.year {
+		return Pattern{}, fmt.Errorf("pattern with {MM} must also contain {YYYY} or {YY}")
+	}
+
+	return p, nil
+}
+
+func isLiteralRune(r rune) bool {
+	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' ||
+		r == '-' || r == '_' || r == '.'
+}
+
+func (p Pattern) hasMonth() bool {
+	for _, part := range p.parts {
+		if part.token == "MM" {
+			return true
+		}
+	}
+	return false
+}
+
+// Period is the counter a document dated t draws its number from: its year
+// for patterns that contain one, otherwise "".
+func (p Pattern) Period(t time.Time) string {
+	if p.year {
+		return strconv.Itoa(t.Year())
+	}
+	return ""
+}
+
+// Format returns the number for a document dated t with sequence number seq.
+func (p Pattern) Format(t time.Time, seq int64) string {
+	var b strings.Builder
+	for _, part := range p.parts {
+		switch part.token {
+		case "":
+			b.WriteString(part.literal)
+		case "YYYY":
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case "YY":
+			fmt.Fprintf(&b, "%02d", t.Year()%100)
+		case "MM":
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case "seq":
+			fmt.Fprintf(&b, "%0*d", part.width, seq)
+		}
+	}
+	return b.String()
+}
+
+func (p Pattern) String() string {
+	return p.text
+}
@@ -0,0 +1,58 @@
+package numbering
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	at := time.Date(2026, 3, 9, 15, 4, 5, 0, time.UTC)
+	tests := []struct {
+		pattern string
+		seq     int64
+		want    string
+		period  string
+	}{
+		{"INV-{YYYY}-{seq:5}", 42, "INV-2026-00042", "2026"},
+		{"INV-{YY}{MM}-{seq:3}", 7, "INV-2603-007", "2026"},
+		{"{seq}", 123, "123", ""},
+		{"CN.{seq:2}", 123, "CN.123", ""},
+		{"Q_{YYYY}_{MM}_{seq:4}", 1, "Q_2026_03_0001", "2026"},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.pattern)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := p.Format(at, tt.seq); got != tt.want {
+			t.Errorf("Parse(%q).Format = %q, want %q", tt.pattern, got, tt.want)
+		}
+		if got := p.Period(at); got != tt.period {
+			t.Errorf("Parse(%q).Period = %q, want %q", tt.pattern, got, tt.period)
+		}
+		if p.String() != tt.pattern {
+			t.Errorf("Parse(%q).String() = %q", tt.pattern, p.String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, pattern := range []string{
+		"",
+		"INV-{YYYY}",
+		"{seq}-{seq}",
+		"INV {seq}",
+		"INV/{seq}",
+		"{seq:0}",
+		"{seq:13}",
+		"{seq:x}",
+		"{seq",
+		"{DD}-{seq}",
+		"{MM}-{seq}",
+	} {
+		if _, err := Parse(pattern); err == nil {
+			t.Errorf("Parse(%q) accepted it", pattern)
+		}
+	}
+}
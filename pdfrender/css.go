@@ -0,0 +1,675 @@
+package pdfrender
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// userAgentCSS is the default styling of elements, as in a browser.
+const userAgentCSS = `
+html, body, div, p, h1, h2, h3, h4, h5, h6, ul, ol, li, header, footer, section, address, blockquote { display: block }
+head, style, title, script, meta, link { display: none }
+table { display: table }
+thead, tbody, tfoot { display: table-row-group }
+tr { display: table-row }
+td, th { display: table-cell; padding: 1px; vertical-align: middle }
+th { font-weight: bold; text-align: center }
+body { margin: 8px }
+h1 { font-size: 2em; margin: 0.67em 0; font-weight: bold }
+h2 { font-size: 1.5em; margin: 0.83em 0; font-weight: bold }
+h3 { font-size: 1.17em; margin: 1em 0; font-weight: bold }
+h4, h5, h6 { margin: 1.33em 0; font-weight: bold }
+p { margin: 1em 0 }
+b, strong { font-weight: bold }
+i, em { font-style: italic }
+`
+
+const (
+	mmPerPx = 25.4 / 96
+	mmPerPt = 25.4 / 72
+)
+
+type color struct {
+	r, g, b int
+}
+
+var namedColors = map[string]color{
+	"black":  {0, 0, 0},
+	"white":  {255, 255, 255},
+	"red":    {255, 0, 0},
+	"green":  {0, 128, 0},
+	"blue":   {0, 0, 255},
+	"gray":   {128, 128, 128},
+	"grey":   {128, 128, 128},
+	"silver": {192, 192, 192},
+	"maroon": {128, 0, 0},
+	"navy":   {0, 0, 128},
+	"orange": {255, 165, 0},
+	"yellow": {255, 255, 0},
+	"purple": {128, 0, 128},
+	"teal":   {0, 128, 128},
+}
+
+// parseColor reads a color name, #rgb, #rrggbb or rgb(r, g, b).
+func parseColor(v string) (color, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if c, ok := namedColors[v]; ok {
+		return c, true
+	}
+	var c color
+	switch {
+	case len(v) == 7 && v[0] == '#':
+		if _, err := fmt.Sscanf(v, "#%02x%02x%02x", &c.r, &c.g, &c.b); err != nil {
+			return c, false
+		}
+	case len(v) == 4 && v[0] == '#':
+		if _, err := fmt.Sscanf(v, "#%1x%1x%1x", &c.r, &c.g, &c.b); err != nil {
+			return c, false
+		}
+		c.r, c.g, c.b = c.r*17, c.g*17, c.b*17
+	case strings.HasPrefix(v, "rgb(") && strings.HasSuffix(v, ")"):
+		parts := strings.Split(v[4:len(v)-1], ",")
+		if len(parts) != 3 {
+			return c, false
+		}
+		var rgb [3]int
+		for i, p := range parts {
+			n, err := strconv.Atoi(strings.TrimSpace(p))
+			if err != nil {
+				return c, false
+			}
+			rgb[i] = n
+		}
+		c = color{rgb[0], rgb[1], rgb[2]}
+	default:
+		return c, false
+	}
+	return c, true
+}
+
+// length is a CSS length in mm, a percentage of the containing block's
+// width, or auto.
+type length struct {
+	value   float64
+	percent bool
+	auto    bool
+}
+
+// resolve is l in mm within a containing block width wide; auto is 0.
+func (l length) resolve(width float64) float64 {
+	if l.percent {
+		return width * l.value / 100
+	}
+	return l.value
+}
+
+// parseLength reads a length; em units are relative to fontSize, in pt.
+func parseLength(v string, fontSize float64) (length, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "auto" {
+		return length{auto: true}, true
+	}
+	if v == "0" {
+		return length{}, true
+	}
+
+	units := []struct {
+		suffix string
+		mm     float64
+	}{
+		{"px", mmPerPx}, {"pt", mmPerPt}, {"mm", 1}, {"cm", 10}, {"in", 25.4},
+		{"rem", 16 * mmPerPx}, {"em", fontSize * mmPerPt}, {"%", 1},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(v, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(v, u.suffix), 64)
+		if err != nil {
+			return length{}, false
+		}
+		return length{value: n * u.mm, percent: u.suffix == "%"}, true
+	}
+	return length{}, false
+}
+
+type border struct {
+	width float64
+	color color
+}
+
+// style is an element's computed style: the subset of CSS the native
+// renderer understands.
+type style struct {
+	display string
+
+	// Inherited
+	color         color
+	font          string  // a CSS font-family list
+	fontSize      float64 // pt
+	bold, italic  bool
+	lineHeight    float64 // as a multiple of fontSize
+	textAlign     string
+	textTransform string
+	whiteSpace    string
+
+	background      *color
+	verticalAlign   string
+	tableLayout     string
+	pageBreakInside string
+	margin          [4]length // top, right, bottom, left
+	padding         [4]length
+	border          [4]border
+	width           *length
+	height          *length
+	maxWidth        *length
+	maxHeight       *length
+}
+
+// rootStyle is the style the document root starts from.
+func rootStyle() *style {
+	return &style{
+		display:    "block",
+		font:       "times",
+		fontSize:   12,
+		lineHeight: 1.2,
+		textAlign:  "left",
+		whiteSpace: "normal",
+	}
+}
+
+// inherit is the style of an element whose parent has style s, before its
+// own declarations apply.
+func (s *style) inherit() *style {
+	return &style{
+		display:       "inline",
+		color:         s.color,
+		font:          s.font,
+		fontSize:      s.fontSize,
+		bold:          s.bold,
+		italic:        s.italic,
+		lineHeight:    s.lineHeight,
+		textAlign:     s.textAlign,
+		textTransform: s.textTransform,
+		whiteSpace:    s.whiteSpace,
+		verticalAlign: "baseline",
+	}
+}
+
+// fontStyle is the gofpdf style string of a font's weight and slant.
+func fontStyle(bold, italic bool) string {
+	fs := ""
+	if bold {
+		fs += "B"
+	}
+	if italic {
+		fs += "I"
+	}
+	return fs
+}
+
+// fontFamily maps a CSS font-family list, or a font's family name, to the
+// core font it is closest to.
+func fontFamily(v string) string {
+	for _, family := range strings.Split(strings.ToLower(v), ",") {
+		family = strings.Trim(strings.TrimSpace(family), `'"`)
+		switch {
+		case strings.Contains(family, "courier") || strings.Contains(family, "mono"):
+			return "courier"
+		case strings.Contains(family, "times") || strings.Contains(family, "georgia") ||
+			strings.Contains(family, "serif") && !strings.Contains(family, "sans"):
+			return "times"
+		case strings.Contains(family, "helvetica") || strings.Contains(family, "arial") || strings.Contains(family, "sans"):
+			return "helvetica"
+		}
+	}
+	return "helvetica"
+}
+
+// fontSize reads a font-size, in pt, for an element whose parent's font
+// size is parent.
+func fontSize(v string, parent float64) (float64, bool) {
+	keywords := map[string]float64{
+		"xx-small": 9, "x-small": 10, "small": 13, "medium": 16,
+		"large": 18, "x-large": 24, "xx-large": 32,
+	}
+	v = strings.ToLower(strings.TrimSpace(v))
+	if px, ok := keywords[v]; ok {
+		return px * 0.75, true
+	}
+	switch v {
+	case "smaller":
+		return parent / 1.2, true
+	case "larger":
+		return parent * 1.2, true
+	}
+	l, ok := parseLength(v, parent)
+	if !ok || l.auto {
+		return 0, false
+	}
+	if l.percent {
+		return parent * l.value / 100, true
+	}
+	return l.value / mmPerPt, true
+}
+
+// boxSides expands the one to four values of a margin or padding shorthand
+// to top, right, bottom and left.
+func boxSides(v string, fontSize float64) ([4]length, bool) {
+	var sides [4]length
+	var values []length
+	for _, f := range strings.Fields(v) {
+		l, ok := parseLength(f, fontSize)
+		if !ok {
+			return sides, false
+		}
+		values = append(values, l)
+	}
+	switch len(values) {
+	case 1:
+		sides = [4]length{values[0], values[0], values[0], values[0]}
+	case 2:
+		sides = [4]length{values[0], values[1], values[0], values[1]}
+	case 3:
+		sides = [4]length{values[0], values[1], values[2], values[1]}
+	case 4:
+		sides = [4]length{values[0], values[1], values[2], values[3]}
+	default:
+		return sides, false
+	}
+	return sides, true
+}
+
+// parseBorder reads a border shorthand such as "1px solid #ddd".
+func parseBorder(v string, s *style) border {
+	b := border{width: 3 * mmPerPx, color: s.color}
+	for _, f := range strings.Fields(strings.ToLower(v)) {
+		switch f {
+		case "none", "hidden":
+			return border{}
+		case "thin":
+			b.width = mmPerPx
+		case "medium":
+			b.width = 3 * mmPerPx
+		case "thick":
+			b.width = 5 * mmPerPx
+		case "solid", "dashed", "dotted", "double", "groove", "ridge", "inset", "outset":
+		default:
+			if l, ok := parseLength(f, s.fontSize); ok && !l.percent && !l.auto {
+				b.width = l.value
+			} else if c, ok := parseColor(f); ok {
+				b.color = c
+			}
+		}
+	}
+	return b
+}
+
+var sideNames = [4]string{"top", "right", "bottom", "left"}
+
+// apply sets one declaration on s. Values it does not understand are
+// ignored, as a browser would.
+func (s *style) apply(property, value string) {
+	switch property {
+	case "display":
+		s.display = value
+	case "color":
+		if c, ok := parseColor(value); ok {
+			s.color = c
+		}
+	case "background", "background-color":
+		if value == "none" || value == "transparent" {
+			s.background = nil
+		}
+		for _, f := range strings.Fields(value) {
+			if c, ok := parseColor(f); ok {
+				s.background = &c
+			}
+		}
+	case "font-family":
+		s.font = value
+	case "font-weight":
+		switch value {
+		case "bold", "bolder", "600", "700", "800", "900":
+			s.bold = true
+		case "normal", "lighter", "100", "200", "300", "400", "500":
+			s.bold = false
+		}
+	case "font-style":
+		s.italic = value == "italic" || value == "oblique"
+	case "line-height":
+		if value == "normal" {
+			s.lineHeight = 1.2
+		} else if n, err := strconv.ParseFloat(value, 64); err == nil {
+			s.lineHeight = n
+		} else if l, ok := parseLength(value, s.fontSize); ok && !l.auto {
+			if l.percent {
+				s.lineHeight = l.value / 100
+			} else {
+				s.lineHeight = l.value / (s.fontSize * mmPerPt)
+			}
+		}
+	case "text-align":
+		s.textAlign = value
+	case "text-transform":
+		s.textTransform = value
+	case "white-space":
+		s.whiteSpace = value
+	case "vertical-align":
+		s.verticalAlign = value
+	case "table-layout":
+		s.tableLayout = value
+	case "page-break-inside", "break-inside":
+		s.pageBreakInside = value
+	case "margin":
+		if sides, ok := boxSides(value, s.fontSize); ok {
+			s.margin = sides
+		}
+	case "padding":
+		if sides, ok := boxSides(value, s.fontSize); ok {
+			s.padding = sides
+		}
+	case "border":
+		b := parseBorder(value, s)
+		s.border = [4]border{b, b, b, b}
+	case "width", "height", "max-width", "max-height":
+		l, ok := parseLength(value, s.fontSize)
+		if !ok {
+			if value == "none" && strings.HasPrefix(property, "max-") {
+				l, ok = length{auto: true}, true
+			} else {
+				return
+			}
+		}
+		switch property {
+		case "width":
+			s.width = &l
+		case "height":
+			s.height = &l
+		case "max-width":
+			s.maxWidth = &l
+		case "max-height":
+			s.maxHeight = &l
+		}
+	default:
+		for i, side := range sideNames {
+			switch property {
+			case "margin-" + side:
+				if l, ok := parseLength(value, s.fontSize); ok {
+					s.margin[i] = l
+				}
+			case "padding-" + side:
+				if l, ok := parseLength(value, s.fontSize); ok {
+					s.padding[i] = l
+				}
+			case "border-" + side:
+				s.border[i] = parseBorder(value, s)
+			}
+		}
+	}
+}
+
+type declaration struct {
+	property, value string
+}
+
+// parseDeclarations reads the body of a rule or a style attribute.
+func parseDeclarations(body string) []declaration {
+	var decls []declaration
+	for _, d := range strings.Split(body, ";") {
+		property, value, ok := strings.Cut(d, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		decls = append(decls, declaration{strings.ToLower(strings.TrimSpace(property)), value})
+	}
+	return decls
+}
+
+// compound is a selector for a single element, such as td.total:first-child.
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	pseudos []string
+}
+
+func (c compound) matches(n *node) bool {
+	if n.tag == "" || n.tag == "#document" || (c.tag != "" && c.tag != "*" && c.tag != n.tag) {
+		return false
+	}
+	if c.id != "" && n.attrs["id"] != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !n.hasClass(class) {
+			return false
+		}
+	}
+	for _, p := range c.pseudos {
+		position, last := n.position(), 0
+		for _, sibling := range n.parent.children {
+			if sibling.tag != "" {
+				last++
+			}
+		}
+		switch p {
+		case "first-child":
+			if position != 1 {
+				return false
+			}
+		case "last-child":
+			if position != last {
+				return false
+			}
+		case "nth-child(odd)":
+			if position%2 != 1 {
+				return false
+			}
+		case "nth-child(even)":
+			if position%2 != 0 {
+				return false
+			}
+		default:
+			var nth int
+			if _, err := fmt.Sscanf(p, "nth-child(%d)", &nth); err != nil || position != nth {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// selector is a chain of compound selectors joined by descendant (' ') or
+// child ('>') combinators.
+type selector struct {
+	parts       []compound
+	combinators []byte
+	specificity int
+}
+
+func (s selector) matches(n *node) bool {
+	return s.matchFrom(len(s.parts)-1, n)
+}
+
+func (s selector) matchFrom(i int, n *node) bool {
+	if !s.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	if s.combinators[i-1] == '>' {
+		return n.parent != nil && s.matchFrom(i-1, n.parent)
+	}
+	for p := n.parent; p != nil; p = p.parent {
+		if s.matchFrom(i-1, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSelector reads one selector of a list, reporting false for those
+// using features the renderer lacks, which then never match.
+func parseSelector(text string) (selector, bool) {
+	var s selector
+	combinator := byte(' ')
+	for _, token := range strings.Fields(strings.ReplaceAll(text, ">", " > ")) {
+		if token == ">" {
+			combinator = '>'
+			continue
+		}
+		if strings.ContainsAny(token, "[+~") || strings.Contains(token, "::") {
+			return s, false
+		}
+
+		var c compound
+		rest := token
+		for rest != "" {
+			end := strings.IndexAny(rest[1:], ".#:") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			part := rest[:end]
+			rest = rest[end:]
+			switch part[0] {
+			case '.':
+				c.classes = append(c.classes, part[1:])
+				s.specificity += 10
+			case '#':
+				c.id = part[1:]
+				s.specificity += 100
+			case ':':
+				c.pseudos = append(c.pseudos, part[1:])
+				s.specificity += 10
+			default:
+				c.tag = strings.ToLower(part)
+				if c.tag != "*" {
+					s.specificity++
+				}
+			}
+		}
+
+		if len(s.parts) > 0 {
+			s.combinators = append(s.combinators, combinator)
+		}
+		s.parts = append(s.parts, c)
+		combinator = ' '
+	}
+	return s, len(s.parts) > 0
+}
+
+// rule is one selector of a style rule with its declarations. Rules of the
+// user agent stylesheet give way to the document's whatever their
+// specificity.
+type rule struct {
+	selector     selector
+	declarations []declaration
+	userAgent    bool
+}
+
+// parseStylesheet appends the rules in css to rules. At-rules such as
+// @media and @page are skipped.
+func parseStylesheet(rules []rule, css string, userAgent bool) []rule {
+	for {
+		start := strings.Index(css, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(css[start+2:], "*/")
+		if end < 0 {
+			css = css[:start]
+			break
+		}
+		css = css[:start] + " " + css[start+2+end+2:]
+	}
+
+	for {
+		open := strings.Index(css, "{")
+		if open < 0 {
+			return rules
+		}
+		prelude := strings.TrimSpace(css[:open])
+
+		// Find the matching brace, as at-rules can nest blocks
+		depth, close := 0, -1
+		for i := open; i < len(css) && close < 0; i++ {
+			switch css[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					close = i
+				}
+			}
+		}
+		if close < 0 {
+			return rules
+		}
+		body := css[open+1 : close]
+		css = css[close+1:]
+
+		if strings.HasPrefix(prelude, "@") {
+			continue
+		}
+		declarations := parseDeclarations(body)
+		for _, text := range strings.Split(prelude, ",") {
+			if s, ok := parseSelector(text); ok {
+				rules = append(rules, rule{s, declarations, userAgent})
+			}
+		}
+	}
+}
+
+// cascade computes the style of n and everything below it from the rules,
+// in increasing priority, and each element's style attribute.
+func cascade(n *node, rules []rule, parent *style) {
+	if n.tag == "" {
+		return
+	}
+	if n.tag == "#document" {
+		n.style = rootStyle()
+	} else {
+		var matched []rule
+		for _, r := range rules {
+			if r.selector.matches(n) {
+				matched = append(matched, r)
+			}
+		}
+		sort.SliceStable(matched, func(i, j int) bool {
+			if matched[i].userAgent != matched[j].userAgent {
+				return matched[i].userAgent
+			}
+			return matched[i].selector.specificity < matched[j].selector.specificity
+		})
+		var declarations []declaration
+		for _, r := range matched {
+			declarations = append(declarations, r.declarations...)
+		}
+		declarations = append(declarations, parseDeclarations(n.attrs["style"])...)
+
+		// Other lengths are relative to the element's own font size, so it
+		// goes first
+		s := parent.inherit()
+		for _, d := range declarations {
+			if d.property == "font-size" {
+				if size, ok := fontSize(d.value, parent.fontSize); ok {
+					s.fontSize = size
+				}
+			}
+		}
+		for _, d := range declarations {
+			s.apply(d.property, strings.ToLower(d.value))
+		}
+		n.style = s
+	}
+
+	for _, c := range n.children {
+		cascade(c, rules, n.style)
+	}
+}
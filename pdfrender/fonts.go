@@ -0,0 +1,304 @@
+package pdfrender
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf16"
+)
+
+// fontFace is a font text can be set in: one of the core PDF fonts, limited
+// to Windows-1252, or a TrueType font from the font directory, embedded in
+// the PDF with the characters used.
+type fontFace struct {
+	family       string
+	bold, italic bool
+	path         string    // "" for a core font
+	ranges       [][2]rune // the characters a TrueType font has, in order
+}
+
+// name is the family the face is registered with gofpdf under.
+func (f *fontFace) name() string {
+	if f.path == "" {
+		return f.family
+	}
+	return "ttf-" + strings.ToLower(strings.ReplaceAll(f.family, " ", ""))
+}
+
+// style is the gofpdf style string of the face.
+func (f *fontFace) style() string {
+	return fontStyle(f.bold, f.italic)
+}
+
+// covers reports whether the face has a glyph for r.
+func (f *fontFace) covers(r rune) bool {
+	if f.path == "" {
+		return inWindows1252(r)
+	}
+	i, _ := slices.BinarySearchFunc(f.ranges, r, func(rg [2]rune, r rune) int {
+		if rg[1] < r {
+			return -1
+		}
+		if rg[0] > r {
+			return 1
+		}
+		return 0
+	})
+	return i < len(f.ranges) && f.ranges[i][0] <= r && r <= f.ranges[i][1]
+}
+
+// coreFaces are the core fonts by name and style.
+var coreFaces = map[string]*fontFace{}
+
+func init() {
+	for _, family := range []string{"helvetica", "times", "courier"} {
+		for _, bold := range []bool{false, true} {
+			for _, italic := range []bool{false, true} {
+				coreFaces[family+fontStyle(bold, italic)] = &fontFace{family: family, bold: bold, italic: italic}
+			}
+		}
+	}
+}
+
+// windows1252 are the characters Windows-1252 has between 0x80 and 0x9f.
+const windows1252 = "€‚ƒ„…†‡ˆ‰Š‹ŒŽ‘’“”•–—˜™š›œžŸ"
+
+func inWindows1252(r rune) bool {
+	return r >= 0x20 && r < 0x7f || r >= 0xa0 && r <= 0xff || strings.ContainsRune(windows1252, r)
+}
+
+// fontSet is the TrueType fonts in the font directory, in the order they are
+// tried for characters a text's own font lacks.
+type fontSet []*fontFace
+
+// loadFonts reads every TrueType font in dir and its subdirectories. Other
+// files are ignored, as are further fonts of a family and style already
+// found.
+func loadFonts(dir string) (fontSet, error) {
+	var fonts fontSet
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".ttf") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := parseTrueType(data)
+		if err != nil {
+			return fmt.Errorf("font %s: %v", path, err)
+		}
+		f.path = path
+		for _, other := range fonts {
+			if strings.EqualFold(other.family, f.family) && other.style() == f.style() {
+				return nil
+			}
+		}
+		fonts = append(fonts, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(fonts) == 0 {
+		return nil, fmt.Errorf("no TrueType fonts in %s", dir)
+	}
+	return fonts, nil
+}
+
+// face is the font for text in a CSS font-family list and weight: the first
+// family in the list that is in the set, or else the first Latin font in the
+// set of the same kind, sans-serif, serif or monospace, as the core font the
+// list maps to, or else that core font.
+func (fonts fontSet) face(families string, bold, italic bool) *fontFace {
+	for _, family := range strings.Split(families, ",") {
+		family = strings.Trim(strings.TrimSpace(family), `'"`)
+		if f := fonts.match(bold, italic, func(f *fontFace) bool { return strings.EqualFold(f.family, family) }); f != nil {
+			return f
+		}
+	}
+	core := fontFamily(families)
+	if f := fonts.match(bold, italic, func(f *fontFace) bool { return fontFamily(f.family) == core && f.covers('a') }); f != nil {
+		return f
+	}
+	return coreFaces[core+fontStyle(bold, italic)]
+}
+
+// fallback is the first font in the set with a glyph for r, or nil.
+func (fonts fontSet) fallback(r rune, bold, italic bool) *fontFace {
+	return fonts.match(bold, italic, func(f *fontFace) bool { return f.covers(r) })
+}
+
+// match is the first font that ok accepts, in the weight and slant asked
+// for if there is one and else the nearest.
+func (fonts fontSet) match(bold, italic bool, ok func(*fontFace) bool) *fontFace {
+	var best *fontFace
+	score := -1
+	for _, f := range fonts {
+		if !ok(f) {
+			continue
+		}
+		s := 0
+		if f.bold == bold {
+			s += 2
+		}
+		if f.italic == italic {
+			s++
+		}
+		if s > score {
+			best, score = f, s
+		}
+	}
+	return best
+}
+
+// parseTrueType reads a font's family, from its name table, its style, from
+// its head table, and the characters it has, from its cmap table.
+func parseTrueType(data []byte) (*fontFace, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("not a TrueType font")
+	}
+	switch string(data[:4]) {
+	case "\x00\x01\x00\x00", "true":
+	case "OTTO":
+		return nil, fmt.Errorf("PostScript outlines are not supported, use a TrueType font")
+	default:
+		return nil, fmt.Errorf("not a TrueType font")
+	}
+
+	tables := map[string][]byte{}
+	for i := 0; i < u16(data, 4); i++ {
+		rec := 12 + 16*i
+		offset, length := u32(data, rec+8), u32(data, rec+12)
+		if rec+16 > len(data) || offset+length > len(data) {
+			return nil, fmt.Errorf("truncated table directory")
+		}
+		tables[string(data[rec:rec+4])] = data[offset : offset+length]
+	}
+	for _, tag := range []string{"head", "name", "cmap", "glyf"} {
+		if tables[tag] == nil {
+			return nil, fmt.Errorf("no %s table", tag)
+		}
+	}
+
+	f := &fontFace{family: fontName(tables["name"])}
+	if f.family == "" {
+		return nil, fmt.Errorf("no family name")
+	}
+	macStyle := u16(tables["head"], 44)
+	f.bold = macStyle&1 != 0
+	f.italic = macStyle&2 != 0
+
+	f.ranges = characterRanges(tables["cmap"])
+	if len(f.ranges) == 0 {
+		return nil, fmt.Errorf("no Unicode character map")
+	}
+	return f, nil
+}
+
+// fontName is the font family name in a name table, in US English if the
+// table has it in more than one language.
+func fontName(name []byte) string {
+	family := ""
+	stringOffset := u16(name, 4)
+	for i := 0; i < u16(name, 2); i++ {
+		rec := 6 + 12*i
+		platform, encoding, language, id := u16(name, rec), u16(name, rec+2), u16(name, rec+4), u16(name, rec+6)
+		length, offset := u16(name, rec+8), stringOffset+u16(name, rec+10)
+		if id != 1 || offset+length > len(name) {
+			continue
+		}
+		s := name[offset : offset+length]
+		switch {
+		case platform == 3 && (encoding == 1 || encoding == 10):
+			units := make([]uint16, len(s)/2)
+			for j := range units {
+				units[j] = binary.BigEndian.Uint16(s[2*j:])
+			}
+			if family == "" || language == 0x409 {
+				family = string(utf16.Decode(units))
+			}
+		case platform == 1 && encoding == 0 && family == "":
+			family = string(s)
+		}
+	}
+	return strings.TrimSpace(family)
+}
+
+// characterRanges lists the characters a cmap table maps to glyphs, from its
+// full Unicode subtable if it has one and else its Basic Multilingual Plane
+// one.
+func characterRanges(cmap []byte) [][2]rune {
+	var bmp, full []byte
+	for i := 0; i < u16(cmap, 2); i++ {
+		rec := 4 + 8*i
+		platform, encoding, offset := u16(cmap, rec), u16(cmap, rec+2), u32(cmap, rec+4)
+		if offset >= len(cmap) {
+			continue
+		}
+		sub := cmap[offset:]
+		switch {
+		case u16(sub, 0) == 12 && (platform == 3 && encoding == 10 || platform == 0):
+			full = sub
+		case u16(sub, 0) == 4 && (platform == 3 && encoding == 1 || platform == 0):
+			bmp = sub
+		}
+	}
+
+	var ranges [][2]rune
+	switch {
+	case full != nil:
+		groups := u32(full, 12)
+		if 16+12*groups > len(full) {
+			return nil
+		}
+		for i := 0; i < groups; i++ {
+			g := 16 + 12*i
+			ranges = append(ranges, [2]rune{rune(u32(full, g)), rune(u32(full, g+4))})
+		}
+	case bmp != nil:
+		segments := u16(bmp, 6) / 2
+		if 16+8*segments > len(bmp) {
+			return nil
+		}
+		for i := 0; i < segments; i++ {
+			start, end := u16(bmp, 16+2*segments+2*i), u16(bmp, 14+2*i)
+			if start <= end && start != 0xffff {
+				ranges = append(ranges, [2]rune{rune(start), rune(end)})
+			}
+		}
+	}
+
+	slices.SortFunc(ranges, func(a, b [2]rune) int { return int(a[0] - b[0]) })
+	var merged [][2]rune
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], r[1])
+		} else {
+			merged = append(merged, r)
+		}
+	}
+	return merged
+}
+
+// u16 and u32 read big-endian numbers, as 0 past the end of b.
+func u16(b []byte, offset int) int {
+	if offset < 0 || offset+2 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b[offset:]))
+}
+
+func u32(b []byte, offset int) int {
+	if offset < 0 || offset+4 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b[offset:]))
+}
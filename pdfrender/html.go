@@ -0,0 +1,134 @@
+package pdfrender
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// node is an element of a parsed document, or a run of its text if tag is
+// "". Elements get their computed style before layout.
+type node struct {
+	tag      string
+	attrs    map[string]string
+	text     string
+	parent   *node
+	children []*node
+	style    *style
+}
+
+func (n *node) hasClass(class string) bool {
+	for _, c := range strings.Fields(n.attrs["class"]) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// position is n's place among its parent's elements, counting from 1.
+func (n *node) position() int {
+	i := 0
+	for _, c := range n.parent.children {
+		if c.tag != "" {
+			i++
+		}
+		if c == n {
+			break
+		}
+	}
+	return i
+}
+
+// colspan is the number of table columns a cell spans.
+func (n *node) colspan() int {
+	span, err := strconv.Atoi(n.attrs["colspan"])
+	if err != nil || span < 1 {
+		return 1
+	}
+	return span
+}
+
+// find returns the first element named tag in document order, or nil.
+func (n *node) find(tag string) *node {
+	if n.tag == tag {
+		return n
+	}
+	for _, c := range n.children {
+		if found := c.find(tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// meta is the content of the document's <meta> named name, or "".
+func (n *node) meta(name string) string {
+	if n.tag == "meta" && strings.EqualFold(n.attrs["name"], name) {
+		return n.attrs["content"]
+	}
+	for _, c := range n.children {
+		if content := c.meta(name); content != "" {
+			return content
+		}
+	}
+	return ""
+}
+
+// textContent is all the text within n.
+func (n *node) textContent() string {
+	if n.tag == "" {
+		return n.text
+	}
+	var b strings.Builder
+	for _, c := range n.children {
+		b.WriteString(c.textContent())
+	}
+	return b.String()
+}
+
+// parseHTML reads a document into a tree under a root node tagged
+// "#document", which no element can be. It is lenient as browsers are: void
+// elements such as <img> need no closing tag, unclosed elements are closed by
+// their parent's end tag and HTML entities are understood.
+func parseHTML(src string) (*node, error) {
+	d := xml.NewDecoder(strings.NewReader(src))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+
+	root := &node{tag: "#document", attrs: map[string]string{}}
+	current := root
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &node{tag: strings.ToLower(t.Name.Local), attrs: map[string]string{}, parent: current}
+			for _, a := range t.Attr {
+				n.attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			current.children = append(current.children, n)
+			current = n
+		case xml.EndElement:
+			tag := strings.ToLower(t.Name.Local)
+			for n := current; n != root; n = n.parent {
+				if n.tag == tag {
+					current = n.parent
+					break
+				}
+			}
+		case xml.CharData:
+			current.children = append(current.children, &node{text: string(t), parent: current})
+		}
+	}
+
+	return root, nil
+}
@@ -0,0 +1,85 @@
+package pdfrender
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// srgb is an ICC version 2 display profile for sRGB, the colour space the
+// output intent of a PDF/A document says its RGB colours are in.
+var srgb = srgbProfile()
+
+func srgbProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			b = binary.BigEndian.AppendUint32(b, uint32(int32(math.Round(v*65536))))
+		}
+		return b
+	}
+	text := func(s string) []byte {
+		return append([]byte("text\x00\x00\x00\x00"+s), 0)
+	}
+	desc := func(s string) []byte {
+		b := []byte("desc\x00\x00\x00\x00")
+		b = binary.BigEndian.AppendUint32(b, uint32(len(s)+1))
+		b = append(b, s...)
+		b = append(b, 0)
+		// No Unicode or ScriptCode description
+		return append(b, make([]byte, 4+4+2+1+67)...)
+	}
+	// A gamma of 2.2, as u8Fixed8Number
+	curve := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x01\x02\x33")
+
+	tags := []struct {
+		signature string
+		data      []byte
+	}{
+		{"desc", desc("sRGB IEC61966-2.1")},
+		{"cprt", text("No copyright, use freely")},
+		{"wtpt", xyz(0.9505, 1, 1.0891)},
+		{"rXYZ", xyz(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", xyz(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", xyz(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	start := 128 + 4 + 12*len(tags)
+	offsets := map[string]int{}
+	for _, t := range tags {
+		// The three curves are the same and share their data
+		offset, ok := offsets[string(t.data)]
+		if !ok {
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+			offset = start + data.Len()
+			offsets[string(t.data)] = offset
+			data.Write(t.data)
+		}
+		table.WriteString(t.signature)
+		binary.Write(&table, binary.BigEndian, uint32(offset))
+		binary.Write(&table, binary.BigEndian, uint32(len(t.data)))
+	}
+	for data.Len()%4 != 0 {
+		data.WriteByte(0)
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header, uint32(start+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	for i, v := range []uint16{2024, 1, 1, 0, 0, 0} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	// The profile connection space's illuminant, D50
+	copy(header[68:], xyz(0.9642, 1, 0.8249)[8:])
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
@@ -0,0 +1,1123 @@
+package pdfrender
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// The page is A4 with 10 mm margins, as wkhtmltopdf is run. A page footer
+// goes in a deeper bottom margin.
+const (
+	pageWidth    = 210.0
+	pageHeight   = 297.0
+	pageMargin   = 10.0
+	footerMargin = 15.0
+	footerSize   = 8.0 // pt
+	bodyWidth    = pageWidth - 2*pageMargin
+)
+
+// Layout runs down one long strip of body-sized pages: y is measured from
+// the top of the first page's body, and page n holds y from n*bodyHeight.
+
+func (l *layout) pageOf(y float64) int {
+	return int(math.Floor((y + 0.001) / l.bodyHeight))
+}
+
+func (l *layout) pageTop(y float64) float64 {
+	return float64(l.pageOf(y)) * l.bodyHeight
+}
+
+// nextPage is where the page after the one y is on starts.
+func (l *layout) nextPage(y float64) float64 {
+	return l.pageTop(y) + l.bodyHeight
+}
+
+// crosses reports whether a box from top to bottom runs onto another page.
+func (l *layout) crosses(top, bottom float64) bool {
+	return l.pageOf(top) != l.pageOf(bottom-0.01)
+}
+
+// breaks reports whether a box from top to bottom that cannot be split
+// should move to the next page: it would run onto it, it is not at the top
+// of a page already and it is no taller than one.
+func (l *layout) breaks(top, bottom float64) bool {
+	return l.crosses(top, bottom) && top > l.pageTop(top)+0.01 && bottom-top <= l.bodyHeight
+}
+
+// fit is where something h tall that cannot be split goes if it would start
+// at y: there, or at the top of the next page.
+func (l *layout) fit(y, h float64) float64 {
+	if l.breaks(y, y+h) {
+		return l.nextPage(y)
+	}
+	return y
+}
+
+const (
+	opRect = iota
+	opText
+	opImage
+)
+
+// op is something to paint: a filled rectangle, a run of text whose line
+// starts at y, or an image.
+type op struct {
+	kind       int
+	x, y, w, h float64
+	color      color
+	style      *style
+	face       *fontFace
+	text       string
+	baseline   float64 // below y
+	image      string
+}
+
+// picture is an image registered with the PDF, sized in mm.
+type picture struct {
+	name string
+	w, h float64
+}
+
+type layout struct {
+	pdf    *gofpdf.Fpdf
+	tr     func(string) string
+	rules  []rule
+	ops    []op
+	images map[string]picture
+
+	// The TrueType fonts text may be set in, the font of each family list
+	// and style used so far and the fonts registered with the PDF
+	fonts      fontSet
+	faces      map[string]*fontFace
+	registered map[*fontFace]bool
+
+	// The height of a page's body, and the footer printed beneath it in the
+	// style of the document's body, if any
+	bodyHeight  float64
+	footer      string
+	footerStyle *style
+}
+
+// run is a piece of text set in one font.
+type run struct {
+	text  string
+	face  *fontFace
+	width float64
+}
+
+// face is the font of text in style s.
+func (l *layout) face(s *style) *fontFace {
+	key := s.font + "/" + fontStyle(s.bold, s.italic)
+	if f, ok := l.faces[key]; ok {
+		return f
+	}
+	f := l.fonts.face(s.font, s.bold, s.italic)
+	l.faces[key] = f
+	return f
+}
+
+// font sets the text that follows in face at size pt, registering the face
+// with the PDF the first time a TrueType font is used.
+func (l *layout) font(face *fontFace, size float64) {
+	if face.path != "" && !l.registered[face] {
+		data, err := os.ReadFile(face.path)
+		if err != nil {
+			l.pdf.SetError(err)
+		}
+		l.pdf.AddUTF8FontFromBytes(face.name(), face.style(), data)
+		l.registered[face] = true
+	}
+	l.pdf.SetFont(face.name(), face.style(), size)
+}
+
+// encode is text as the PDF takes it in face: in Windows-1252 for a core
+// font.
+func (l *layout) encode(face *fontFace, text string) string {
+	if face.path == "" {
+		return l.tr(text)
+	}
+	return text
+}
+
+// runs splits text in style s by the font each character is set in: s's
+// own if it has the character, or else the first TrueType font that does.
+// Marks go in the font of the letter they belong to.
+func (l *layout) runs(s *style, text string) []run {
+	own := l.face(s)
+	var runs []run
+	for _, r := range text {
+		face := own
+		n := len(runs)
+		switch {
+		case n > 0 && unicode.Is(unicode.Mn, r):
+			face = runs[n-1].face
+		case !own.covers(r) && !unicode.IsSpace(r):
+			if f := l.fonts.fallback(r, s.bold, s.italic); f != nil {
+				face = f
+			}
+		}
+		if n > 0 && runs[n-1].face == face {
+			runs[n-1].text += string(r)
+		} else {
+			runs = append(runs, run{text: string(r), face: face})
+		}
+	}
+	for i := range runs {
+		l.font(runs[i].face, s.fontSize)
+		runs[i].width = l.pdf.GetStringWidth(l.encode(runs[i].face, runs[i].text))
+	}
+	return runs
+}
+
+// textWidth is the width of text in s's fonts.
+func (l *layout) textWidth(s *style, text string) float64 {
+	w := 0.0
+	for _, r := range l.runs(s, text) {
+		w += r.width
+	}
+	return w
+}
+
+// display is how n takes part in layout: "inline" for text.
+func display(n *node) string {
+	if n.tag == "" {
+		return "inline"
+	}
+	return n.style.display
+}
+
+// isBlock reports whether n starts a box of its own rather than flowing
+// within a line.
+func isBlock(n *node) bool {
+	d := display(n)
+	return d != "inline" && d != "none"
+}
+
+// flow lays out n's children in a content box width wide at x, starting at
+// y, and returns where they end. Adjacent vertical margins collapse into the
+// larger of the two.
+func (l *layout) flow(n *node, x, y, width float64) float64 {
+	var run []*node
+	margin := 0.0
+	flushRun := func() {
+		if hasContent(run) {
+			y = l.lines(run, n.style, x, y+margin, width)
+			margin = 0
+		}
+		run = nil
+	}
+
+	for _, c := range n.children {
+		if !isBlock(c) {
+			if display(c) != "none" {
+				run = append(run, c)
+			}
+			continue
+		}
+		flushRun()
+		top := c.style.margin[0].resolve(width)
+		y = l.block(c, x, y+max(margin, top), width)
+		margin = c.style.margin[2].resolve(width)
+	}
+	flushRun()
+
+	return y + margin
+}
+
+// hasContent reports whether a run of inline nodes has anything to show
+// other than white space.
+func hasContent(run []*node) bool {
+	for _, n := range run {
+		switch {
+		case n.tag == "":
+			if strings.TrimSpace(n.text) != "" {
+				return true
+			}
+		case n.tag == "br" || n.tag == "img":
+			return true
+		case display(n) != "none" && hasContent(n.children):
+			return true
+		}
+	}
+	return false
+}
+
+// boxWidth is the border box width of block n in a containing block width
+// wide, with its left margin.
+func (l *layout) boxWidth(n *node, width float64) (w, left float64) {
+	s := n.style
+	marginLeft, marginRight := s.margin[3].resolve(width), s.margin[1].resolve(width)
+	w = width - marginLeft - marginRight
+	explicit := s.width != nil && !s.width.auto
+	switch {
+	case explicit:
+		w = s.width.resolve(width)
+		if display(n) != "table" {
+			w += horizontalExtras(s, width)
+		}
+	case display(n) == "table":
+		_, most := l.measure(n, width)
+		w = min(w, most)
+		explicit = true
+	}
+	if s.maxWidth != nil && !s.maxWidth.auto {
+		if most := s.maxWidth.resolve(width); w > most {
+			w, explicit = most, true
+		}
+	}
+
+	if explicit {
+		switch {
+		case s.margin[3].auto && s.margin[1].auto:
+			marginLeft = (width - w) / 2
+		case s.margin[3].auto:
+			marginLeft = width - w - marginRight
+		}
+	}
+	return w, marginLeft
+}
+
+// horizontalExtras is the width s's padding and borders add to its content.
+func horizontalExtras(s *style, width float64) float64 {
+	return s.padding[1].resolve(width) + s.padding[3].resolve(width) + s.border[1].width + s.border[3].width
+}
+
+// block lays out block n, whose top margin is already above y, in a
+// containing block width wide at x and returns where its border box ends.
+// A block with page-break-inside: avoid that would run onto the next page
+// starts on it instead.
+func (l *layout) block(n *node, x, y, width float64) float64 {
+	s := n.style
+	w, left := l.boxWidth(n, width)
+	x += left
+	mark := len(l.ops)
+
+	content := func(y float64) float64 {
+		var bottom float64
+		if display(n) == "table" {
+			bottom = l.table(n, x, y, w)
+		} else {
+			bottom = l.flow(n,
+				x+s.border[3].width+s.padding[3].resolve(width),
+				y+s.border[0].width+s.padding[0].resolve(width),
+				w-horizontalExtras(s, width))
+			bottom += s.padding[2].resolve(width) + s.border[2].width
+		}
+		if s.height != nil && !s.height.auto && !s.height.percent {
+			bottom = max(bottom, y+s.height.value)
+		}
+		return bottom
+	}
+	bottom := content(y)
+	if s.pageBreakInside == "avoid" && l.breaks(y, bottom) {
+		l.ops = l.ops[:mark]
+		y = l.nextPage(y)
+		bottom = content(y)
+	}
+
+	l.decorate(mark, s, x, y, w, bottom-y)
+	return bottom
+}
+
+// decorate paints s's background beneath the ops from mark on and its
+// borders over them, for a border box at x, y.
+func (l *layout) decorate(mark int, s *style, x, y, w, h float64) {
+	if s.background != nil {
+		l.ops = slices.Insert(l.ops, mark, op{kind: opRect, x: x, y: y, w: w, h: h, color: *s.background})
+	}
+	b := s.border
+	sides := []op{
+		{x: x, y: y, w: w, h: b[0].width, color: b[0].color},
+		{x: x + w - b[1].width, y: y, w: b[1].width, h: h, color: b[1].color},
+		{x: x, y: y + h - b[2].width, w: w, h: b[2].width, color: b[2].color},
+		{x: x, y: y, w: b[3].width, h: h, color: b[3].color},
+	}
+	for _, side := range sides {
+		if side.w > 0 && side.h > 0 {
+			side.kind = opRect
+			l.ops = append(l.ops, side)
+		}
+	}
+}
+
+// item is a word, line break or image within a line of text. space is the
+// width of the collapsed white space before it, if any, and dir the word's
+// direction.
+type item struct {
+	text    string
+	style   *style
+	runs    []run
+	width   float64
+	space   float64
+	dir     int
+	br      bool
+	picture *picture
+}
+
+// word is the item for text in style s.
+func (l *layout) word(s *style, text string) item {
+	it := item{text: text, style: s, runs: l.runs(s, text)}
+	for _, r := range it.runs {
+		it.width += r.width
+	}
+	return it
+}
+
+// items breaks a run of inline nodes into words, breaks and images.
+func (l *layout) items(run []*node, items []item, space *bool, width float64) []item {
+	for _, n := range run {
+		switch {
+		case n.tag == "":
+			s := n.parent.style
+			text := n.text
+			paragraphs := []string{text}
+			if s.whiteSpace == "pre-line" || s.whiteSpace == "pre-wrap" || s.whiteSpace == "pre" {
+				paragraphs = strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+			}
+			for i, p := range paragraphs {
+				if i > 0 {
+					items = append(items, item{br: true, style: s})
+					*space = false
+				}
+				if p != "" && unicode.IsSpace([]rune(p)[0]) {
+					*space = true
+				}
+				for j, word := range strings.Fields(p) {
+					// Fields drops the white space between words
+					if j > 0 {
+						*space = true
+					}
+					word = transform(word, s.textTransform)
+					dir := direction(word)
+					if dir < 0 {
+						word = visual(shapeArabic(word))
+					}
+					for _, piece := range ideographs(word) {
+						it := l.word(s, piece)
+						it.dir = dir
+						if *space {
+							it.space = l.textWidth(s, " ")
+						}
+						items = append(items, it)
+						*space = false
+					}
+				}
+				if p != "" && unicode.IsSpace([]rune(p)[len([]rune(p))-1]) {
+					*space = true
+				}
+			}
+		case n.style.display == "none":
+		case n.tag == "br":
+			items = append(items, item{br: true, style: n.style})
+			*space = false
+		case n.tag == "img":
+			if p, ok := l.image(n, width); ok {
+				it := item{style: n.style, width: p.w, picture: &p}
+				if *space {
+					it.space = l.textWidth(n.style, " ")
+				}
+				items = append(items, it)
+				*space = false
+			}
+		default:
+			items = l.items(n.children, items, space, width)
+		}
+	}
+	return items
+}
+
+func transform(word, textTransform string) string {
+	switch textTransform {
+	case "uppercase":
+		return strings.ToUpper(word)
+	case "lowercase":
+		return strings.ToLower(word)
+	case "capitalize":
+		r, size := utf8.DecodeRuneInString(word)
+		return string(unicode.ToUpper(r)) + word[size:]
+	}
+	return word
+}
+
+// split breaks a word too wide for a line into pieces that fit.
+func (l *layout) split(it item, width float64) []item {
+	var pieces []item
+	var piece []rune
+	for _, r := range it.text {
+		if len(piece) > 0 && l.textWidth(it.style, string(piece)+string(r)) > width {
+			pieces = append(pieces, l.word(it.style, string(piece)))
+			piece = nil
+		}
+		piece = append(piece, r)
+	}
+	pieces = append(pieces, l.word(it.style, string(piece)))
+	for i := range pieces {
+		pieces[i].dir = it.dir
+	}
+	pieces[0].space = it.space
+	return pieces
+}
+
+// lines lays out a run of inline nodes as lines of text width wide at x,
+// starting at y, in a block of style s, and returns where they end.
+func (l *layout) lines(run []*node, s *style, x, y, width float64) float64 {
+	var space bool
+	items := l.items(run, nil, &space, width)
+
+	var line []item
+	lineWidth := 0.0
+	emit := func() {
+		y = l.line(line, s, x, y, width, lineWidth)
+		line, lineWidth = nil, 0
+	}
+	for _, it := range items {
+		if it.br {
+			emit()
+			continue
+		}
+		if len(line) == 0 {
+			it.space = 0
+		}
+		if len(line) > 0 && lineWidth+it.space+it.width > width+0.01 {
+			emit()
+			it.space = 0
+		}
+		if it.picture == nil && it.width > width+0.01 {
+			pieces := l.split(it, width)
+			for _, p := range pieces[:len(pieces)-1] {
+				line, lineWidth = append(line, p), lineWidth+p.space+p.width
+				emit()
+			}
+			it = pieces[len(pieces)-1]
+		}
+		line = append(line, it)
+		lineWidth += it.space + it.width
+	}
+	if len(line) > 0 {
+		emit()
+	}
+	return y
+}
+
+// line lays out one line of items and returns where it ends. An empty line,
+// from consecutive breaks, is as tall as a line of s's text.
+func (l *layout) line(line []item, s *style, x, y, width, lineWidth float64) float64 {
+	height := s.fontSize * mmPerPt * s.lineHeight
+	text := 0.0
+	for _, it := range line {
+		if it.picture != nil {
+			height = max(height, it.picture.h)
+		} else {
+			height = max(height, it.style.fontSize*mmPerPt*it.style.lineHeight)
+			text = max(text, it.style.fontSize*mmPerPt)
+		}
+	}
+	y = l.fit(y, height)
+
+	switch s.textAlign {
+	case "center":
+		x += (width - lineWidth) / 2
+	case "right":
+		x += width - lineWidth
+	}
+
+	// Text sits on a common baseline, its em box centered in the line
+	baseline := height/2 + 0.3*text
+	reorder(line)
+	joinable := false // whether the last op is text of this line
+	for _, it := range line {
+		x += it.space
+		if it.picture != nil {
+			l.ops = append(l.ops, op{kind: opImage, x: x, y: y + (height-it.picture.h)/2, w: it.picture.w, h: it.picture.h, image: it.picture.name})
+			x += it.width
+			joinable = false
+			continue
+		}
+		for i, r := range it.runs {
+			if n := len(l.ops); joinable && l.ops[n-1].style == it.style && l.ops[n-1].face == r.face && (it.space == 0 || r.face == l.face(it.style)) {
+				// Words in the same style and font go out as one piece of
+				// text, the spaces between them in that font too
+				last := &l.ops[n-1]
+				if i == 0 && it.space > 0 {
+					last.text += " "
+				}
+				last.text += r.text
+				last.w = x + r.width - last.x
+			} else {
+				l.ops = append(l.ops, op{kind: opText, x: x, y: y, w: r.width, h: height, style: it.style, face: r.face, text: r.text, baseline: baseline})
+			}
+			joinable = true
+			x += r.width
+		}
+	}
+	return y + height
+}
+
+// reorder puts each stretch of right-to-left words in a line in the order
+// they are drawn, last word first, leaving the spaces between words where
+// they are. Numbers between right-to-left words read with them.
+func reorder(line []item) {
+	for i := 0; i < len(line); i++ {
+		if line[i].dir >= 0 {
+			continue
+		}
+		end := i
+		for j := i; j < len(line) && line[j].dir <= 0; j++ {
+			if line[j].dir < 0 {
+				end = j
+			}
+		}
+		spaces := make([]float64, end+1-i)
+		for k := range spaces {
+			spaces[k] = line[i+k].space
+		}
+		slices.Reverse(line[i : end+1])
+		for k := range spaces {
+			line[i+k].space = spaces[k]
+		}
+		i = end
+	}
+}
+
+// image decodes and registers the data URI image n shows, sized by its
+// style within a containing block width wide. Other sources are not
+// fetched, as wkhtmltopdf is not allowed to either.
+func (l *layout) image(n *node, width float64) (picture, bool) {
+	src := n.attrs["src"]
+	p, ok := l.images[src]
+	if !ok {
+		header, encoded, found := strings.Cut(strings.TrimPrefix(src, "data:"), ",")
+		if !found || !strings.HasPrefix(src, "data:") || !strings.HasSuffix(header, ";base64") {
+			return p, false
+		}
+		data, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return p, false
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			return p, false
+		}
+		if format == "jpeg" {
+			format = "jpg"
+		}
+
+		p = picture{
+			name: fmt.Sprintf("image%d", len(l.images)),
+			w:    float64(config.Width) * mmPerPx,
+			h:    float64(config.Height) * mmPerPx,
+		}
+		l.pdf.RegisterImageOptionsReader(p.name, gofpdf.ImageOptions{ImageType: format}, bytes.NewReader(data))
+		if l.pdf.Err() {
+			l.pdf.ClearError()
+			return p, false
+		}
+		l.images[src] = p
+	}
+
+	s := n.style
+	explicit := func(l *length) bool { return l != nil && !l.auto }
+	switch {
+	case explicit(s.width) && explicit(s.height):
+		p.w, p.h = s.width.resolve(width), s.height.resolve(width)
+	case explicit(s.width):
+		p.w, p.h = s.width.resolve(width), p.h*s.width.resolve(width)/p.w
+	case explicit(s.height):
+		p.w, p.h = p.w*s.height.resolve(width)/p.h, s.height.resolve(width)
+	}
+	if explicit(s.maxWidth) && p.w > s.maxWidth.resolve(width) {
+		p.w, p.h = s.maxWidth.resolve(width), p.h*s.maxWidth.resolve(width)/p.w
+	}
+	if explicit(s.maxHeight) && p.h > s.maxHeight.resolve(width) {
+		p.w, p.h = p.w*s.maxHeight.resolve(width)/p.h, s.maxHeight.resolve(width)
+	}
+	return p, true
+}
+
+// measure is the narrowest n can be laid out, its longest word, and the
+// width it takes without wrapping, both with its padding and borders, in
+// a containing block width wide.
+func (l *layout) measure(n *node, width float64) (least, most float64) {
+	s := n.style
+	extras := horizontalExtras(s, width)
+	if s.width != nil && !s.width.auto && !s.width.percent {
+		w := s.width.value
+		if display(n) != "table" {
+			w += extras
+		}
+		return w, w
+	}
+
+	if display(n) == "table" {
+		for _, c := range l.columns(tableRows(n), width) {
+			least += c.least
+			most += c.most
+		}
+		return least + extras, most + extras
+	}
+
+	var run []*node
+	measureRun := func() {
+		var space bool
+		lineWidth := 0.0
+		for _, it := range l.items(run, nil, &space, width) {
+			if it.br {
+				lineWidth = 0
+				continue
+			}
+			least = max(least, it.width)
+			lineWidth += it.space + it.width
+			most = max(most, lineWidth)
+		}
+		run = nil
+	}
+	for _, c := range n.children {
+		if !isBlock(c) {
+			run = append(run, c)
+			continue
+		}
+		measureRun()
+		margins := 0.0
+		for _, m := range []length{c.style.margin[1], c.style.margin[3]} {
+			if !m.auto && !m.percent {
+				margins += m.value
+			}
+		}
+		childLeast, childMost := l.measure(c, width)
+		least = max(least, childLeast+margins)
+		most = max(most, childMost+margins)
+	}
+	measureRun()
+
+	return least + extras, most + extras
+}
+
+// tableRow is a row of a table with the row group it is in, if any. Rows
+// of a table's head are repeated at the top of each page it runs onto.
+type tableRow struct {
+	node  *node
+	group *node
+	head  bool
+	cells []*node
+}
+
+func tableRows(table *node) []tableRow {
+	var rows []tableRow
+	add := func(tr, group *node) {
+		row := tableRow{node: tr, group: group, head: group != nil && group.tag == "thead"}
+		for _, c := range tr.children {
+			if c.tag != "" && c.style.display == "table-cell" {
+				row.cells = append(row.cells, c)
+			}
+		}
+		rows = append(rows, row)
+	}
+	for _, c := range table.children {
+		switch {
+		case c.tag == "":
+		case c.style.display == "table-row":
+			add(c, nil)
+		case c.style.display == "table-row-group":
+			for _, tr := range c.children {
+				if tr.tag != "" && tr.style.display == "table-row" {
+					add(tr, c)
+				}
+			}
+		}
+	}
+	return rows
+}
+
+// column is how wide a table column may be: the least and most of its
+// cells' widths, and the percentage or fixed width any cell gives it.
+type column struct {
+	least, most float64
+	percent     float64
+	fixed       bool
+}
+
+// columns measures the columns of rows from their cells which span one
+// column, in a table width wide.
+func (l *layout) columns(rows []tableRow, width float64) []column {
+	var columns []column
+	for _, row := range rows {
+		i := 0
+		for _, cell := range row.cells {
+			span := cell.colspan()
+			for len(columns) < i+span {
+				columns = append(columns, column{})
+			}
+			if span == 1 {
+				least, most := l.measure(cell, width)
+				c := &columns[i]
+				c.least, c.most = max(c.least, least), max(c.most, most)
+				if w := cell.style.width; w != nil && !w.auto {
+					if w.percent {
+						c.percent = max(c.percent, w.value)
+					} else {
+						c.fixed = true
+					}
+				}
+			}
+			i += span
+		}
+	}
+	return columns
+}
+
+// columnWidths shares width out between columns as browsers do: those
+// with a percentage get it and those with a fixed width get that. The rest
+// get their most width if there is room, growing in proportion to it if
+// there is more, or else something between their least and most.
+func columnWidths(columns []column, width float64) []float64 {
+	widths := make([]float64, len(columns))
+	remaining := width
+	var least, most, fixed float64
+	auto := 0
+	for i, c := range columns {
+		switch {
+		case c.percent > 0:
+			widths[i] = max(width*c.percent/100, c.least)
+			remaining -= widths[i]
+		case c.fixed:
+			widths[i] = c.most
+			remaining -= widths[i]
+			fixed += widths[i]
+		default:
+			least += c.least
+			most += c.most
+			auto++
+		}
+	}
+
+	for i, c := range columns {
+		switch {
+		case c.percent > 0 || c.fixed:
+			// With no other columns to take it, spare width goes to
+			// fixed ones
+			if auto == 0 && c.fixed && remaining > 0 {
+				widths[i] += remaining * c.most / fixed
+			}
+		case remaining >= most && most > 0:
+			widths[i] = c.most * remaining / most
+		case remaining > least:
+			widths[i] = c.least + (c.most-c.least)*(remaining-least)/(most-least)
+		default:
+			widths[i] = c.least
+		}
+	}
+	return widths
+}
+
+// fixedColumnWidths shares width out between columns by the widths of the
+// first row's cells alone, as table-layout: fixed does, so long content
+// wraps rather than widening its column. Columns without a width share what
+// is left equally.
+func fixedColumnWidths(rows []tableRow, width float64) []float64 {
+	columns := 0
+	for _, row := range rows {
+		span := 0
+		for _, cell := range row.cells {
+			span += cell.colspan()
+		}
+		columns = max(columns, span)
+	}
+	widths := make([]float64, columns)
+	if len(rows) == 0 {
+		return widths
+	}
+
+	given := make([]bool, columns)
+	remaining, i := width, 0
+	for _, cell := range rows[0].cells {
+		span := min(cell.colspan(), columns-i)
+		if w := cell.style.width; w != nil && !w.auto {
+			cw := w.resolve(width)
+			if !w.percent {
+				cw += horizontalExtras(cell.style, width)
+			}
+			for j := i; j < i+span; j++ {
+				widths[j], given[j] = cw/float64(span), true
+			}
+			remaining -= cw
+		}
+		i += span
+	}
+
+	free := 0
+	for _, g := range given {
+		if !g {
+			free++
+		}
+	}
+	for j, g := range given {
+		if !g {
+			widths[j] = max(remaining, 0) / float64(free)
+		}
+	}
+	return widths
+}
+
+// tableUnits groups rows into those that go onto a page together: each
+// row by itself, but all the rows of a group with page-break-inside: avoid,
+// such as an item and its discount.
+func tableUnits(rows []tableRow) [][]tableRow {
+	var units [][]tableRow
+	for i, row := range rows {
+		keep := row.group != nil && !row.head && row.group.style.pageBreakInside == "avoid"
+		if keep && i > 0 && rows[i-1].group == row.group {
+			units[len(units)-1] = append(units[len(units)-1], row)
+		} else {
+			units = append(units, []tableRow{row})
+		}
+	}
+	return units
+}
+
+// runningTotal is the data-running-total of the last row of unit, or of
+// its group, or "" if it has none.
+func runningTotal(unit []tableRow) string {
+	last := unit[len(unit)-1]
+	if total, ok := last.node.attrs["data-running-total"]; ok {
+		return total
+	}
+	if last.group != nil {
+		return last.group.attrs["data-running-total"]
+	}
+	return ""
+}
+
+// carryRow makes a row for table with label across all but its last
+// column and total in that, styled by the document as a tr of class
+// "carry" and class.
+func (l *layout) carryRow(table *node, class, label, total string, columns int) tableRow {
+	tr := &node{tag: "tr", attrs: map[string]string{"class": "carry " + class}, parent: table}
+	labelCell := &node{tag: "td", attrs: map[string]string{"colspan": strconv.Itoa(columns - 1)}, parent: tr}
+	labelCell.children = []*node{{text: label, parent: labelCell}}
+	totalCell := &node{tag: "td", attrs: map[string]string{}, parent: tr}
+	totalCell.children = []*node{{text: total, parent: totalCell}}
+	tr.children = []*node{labelCell, totalCell}
+	cascade(tr, l.rules, table.style)
+	return tableRow{node: tr, cells: tr.children}
+}
+
+// table lays out table n width wide at x, starting at y, and returns where
+// it ends. A row never splits across pages: one that would is moved to the
+// next, after the table's head again.
+//
+// A table with data-carried-forward and data-brought-forward labels that
+// runs onto another page ends the page with a row of the first and the
+// data-running-total of the rows above, and starts the next with a row of
+// the second.
+func (l *layout) table(n *node, x, y, width float64) float64 {
+	s := n.style
+	x += s.border[3].width + s.padding[3].resolve(width)
+	y += s.border[0].width + s.padding[0].resolve(width)
+	inner := width - horizontalExtras(s, width)
+
+	rows := tableRows(n)
+	var widths []float64
+	if s.tableLayout == "fixed" {
+		widths = fixedColumnWidths(rows, inner)
+	} else {
+		widths = columnWidths(l.columns(rows, inner), inner)
+	}
+
+	// Every row but the last leaves room beneath it for a carried forward
+	// row, in case the next has to go onto the next page
+	carried, brought := n.attrs["data-carried-forward"], n.attrs["data-brought-forward"]
+	reserve := 0.0
+	if carried != "" {
+		mark := len(l.ops)
+		reserve = l.row(l.carryRow(n, "carried-forward", carried, "", len(widths)), x, 0, widths)
+		l.ops = l.ops[:mark]
+	}
+
+	var head []tableRow
+	headMark, headTop := len(l.ops), y
+	total := ""
+	units := tableUnits(rows)
+	for i, unit := range units {
+		mark := len(l.ops)
+		bottom := l.rows(unit, x, y, widths)
+		need := bottom
+		if i < len(units)-1 && !unit[0].head {
+			need += reserve
+		}
+		if l.breaks(y, need) {
+			if len(head) > 0 && i == len(head) && headTop > l.pageTop(headTop)+0.01 {
+				// Keep the head with the first row rather than alone at the
+				// bottom of a page
+				mark, y = headMark, headTop
+			}
+			l.ops = l.ops[:mark]
+			next := l.nextPage(y)
+			if carried != "" && total != "" {
+				l.row(l.carryRow(n, "carried-forward", carried, total, len(widths)), x, y, widths)
+			}
+			y = next
+			if !unit[0].head {
+				for _, h := range head {
+					y = l.row(h, x, y, widths)
+				}
+			}
+			if brought != "" && total != "" {
+				y = l.row(l.carryRow(n, "brought-forward", brought, total, len(widths)), x, y, widths)
+			}
+			bottom = l.rows(unit, x, y, widths)
+		}
+		if unit[0].head {
+			head = append(head, unit...)
+		}
+		if t := runningTotal(unit); t != "" {
+			total = t
+		}
+		y = bottom
+	}
+
+	return y + s.padding[2].resolve(width) + s.border[2].width
+}
+
+// rows lays out rows one after another and returns where they end.
+func (l *layout) rows(rows []tableRow, x, y float64, widths []float64) float64 {
+	for _, row := range rows {
+		y = l.row(row, x, y, widths)
+	}
+	return y
+}
+
+// row lays out one row of a table with the given column widths and returns
+// where it ends. Cells are as tall as the row, their content aligned within
+// them by vertical-align.
+func (l *layout) row(row tableRow, x, y float64, widths []float64) float64 {
+	type cellBox struct {
+		node      *node
+		mark, end int
+		x, w, h   float64
+	}
+
+	rowMark := len(l.ops)
+	var cells []cellBox
+	column, cx := 0, x
+	for _, cell := range row.cells {
+		s := cell.style
+		span := min(cell.colspan(), len(widths)-column)
+		w := 0.0
+		for _, cw := range widths[column : column+span] {
+			w += cw
+		}
+		column += span
+
+		mark := len(l.ops)
+		bottom := l.flow(cell,
+			cx+s.border[3].width+s.padding[3].resolve(w),
+			y+s.border[0].width+s.padding[0].resolve(w),
+			w-horizontalExtras(s, w))
+		bottom += s.padding[2].resolve(w) + s.border[2].width
+		cells = append(cells, cellBox{cell, mark, len(l.ops), cx, w, bottom - y})
+		cx += w
+	}
+
+	height := 0.0
+	for _, c := range cells {
+		height = max(height, c.h)
+	}
+	if h := row.node.style.height; h != nil && !h.auto && !h.percent {
+		height = max(height, h.value)
+	}
+
+	for i := len(cells) - 1; i >= 0; i-- {
+		c := cells[i]
+		shift := 0.0
+		switch c.node.style.verticalAlign {
+		case "middle":
+			shift = (height - c.h) / 2
+		case "bottom":
+			shift = height - c.h
+		}
+		for j := c.mark; j < c.end; j++ {
+			l.ops[j].y += shift
+		}
+		l.decorate(c.mark, c.node.style, c.x, y, c.w, height)
+	}
+
+	background := row.node.style.background
+	if background == nil && row.group != nil {
+		background = row.group.style.background
+	}
+	if background != nil {
+		l.ops = slices.Insert(l.ops, rowMark, op{kind: opRect, x: x, y: y, w: cx - x, h: height, color: *background})
+	}
+	return y + height
+}
+
+// paint draws the ops onto as many pages as they run to, splitting
+// rectangles that run from one page onto the next, with the footer at the
+// bottom of each.
+func (l *layout) paint() {
+	pages := 1
+	for _, o := range l.ops {
+		pages = max(pages, l.pageOf(o.y+max(o.h-0.01, 0))+1)
+	}
+
+	for page := 0; page < pages; page++ {
+		l.pdf.AddPage()
+		top := float64(page) * l.bodyHeight
+		for _, o := range l.ops {
+			switch o.kind {
+			case opRect:
+				from, to := max(o.y, top), min(o.y+o.h, top+l.bodyHeight)
+				if to > from {
+					l.pdf.SetFillColor(o.color.r, o.color.g, o.color.b)
+					l.pdf.Rect(o.x, pageMargin+from-top, o.w, to-from, "F")
+				}
+			case opText:
+				if l.pageOf(o.y) == page {
+					s := o.style
+					l.font(o.face, s.fontSize)
+					l.pdf.SetTextColor(s.color.r, s.color.g, s.color.b)
+					l.pdf.Text(o.x, pageMargin+o.y-top+o.baseline, l.encode(o.face, o.text))
+				}
+			case opImage:
+				if l.pageOf(o.y) == page {
+					l.pdf.ImageOptions(o.image, o.x, pageMargin+o.y-top, o.w, o.h, false, gofpdf.ImageOptions{}, 0, "")
+				}
+			}
+		}
+
+		if l.footer != "" {
+			text := strings.NewReplacer(
+				"[page]", strconv.Itoa(page+1),
+				"[topage]", strconv.Itoa(pages),
+			).Replace(l.footer)
+			s := *l.footerStyle
+			s.fontSize, s.bold, s.italic = footerSize, false, false
+			runs := l.runs(&s, text)
+			x := pageWidth / 2
+			for _, r := range runs {
+				x -= r.width / 2
+			}
+			l.pdf.SetTextColor(102, 102, 102)
+			for _, r := range runs {
+				l.font(r.face, footerSize)
+				l.pdf.Text(x, pageHeight-pageMargin+footerSize*mmPerPt/2, l.encode(r.face, r.text))
+				x += r.width
+			}
+		}
+	}
+}
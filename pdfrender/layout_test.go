@@ -0,0 +1,63 @@
+package pdfrender
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var (
+	streamPattern = regexp.MustCompile(`(?s)stream\r?\n(.*?)endstream`)
+	showPattern   = regexp.MustCompile(`\(((?:\\.|[^\\)])*)\) Tj`)
+)
+
+// pdfText returns the strings shown by the text operators of a PDF's
+// content streams, in order.
+func pdfText(t *testing.T, pdf []byte) []string {
+	t.Helper()
+	var shown []string
+	for _, m := range streamPattern.FindAllSubmatch(pdf, -1) {
+		r, err := zlib.NewReader(bytes.NewReader(m[1]))
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(r)
+		if err != nil {
+			continue
+		}
+		for _, s := range showPattern.FindAllSubmatch(content, -1) {
+			shown = append(shown, strings.NewReplacer(`\(`, "(", `\)`, ")", `\\`, `\`).Replace(string(s[1])))
+		}
+	}
+	return shown
+}
+
+func TestRenderKeepsSpacesBetweenWords(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"paragraph", "<p>John Smith</p>", []string{"John Smith"}},
+		{"collapsed white space", "<p>  John \n\t Smith  </p>", []string{"John Smith"}},
+		{"styled run", "<p>Ship to <b>1 Main</b> St</p>", []string{"Ship to", "1 Main", "St"}},
+		{"table cell", "<table><tr><td>Net 30 days</td></tr></table>", []string{"Net 30 days"}},
+		{"preformatted lines", `<p style="white-space: pre-line">Two words
+on two lines</p>`, []string{"Two words", "on two lines"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := (native{}).Render(&b, "<html><body>"+tt.body+"</body></html>"); err != nil {
+				t.Fatal(err)
+			}
+			if got := pdfText(t, b.Bytes()); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got text %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package pdfrender
+
+import (
+	"io"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// native renders in pure Go with gofpdf. It understands the HTML and CSS
+// documents such as invoices are made of: blocks, tables, text and data URI
+// images, with colors, fonts, margins, padding and borders. Text is set in
+// its TrueType fonts, falling back from one to the next for characters a
+// font lacks, or without any in the core PDF fonts, limited to
+// Windows-1252. Arabic is shaped and right-to-left words are drawn in
+// their order.
+type native struct {
+	fonts fontSet
+}
+
+// FooterMeta names the <meta> whose content, if any, is printed at the foot
+// of every page, with [page] replaced by the page number and [topage] by
+// the number of pages.
+const FooterMeta = "pdf-footer"
+
+func (r native) Render(w io.Writer, html string) error {
+	doc, err := parseHTML(html)
+	if err != nil {
+		return err
+	}
+
+	rules := parseStylesheet(nil, userAgentCSS, true)
+	var styles func(n *node)
+	styles = func(n *node) {
+		if n.tag == "style" {
+			rules = parseStylesheet(rules, n.textContent(), false)
+		}
+		for _, c := range n.children {
+			styles(c)
+		}
+	}
+	styles(doc)
+	cascade(doc, rules, nil)
+
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(false, 0)
+	if title := doc.find("title"); title != nil {
+		pdf.SetTitle(strings.TrimSpace(title.textContent()), true)
+	}
+
+	l := &layout{
+		pdf:         pdf,
+		tr:          pdf.UnicodeTranslatorFromDescriptor(""),
+		rules:       rules,
+		images:      map[string]picture{},
+		fonts:       r.fonts,
+		faces:       map[string]*fontFace{},
+		registered:  map[*fontFace]bool{},
+		bodyHeight:  pageHeight - 2*pageMargin,
+		footer:      doc.meta(FooterMeta),
+		footerStyle: doc.style,
+	}
+	if l.footer != "" {
+		l.bodyHeight = pageHeight - pageMargin - footerMargin
+	}
+	if body := doc.find("body"); body != nil {
+		l.footerStyle = body.style
+	}
+	l.flow(doc, pageMargin, 0, bodyWidth)
+	l.paint()
+
+	return pdf.Output(w)
+}
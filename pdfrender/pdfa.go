@@ -0,0 +1,469 @@
+package pdfrender
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Attachment is a file embedded in a PDF/A-3 document. Relationship is how
+// it relates to the document: Source, Data, Alternative or Supplement.
+type Attachment struct {
+	Name         string
+	MIMEType     string
+	Description  string
+	Relationship string
+	Data         []byte
+}
+
+// Archive is what a PDF/A-3 document says about itself beyond its pages.
+type Archive struct {
+	Title       string
+	Attachments []Attachment
+	// Metadata is further rdf:Description elements for the document's XMP
+	// metadata, such as those a standard for its attachments asks for
+	Metadata string
+	// Time the document is dated, now if it is zero
+	Time time.Time
+}
+
+// ErrFontsNotEmbedded is returned for a PDF that uses the core fonts, which
+// PDF/A forbids as they are not embedded.
+var ErrFontsNotEmbedded = errors.New("the PDF uses fonts that are not embedded, as PDF/A requires: render it with a font directory")
+
+// PDFA3 rewrites a PDF as PDF/A-3b, archival PDF that may carry other files,
+// with a's attachments and metadata. The PDF must have a classic
+// cross-reference table, as both backends write, and embed all its fonts.
+func PDFA3(pdf []byte, a Archive) ([]byte, error) {
+	doc, err := parsePDF(pdf)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range doc.objects {
+		if !embedsFonts(obj.body) {
+			return nil, ErrFontsNotEmbedded
+		}
+	}
+	catalog, err := dictEntries(string(doc.objects[doc.root].body))
+	if err != nil {
+		return nil, fmt.Errorf("catalog: %v", err)
+	}
+
+	at := a.Time
+	if at.IsZero() {
+		at = time.Now()
+	}
+	at = at.UTC().Truncate(time.Second)
+	date := at.Format("D:20060102150405+00'00'")
+	producer := "invoice-app"
+
+	next := slices.Max(doc.numbers()) + 1
+	add := func(body string) int {
+		n := next
+		next++
+		doc.objects[n] = pdfObject{body: []byte(body)}
+		return n
+	}
+	stream := func(dict string, data []byte) string {
+		return fmt.Sprintf("<<%s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+
+	info := fmt.Sprintf("<<\n/Title %s\n/Producer %s\n/CreationDate (%s)\n/ModDate (%s)\n>>", pdfString(a.Title), pdfString(producer), date, date)
+	if doc.info == 0 {
+		doc.info = add(info)
+	} else {
+		doc.objects[doc.info] = pdfObject{gen: doc.objects[doc.info].gen, body: []byte(info)}
+	}
+
+	metadata := add(stream(" /Type /Metadata /Subtype /XML", []byte(xmp(a.Title, producer, at, a.Metadata))))
+	profile := add(stream(" /N 3", srgb))
+	intent := add(fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (sRGB) /Info (sRGB IEC61966-2.1) /DestOutputProfile %d 0 R >>", profile))
+
+	attachments := slices.Clone(a.Attachments)
+	slices.SortFunc(attachments, func(x, y Attachment) int { return strings.Compare(x.Name, y.Name) })
+	var files, names []string
+	for _, f := range attachments {
+		file := add(stream(fmt.Sprintf(" /Type /EmbeddedFile /Subtype %s /Params << /ModDate (%s) /Size %d >>", pdfName(f.MIMEType), date, len(f.Data)), f.Data))
+		spec := add(fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /Desc %s /AFRelationship %s /EF << /F %d 0 R /UF %d 0 R >> >>",
+			pdfString(f.Name), pdfString(f.Name), pdfString(f.Description), pdfName(f.Relationship), file, file))
+		files = append(files, fmt.Sprintf("%d 0 R", spec))
+		names = append(names, fmt.Sprintf("%s %d 0 R", pdfString(f.Name), spec))
+	}
+
+	// The catalog keeps what it has but for what is replaced here
+	var b strings.Builder
+	b.WriteString("<<\n")
+	for _, e := range catalog {
+		switch e[0] {
+		case "/Metadata", "/OutputIntents", "/Names", "/AF":
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s\n", e[0], e[1])
+	}
+	fmt.Fprintf(&b, "/Metadata %d 0 R\n/OutputIntents [%d 0 R]\n", metadata, intent)
+	if len(files) > 0 {
+		fmt.Fprintf(&b, "/Names << /EmbeddedFiles << /Names [%s] >> >>\n/AF [%s]\n", strings.Join(names, " "), strings.Join(files, " "))
+	}
+	b.WriteString(">>")
+	doc.objects[doc.root] = pdfObject{gen: doc.objects[doc.root].gen, body: []byte(b.String())}
+
+	id := md5.New()
+	id.Write(pdf)
+	id.Write([]byte(date))
+	return doc.write(fmt.Sprintf("<%x>", id.Sum(nil))), nil
+}
+
+// xmp is the XMP metadata of a PDF/A-3b document, which must agree with its
+// document information dictionary.
+func xmp(title, producer string, at time.Time, extra string) string {
+	date := at.Format("2006-01-02T15:04:05+00:00")
+	return `<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/">
+<pdfaid:part>3</pdfaid:part>
+<pdfaid:conformance>B</pdfaid:conformance>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + html.EscapeString(title) + `</rdf:li></rdf:Alt></dc:title>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+<pdf:Producer>` + html.EscapeString(producer) + `</pdf:Producer>
+</rdf:Description>
+<rdf:Description rdf:about="" xmlns:xmp="http://ns.adobe.com/xap/1.0/">
+<xmp:CreateDate>` + date + `</xmp:CreateDate>
+<xmp:ModifyDate>` + date + `</xmp:ModifyDate>
+</rdf:Description>
+` + extra + `</rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
+
+var (
+	fontDict       = regexp.MustCompile(`/Type\s*/Font\b`)
+	simpleFont     = regexp.MustCompile(`/Subtype\s*/(Type1|MMType1|TrueType)\b`)
+	fontDescriptor = regexp.MustCompile(`/Type\s*/FontDescriptor\b`)
+	fontFile       = regexp.MustCompile(`/FontFile[23]?\b`)
+)
+
+// embedsFonts reports whether an object is not a font, or a font whose
+// program is in the PDF.
+func embedsFonts(body []byte) bool {
+	if i := bytes.Index(body, []byte("stream")); i >= 0 {
+		body = body[:i]
+	}
+	switch {
+	case fontDict.Match(body) && simpleFont.Match(body):
+		return bytes.Contains(body, []byte("/FontDescriptor"))
+	case fontDescriptor.Match(body):
+		return fontFile.Match(body)
+	}
+	return true
+}
+
+type pdfObject struct {
+	gen  int
+	body []byte // between obj and endobj
+}
+
+// pdfFile is a PDF's objects by number, and its catalog and document
+// information dictionary.
+type pdfFile struct {
+	objects    map[int]pdfObject
+	root, info int
+}
+
+var (
+	objectHeader = regexp.MustCompile(`^\s*(\d+)\s+(\d+)\s+obj`)
+	rootRef      = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	infoRef      = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+)
+
+// parsePDF reads the objects of a PDF by its cross-reference table, each
+// running until the next one starts.
+func parsePDF(data []byte) (*pdfFile, error) {
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return nil, errors.New("not a PDF: no startxref")
+	}
+	fields := strings.Fields(string(data[i+len("startxref") : min(len(data), i+40)]))
+	if len(fields) == 0 {
+		return nil, errors.New("not a PDF: no startxref")
+	}
+	xref, err := strconv.Atoi(fields[0])
+	if err != nil || xref < 0 || xref >= len(data) {
+		return nil, errors.New("not a PDF: bad startxref")
+	}
+	if !bytes.HasPrefix(data[xref:], []byte("xref")) {
+		return nil, errors.New("cross-reference streams are not supported")
+	}
+
+	end := bytes.Index(data[xref:], []byte("trailer"))
+	if end < 0 {
+		return nil, errors.New("no trailer")
+	}
+	trailer := data[xref+end : i]
+	if bytes.Contains(trailer, []byte("/Encrypt")) {
+		return nil, errors.New("encrypted PDFs are not supported")
+	}
+	if bytes.Contains(trailer, []byte("/Prev")) {
+		return nil, errors.New("incrementally updated PDFs are not supported")
+	}
+
+	// Subsections of the table: the first number, how many, and then each
+	// entry's offset, generation and whether it is in use
+	offsets := map[int]int{}
+	table := strings.Fields(string(data[xref+len("xref") : xref+end]))
+	for len(table) >= 2 {
+		first, err1 := strconv.Atoi(table[0])
+		count, err2 := strconv.Atoi(table[1])
+		if err1 != nil || err2 != nil || len(table) < 2+3*count {
+			return nil, errors.New("bad cross-reference table")
+		}
+		for n := 0; n < count; n++ {
+			entry := table[2+3*n:]
+			if entry[2] == "n" {
+				offset, err := strconv.Atoi(entry[0])
+				if err != nil || offset >= xref {
+					return nil, errors.New("bad cross-reference table")
+				}
+				offsets[first+n] = offset
+			}
+		}
+		table = table[2+3*count:]
+	}
+
+	doc := &pdfFile{objects: map[int]pdfObject{}}
+	starts := []int{xref}
+	for _, offset := range offsets {
+		starts = append(starts, offset)
+	}
+	slices.Sort(starts)
+	for n, offset := range offsets {
+		j, _ := slices.BinarySearch(starts, offset)
+		chunk := data[offset:starts[j+1]]
+		m := objectHeader.FindSubmatchIndex(chunk)
+		if m == nil || string(chunk[m[2]:m[3]]) != strconv.Itoa(n) {
+			return nil, fmt.Errorf("object %d is not where the cross-reference table has it", n)
+		}
+		gen, _ := strconv.Atoi(string(chunk[m[4]:m[5]]))
+		stop := bytes.LastIndex(chunk, []byte("endobj"))
+		if stop < m[1] {
+			return nil, fmt.Errorf("object %d has no endobj", n)
+		}
+		doc.objects[n] = pdfObject{gen: gen, body: bytes.TrimSpace(chunk[m[1]:stop])}
+	}
+
+	if m := rootRef.FindSubmatch(trailer); m != nil {
+		doc.root, _ = strconv.Atoi(string(m[1]))
+	}
+	if _, ok := doc.objects[doc.root]; !ok {
+		return nil, errors.New("no catalog")
+	}
+	if m := infoRef.FindSubmatch(trailer); m != nil {
+		doc.info, _ = strconv.Atoi(string(m[1]))
+		if _, ok := doc.objects[doc.info]; !ok {
+			doc.info = 0
+		}
+	}
+	return doc, nil
+}
+
+func (doc *pdfFile) numbers() []int {
+	var numbers []int
+	for n := range doc.objects {
+		numbers = append(numbers, n)
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// write writes the document out afresh, with a PDF 1.7 header, as PDF/A-3
+// is based on, and a new cross-reference table.
+func (doc *pdfFile) write(id string) []byte {
+	var b bytes.Buffer
+	// The comment of bytes above 127 marks the file as binary
+	b.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+
+	numbers := doc.numbers()
+	size := numbers[len(numbers)-1] + 1
+	offsets := make([]int, size)
+	for _, n := range numbers {
+		offsets[n] = b.Len()
+		obj := doc.objects[n]
+		fmt.Fprintf(&b, "%d %d obj\n", n, obj.gen)
+		b.Write(obj.body)
+		b.WriteString("\nendobj\n")
+	}
+
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n", size)
+	for n, offset := range offsets {
+		if offset == 0 {
+			b.WriteString("0000000000 65535 f \n")
+		} else {
+			fmt.Fprintf(&b, "%010d %05d n \n", offset, doc.objects[n].gen)
+		}
+	}
+	fmt.Fprintf(&b, "trailer\n<<\n/Size %d\n/Root %d %d R\n/Info %d %d R\n/ID [%s %s]\n>>\nstartxref\n%d\n%%%%EOF\n",
+		size, doc.root, doc.objects[doc.root].gen, doc.info, doc.objects[doc.info].gen, id, id, xref)
+	return b.Bytes()
+}
+
+// dictEntries splits a dictionary into its keys and their values, as they
+// are written.
+func dictEntries(dict string) ([][2]string, error) {
+	s := strings.TrimSpace(dict)
+	if !strings.HasPrefix(s, "<<") || !strings.HasSuffix(s, ">>") {
+		return nil, errors.New("not a dictionary")
+	}
+	s = s[2 : len(s)-2]
+	var entries [][2]string
+	for {
+		s = strings.TrimLeft(s, pdfWhitespace)
+		if s == "" {
+			return entries, nil
+		}
+		if s[0] != '/' {
+			return nil, errors.New("bad dictionary key")
+		}
+		key := s[:tokenEnd(s, 1)]
+		s = s[len(key):]
+		n := valueEnd(s)
+		if n < 0 {
+			return nil, fmt.Errorf("bad value of %s", key)
+		}
+		entries = append(entries, [2]string{key, strings.TrimSpace(s[:n])})
+		s = s[n:]
+	}
+}
+
+const (
+	pdfWhitespace = "\x00\t\n\f\r "
+	pdfDelimiters = "()<>[]{}/%"
+)
+
+// tokenEnd is where the name or number starting before i in s ends.
+func tokenEnd(s string, i int) int {
+	for i < len(s) && !strings.ContainsRune(pdfWhitespace+pdfDelimiters, rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+var indirect = regexp.MustCompile(`^\s*\d+\s+\d+\s+R`)
+
+// valueEnd is where the value at the start of s ends, or -1 if it does not.
+func valueEnd(s string) int {
+	i := len(s) - len(strings.TrimLeft(s, pdfWhitespace))
+	if i == len(s) {
+		return -1
+	}
+	if m := indirect.FindStringIndex(s); m != nil {
+		return m[1]
+	}
+	switch s[i] {
+	case '/':
+		return tokenEnd(s, i+1)
+	case '(', '<', '[':
+	default:
+		return tokenEnd(s, i)
+	}
+
+	// Strings, arrays and dictionaries run until what they open closes
+	depth := 0
+	for i < len(s) {
+		switch {
+		case s[i] == '(':
+			i = stringEnd(s, i)
+			if i < 0 {
+				return -1
+			}
+		case strings.HasPrefix(s[i:], "<<"):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], ">>"):
+			depth--
+			i++
+		case s[i] == '<':
+			if j := strings.IndexByte(s[i:], '>'); j >= 0 {
+				i += j
+			} else {
+				return -1
+			}
+		case s[i] == '[':
+			depth++
+		case s[i] == ']':
+			depth--
+		}
+		i++
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// stringEnd is the index of the parenthesis that closes the literal string
+// opening at i in s, or -1 if none does.
+func stringEnd(s string, i int) int {
+	parens := 0
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '(':
+			parens++
+		case ')':
+			parens--
+			if parens == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// pdfString writes s as a PDF text string: literal if it is ASCII, and
+// else UTF-16 with a byte order mark.
+func pdfString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+		}
+	}
+	if ascii {
+		return "(" + strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s) + ")"
+	}
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfName writes s as a PDF name, escaping what may not appear in one.
+func pdfName(s string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= 0x20 || c >= 0x7f || c == '#' || strings.IndexByte(pdfDelimiters, c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
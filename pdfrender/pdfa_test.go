@@ -0,0 +1,201 @@
+package pdfrender
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// fontlessPDF is a page with nothing but a rectangle on it, which PDF/A
+// accepts as it uses no fonts.
+func fontlessPDF(t *testing.T) []byte {
+	t.Helper()
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.Rect(20, 20, 50, 30, "D")
+	var b bytes.Buffer
+	if err := pdf.Output(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// catalogEntry returns the value of a key of doc's catalog.
+func catalogEntry(t *testing.T, doc *pdfFile, key string) string {
+	t.Helper()
+	entries, err := dictEntries(string(doc.objects[doc.root].body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if e[0] == key {
+			return e[1]
+		}
+	}
+	t.Fatalf("catalog has no %s", key)
+	return ""
+}
+
+// object returns the object a reference such as "12 0 R" points to.
+func object(t *testing.T, doc *pdfFile, ref string) string {
+	t.Helper()
+	n, err := strconv.Atoi(strings.Fields(ref)[0])
+	if err != nil {
+		t.Fatalf("bad reference %q", ref)
+	}
+	obj, ok := doc.objects[n]
+	if !ok {
+		t.Fatalf("no object %d", n)
+	}
+	return string(obj.body)
+}
+
+// streamData returns the bytes of a stream object.
+func streamData(t *testing.T, body string) string {
+	t.Helper()
+	_, data, ok := strings.Cut(body, "stream\n")
+	if !ok {
+		t.Fatalf("not a stream: %.60s", body)
+	}
+	data, ok = strings.CutSuffix(data, "\nendstream")
+	if !ok {
+		t.Fatalf("stream does not end: %.60s", body)
+	}
+	return data
+}
+
+func TestPDFA3Attachment(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?><Invoice/>`)
+	out, err := PDFA3(fontlessPDF(t), Archive{
+		Title: "Invoice INV-1",
+		Attachments: []Attachment{{
+			Name:         "factur-x.xml",
+			MIMEType:     "text/xml",
+			Description:  "Factur-X invoice",
+			Relationship: "Alternative",
+			Data:         data,
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(out, []byte("%PDF-1.7\n")) {
+		t.Errorf("header is %q, want PDF 1.7", out[:9])
+	}
+
+	// What PDFA3 writes can be read back
+	doc, err := parsePDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is both associated with the document and named in it
+	af := catalogEntry(t, doc, "/AF")
+	spec := object(t, doc, strings.Trim(af, "[]"))
+	for _, want := range []string{"/Type /Filespec", "/F (factur-x.xml)", "/UF (factur-x.xml)", "/Desc (Factur-X invoice)", "/AFRelationship /Alternative"} {
+		if !strings.Contains(spec, want) {
+			t.Errorf("file specification %q lacks %s", spec, want)
+		}
+	}
+	if names := catalogEntry(t, doc, "/Names"); !strings.Contains(names, "/EmbeddedFiles << /Names [(factur-x.xml) "+strings.Trim(af, "[]")+"] >>") {
+		t.Errorf("names %q do not list the attachment", names)
+	}
+
+	ef := spec[strings.Index(spec, "/EF << /F ")+len("/EF << /F "):]
+	file := object(t, doc, ef)
+	for _, want := range []string{"/Type /EmbeddedFile", "/Subtype /text#2Fxml", "/Size " + strconv.Itoa(len(data))} {
+		if !strings.Contains(file, want) {
+			t.Errorf("embedded file %.120q lacks %s", file, want)
+		}
+	}
+	if got := streamData(t, file); got != string(data) {
+		t.Errorf("embedded file holds %q, want %q", got, data)
+	}
+
+	// An sRGB output intent, as PDF/A asks for device colors
+	intent := object(t, doc, strings.Trim(catalogEntry(t, doc, "/OutputIntents"), "[]"))
+	if !strings.Contains(intent, "/S /GTS_PDFA1") || !strings.Contains(intent, "/DestOutputProfile") {
+		t.Errorf("output intent %q is not an sRGB PDF/A one", intent)
+	}
+}
+
+func TestPDFA3Metadata(t *testing.T) {
+	at := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	extra := `<rdf:Description rdf:about="" xmlns:fx="urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0#">
+<fx:DocumentFileName>factur-x.xml</fx:DocumentFileName>
+</rdf:Description>
+`
+	out, err := PDFA3(fontlessPDF(t), Archive{Title: "Invoice <INV-1> & co", Metadata: extra, Time: at})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := parsePDF(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metadata := object(t, doc, catalogEntry(t, doc, "/Metadata"))
+	if !strings.Contains(metadata, "/Type /Metadata /Subtype /XML") || strings.Contains(metadata, "/Filter") {
+		t.Errorf("metadata %.80q is not an uncompressed XML metadata stream", metadata)
+	}
+
+	// The XMP is well-formed and says what the document is
+	var xmp struct {
+		Descriptions []struct {
+			Part        string `xml:"http://www.aiim.org/pdfa/ns/id/ part"`
+			Conformance string `xml:"http://www.aiim.org/pdfa/ns/id/ conformance"`
+			Title       string `xml:"title>Alt>li"`
+			Producer    string `xml:"http://ns.adobe.com/pdf/1.3/ Producer"`
+			CreateDate  string `xml:"http://ns.adobe.com/xap/1.0/ CreateDate"`
+			ModifyDate  string `xml:"http://ns.adobe.com/xap/1.0/ ModifyDate"`
+			FileName    string `xml:"urn:factur-x:pdfa:CrossIndustryDocument:invoice:1p0# DocumentFileName"`
+		} `xml:"RDF>Description"`
+	}
+	if err := xml.Unmarshal([]byte(streamData(t, metadata)), &xmp); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, d := range xmp.Descriptions {
+		for key, value := range map[string]string{
+			"part": d.Part, "conformance": d.Conformance, "title": d.Title, "producer": d.Producer,
+			"create": d.CreateDate, "modify": d.ModifyDate, "file": d.FileName,
+		} {
+			if value != "" {
+				got[key] = value
+			}
+		}
+	}
+	want := map[string]string{
+		"part": "3", "conformance": "B", "title": "Invoice <INV-1> & co", "producer": "invoice-app",
+		"create": "2026-03-01T09:30:00+00:00", "modify": "2026-03-01T09:30:00+00:00", "file": "factur-x.xml",
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("XMP %s is %q, want %q", key, got[key], value)
+		}
+	}
+
+	// PDF/A needs the document information dictionary to agree with it
+	info := string(doc.objects[doc.info].body)
+	for _, want := range []string{"/Title (Invoice <INV-1> & co)", "/Producer (invoice-app)", "/CreationDate (D:20260301093000+00'00')", "/ModDate (D:20260301093000+00'00')"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("document information %q lacks %s", info, want)
+		}
+	}
+}
+
+func TestPDFA3RefusesFontsNotEmbedded(t *testing.T) {
+	var b bytes.Buffer
+	if err := (native{}).Render(&b, "<html><body><p>Core fonts</p></body></html>"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PDFA3(b.Bytes(), Archive{Title: "Invoice"}); !errors.Is(err, ErrFontsNotEmbedded) {
+		t.Errorf("got %v, want %v", err, ErrFontsNotEmbedded)
+	}
+}
@@ -0,0 +1,65 @@
+package pdfrender
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+)
+
+// Backends a Renderer can use.
+const (
+	Native      = "native"
+	Wkhtmltopdf = "wkhtmltopdf"
+)
+
+// Renderer turns a complete HTML document into an A4 PDF.
+type Renderer interface {
+	Render(w io.Writer, html string) error
+}
+
+// Config chooses a Renderer and how it works.
+type Config struct {
+	// Backend is Native or Wkhtmltopdf, Native if it is ""
+	Backend string
+	// WkhtmltopdfPath is the wkhtmltopdf binary to run, or "" for the one on
+	// the PATH
+	WkhtmltopdfPath string
+	// FontDir holds the TrueType fonts the native backend sets text in, if
+	// it is not ""
+	FontDir string
+}
+
+// EmbedsFonts reports whether the PDFs r renders embed their fonts, as PDF/A
+// requires. The native backend only does with a font directory.
+func EmbedsFonts(r Renderer) bool {
+	n, ok := r.(native)
+	return !ok || len(n.fonts) > 0
+}
+
+// New returns the renderer c chooses. The native backend fails here if the
+// font directory has no usable fonts, and wkhtmltopdf if there is no binary.
+func New(c Config) (Renderer, error) {
+	switch c.Backend {
+	case "", Native:
+		if c.FontDir == "" {
+			return native{}, nil
+		}
+		fonts, err := loadFonts(c.FontDir)
+		if err != nil {
+			return nil, err
+		}
+		return native{fonts: fonts}, nil
+	case Wkhtmltopdf:
+		path := c.WkhtmltopdfPath
+		if path == "" {
+			path = Wkhtmltopdf
+		}
+		found, err := exec.LookPath(path)
+		if err != nil {
+			return nil, fmt.Errorf("wkhtmltopdf not found: %v", err)
+		}
+		return wkhtmltopdf{path: found}, nil
+	default:
+		return nil, fmt.Errorf("unknown PDF renderer %q: use %s or %s", c.Backend, Native, Wkhtmltopdf)
+	}
+}
@@ -0,0 +1,196 @@
+package pdfrender
+
+import (
+	"slices"
+	"unicode"
+)
+
+// arabicForms are the isolated, final, initial and medial presentation forms
+// of Arabic letters. Letters with no initial form join only the letter
+// before them.
+var arabicForms = map[rune][4]rune{
+	0x0621: {0xfe80, 0, 0, 0},
+	0x0622: {0xfe81, 0xfe82, 0, 0},
+	0x0623: {0xfe83, 0xfe84, 0, 0},
+	0x0624: {0xfe85, 0xfe86, 0, 0},
+	0x0625: {0xfe87, 0xfe88, 0, 0},
+	0x0626: {0xfe89, 0xfe8a, 0xfe8b, 0xfe8c},
+	0x0627: {0xfe8d, 0xfe8e, 0, 0},
+	0x0628: {0xfe8f, 0xfe90, 0xfe91, 0xfe92},
+	0x0629: {0xfe93, 0xfe94, 0, 0},
+	0x062a: {0xfe95, 0xfe96, 0xfe97, 0xfe98},
+	0x062b: {0xfe99, 0xfe9a, 0xfe9b, 0xfe9c},
+	0x062c: {0xfe9d, 0xfe9e, 0xfe9f, 0xfea0},
+	0x062d: {0xfea1, 0xfea2, 0xfea3, 0xfea4},
+	0x062e: {0xfea5, 0xfea6, 0xfea7, 0xfea8},
+	0x062f: {0xfea9, 0xfeaa, 0, 0},
+	0x0630: {0xfeab, 0xfeac, 0, 0},
+	0x0631: {0xfead, 0xfeae, 0, 0},
+	0x0632: {0xfeaf, 0xfeb0, 0, 0},
+	0x0633: {0xfeb1, 0xfeb2, 0xfeb3, 0xfeb4},
+	0x0634: {0xfeb5, 0xfeb6, 0xfeb7, 0xfeb8},
+	0x0635: {0xfeb9, 0xfeba, 0xfebb, 0xfebc},
+	0x0636: {0xfebd, 0xfebe, 0xfebf, 0xfec0},
+	0x0637: {0xfec1, 0xfec2, 0xfec3, 0xfec4},
+	0x0638: {0xfec5, 0xfec6, 0xfec7, 0xfec8},
+	0x0639: {0xfec9, 0xfeca, 0xfecb, 0xfecc},
+	0x063a: {0xfecd, 0xfece, 0xfecf, 0xfed0},
+	0x0640: {0x0640, 0x0640, 0x0640, 0x0640},
+	0x0641: {0xfed1, 0xfed2, 0xfed3, 0xfed4},
+	0x0642: {0xfed5, 0xfed6, 0xfed7, 0xfed8},
+	0x0643: {0xfed9, 0xfeda, 0xfedb, 0xfedc},
+	0x0644: {0xfedd, 0xfede, 0xfedf, 0xfee0},
+	0x0645: {0xfee1, 0xfee2, 0xfee3, 0xfee4},
+	0x0646: {0xfee5, 0xfee6, 0xfee7, 0xfee8},
+	0x0647: {0xfee9, 0xfeea, 0xfeeb, 0xfeec},
+	0x0648: {0xfeed, 0xfeee, 0, 0},
+	0x0649: {0xfeef, 0xfef0, 0, 0},
+	0x064a: {0xfef1, 0xfef2, 0xfef3, 0xfef4},
+	0x067e: {0xfb56, 0xfb57, 0xfb58, 0xfb59},
+	0x0686: {0xfb7a, 0xfb7b, 0xfb7c, 0xfb7d},
+	0x0698: {0xfb8a, 0xfb8b, 0, 0},
+	0x06a9: {0xfb8e, 0xfb8f, 0xfb90, 0xfb91},
+	0x06af: {0xfb92, 0xfb93, 0xfb94, 0xfb95},
+	0x06cc: {0xfbfc, 0xfbfd, 0xfbfe, 0xfbff},
+}
+
+// lamAlef are the isolated and final ligatures of lam with each alef.
+var lamAlef = map[rune][2]rune{
+	0x0622: {0xfef5, 0xfef6},
+	0x0623: {0xfef7, 0xfef8},
+	0x0625: {0xfef9, 0xfefa},
+	0x0627: {0xfefb, 0xfefc},
+}
+
+// joinsNext reports whether Arabic letter r joins the letter after it.
+func joinsNext(r rune) bool {
+	return arabicForms[r][2] != 0
+}
+
+// joinsPrevious reports whether Arabic letter r joins the letter before it.
+func joinsPrevious(r rune) bool {
+	return arabicForms[r][1] != 0
+}
+
+// shapeArabic replaces the Arabic letters in word with the forms they take
+// by their neighbours, as fonts without shaping tables draw them.
+func shapeArabic(word string) string {
+	runes := []rune(word)
+	// neighbour is the letter next to i in direction step, skipping marks
+	neighbour := func(i, step int) rune {
+		for j := i + step; j >= 0 && j < len(runes); j += step {
+			if !unicode.Is(unicode.Mn, runes[j]) {
+				return runes[j]
+			}
+		}
+		return 0
+	}
+
+	var shaped []rune
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		forms, ok := arabicForms[r]
+		if !ok {
+			shaped = append(shaped, r)
+			continue
+		}
+		previous := joinsNext(neighbour(i, -1))
+		next := neighbour(i, 1)
+		if ligature, ok := lamAlef[next]; ok && r == 0x0644 {
+			if previous {
+				shaped = append(shaped, ligature[1])
+			} else {
+				shaped = append(shaped, ligature[0])
+			}
+			// Marks on the lam stay with the ligature
+			for i++; runes[i] != next; i++ {
+				shaped = append(shaped, runes[i])
+			}
+			continue
+		}
+		form := forms[0]
+		switch {
+		case previous && joinsNext(r) && joinsPrevious(next):
+			form = forms[3]
+		case previous:
+			form = forms[1]
+		case joinsNext(r) && joinsPrevious(next):
+			form = forms[2]
+		}
+		shaped = append(shaped, form)
+	}
+	return string(shaped)
+}
+
+// direction is a word's writing direction from its first strong
+// character: 1 for left to right, -1 for right to left and 0 for a word
+// without letters, such as a number, that takes the direction of the
+// words around it.
+func direction(word string) int {
+	for _, r := range word {
+		switch {
+		case isRTL(r):
+			return -1
+		case unicode.IsLetter(r):
+			return 1
+		}
+	}
+	return 0
+}
+
+func isRTL(r rune) bool {
+	return unicode.In(r, unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana)
+}
+
+// visual puts a right-to-left word in the order its characters are drawn
+// from left to right, keeping numbers within it reading left to right and
+// marks after the letter they belong to.
+func visual(word string) string {
+	var clusters [][]rune
+	for _, r := range word {
+		n := len(clusters)
+		switch {
+		case n > 0 && unicode.Is(unicode.Mn, r):
+			clusters[n-1] = append(clusters[n-1], r)
+		case n > 0 && unicode.IsDigit(r) && unicode.IsDigit(clusters[n-1][0]):
+			clusters[n-1] = append(clusters[n-1], r)
+		default:
+			clusters = append(clusters, []rune{r})
+		}
+	}
+	slices.Reverse(clusters)
+	var b []rune
+	for _, c := range clusters {
+		b = append(b, c...)
+	}
+	return string(b)
+}
+
+// isIdeograph reports whether a line may break on either side of r, as it
+// may between the characters of Chinese and Japanese text.
+func isIdeograph(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// noBreakBefore reports whether r must not start a line of Chinese or
+// Japanese text, as closing punctuation such as a full stop must not.
+func noBreakBefore(r rune) bool {
+	return unicode.In(r, unicode.Pe, unicode.Pf, unicode.Po) || r == 'ー' || r == '々'
+}
+
+// ideographs splits a word between the Chinese and Japanese characters in
+// it, where a line may break.
+func ideographs(word string) []string {
+	var pieces []string
+	piece := ""
+	breakable := false
+	for _, r := range word {
+		if piece != "" && (isIdeograph(r) || breakable) && !noBreakBefore(r) {
+			pieces = append(pieces, piece)
+			piece = ""
+		}
+		piece += string(r)
+		breakable = isIdeograph(r)
+	}
+	return append(pieces, piece)
+}
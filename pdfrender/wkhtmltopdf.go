@@ -0,0 +1,66 @@
+package pdfrender
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// wkhtmltopdfTimeout bounds how long one document may take to render.
+const wkhtmltopdfTimeout = 30 * time.Second
+
+// wkhtmltopdf renders with the wkhtmltopdf binary, piping the document
+// through it. Documents must be self-contained: JavaScript and access to
+// local files are turned off, so images have to be data URIs.
+type wkhtmltopdf struct {
+	path string
+}
+
+func (r wkhtmltopdf) Render(w io.Writer, html string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), wkhtmltopdfTimeout)
+	defer cancel()
+
+	// The page margins and 96 dpi without shrinking match the native
+	// renderer, so CSS sizes come out the same in both
+	args := []string{
+		"--quiet",
+		"--encoding", "utf-8",
+		"--page-size", "A4",
+		"--margin-top", "10mm", "--margin-right", "10mm", "--margin-left", "10mm",
+		"--dpi", "96",
+		"--disable-smart-shrinking",
+		"--disable-javascript",
+		"--disable-local-file-access",
+	}
+
+	// wkhtmltopdf fills in [page] and [topage] in the footer itself
+	footer := ""
+	if doc, err := parseHTML(html); err == nil {
+		footer = doc.meta(FooterMeta)
+	}
+	if footer != "" {
+		args = append(args,
+			"--margin-bottom", fmt.Sprintf("%gmm", footerMargin),
+			"--footer-center", footer,
+			"--footer-font-size", fmt.Sprint(footerSize),
+			"--footer-spacing", "3")
+	} else {
+		args = append(args, "--margin-bottom", fmt.Sprintf("%gmm", pageMargin))
+	}
+
+	cmd := exec.CommandContext(ctx, r.path, append(args, "-", "-")...)
+	cmd.Stdin = strings.NewReader(html)
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wkhtmltopdf: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	_, err := out.WriteTo(w)
+	return err
+}
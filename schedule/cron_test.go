@@ -0,0 +1,105 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) accepted it", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2026-03-02 is a Monday
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"0 9 1 * *", "2026-03-02 00:00", "2026-04-01 09:00"},
+		{"0 9 1 * *", "2026-04-01 08:59", "2026-04-01 09:00"},
+		// Strictly after
+		{"0 9 1 * *", "2026-04-01 09:00", "2026-05-01 09:00"},
+		{"*/15 * * * *", "2026-03-02 10:07", "2026-03-02 10:15"},
+		{"30 8-17/3 * * *", "2026-03-02 12:00", "2026-03-02 14:30"},
+		{"0 0 * * 1,5", "2026-03-02 00:00", "2026-03-06 00:00"},
+		// Sunday is 0 or 7
+		{"0 0 * * 7", "2026-03-02 00:00", "2026-03-08 00:00"},
+		{"0 0 * * 0", "2026-03-02 00:00", "2026-03-08 00:00"},
+		{"0 0 31 * *", "2026-04-01 00:00", "2026-05-31 00:00"},
+		{"0 0 29 2 *", "2026-03-02 00:00", "2028-02-29 00:00"},
+		{"0 12 * 12 *", "2026-12-31 12:00", "2027-12-01 12:00"},
+		// Both day fields restricted: either matches
+		{"0 0 15 * 5", "2026-03-02 00:00", "2026-03-06 00:00"},
+		{"0 0 15 * 5", "2026-03-13 00:00", "2026-03-15 00:00"},
+		// A day field starting with * or covering every day is unrestricted,
+		// so only the other one counts
+		{"0 0 */1 * 5", "2026-03-02 00:00", "2026-03-06 00:00"},
+		{"0 0 1-31 * 5", "2026-03-02 00:00", "2026-03-06 00:00"},
+		{"0 0 15 * */1", "2026-03-02 00:00", "2026-03-15 00:00"},
+		{"0 0 15 * 0-6", "2026-03-02 00:00", "2026-03-15 00:00"},
+		{"0 0 15 * 1-7", "2026-03-02 00:00", "2026-03-15 00:00"},
+		// */2 starts with * too: odd days that are Fridays
+		{"0 0 */2 * 5", "2026-03-02 00:00", "2026-03-13 00:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := c.Next(date(tt.from)); !got.Equal(date(tt.want)) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tt.expr, tt.from, got.Format("2006-01-02 15:04 Mon"), tt.want)
+		}
+	}
+}
+
+func TestCronNeverMatches(t *testing.T) {
+	c, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Next(date("2026-01-01 00:00")); !got.IsZero() {
+		t.Errorf("Next = %s, want the zero time for February 31st", got)
+	}
+	if _, err := Parse(Cron, "0 0 31 2 *", date("2026-01-01 00:00")); err == nil {
+		t.Error("Parse accepted a cron expression that never matches")
+	}
+}
+
+func TestCronString(t *testing.T) {
+	c, err := ParseCron("  0  9 1   * * ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.String() != "0 9 1 * *" {
+		t.Errorf("String() = %q", c.String())
+	}
+}
@@ -0,0 +1,125 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+)
+
+// Intervals a recurring invoice can repeat at.
+const (
+	Monthly   = "monthly"
+	Quarterly = "quarterly"
+	Cron      = "cron"
+)
+
+// Schedule says when a recurring invoice runs.
+type Schedule interface {
+	// Next returns the first run strictly after t, or the zero time if
+	// there is none.
+	Next(t time.Time) time.Time
+}
+
+// Parse returns the schedule for an interval whose first run is no earlier
+// than start. Monthly and quarterly schedules run on start's day of the
+// month, or the month's last day if it is shorter. expr is a cron expression
+// for the cron interval and must be empty otherwise.
+func Parse(interval, expr string, start time.Time) (Schedule, error) {
+	switch interval {
+	case Monthly, Quarterly:
+		if expr != "" {
+			return nil, fmt.Errorf("a cron expression is only allowed for the %s interval", Cron)
+		}
+		months := 1
+		if interval == Quarterly {
+			months = 3
+		}
+		return monthly{start: start, months: months}, nil
+	case Cron:
+		c, err := ParseCron(expr)
+		if err != nil {
+			return nil, err
+		}
+		s := startingAt{c, start}
+		if s.Next(start).IsZero() {
+			return nil, fmt.Errorf("cron expression %q never matches", c)
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("interval must be %s, %s or %s", Monthly, Quarterly, Cron)
+}
+
+// Upcoming lists up to n runs of s after t, stopping after end unless it is
+// zero, or when s has no more runs.
+func Upcoming(s Schedule, t, end time.Time, n int) []time.Time {
+	runs := []time.Time{}
+	for len(runs) < n {
+		t = s.Next(t)
+		if t.IsZero() || !end.IsZero() && t.After(end) {
+			break
+		}
+		runs = append(runs, t)
+	}
+	return runs
+}
+
+// Missed lists the runs of s from first, itself a run, up to and including
+// now, keeping only the latest n of them. It also returns how many earlier
+// runs it left out.
+func Missed(s Schedule, first, now time.Time, n int) (runs []time.Time, skipped int) {
+	for t := first; !t.IsZero() && !t.After(now); t = s.Next(t) {
+		runs = append(runs, t)
+		if len(runs) > n {
+			runs = runs[1:]
+			skipped++
+		}
+	}
+	return runs, skipped
+}
+
+type monthly struct {
+	start  time.Time
+	months int
+}
+
+func (m monthly) Next(t time.Time) time.Time {
+	if t.Before(m.start) {
+		return m.start
+	}
+
+	// Start from the run just before t's month and step forward
+	elapsed := (t.Year()-m.start.Year())*12 + int(t.Month()-m.start.Month())
+	i := elapsed/m.months - 1
+	if i < 0 {
+		i = 0
+	}
+	for ; ; i++ {
+		if run := addMonths(m.start, i*m.months); run.After(t) {
+			return run
+		}
+	}
+}
+
+// addMonths adds n months to t, clamping the day to the end of the month
+// rather than overflowing into the next one as time.AddDate does.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// startingAt runs a schedule no earlier than start.
+type startingAt struct {
+	Schedule
+	start time.Time
+}
+
+func (s startingAt) Next(t time.Time) time.Time {
+	if t.Before(s.start) {
+		t = s.start.Add(-time.Nanosecond)
+	}
+	return s.Schedule.Next(t)
+}
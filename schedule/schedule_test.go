@@ -0,0 +1,135 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	start := date("2026-01-31 00:00")
+	tests := []struct {
+		interval, expr string
+	}{
+		{"weekly", ""},
+		{Monthly, "0 0 * * *"},
+		{Quarterly, "0 0 * * *"},
+		{Cron, ""},
+		{Cron, "not cron"},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.interval, tt.expr, start); err == nil {
+			t.Errorf("Parse(%q, %q) accepted it", tt.interval, tt.expr)
+		}
+	}
+}
+
+func TestUpcoming(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval string
+		expr     string
+		start    string
+		from     string
+		end      string
+		n        int
+		want     []string
+	}{
+		{
+			name: "monthly clamps to the end of shorter months", interval: Monthly,
+			start: "2026-01-31 00:00", from: "2026-01-01 00:00", n: 4,
+			want: []string{"2026-01-31 00:00", "2026-02-28 00:00", "2026-03-31 00:00", "2026-04-30 00:00"},
+		},
+		{
+			name: "monthly from the middle of the schedule", interval: Monthly,
+			start: "2025-01-31 00:00", from: "2026-02-28 00:00", n: 2,
+			want: []string{"2026-03-31 00:00", "2026-04-30 00:00"},
+		},
+		{
+			name: "quarterly", interval: Quarterly,
+			start: "2026-01-15 00:00", from: "2026-01-15 00:00", n: 3,
+			want: []string{"2026-04-15 00:00", "2026-07-15 00:00", "2026-10-15 00:00"},
+		},
+		{
+			name: "quarterly leap day", interval: Quarterly,
+			start: "2027-11-30 00:00", from: "2027-11-01 00:00", n: 3,
+			want: []string{"2027-11-30 00:00", "2028-02-29 00:00", "2028-05-30 00:00"},
+		},
+		{
+			name: "end date stops the schedule", interval: Monthly,
+			start: "2026-01-01 00:00", from: "2025-12-01 00:00", end: "2026-03-01 00:00", n: 10,
+			want: []string{"2026-01-01 00:00", "2026-02-01 00:00", "2026-03-01 00:00"},
+		},
+		{
+			name: "cron runs no earlier than the start", interval: Cron, expr: "0 9 * * 1",
+			start: "2026-03-04 00:00", from: "2026-01-01 00:00", n: 2,
+			want: []string{"2026-03-09 09:00", "2026-03-16 09:00"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.interval, tt.expr, date(tt.start))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var end time.Time
+			if tt.end != "" {
+				end = date(tt.end)
+			}
+			got := Upcoming(s, date(tt.from), end, tt.n)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Upcoming = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(date(tt.want[i])) {
+					t.Errorf("Upcoming[%d] = %s, want %s", i, got[i].Format("2006-01-02 15:04"), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMissed(t *testing.T) {
+	hourly, err := Parse(Cron, "0 * * * *", date("2026-03-01 00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	monthly, err := Parse(Monthly, "", date("2026-01-10 00:00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		s           Schedule
+		first, now  string
+		n           int
+		wantFirst   string
+		wantRuns    int
+		wantSkipped int
+	}{
+		{"none missed yet", monthly, "2026-05-10 00:00", "2026-05-09 23:59", 12, "", 0, 0},
+		{"one due now", monthly, "2026-05-10 00:00", "2026-05-10 00:00", 12, "2026-05-10 00:00", 1, 0},
+		{"a few missed", monthly, "2026-02-10 00:00", "2026-05-20 00:00", 12, "2026-02-10 00:00", 4, 0},
+		// A week down misses 169 hourly runs, of which the latest 12 are made
+		{"capped", hourly, "2026-03-02 00:00", "2026-03-09 00:30", 12, "2026-03-08 13:00", 12, 157},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs, skipped := Missed(tt.s, date(tt.first), date(tt.now), tt.n)
+			if len(runs) != tt.wantRuns || skipped != tt.wantSkipped {
+				t.Fatalf("Missed = %d runs, %d skipped, want %d runs, %d skipped", len(runs), skipped, tt.wantRuns, tt.wantSkipped)
+			}
+			if tt.wantRuns > 0 && !runs[0].Equal(date(tt.wantFirst)) {
+				t.Errorf("first run = %s, want %s", runs[0].Format("2006-01-02 15:04"), tt.wantFirst)
+			}
+			for i := 1; i < len(runs); i++ {
+				if !runs[i].Equal(tt.s.Next(runs[i-1])) {
+					t.Errorf("runs[%d] = %s does not follow %s", i, runs[i], runs[i-1])
+				}
+			}
+			if len(runs) > 0 && runs[len(runs)-1].After(date(tt.now)) {
+				t.Errorf("last run %s is after now", runs[len(runs)-1])
+			}
+		})
+	}
+}
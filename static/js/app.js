@@ -90,13 +90,16 @@ function displayInvoices(invoices) {
         row.style.transition = 'all 0.3s ease-in-out';
         
         const statusBadgeClass = {
-            'created': 'professional-badge-info',
-            'processed': 'professional-badge-success',
-            'deleted': 'professional-badge-error'
+            'draft': 'professional-badge-info',
+            'finalized': 'professional-badge-success',
+            'sent': 'professional-badge-success',
+            'paid': 'professional-badge-success',
+            'void': 'professional-badge-error',
+            'credited': 'professional-badge-error'
         }[invoice.status] || 'professional-badge-neutral';
         
         row.innerHTML = `
-            <td style="font-weight: 600; color: var(--primary-600);">#${String(invoice.id).padStart(6, '0')}</td>
+            <td style="font-weight: 600; color: var(--primary-600);">${invoice.invoice_number}</td>
             <td>
                 <div style="display: flex; align-items: center; gap: 0.5rem;">
                     <div style="width: 2rem; height: 2rem; background: var(--primary-100); border-radius: 50%; display: flex; align-items: center; justify-content: center; font-size: 0.875rem;">👤</div>
@@ -113,7 +116,7 @@ function displayInvoices(invoices) {
                 </span>
             </td>
             <td>${window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.created_at) : new Date(invoice.created_at).toLocaleDateString()}</td>
-            <td>${invoice.processed_at ? (window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.processed_at) : new Date(invoice.processed_at).toLocaleDateString()) : '-'}</td>
+            <td>${invoice.finalized_at ? (window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.finalized_at) : new Date(invoice.finalized_at).toLocaleDateString()) : '-'}</td>
             <td>
                 <button onclick="viewInvoice(${invoice.id})" class="professional-btn professional-btn-secondary professional-btn-sm" style="padding: 0.25rem 0.75rem;">
                     <span>👁️</span> View
@@ -138,9 +141,12 @@ function displayInvoices(invoices) {
 
 function updateStats(invoices) {
     const stats = {
-        created: 0,
-        processed: 0,
-        deleted: 0
+        draft: 0,
+        finalized: 0,
+        sent: 0,
+        paid: 0,
+        void: 0,
+        credited: 0
     };
     
     invoices.forEach(invoice => {
@@ -148,9 +154,9 @@ function updateStats(invoices) {
     });
     
     // Animate the count updates
-    animateCounterUpdate('created-count', stats.created);
-    animateCounterUpdate('processed-count', stats.processed);
-    animateCounterUpdate('deleted-count', stats.deleted);
+    animateCounterUpdate('draft-count', stats.draft);
+    animateCounterUpdate('finalized-count', stats.finalized);
+    animateCounterUpdate('void-count', stats.void);
 }
 
 function animateCounterUpdate(elementId, newValue) {
@@ -335,7 +341,7 @@ async function saveInvoice() {
             
             // Show success toast
             if (window.showToast) {
-                window.showToast(`Invoice #${String(result.id).padStart(6, '0')} created successfully`, 'success');
+                window.showToast(`Invoice ${result.invoice_number} created successfully`, 'success');
             }
             
             // Reset button state
@@ -383,9 +389,12 @@ async function viewInvoice(id) {
         const detailsDiv = document.getElementById('invoice-details');
         
         const statusBadgeClass = {
-            'created': 'professional-badge-info',
-            'processed': 'professional-badge-success',
-            'deleted': 'professional-badge-error'
+            'draft': 'professional-badge-info',
+            'finalized': 'professional-badge-success',
+            'sent': 'professional-badge-success',
+            'paid': 'professional-badge-success',
+            'void': 'professional-badge-error',
+            'credited': 'professional-badge-error'
         }[invoice.status] || 'professional-badge-neutral';
         
         const customerSection = invoice.customer ? `
@@ -429,7 +438,7 @@ async function viewInvoice(id) {
                     <div style="display: grid; grid-template-columns: repeat(auto-fit, minmax(200px, 1fr)); gap: 1rem;">
                         <div>
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Invoice ID</div>
-                            <div style="font-weight: 600; color: var(--primary-600);">#${String(invoice.id).padStart(6, '0')}</div>
+                            <div style="font-weight: 600; color: var(--primary-600);">${invoice.invoice_number}</div>
                         </div>
                         <div>
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Status</div>
@@ -439,9 +448,9 @@ async function viewInvoice(id) {
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Created Date</div>
                             <div>${window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.created_at) : new Date(invoice.created_at).toLocaleDateString()}</div>
                         </div>
-                        ${invoice.processed_at ? `<div>
-                            <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Processed Date</div>
-                            <div>${window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.processed_at) : new Date(invoice.processed_at).toLocaleDateString()}</div>
+                        ${invoice.finalized_at ? `<div>
+                            <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Finalized Date</div>
+                            <div>${window.professionalInteractions ? window.professionalInteractions.formatDate(invoice.finalized_at) : new Date(invoice.finalized_at).toLocaleDateString()}</div>
                         </div>` : ''}
                     </div>
                 </div>
@@ -483,7 +492,7 @@ async function viewInvoice(id) {
         `;
         
         const processBtn = document.getElementById('process-btn');
-        if (invoice.status === 'created') {
+        if (invoice.status === 'draft') {
             processBtn.style.display = 'inline-block';
         } else {
             processBtn.style.display = 'none';
@@ -529,8 +538,8 @@ async function updateInvoiceStatus(status) {
             
             // Show success message
             const statusMessages = {
-                'processed': 'Invoice marked as processed',
-                'deleted': 'Invoice deleted successfully'
+                'finalized': 'Invoice finalized',
+                'void': 'Invoice voided'
             };
             
             if (window.showToast) {
@@ -578,7 +587,7 @@ async function printInvoice() {
         const a = document.createElement('a');
         a.style.display = 'none';
         a.href = url;
-        a.download = `invoice_${String(currentInvoice.id).padStart(6, '0')}.pdf`;
+        a.download = `invoice_${currentInvoice.invoice_number}.pdf`;
         
         // Trigger download
         document.body.appendChild(a);
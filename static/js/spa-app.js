@@ -145,6 +145,10 @@ class InvoiceProApp {
 
     async loadInitialData() {
         try {
+            // Every API call needs a session, so find out who is signed in first
+            this.state.user = await this.apiRequest('/auth/me');
+            this.loadOrganizations();
+
             // Load data that's needed across multiple views
             const [customers, products] = await Promise.all([
                 this.fetchWithCache('/customers', 'customers'),
@@ -175,10 +179,14 @@ class InvoiceProApp {
                 ...options,
                 headers: {
                     'Content-Type': 'application/json',
+                    ...this.organizationHeaders(),
                     ...options.headers
                 }
             });
             
+            if (response.status === 401) {
+                this.redirectToLogin();
+            }
             if (!response.ok) {
                 throw new Error(`API Error: ${response.statusText}`);
             }
@@ -213,12 +221,24 @@ class InvoiceProApp {
                 ...options,
                 headers: {
                     'Content-Type': 'application/json',
+                    ...this.organizationHeaders(),
                     ...options.headers
                 }
             });
             
+            if (response.status === 401) {
+                this.redirectToLogin();
+            }
             if (!response.ok) {
                 const errorText = await response.text();
+                // Refusals explain themselves in a JSON body
+                if (response.status === 403) {
+                    try {
+                        throw new Error(JSON.parse(errorText).error);
+                    } catch (e) {
+                        if (!(e instanceof SyntaxError)) throw e;
+                    }
+                }
                 throw new Error(errorText || response.statusText);
             }
             
@@ -229,6 +249,56 @@ class InvoiceProApp {
         }
     }
 
+    /**
+     * Work in the organization picked in the switcher, if any
+     */
+    organizationHeaders() {
+        const id = localStorage.getItem('organizationId');
+        return id ? { 'X-Organization-ID': id } : {};
+    }
+
+    /**
+     * Fill the organization switcher, hiding it for members of just one
+     */
+    async loadOrganizations() {
+        const select = document.getElementById('organization-switcher');
+        if (!select) return;
+
+        const organizations = await this.apiRequest('/organizations');
+        select.replaceChildren(...organizations.map(o => new Option(o.name, o.id, false, o.current)));
+        select.style.display = organizations.length > 1 ? '' : 'none';
+    }
+
+    /**
+     * Switch organization and reload, since every cached record belongs to
+     * the old one
+     */
+    switchOrganization(id) {
+        localStorage.setItem('organizationId', id);
+        this.clearCache();
+        window.location.reload();
+    }
+
+    /**
+     * Send the user to the sign-in page, coming back here afterwards
+     */
+    redirectToLogin() {
+        const next = encodeURIComponent(window.location.pathname + window.location.hash);
+        window.location.href = `/login.html?next=${next}`;
+    }
+
+    /**
+     * End the session and return to the sign-in page
+     */
+    async logout() {
+        try {
+            await fetch(`${this.apiBaseUrl}/auth/logout`, { method: 'POST' });
+        } finally {
+            this.clearCache();
+            window.location.href = '/login.html';
+        }
+    }
+
     /**
      * Cache management
      */
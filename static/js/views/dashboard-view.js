@@ -8,9 +8,12 @@ export class DashboardView {
         this.app = app;
         this.invoices = [];
         this.stats = {
-            created: 0,
-            processed: 0,
-            deleted: 0
+            draft: 0,
+            finalized: 0,
+            sent: 0,
+            paid: 0,
+            void: 0,
+            credited: 0
         };
         this.filters = {};
         this.currentInvoice = null;
@@ -76,7 +79,7 @@ export class DashboardView {
                             <th data-sortable style="cursor: pointer;">💰 Total Amount</th>
                             <th data-sortable style="cursor: pointer;">📊 Status</th>
                             <th data-sortable style="cursor: pointer;">📅 Created Date</th>
-                            <th data-sortable style="cursor: pointer;">✅ Processed Date</th>
+                            <th data-sortable style="cursor: pointer;">✅ Finalized Date</th>
                             <th>⚡ Actions</th>
                         </tr>
                     </thead>
@@ -125,27 +128,27 @@ export class DashboardView {
                 </div>
             </div>
             <div class="professional-metric-card">
-                <div class="professional-metric-title">Pending Invoices</div>
-                <div class="professional-metric-value" data-count="${this.stats.created}" id="created-count">${this.stats.created}</div>
+                <div class="professional-metric-title">Draft Invoices</div>
+                <div class="professional-metric-value" data-count="${this.stats.draft}" id="draft-count">${this.stats.draft}</div>
                 <div class="professional-metric-change">
                     <span>⏳</span>
-                    <span>Awaiting processing</span>
+                    <span>Awaiting finalization</span>
                 </div>
             </div>
             <div class="professional-metric-card">
-                <div class="professional-metric-title">Processed Invoices</div>
-                <div class="professional-metric-value" data-count="${this.stats.processed}" id="processed-count">${this.stats.processed}</div>
+                <div class="professional-metric-title">Finalized Invoices</div>
+                <div class="professional-metric-value" data-count="${this.stats.finalized}" id="finalized-count">${this.stats.finalized}</div>
                 <div class="professional-metric-change positive">
                     <span>✅</span>
-                    <span>Completed</span>
+                    <span>Issued</span>
                 </div>
             </div>
             <div class="professional-metric-card">
-                <div class="professional-metric-title">Deleted Invoices</div>
-                <div class="professional-metric-value" data-count="${this.stats.deleted}" id="deleted-count">${this.stats.deleted}</div>
+                <div class="professional-metric-title">Void Invoices</div>
+                <div class="professional-metric-value" data-count="${this.stats.void}" id="void-count">${this.stats.void}</div>
                 <div class="professional-metric-change negative">
                     <span>🗑️</span>
-                    <span>Removed</span>
+                    <span>Cancelled</span>
                 </div>
             </div>
         `;
@@ -163,12 +166,12 @@ export class DashboardView {
                     <input type="date" name="created_to" class="professional-input">
                 </div>
                 <div class="professional-form-group">
-                    <label class="professional-label">✅ Processed From</label>
-                    <input type="date" name="processed_from" class="professional-input">
+                    <label class="professional-label">✅ Finalized From</label>
+                    <input type="date" name="finalized_from" class="professional-input">
                 </div>
                 <div class="professional-form-group">
-                    <label class="professional-label">✅ Processed To</label>
-                    <input type="date" name="processed_to" class="professional-input">
+                    <label class="professional-label">✅ Finalized To</label>
+                    <input type="date" name="finalized_to" class="professional-input">
                 </div>
                 <div class="professional-form-group">
                     <label class="professional-label">💰 Price From</label>
@@ -190,16 +193,28 @@ export class DashboardView {
                     <label class="professional-label">📊 Status</label>
                     <div style="display: flex; flex-direction: column; gap: 0.5rem;">
                         <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
-                            <input type="checkbox" name="status" value="created" style="accent-color: var(--primary-600);">
-                            <span class="professional-badge professional-badge-info">Created</span>
+                            <input type="checkbox" name="status" value="draft" style="accent-color: var(--primary-600);">
+                            <span class="professional-badge professional-badge-info">Draft</span>
                         </label>
                         <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
-                            <input type="checkbox" name="status" value="processed" style="accent-color: var(--success-600);">
-                            <span class="professional-badge professional-badge-success">Processed</span>
+                            <input type="checkbox" name="status" value="finalized" style="accent-color: var(--success-600);">
+                            <span class="professional-badge professional-badge-success">Finalized</span>
                         </label>
                         <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
-                            <input type="checkbox" name="status" value="deleted" style="accent-color: var(--error-600);">
-                            <span class="professional-badge professional-badge-error">Deleted</span>
+                            <input type="checkbox" name="status" value="sent" style="accent-color: var(--success-600);">
+                            <span class="professional-badge professional-badge-success">Sent</span>
+                        </label>
+                        <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
+                            <input type="checkbox" name="status" value="paid" style="accent-color: var(--success-600);">
+                            <span class="professional-badge professional-badge-success">Paid</span>
+                        </label>
+                        <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
+                            <input type="checkbox" name="status" value="void" style="accent-color: var(--error-600);">
+                            <span class="professional-badge professional-badge-error">Void</span>
+                        </label>
+                        <label style="display: flex; align-items: center; gap: 0.5rem; cursor: pointer;">
+                            <input type="checkbox" name="status" value="credited" style="accent-color: var(--error-600);">
+                            <span class="professional-badge professional-badge-error">Credited</span>
                         </label>
                     </div>
                 </div>
@@ -226,14 +241,17 @@ export class DashboardView {
         return this.invoices.map((invoice, index) => {
             const customerInfo = invoice.customer ? invoice.customer.name : 'No Customer';
             const statusBadgeClass = {
-                'created': 'professional-badge-info',
-                'processed': 'professional-badge-success',
-                'deleted': 'professional-badge-error'
+                'draft': 'professional-badge-info',
+                'finalized': 'professional-badge-success',
+                'sent': 'professional-badge-success',
+                'paid': 'professional-badge-success',
+                'void': 'professional-badge-error',
+                'credited': 'professional-badge-error'
             }[invoice.status] || 'professional-badge-neutral';
             
             return `
                 <tr style="opacity: 0; transform: translateY(20px); animation: fadeInUp 0.3s ease-out ${index * 0.05}s forwards;">
-                    <td style="font-weight: 600; color: var(--primary-600);">#${String(invoice.id).padStart(6, '0')}</td>
+                    <td style="font-weight: 600; color: var(--primary-600);">${invoice.invoice_number}</td>
                     <td>
                         <div style="display: flex; align-items: center; gap: 0.5rem;">
                             <div style="width: 2rem; height: 2rem; background: var(--primary-100); border-radius: 50%; display: flex; align-items: center; justify-content: center; font-size: 0.875rem;">👤</div>
@@ -243,14 +261,14 @@ export class DashboardView {
                             </div>
                         </div>
                     </td>
-                    <td style="font-weight: 600; font-size: 1.125rem;">$${invoice.total_price.toFixed(2)}</td>
+                    <td style="font-weight: 600; font-size: 1.125rem;">${new Intl.NumberFormat('en-US', { style: 'currency', currency: invoice.currency || 'USD' }).format(invoice.total_price)}</td>
                     <td>
                         <span class="professional-badge ${statusBadgeClass}">
                             ${invoice.status.charAt(0).toUpperCase() + invoice.status.slice(1)}
                         </span>
                     </td>
                     <td>${this.formatDate(invoice.created_at)}</td>
-                    <td>${invoice.processed_at ? this.formatDate(invoice.processed_at) : '-'}</td>
+                    <td>${invoice.finalized_at ? this.formatDate(invoice.finalized_at) : '-'}</td>
                     <td>
                         <button onclick="dashboardView.viewInvoice(${invoice.id})" class="professional-btn professional-btn-secondary professional-btn-sm" style="padding: 0.25rem 0.75rem;">
                             <span>👁️</span> View
@@ -298,11 +316,11 @@ export class DashboardView {
                         <button id="print-btn" onclick="dashboardView.printInvoice()" class="professional-btn professional-btn-primary">
                             <span>🖨️</span> Generate PDF
                         </button>
-                        <button id="process-btn" onclick="dashboardView.updateInvoiceStatus('processed')" class="professional-btn professional-btn-success">
-                            <span>✅</span> Mark as Processed
+                        <button id="process-btn" onclick="dashboardView.updateInvoiceStatus('finalized')" class="professional-btn professional-btn-success">
+                            <span>✅</span> Finalize
                         </button>
-                        <button onclick="dashboardView.updateInvoiceStatus('deleted')" class="professional-btn professional-btn-danger">
-                            <span>🗑️</span> Delete Invoice
+                        <button onclick="dashboardView.updateInvoiceStatus('void')" class="professional-btn professional-btn-danger">
+                            <span>🗑️</span> Void Invoice
                         </button>
                         <button onclick="dashboardView.hideViewModal()" class="professional-btn professional-btn-secondary">
                             <span>❌</span> Close
@@ -356,9 +374,12 @@ export class DashboardView {
 
     updateStats() {
         this.stats = {
-            created: 0,
-            processed: 0,
-            deleted: 0
+            draft: 0,
+            finalized: 0,
+            sent: 0,
+            paid: 0,
+            void: 0,
+            credited: 0
         };
         
         this.invoices.forEach(invoice => {
@@ -429,7 +450,7 @@ export class DashboardView {
             
             // Show/hide process button
             const processBtn = document.getElementById('process-btn');
-            processBtn.style.display = invoice.status === 'created' ? 'inline-flex' : 'none';
+            processBtn.style.display = invoice.status === 'draft' ? 'inline-flex' : 'none';
             
             if (window.openModal) {
                 window.openModal('view-modal');
@@ -557,7 +578,7 @@ export class DashboardView {
             await this.loadData();
             this.refreshInvoiceList();
             
-            const message = status === 'processed' ? 'Invoice marked as processed' : 'Invoice deleted successfully';
+            const message = status === 'finalized' ? 'Invoice finalized' : 'Invoice voided';
             this.app.showNotification(message, 'success');
         } catch (error) {
             this.app.showNotification('Failed to update invoice status', 'error');
@@ -574,7 +595,7 @@ export class DashboardView {
             const url = window.URL.createObjectURL(blob);
             const a = document.createElement('a');
             a.href = url;
-            a.download = `invoice_${String(this.currentInvoice.id).padStart(6, '0')}.pdf`;
+            a.download = `invoice_${this.currentInvoice.invoice_number}.pdf`;
             a.click();
             
             window.URL.revokeObjectURL(url);
@@ -592,7 +613,7 @@ export class DashboardView {
         }
         
         // Update stats displays
-        ['created', 'processed', 'deleted'].forEach(status => {
+        ['draft', 'finalized', 'void'].forEach(status => {
             const element = document.getElementById(`${status}-count`);
             if (element) {
                 element.textContent = this.stats[status];
@@ -30,25 +30,25 @@ export class InvoiceDetailView {
             <div style="margin-bottom: 2rem;">
                 <div style="display: flex; justify-content: space-between; align-items: center; margin-bottom: 1rem;">
                     <h1 style="font-size: 2.25rem; font-weight: 700; color: var(--gray-900);">
-                        Invoice #${String(this.invoice.id).padStart(6, '0')}
+                        Invoice ${this.invoice.invoice_number}
                     </h1>
                     <div style="display: flex; gap: 1rem;">
                         <button onclick="invoiceDetailView.printInvoice()" class="professional-btn professional-btn-primary">
                             <span>🖨️</span> Generate PDF
                         </button>
-                        ${this.invoice.status === 'created' ? `
-                            <button onclick="invoiceDetailView.updateStatus('processed')" class="professional-btn professional-btn-success">
-                                <span>✅</span> Mark as Processed
+                        ${this.invoice.status === 'draft' ? `
+                            <button onclick="invoiceDetailView.updateStatus('finalized')" class="professional-btn professional-btn-success">
+                                <span>✅</span> Finalize
                             </button>
                         ` : ''}
-                        <button onclick="invoiceDetailView.updateStatus('deleted')" class="professional-btn professional-btn-danger">
-                            <span>🗑️</span> Delete Invoice
+                        <button onclick="invoiceDetailView.updateStatus('void')" class="professional-btn professional-btn-danger">
+                            <span>🗑️</span> Void Invoice
                         </button>
                     </div>
                 </div>
                 <div style="color: var(--gray-600);">
                     Created on ${this.formatDate(this.invoice.created_at)}
-                    ${this.invoice.processed_at ? ` • Processed on ${this.formatDate(this.invoice.processed_at)}` : ''}
+                    ${this.invoice.finalized_at ? ` • Finalized on ${this.formatDate(this.invoice.finalized_at)}` : ''}
                 </div>
             </div>
 
@@ -64,9 +64,12 @@ export class InvoiceDetailView {
 
     renderInvoiceDetails() {
         const statusBadgeClass = {
-            'created': 'professional-badge-info',
-            'processed': 'professional-badge-success', 
-            'deleted': 'professional-badge-error'
+            'draft': 'professional-badge-info',
+            'finalized': 'professional-badge-success',
+            'sent': 'professional-badge-success',
+            'paid': 'professional-badge-success',
+            'void': 'professional-badge-error',
+            'credited': 'professional-badge-error'
         }[this.invoice.status] || 'professional-badge-neutral';
 
         const customerSection = this.invoice.customer ? `
@@ -112,7 +115,7 @@ export class InvoiceDetailView {
                     <div style="display: grid; grid-template-columns: repeat(auto-fit, minmax(200px, 1fr)); gap: 1rem;">
                         <div>
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Invoice ID</div>
-                            <div style="font-weight: 600; color: var(--primary-600);">#${String(this.invoice.id).padStart(6, '0')}</div>
+                            <div style="font-weight: 600; color: var(--primary-600);">${this.invoice.invoice_number}</div>
                         </div>
                         <div>
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Status</div>
@@ -122,9 +125,13 @@ export class InvoiceDetailView {
                             <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Created Date</div>
                             <div>${this.formatDate(this.invoice.created_at)}</div>
                         </div>
-                        ${this.invoice.processed_at ? `<div>
-                            <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Processed Date</div>
-                            <div>${this.formatDate(this.invoice.processed_at)}</div>
+                        ${this.invoice.finalized_at ? `<div>
+                            <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Finalized Date</div>
+                            <div>${this.formatDate(this.invoice.finalized_at)}</div>
+                        </div>` : ''}
+                        ${this.invoice.due_date ? `<div>
+                            <div style="font-size: 0.875rem; font-weight: 500; color: var(--gray-600); margin-bottom: 0.25rem;">Due Date</div>
+                            <div style="${this.invoice.overdue ? 'color: var(--error-500); font-weight: 600;' : ''}">${this.invoice.due_date}${this.invoice.overdue ? ' (Overdue)' : ''}</div>
                         </div>` : ''}
                     </div>
                 </div>
@@ -184,8 +191,8 @@ export class InvoiceDetailView {
     // Actions
     async updateStatus(status) {
         const confirmMessages = {
-            'processed': 'Mark this invoice as processed?',
-            'deleted': 'Delete this invoice? This action cannot be undone.'
+            'finalized': 'Finalize this invoice? It can no longer be edited.',
+            'void': 'Void this invoice? This action cannot be undone.'
         };
 
         if (!confirm(confirmMessages[status])) {
@@ -196,8 +203,8 @@ export class InvoiceDetailView {
             await this.app.updateInvoiceStatus(this.invoice.id, status);
             
             const successMessages = {
-                'processed': 'Invoice marked as processed',
-                'deleted': 'Invoice deleted successfully'
+                'finalized': 'Invoice finalized',
+                'void': 'Invoice voided'
             };
             
             this.app.showNotification(successMessages[status], 'success');
@@ -222,7 +229,7 @@ export class InvoiceDetailView {
             const url = window.URL.createObjectURL(blob);
             const a = document.createElement('a');
             a.href = url;
-            a.download = `invoice_${String(this.invoice.id).padStart(6, '0')}.pdf`;
+            a.download = `invoice_${this.invoice.invoice_number}.pdf`;
             a.click();
             
             window.URL.revokeObjectURL(url);
@@ -245,10 +252,10 @@ export class InvoiceDetailView {
         });
     }
 
-    formatCurrency(amount) {
+    formatCurrency(amount, currency = this.invoice?.currency || 'USD') {
         return new Intl.NumberFormat('en-US', {
             style: 'currency',
-            currency: 'USD'
+            currency: currency
         }).format(amount);
     }
 }
\ No newline at end of file
@@ -0,0 +1,114 @@
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"invoice-app/money"
+)
+
+// Rate is a tax percentage in basis points: 2000 is 20%, 750 is 7.5%.
+type Rate int64
+
+const maxRate Rate = 10000
+
+// ParseRate reads a percentage such as "20", "7.5" or "21.00".
+func ParseRate(s string) (Rate, error) {
+	text := strings.TrimSpace(s)
+	whole, frac, hasPoint := strings.Cut(text, ".")
+	if whole == "" || hasPoint && frac == "" || len(frac) > 2 {
+		return 0, fmt.Errorf("invalid tax rate %q: use a percentage with at most two decimals", s)
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid tax rate %q", s)
+		}
+	}
+
+	frac += strings.Repeat("0", 2-len(frac))
+	bp, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil || Rate(bp) > maxRate {
+		return 0, fmt.Errorf("tax rate %q must be between 0 and 100", s)
+	}
+
+	return Rate(bp), nil
+}
+
+// String formats the rate as a percentage without the sign, e.g. "7.50".
+func (r Rate) String() string {
+	return fmt.Sprintf("%d.%02d", int64(r)/100, int64(r)%100)
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if strings.HasPrefix(text, `"`) {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Apply returns the tax due on a net amount, rounded to the currency's
+// minor unit.
+func (r Rate) Apply(net money.Money) money.Money {
+	return net.MulRatio(int64(r), 10000)
+}
+
+// Line is one taxed invoice line: its net amount and the tax charged on it.
+type Line struct {
+	Net  money.Money
+	Rate Rate
+	Tax  money.Money
+}
+
+// NewLine computes the tax for a single net amount.
+func NewLine(net money.Money, rate Rate) Line {
+	return Line{Net: net, Rate: rate, Tax: rate.Apply(net)}
+}
+
+// Summary totals every line charged at the same rate.
+type Summary struct {
+	Rate    Rate
+	Taxable money.Money
+	Tax     money.Money
+}
+
+// Summarize groups lines by rate, highest rate first. Tax is computed per
+// line, so each summary's Tax is the sum of its lines' tax rather than the
+// rate applied to the summed taxable amount.
+func Summarize(lines []Line, currency string) []Summary {
+	byRate := make(map[Rate]*Summary)
+	for _, line := range lines {
+		s, ok := byRate[line.Rate]
+		if !ok {
+			s = &Summary{Rate: line.Rate, Taxable: money.Zero(currency), Tax: money.Zero(currency)}
+			byRate[line.Rate] = s
+		}
+		s.Taxable = s.Taxable.Add(line.Net)
+		s.Tax = s.Tax.Add(line.Tax)
+	}
+
+	summaries := make([]Summary, 0, len(byRate))
+	for _, s := range byRate {
+		summaries = append(summaries, *s)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Rate > summaries[j].Rate
+	})
+
+	return summaries
+}
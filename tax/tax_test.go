@@ -0,0 +1,155 @@
+package tax
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"invoice-app/money"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Rate
+		wantErr bool
+	}{
+		{"20", 2000, false},
+		{"7.5", 750, false},
+		{"21.00", 2100, false},
+		{" 0 ", 0, false},
+		{"0.01", 1, false},
+		{"100", 10000, false},
+		{"100.00", 10000, false},
+		{"100.01", 0, true},
+		{"101", 0, true},
+		{"-1", 0, true},
+		{"+5", 0, true},
+		{"7.555", 0, true},
+		{"7.", 0, true},
+		{".5", 0, true},
+		{"", 0, true},
+		{"7,5", 0, true},
+		{"1e2", 0, true},
+		{"99999999999999999999", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.text)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRate(%q) = %d, want an error", tt.text, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestRateJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Rate
+		wantErr bool
+	}{
+		{`20`, 2000, false},
+		{`7.5`, 750, false},
+		{`"7.50"`, 750, false},
+		{`7.555`, 0, true},
+		{`"abc"`, 0, true},
+		{`-2`, 0, true},
+	}
+	for _, tt := range tests {
+		var got Rate
+		err := json.Unmarshal([]byte(tt.json), &got)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %d, want an error", tt.json, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", tt.json, got, err, tt.want)
+		}
+	}
+
+	out, err := json.Marshal(struct{ Rate Rate }{750})
+	if err != nil || string(out) != `{"Rate":7.50}` {
+		t.Errorf("Marshal = %s, %v, want {\"Rate\":7.50}", out, err)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		rate     Rate
+		net      int64
+		currency string
+		want     int64
+	}{
+		{2000, 10000, "EUR", 2000},
+		{2100, 1999, "EUR", 420}, // 419.79
+		{750, 1999, "USD", 150},  // 149.925
+		{5000, 1, "EUR", 1},      // 0.5 rounds up
+		{5000, 3, "EUR", 2},      // 1.5 rounds up
+		{5000, -1, "EUR", -1},    // -0.5 rounds away from zero
+		{5000, -3, "EUR", -2},    // -1.5 too
+		{2000, 3, "EUR", 1},      // 0.6
+		{2000, 2, "EUR", 0},      // 0.4
+		{1950, 10, "EUR", 2},     // 1.95
+		{1000, 5, "JPY", 1},      // half a yen
+		{1000, 1005, "BHD", 101}, // 100.5 fils
+		{0, 1999, "EUR", 0},
+		{10000, 1999, "EUR", 1999},
+	}
+	for _, tt := range tests {
+		got := tt.rate.Apply(money.New(tt.net, tt.currency))
+		if got != money.New(tt.want, tt.currency) {
+			t.Errorf("%s%% of %d %s = %v, want %d", tt.rate, tt.net, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	eur := func(cents int64) money.Money { return money.New(cents, "EUR") }
+	tests := []struct {
+		name  string
+		lines []Line
+		want  []Summary
+	}{
+		{"no lines", nil, []Summary{}},
+		{
+			"grouped by rate, highest first",
+			[]Line{
+				NewLine(eur(1000), 0),
+				NewLine(eur(1999), 2000),
+				NewLine(eur(500), 700),
+				NewLine(eur(3001), 2000),
+			},
+			[]Summary{
+				{Rate: 2000, Taxable: eur(5000), Tax: eur(1000)},
+				{Rate: 700, Taxable: eur(500), Tax: eur(35)},
+				{Rate: 0, Taxable: eur(1000), Tax: eur(0)},
+			},
+		},
+		{
+			// Each line's half cent rounds up, so the tax is 2 cents where
+			// 50% of the 2 cent total would be 1
+			"tax summed per line",
+			[]Line{NewLine(eur(1), 5000), NewLine(eur(1), 5000)},
+			[]Summary{{Rate: 5000, Taxable: eur(2), Tax: eur(2)}},
+		},
+		{
+			"negative lines net off",
+			[]Line{NewLine(eur(1000), 2000), NewLine(eur(-400), 2000)},
+			[]Summary{{Rate: 2000, Taxable: eur(600), Tax: eur(120)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.lines, "EUR"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+// Package templates holds the HTML documents the server renders.
+package templates
+
+import _ "embed"
+
+// Invoice is the HTML layout of invoices, credit notes and quotes. It is
+// executed with handlers.InvoicePDFData and styled by its PDF template.
+//
+//go:embed invoice.html
+var Invoice string
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"invoice-app/auth"
+	"invoice-app/database"
+)
+
+const usage = "Usage: go run users.go [add <email> [name [role]] | passwd <email> | role <email> <organization> <role> | join <email> <organization> [role] | list]\nRoles are admin (the default for add and join), accountant, clerk and read_only, and apply in one organization.\nAdded users join the first organization; join adds them to another by name.\nPasswords are read from standard input."
+
+// Creates the first users, who can then sign in and add others through the
+// API, and resets forgotten passwords.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	db, err := database.Initialize()
+	if err != nil {
+		log.Fatal("Failed to open database: ", err)
+	}
+	defer db.Close()
+
+	switch {
+	case os.Args[1] == "add" && len(os.Args) >= 3 && len(os.Args) <= 5:
+		name, role := "", auth.Admin
+		if len(os.Args) >= 4 {
+			name = os.Args[3]
+		}
+		if len(os.Args) == 5 {
+			role = os.Args[4]
+		}
+		if err := auth.ParseRole(role); err != nil {
+			log.Fatal("Invalid role: ", err)
+		}
+		hash, err := auth.HashPassword(readPassword())
+		if err != nil {
+			log.Fatal("Invalid password: ", err)
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			log.Fatal("Failed to add user: ", err)
+		}
+		result, err := tx.Exec("INSERT INTO users (email, name, password_hash) VALUES (?, ?, ?)", os.Args[2], name, hash)
+		if err != nil {
+			tx.Rollback()
+			log.Fatal("Failed to add user: ", err)
+		}
+		id, _ := result.LastInsertId()
+		// Without an organization the user could sign in but not work
+		if _, err := tx.Exec("INSERT INTO organization_members (organization_id, user_id, role) SELECT MIN(id), ?, ? FROM organizations", id, role); err != nil {
+			tx.Rollback()
+			log.Fatal("Failed to add user to an organization: ", err)
+		}
+		if err := tx.Commit(); err != nil {
+			log.Fatal("Failed to add user: ", err)
+		}
+		log.Printf("Added user %s", os.Args[2])
+	case os.Args[1] == "passwd" && len(os.Args) == 3:
+		hash, err := auth.HashPassword(readPassword())
+		if err != nil {
+			log.Fatal("Invalid password: ", err)
+		}
+		result, err := db.Exec("UPDATE users SET password_hash = ? WHERE email = ?", hash, os.Args[2])
+		if err != nil {
+			log.Fatal("Failed to set password: ", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			log.Fatalf("No user %s", os.Args[2])
+		}
+		// Sessions started with the old password end
+		if _, err := db.Exec("DELETE FROM sessions WHERE user_id = (SELECT id FROM users WHERE email = ?)", os.Args[2]); err != nil {
+			log.Fatal("Failed to end sessions: ", err)
+		}
+		log.Printf("Set password for %s", os.Args[2])
+	case os.Args[1] == "role" && len(os.Args) == 5:
+		if err := auth.ParseRole(os.Args[4]); err != nil {
+			log.Fatal("Invalid role: ", err)
+		}
+		result, err := db.Exec(`UPDATE organization_members SET role = ?
+			WHERE user_id = (SELECT id FROM users WHERE email = ?)
+			AND organization_id = (SELECT id FROM organizations WHERE name = ?)`, os.Args[4], os.Args[2], os.Args[3])
+		if err != nil {
+			log.Fatal("Failed to set role: ", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			log.Fatalf("No user %s in organization %s", os.Args[2], os.Args[3])
+		}
+		log.Printf("Set role for %s in %s to %s", os.Args[2], os.Args[3], os.Args[4])
+	case os.Args[1] == "join" && (len(os.Args) == 4 || len(os.Args) == 5):
+		role := auth.Admin
+		if len(os.Args) == 5 {
+			role = os.Args[4]
+		}
+		if err := auth.ParseRole(role); err != nil {
+			log.Fatal("Invalid role: ", err)
+		}
+		result, err := db.Exec(`INSERT OR IGNORE INTO organization_members (organization_id, user_id, role)
+			SELECT o.id, u.id, ? FROM organizations o, users u WHERE o.name = ? AND u.email = ?`, role, os.Args[3], os.Args[2])
+		if err != nil {
+			log.Fatal("Failed to join organization: ", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			log.Fatalf("No user %s or organization %s, or already a member", os.Args[2], os.Args[3])
+		}
+		log.Printf("Added %s to %s", os.Args[2], os.Args[3])
+	case os.Args[1] == "list" && len(os.Args) == 2:
+		rows, err := db.Query(`
+			SELECT u.email, u.name, COALESCE(m.role, ''), COALESCE(o.name, ''), u.disabled_at IS NOT NULL
+			FROM users u
+			LEFT JOIN organization_members m ON m.user_id = u.id
+			LEFT JOIN organizations o ON o.id = m.organization_id
+			ORDER BY u.email, o.id`)
+		if err != nil {
+			log.Fatal("Failed to list users: ", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var email, name, role, organization string
+			var disabled bool
+			if err := rows.Scan(&email, &name, &role, &organization, &disabled); err != nil {
+				log.Fatal("Failed to list users: ", err)
+			}
+			status := ""
+			if disabled {
+				status = " (disabled)"
+			}
+			fmt.Printf("%-40s %-12s %-30s %s%s\n", email, role, organization, name, status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func readPassword() string {
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatal("Failed to read password: ", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}